@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
 )
 
 // TODO Maybe findSecretSet belongs in config?
@@ -20,3 +21,15 @@ func findSecretSet(name string) (*config.SecretSet, error) {
 	}
 	return nil, fmt.Errorf("no secret set named %q found in configuration", name)
 }
+
+// closePlugins closes the plugins built by the manager, which stops any plugin
+// processes that were started. Errors are logged.
+func closePlugins(buildMgr *plugin.Manager) {
+	if err := buildMgr.Close(); err != nil {
+		slog := logger.Sugar()
+		slog.Errorw(
+			"failed to close plugins",
+			"error", err,
+		)
+	}
+}
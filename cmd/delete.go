@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin"
+)
+
+var (
+	deleteCmd *cobra.Command
+)
+
+// initDeleteCmd configures the command.
+func initDeleteCmd() {
+	deleteCmd = &cobra.Command{
+		Use:   "delete",
+		Short: "permanently delete disabled secrets after a retention period",
+		Run:   RunDelete,
+	}
+
+	rootCmd.AddCommand(deleteCmd)
+}
+
+// RunDelete performs deletion according to the command-line arguments given
+// and the configuration. All configured deletions are run via this function.
+func RunDelete(cmd *cobra.Command, args []string) {
+	buildMgr := plugin.NewManager(c.Plugins)
+	defer closePlugins(buildMgr)
+	for _, d := range c.Deletions {
+		RunDeletion(buildMgr, &d)
+	}
+}
+
+// RunDeletion performs deletion for a single configured deletion.
+func RunDeletion(
+	buildMgr *plugin.Manager,
+	d *config.Deletion,
+) {
+	slog := logger.Sugar()
+
+	dc, err := buildMgr.Instance(ctx, d.DeleteClient)
+	delCli, ok := dc.(disable.Deleter)
+	if !ok {
+		slog.Errorw(
+			"failed to load delete client; the plugin must support deletion",
+			"client_name", d.DeleteClient,
+			"error", err,
+		)
+		return
+	}
+
+	secretSet, err := findSecretSet(d.SecretSet)
+	if err != nil {
+		slog.Errorw(
+			"failed to locate the secret set to work with ",
+			"client_name", d.DeleteClient,
+			"client_desc", delCli.Name(),
+			"error", err,
+		)
+		return
+	}
+
+	m := disable.NewDeletion(
+		delCli,
+		d.DeleteAfter,
+		dryRun,
+		secretSet.Secrets,
+	)
+
+	err = m.DeleteSecrets(ctx)
+	if err != nil {
+		slog.Errorw(
+			"failed to complete secret deletion",
+			"client_name", d.DeleteClient,
+			"client_desc", dc.Name(),
+			"error", err,
+		)
+	}
+}
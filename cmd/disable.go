@@ -27,6 +27,7 @@ func initDisableCmd() {
 // function.
 func RunDisable(cmd *cobra.Command, args []string) {
 	buildMgr := plugin.NewManager(c.Plugins)
+	defer closePlugins(buildMgr)
 	for _, d := range c.Disablements {
 		RunDisablement(buildMgr, &d)
 	}
@@ -64,6 +65,7 @@ func RunDisablement(
 	m := disable.New(
 		disCli,
 		d.DisableAfter,
+		d.UsageWindow,
 		dryRun,
 		secretSet.Secrets,
 	)
@@ -76,6 +76,7 @@ func init() {
 
 	initRotateCmd()
 	initDisableCmd()
+	initDeleteCmd()
 }
 
 func initContext() {
@@ -31,6 +31,7 @@ func initRotateCmd() {
 // set.
 func RunRotation(cmd *cobra.Command, args []string) {
 	buildMgr := plugin.NewManager(c.Plugins)
+	defer closePlugins(buildMgr)
 	for _, r := range c.Rotations {
 		RunRotations(buildMgr, &r)
 	}
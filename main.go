@@ -3,9 +3,33 @@ package main
 
 import (
 	"github.com/zostay/garotate/cmd"
+	_ "github.com/zostay/garotate/pkg/plugin/acme/order/cert"
+	_ "github.com/zostay/garotate/pkg/plugin/alternating/account/users"
 	_ "github.com/zostay/garotate/pkg/plugin/aws/iam/user/access"
+	_ "github.com/zostay/garotate/pkg/plugin/azure/ad/application/password"
 	_ "github.com/zostay/garotate/pkg/plugin/circleci/project/env"
+	_ "github.com/zostay/garotate/pkg/plugin/cloudflare/api/token/roll"
+	_ "github.com/zostay/garotate/pkg/plugin/datadog/api/key"
+	_ "github.com/zostay/garotate/pkg/plugin/dockerhub/access/token"
+	_ "github.com/zostay/garotate/pkg/plugin/exec"
+	_ "github.com/zostay/garotate/pkg/plugin/gcp/iam/serviceaccount/key"
 	_ "github.com/zostay/garotate/pkg/plugin/github/action/secret"
+	_ "github.com/zostay/garotate/pkg/plugin/github/repo/deploykey"
+	_ "github.com/zostay/garotate/pkg/plugin/grpc"
+	_ "github.com/zostay/garotate/pkg/plugin/jwks/file/entry"
+	_ "github.com/zostay/garotate/pkg/plugin/jwt/signing/key"
+	_ "github.com/zostay/garotate/pkg/plugin/kafka/scram/user/password"
+	_ "github.com/zostay/garotate/pkg/plugin/keepass/kdbx/entry"
+	_ "github.com/zostay/garotate/pkg/plugin/ldap/account/password"
+	_ "github.com/zostay/garotate/pkg/plugin/mysql/user/password"
+	_ "github.com/zostay/garotate/pkg/plugin/postgresql/role/password"
+	_ "github.com/zostay/garotate/pkg/plugin/rabbitmq/management/user/password"
+	_ "github.com/zostay/garotate/pkg/plugin/random/password/generator"
+	_ "github.com/zostay/garotate/pkg/plugin/redis/acl/user"
+	_ "github.com/zostay/garotate/pkg/plugin/ssh/authorizedkeys/entry"
+	_ "github.com/zostay/garotate/pkg/plugin/ssh/key/pair"
+	_ "github.com/zostay/garotate/pkg/plugin/tls/ca/cert"
+	_ "github.com/zostay/garotate/pkg/plugin/webhook/http/endpoint"
 )
 
 // main executes the command.
@@ -13,8 +13,10 @@ func (c *cache) initCache() {
 	}
 }
 
-// CacheSet sets a cache key associated with the secret.
+// CacheSet sets a cache key associated with the secret. The cache is
+// initialized first, if needed.
 func (c *cache) CacheSet(k, v any) {
+	c.initCache()
 	c.cache[k] = v
 }
 
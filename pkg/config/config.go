@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 	"time"
+
+	"github.com/mitchellh/mapstructure"
 )
 
 // KeyMap maps the keys produced by the source rotator to the keys to use in storage.
@@ -15,6 +17,28 @@ type Plugin struct {
 	Options map[string]any `mapstructure:"option"`
 }
 
+// DecodeOptions decodes the plugin options into the given value, which should
+// be a pointer to a struct whose fields are tagged with mapstructure tags.
+// Durations may be given as strings (e.g., "24h") and other values are
+// weakly converted to the required type.
+func (p *Plugin) DecodeOptions(out any) error {
+	return decodeOptions(p.Options, out)
+}
+
+// decodeOptions decodes an options map into the given value.
+func decodeOptions(opts map[string]any, out any) error {
+	d, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		WeaklyTypedInput: true,
+		Result:           out,
+	})
+	if err != nil {
+		return err
+	}
+
+	return d.Decode(opts)
+}
+
 // PluginList is a map of names to client configurations.
 type PluginList map[string]Plugin
 
@@ -29,9 +53,17 @@ type Rotation struct {
 type Disablement struct {
 	DisableClient string        `mapstructure:"client"`
 	DisableAfter  time.Duration `mapstructure:"disable_after"`
+	UsageWindow   time.Duration `mapstructure:"usage_window"`
 	SecretSet     string        `mapstructure:"secret_set"`
 }
 
+// Deletion is used to define a deletion process.
+type Deletion struct {
+	DeleteClient string        `mapstructure:"client"`
+	DeleteAfter  time.Duration `mapstructure:"delete_after"`
+	SecretSet    string        `mapstructure:"secret_set"`
+}
+
 // StorageMap describes how a secret should be stored when rotated.
 type StorageMap struct {
 	StorageClient string `mapstructure:"storage"`
@@ -49,8 +81,9 @@ func (sm *StorageMap) Name() string {
 
 // Secret defines a single rotatable secret.
 type Secret struct {
-	SecretName string       `mapstructure:"secret"`
-	Storages   []StorageMap `mapstructure:"storages"`
+	SecretName string         `mapstructure:"secret"`
+	Storages   []StorageMap   `mapstructure:"storages"`
+	Options    map[string]any `mapstructure:"option"`
 
 	cache
 }
@@ -67,6 +100,7 @@ type Config struct {
 	Plugins      PluginList    `mapstructure:"plugins"`
 	Rotations    []Rotation    `mapstructure:"rotations"`
 	Disablements []Disablement `mapstructure:"disablements"`
+	Deletions    []Deletion    `mapstructure:"deletions"`
 	SecretSets   []SecretSet   `mapstructure:"secret_sets"`
 }
 
@@ -114,3 +148,10 @@ func (c *Config) Prepare() error {
 func (s *Secret) Name() string {
 	return s.SecretName
 }
+
+// DecodeOptions decodes the options configured for this secret into the given
+// value, just like Plugin.DecodeOptions. Plugins use these to permit settings
+// to vary from secret to secret.
+func (s *Secret) DecodeOptions(out any) error {
+	return decodeOptions(s.Options, out)
+}
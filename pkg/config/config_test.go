@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -113,3 +114,49 @@ func TestPrepareHappyNormalized(t *testing.T) {
 	assert.Equal(t, s0.Storages[0].Name(), s0.Storages[0].StorageName, "StorageMap Name() is expected value")
 	assert.Equal(t, s1.Storages[0].Name(), s1.Storages[0].StorageName, "StorageMap Name() is expected value")
 }
+
+func TestDecodeOptions(t *testing.T) {
+	p := &Plugin{
+		Options: map[string]any{
+			"path":     "/tmp/thing",
+			"count":    "3",
+			"lifetime": "36h",
+		},
+	}
+
+	var opts struct {
+		Path     string        `mapstructure:"path"`
+		Count    int           `mapstructure:"count"`
+		Lifetime time.Duration `mapstructure:"lifetime"`
+		Missing  string        `mapstructure:"missing"`
+	}
+
+	err := p.DecodeOptions(&opts)
+	assert.NoError(t, err, "options decode without error")
+	assert.Equal(t, "/tmp/thing", opts.Path, "string option decoded")
+	assert.Equal(t, 3, opts.Count, "int option weakly decoded")
+	assert.Equal(t, 36*time.Hour, opts.Lifetime, "duration option decoded")
+	assert.Equal(t, "", opts.Missing, "missing option left alone")
+}
+
+func TestSecretDecodeOptions(t *testing.T) {
+	s := &Secret{
+		SecretName: "Judah",
+		Options: map[string]any{
+			"length": 24,
+		},
+	}
+
+	opts := struct {
+		Length int    `mapstructure:"length"`
+		Key    string `mapstructure:"key"`
+	}{
+		Length: 32,
+		Key:    "password",
+	}
+
+	err := s.DecodeOptions(&opts)
+	assert.NoError(t, err, "options decode without error")
+	assert.Equal(t, 24, opts.Length, "secret option overrides default")
+	assert.Equal(t, "password", opts.Key, "default kept when option missing")
+}
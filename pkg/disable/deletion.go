@@ -0,0 +1,134 @@
+package disable
+
+import (
+	"context"
+	goerr "errors"
+	"fmt"
+	"time"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/errors"
+)
+
+// DeletionManager provides the business logic for detecting whether disabled
+// secrets have been kept long enough to be deleted and deleting them.
+type DeletionManager struct {
+	client Deleter
+
+	deleteAfter time.Duration
+
+	dryRun bool
+
+	secrets []config.Secret
+}
+
+// NewDeletion constructs a new object to perform deletion of disabled secrets.
+func NewDeletion(
+	dc Deleter,
+	deleteAfter time.Duration,
+	dryRun bool,
+	secrets []config.Secret,
+) *DeletionManager {
+	return &DeletionManager{
+		client:      dc,
+		deleteAfter: deleteAfter,
+		dryRun:      dryRun,
+		secrets:     secrets,
+	}
+}
+
+// needsDeletion returns true if the secret has a disabled date older than
+// deleteAfter in the past.
+func (m *DeletionManager) needsDeletion(
+	ctx context.Context,
+	s *config.Secret,
+) bool {
+	logger := config.LoggerFrom(ctx).Sugar()
+
+	disableDate, err := m.client.LastDisabled(ctx, s)
+	if goerr.Is(err, ErrNothingToDelete) {
+		logger.Debugw(
+			"no disabled secret to delete; skipping",
+			"secret", s.SecretName,
+			"client", m.client.Name(),
+		)
+		return false
+	} else if err != nil {
+		logger.Errorw(
+			"got error while checking last disabled date for deletion; skipping",
+			"secret", s.SecretName,
+			"client", m.client.Name(),
+			"error", err,
+		)
+		return false
+	}
+
+	hasNeed := time.Since(disableDate) > m.deleteAfter
+	if hasNeed {
+		logger.Debugw(
+			"secret is disabled and old enough to require deletion",
+			"secret", s.SecretName,
+			"client", m.client.Name(),
+			"now_ts", time.Now(),
+			"disable_ts", disableDate,
+			"delete_after", m.deleteAfter,
+		)
+	}
+	return hasNeed
+}
+
+// deleteSecret checks to see if the secret given requires deletion and deletes
+// it if it does.
+func (m *DeletionManager) deleteSecret(ctx context.Context, s *config.Secret) error {
+	if !m.needsDeletion(ctx, s) {
+		return nil
+	}
+
+	if !m.dryRun {
+		err := m.client.DeleteSecret(ctx, s)
+		if err != nil {
+			return fmt.Errorf("failed to delete disabled secret %q for deleter %q: %w", s.SecretName, m.client.Name(), err)
+		}
+	} else {
+		logger := config.LoggerFrom(ctx).Sugar()
+		logger.Infow(
+			"dry run: here's where the disabled secret should get deleted",
+			"secret", s.Name(),
+			"client", m.client.Name(),
+		)
+	}
+	return nil
+}
+
+// DeleteSecrets examines all the secrets and deletes any disabled secrets that
+// have been disabled for longer than deleteAfter.
+func (m *DeletionManager) DeleteSecrets(ctx context.Context) error {
+	logger := config.LoggerFrom(ctx).Sugar()
+	errlist := make([]error, 0)
+	for k := range m.secrets {
+		s := &m.secrets[k]
+		logger.Debugw(
+			"examining secret for deletion",
+			"secret", s.SecretName,
+			"client", m.client.Name(),
+		)
+
+		err := m.deleteSecret(ctx, s)
+		if err != nil {
+			errlist = append(errlist, err)
+			logger.Errorw(
+				"failed to delete secret",
+				"secret", s.SecretName,
+				"client", m.client.Name(),
+				"error", err,
+			)
+			continue
+		}
+	}
+
+	if len(errlist) > 0 {
+		return errors.NewAggregate(errlist)
+	}
+
+	return nil
+}
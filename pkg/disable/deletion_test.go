@@ -0,0 +1,166 @@
+package disable
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+type testDeleter struct {
+	testClient
+
+	lastDisabled     time.Time
+	failDeleteSecret int
+	nothingToDelete  bool
+}
+
+func NewTestDeleter() *testDeleter {
+	return &testDeleter{
+		testClient:       *NewTestClient(),
+		lastDisabled:     lastUpdated,
+		failDeleteSecret: -1,
+	}
+}
+
+func (c *testDeleter) LastDisabled(ctx context.Context, s secret.Info) (time.Time, error) {
+	c.lastCallSecrets = append(c.lastCallSecrets, testClientSecret{
+		call: "LastDisabled",
+		sec:  s,
+	})
+	if c.nothingToDelete {
+		return time.Time{}, ErrNothingToDelete
+	}
+	return c.lastDisabled, nil
+}
+
+func (c *testDeleter) DeleteSecret(ctx context.Context, s secret.Info) error {
+	c.lastCallSecrets = append(c.lastCallSecrets, testClientSecret{
+		call: "DeleteSecret",
+		sec:  s,
+	})
+	if c.failDeleteSecret == 0 {
+		return fmt.Errorf("delete bad stuff")
+	} else {
+		c.failDeleteSecret--
+		return nil
+	}
+}
+
+func TestHappyDeletionManagerDryRun(t *testing.T) {
+	c := NewTestDeleter()
+	c.failDeleteSecret = 0
+	m := NewDeletion(c, 0, true,
+		[]config.Secret{
+			{SecretName: "Thomas"},
+			{SecretName: "Matthew"},
+		},
+	)
+
+	ctx := context.Background()
+	err := m.DeleteSecrets(ctx)
+
+	assert.NoError(t, err, "no error on delete secrets dry run")
+
+	callSecrets := []testClientSecret{
+		{call: "LastDisabled", sec: &config.Secret{SecretName: "Thomas"}},
+		{call: "LastDisabled", sec: &config.Secret{SecretName: "Matthew"}},
+	}
+
+	assert.Equal(t, callSecrets, c.lastCallSecrets, "only two calls made")
+}
+
+func TestHappyDeletionManager(t *testing.T) {
+	c := NewTestDeleter()
+	m := NewDeletion(c, 0, false,
+		[]config.Secret{
+			{SecretName: "Thomas"},
+			{SecretName: "Matthew"},
+		},
+	)
+
+	ctx := context.Background()
+	err := m.DeleteSecrets(ctx)
+
+	assert.NoError(t, err, "no error on delete secrets")
+
+	callSecrets := []testClientSecret{
+		{call: "LastDisabled", sec: &config.Secret{SecretName: "Thomas"}},
+		{call: "DeleteSecret", sec: &config.Secret{SecretName: "Thomas"}},
+		{call: "LastDisabled", sec: &config.Secret{SecretName: "Matthew"}},
+		{call: "DeleteSecret", sec: &config.Secret{SecretName: "Matthew"}},
+	}
+
+	assert.Equal(t, callSecrets, c.lastCallSecrets, "all four calls made")
+}
+
+func TestDeletionManagerRetention(t *testing.T) {
+	c := NewTestDeleter()
+	c.lastDisabled = time.Now().Add(-time.Hour)
+	m := NewDeletion(c, 24*time.Hour, false,
+		[]config.Secret{
+			{SecretName: "Thaddeus"},
+		},
+	)
+
+	ctx := context.Background()
+	err := m.DeleteSecrets(ctx)
+
+	assert.NoError(t, err, "no error on delete secrets")
+
+	callSecrets := []testClientSecret{
+		{call: "LastDisabled", sec: &config.Secret{SecretName: "Thaddeus"}},
+	}
+
+	assert.Equal(t, callSecrets, c.lastCallSecrets, "not deleted before retention period")
+}
+
+func TestDeletionManagerNothingToDelete(t *testing.T) {
+	c := NewTestDeleter()
+	c.nothingToDelete = true
+	m := NewDeletion(c, 0, false,
+		[]config.Secret{
+			{SecretName: "Simon"},
+		},
+	)
+
+	ctx := context.Background()
+	err := m.DeleteSecrets(ctx)
+
+	assert.NoError(t, err, "nothing to delete is not an error")
+
+	callSecrets := []testClientSecret{
+		{call: "LastDisabled", sec: &config.Secret{SecretName: "Simon"}},
+	}
+
+	assert.Equal(t, callSecrets, c.lastCallSecrets, "nothing deleted")
+}
+
+func TestSadDeletionManager(t *testing.T) {
+	c := NewTestDeleter()
+	c.failDeleteSecret = 0
+	m := NewDeletion(c, 0, false,
+		[]config.Secret{
+			{SecretName: "Thomas"},
+			{SecretName: "Matthew"},
+		},
+	)
+
+	ctx := context.Background()
+	err := m.DeleteSecrets(ctx)
+
+	assert.Error(t, err, "error on delete secrets sad run")
+
+	callSecrets := []testClientSecret{
+		{call: "LastDisabled", sec: &config.Secret{SecretName: "Thomas"}},
+		{call: "DeleteSecret", sec: &config.Secret{SecretName: "Thomas"}},
+		{call: "LastDisabled", sec: &config.Secret{SecretName: "Matthew"}},
+		{call: "DeleteSecret", sec: &config.Secret{SecretName: "Matthew"}},
+	}
+
+	assert.Equal(t, callSecrets, c.lastCallSecrets, "all four calls made even when sad")
+}
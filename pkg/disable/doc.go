@@ -3,5 +3,7 @@
 // least two active secrets are maintained at the point of rotation to avoid
 // causing an outage for any running process using the current secret. Then, a
 // followup process will disable/delete the old secret after the new secret has
-// been established. This pakcage manages the disablement process.
+// been established. This pakcage manages the disablement process and the
+// optional deletion process that may follow it, which permanently removes the
+// disabled secrets after a retention period.
 package disable
@@ -2,11 +2,22 @@ package disable
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/zostay/garotate/pkg/secret"
 )
 
+var (
+	// ErrNothingToDisable is returned by LastUpdated when the account has no
+	// inactive secret to disable. The secret is skipped until a later run.
+	ErrNothingToDisable = errors.New("no inactive secret to disable")
+
+	// ErrNothingToDelete is returned by LastDisabled when the account has no
+	// disabled secret to delete. The secret is skipped until a later run.
+	ErrNothingToDelete = errors.New("no disabled secret to delete")
+)
+
 // Client defines the interface that any plugin that wishes to perform
 // disablement must implement. It provides means for identifying the client,
 // detecting when a configured secret is ready for disablement, and the method
@@ -18,7 +29,8 @@ type Client interface {
 
 	// LastUpdated must return the timestamp when the newest inactive secret was
 	// last updated. Usually this will be the creation data of an access token
-	// or other piece of data.
+	// or other piece of data. If there is no inactive secret to disable, it
+	// should return ErrNothingToDisable.
 	//
 	// The context provides a logger via the
 	// github.com/zostay/garotate/pkg/config package. It may also be
@@ -39,3 +51,67 @@ type Client interface {
 	// disablement.
 	DisableSecret(context.Context, secret.Info) error
 }
+
+// UsageChecker may be implemented by a disablement client that can tell when
+// the inactive secrets it would disable were last used. When a usage window is
+// configured, disablement is put off while the secrets are still in use to
+// avoid causing an outage.
+type UsageChecker interface {
+	// LastUsed must return the timestamp when the inactive secrets associated
+	// with the account were last used. If they have never been used or there
+	// are none, it should return the zero time.
+	//
+	// The context provides a logger via the
+	// github.com/zostay/garotate/pkg/config package. It may also be
+	// used for timeouts.
+	//
+	// The secret.Info describes the secret that is being checked for
+	// disablement.
+	LastUsed(context.Context, secret.Info) (time.Time, error)
+}
+
+// Refresher may be implemented by a disablement client that publishes
+// something which must be reissued on its own schedule, whether or not any
+// secret is due to be disabled, such as a certificate revocation list that
+// would otherwise expire.
+type Refresher interface {
+	// Refresh is called once at the start of every disablement run. It must
+	// reissue whatever the client publishes if it is due, and do nothing
+	// otherwise.
+	//
+	// The context provides a logger via the
+	// github.com/zostay/garotate/pkg/config package. It may also be
+	// used for timeouts.
+	Refresh(context.Context) error
+}
+
+// Deleter may be implemented by a disablement client that is also able to
+// permanently delete the secrets it has disabled. Deletion is a separate stage
+// that follows disablement, so a disabled secret may be re-enabled by hand
+// until its retention period has passed.
+type Deleter interface {
+	Client
+
+	// LastDisabled must return the timestamp when the newest disabled secret
+	// was disabled, or as near to it as the plugin can tell. If there is no
+	// disabled secret to delete, it should return ErrNothingToDelete.
+	//
+	// The context provides a logger via the
+	// github.com/zostay/garotate/pkg/config package. It may also be
+	// used for timeouts.
+	//
+	// The secret.Info describes the secret that is being checked for
+	// deletion.
+	LastDisabled(context.Context, secret.Info) (time.Time, error)
+
+	// DeleteSecret must permanently delete all disabled secrets associated
+	// with the account. Active secrets must be left alone.
+	//
+	// The context provides a logger via the
+	// github.com/zostay/garotate/pkg/config package. It may also be
+	// used for timeouts.
+	//
+	// The secret.Info describes the secret that is being checked for
+	// deletion.
+	DeleteSecret(context.Context, secret.Info) error
+}
@@ -2,6 +2,7 @@ package disable
 
 import (
 	"context"
+	goerr "errors"
 	"fmt"
 	"time"
 
@@ -15,22 +16,27 @@ type Manager struct {
 	client Client
 
 	disableAfter time.Duration
+	usageWindow  time.Duration
 
 	dryRun bool
 
 	secrets []config.Secret
 }
 
-// New constructs a new object to perform password disablement.
+// New constructs a new object to perform password disablement. If the
+// usageWindow is positive and the client implements UsageChecker, disablement
+// of secrets used within that window is put off until a later run.
 func New(
 	rc Client,
 	disableAfter time.Duration,
+	usageWindow time.Duration,
 	dryRun bool,
 	secrets []config.Secret,
 ) *Manager {
 	return &Manager{
 		client:       rc,
 		disableAfter: disableAfter,
+		usageWindow:  usageWindow,
 		dryRun:       dryRun,
 		secrets:      secrets,
 	}
@@ -45,7 +51,14 @@ func (m *Manager) needsDisablement(
 	logger := config.LoggerFrom(ctx).Sugar()
 
 	updateDate, err := m.client.LastUpdated(ctx, s)
-	if err != nil {
+	if goerr.Is(err, ErrNothingToDisable) {
+		logger.Debugw(
+			"no inactive secret to disable; skipping",
+			"secret", s.SecretName,
+			"client", m.client.Name(),
+		)
+		return false
+	} else if err != nil {
 		logger.Errorw(
 			"got error while checking last update date for disablement; skipping",
 			"secret", s.SecretName,
@@ -68,6 +81,46 @@ func (m *Manager) needsDisablement(
 	return hasNeed
 }
 
+// inUse returns true if the secret has been used within the usage window, in
+// which case disablement must wait. If the client cannot report usage or no
+// window is configured, it returns false.
+func (m *Manager) inUse(
+	ctx context.Context,
+	s *config.Secret,
+) bool {
+	uc, ok := m.client.(UsageChecker)
+	if !ok || m.usageWindow <= 0 {
+		return false
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+
+	lastUsed, err := uc.LastUsed(ctx, s)
+	if err != nil {
+		logger.Errorw(
+			"got error while checking last used date; for safety, disablement will be prevented",
+			"secret", s.SecretName,
+			"client", m.client.Name(),
+			"error", err,
+		)
+		return true
+	}
+
+	if time.Since(lastUsed) < m.usageWindow {
+		logger.Warnw(
+			"inactive secret is still in use; delaying disablement",
+			"secret", s.SecretName,
+			"client", m.client.Name(),
+			"now_ts", time.Now(),
+			"last_used_ts", lastUsed,
+			"usage_window", m.usageWindow,
+		)
+		return true
+	}
+
+	return false
+}
+
 // disableSecret checks to see if the secret given requires disablement and
 // disables it if it does.
 func (m *Manager) disableSecret(ctx context.Context, s *config.Secret) error {
@@ -75,6 +128,10 @@ func (m *Manager) disableSecret(ctx context.Context, s *config.Secret) error {
 		return nil
 	}
 
+	if m.inUse(ctx, s) {
+		return nil
+	}
+
 	if !m.dryRun {
 		err := m.client.DisableSecret(ctx, s)
 		if err != nil {
@@ -91,11 +148,47 @@ func (m *Manager) disableSecret(ctx context.Context, s *config.Secret) error {
 	return nil
 }
 
+// refresh lets a client that implements Refresher reissue whatever it
+// publishes before the secrets are examined.
+func (m *Manager) refresh(ctx context.Context) error {
+	rc, ok := m.client.(Refresher)
+	if !ok {
+		return nil
+	}
+
+	if m.dryRun {
+		logger := config.LoggerFrom(ctx).Sugar()
+		logger.Infow(
+			"dry run: here's where the client should get refreshed",
+			"client", m.client.Name(),
+		)
+		return nil
+	}
+
+	err := rc.Refresh(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to refresh disabler %q: %w", m.client.Name(), err)
+	}
+
+	return nil
+}
+
 // DisableSecrets examines all the IAM keys and disables any of the
-// non-active keys that have surpassed the maxActiveAge.
+// non-active keys that have surpassed the maxActiveAge. A client that
+// implements Refresher is refreshed first.
 func (m *Manager) DisableSecrets(ctx context.Context) error {
 	logger := config.LoggerFrom(ctx).Sugar()
 	errlist := make([]error, 0)
+
+	if err := m.refresh(ctx); err != nil {
+		errlist = append(errlist, err)
+		logger.Errorw(
+			"failed to refresh disabler",
+			"client", m.client.Name(),
+			"error", err,
+		)
+	}
+
 	for k := range m.secrets {
 		s := &m.secrets[k]
 		logger.Debugw(
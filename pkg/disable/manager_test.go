@@ -28,6 +28,7 @@ type testClient struct {
 	lastCallSecrets   []testClientSecret
 	failLastUpdated   int
 	failDisableSecret int
+	nothingToDisable  bool
 }
 
 func NewTestClient() *testClient {
@@ -47,7 +48,9 @@ func (c *testClient) LastUpdated(ctx context.Context, s secret.Info) (time.Time,
 		call: "LastUpdated",
 		sec:  s,
 	})
-	if c.failLastUpdated == 0 {
+	if c.nothingToDisable {
+		return time.Time{}, ErrNothingToDisable
+	} else if c.failLastUpdated == 0 {
 		return time.Time{}, fmt.Errorf("last updated bad stuff")
 	} else {
 		c.failLastUpdated--
@@ -71,7 +74,7 @@ func (c *testClient) DisableSecret(ctx context.Context, s secret.Info) error {
 func TestHappyManagerDryRun(t *testing.T) {
 	c := NewTestClient()
 	c.failDisableSecret = 0
-	m := New(c, 0, true,
+	m := New(c, 0, 0, true,
 		[]config.Secret{
 			{SecretName: "James"},
 			{SecretName: "John"},
@@ -94,7 +97,7 @@ func TestHappyManagerDryRun(t *testing.T) {
 func TestSadManagerDryRun(t *testing.T) {
 	c := NewTestClient()
 	c.failLastUpdated = 0
-	m := New(c, 0, true,
+	m := New(c, 0, 0, true,
 		[]config.Secret{
 			{SecretName: "Andrew"},
 			{SecretName: "Peter"},
@@ -116,7 +119,7 @@ func TestSadManagerDryRun(t *testing.T) {
 
 func TestHappyManager(t *testing.T) {
 	c := NewTestClient()
-	m := New(c, 0, false,
+	m := New(c, 0, 0, false,
 		[]config.Secret{
 			{SecretName: "Philip"},
 			{SecretName: "Bartholomew"},
@@ -141,7 +144,7 @@ func TestHappyManager(t *testing.T) {
 func TestSadManager(t *testing.T) {
 	c := NewTestClient()
 	c.failDisableSecret = 0
-	m := New(c, 0, false,
+	m := New(c, 0, 0, false,
 		[]config.Secret{
 			{SecretName: "Philip"},
 			{SecretName: "Bartholomew"},
@@ -162,3 +165,158 @@ func TestSadManager(t *testing.T) {
 
 	assert.Equal(t, callSecrets, c.lastCallSecrets, "all four calls made even when sad")
 }
+
+func TestManagerNothingToDisable(t *testing.T) {
+	c := NewTestClient()
+	c.nothingToDisable = true
+	m := New(c, 0, 0, false,
+		[]config.Secret{
+			{SecretName: "Jude"},
+		},
+	)
+
+	ctx := context.Background()
+	err := m.DisableSecrets(ctx)
+
+	assert.NoError(t, err, "nothing to disable is not an error")
+
+	callSecrets := []testClientSecret{
+		{call: "LastUpdated", sec: &config.Secret{SecretName: "Jude"}},
+	}
+
+	assert.Equal(t, callSecrets, c.lastCallSecrets, "nothing disabled")
+}
+
+type testUsageClient struct {
+	testClient
+
+	lastUsed time.Time
+}
+
+func (c *testUsageClient) LastUsed(ctx context.Context, s secret.Info) (time.Time, error) {
+	c.lastCallSecrets = append(c.lastCallSecrets, testClientSecret{
+		call: "LastUsed",
+		sec:  s,
+	})
+	return c.lastUsed, nil
+}
+
+func TestManagerUsageWindow(t *testing.T) {
+	c := &testUsageClient{
+		testClient: *NewTestClient(),
+		lastUsed:   time.Now().Add(-time.Hour),
+	}
+	m := New(c, 0, 24*time.Hour, false,
+		[]config.Secret{
+			{SecretName: "Matthias"},
+		},
+	)
+
+	ctx := context.Background()
+	err := m.DisableSecrets(ctx)
+
+	assert.NoError(t, err, "no error when disablement is delayed")
+
+	callSecrets := []testClientSecret{
+		{call: "LastUpdated", sec: &config.Secret{SecretName: "Matthias"}},
+		{call: "LastUsed", sec: &config.Secret{SecretName: "Matthias"}},
+	}
+
+	assert.Equal(t, callSecrets, c.lastCallSecrets, "recently used secret not disabled")
+
+	c.lastCallSecrets = nil
+	c.lastUsed = time.Now().Add(-48 * time.Hour)
+	err = m.DisableSecrets(ctx)
+
+	assert.NoError(t, err, "no error on disable secrets")
+
+	callSecrets = []testClientSecret{
+		{call: "LastUpdated", sec: &config.Secret{SecretName: "Matthias"}},
+		{call: "LastUsed", sec: &config.Secret{SecretName: "Matthias"}},
+		{call: "DisableSecret", sec: &config.Secret{SecretName: "Matthias"}},
+	}
+
+	assert.Equal(t, callSecrets, c.lastCallSecrets, "idle secret disabled")
+
+	c.lastCallSecrets = nil
+	c.lastUsed = time.Now().Add(-time.Hour)
+	m = New(c, 0, 0, false,
+		[]config.Secret{
+			{SecretName: "Matthias"},
+		},
+	)
+	err = m.DisableSecrets(ctx)
+
+	assert.NoError(t, err, "no error on disable secrets")
+
+	callSecrets = []testClientSecret{
+		{call: "LastUpdated", sec: &config.Secret{SecretName: "Matthias"}},
+		{call: "DisableSecret", sec: &config.Secret{SecretName: "Matthias"}},
+	}
+
+	assert.Equal(t, callSecrets, c.lastCallSecrets, "usage ignored without a window")
+}
+
+type testRefreshClient struct {
+	testClient
+
+	failRefresh bool
+}
+
+func (c *testRefreshClient) Refresh(ctx context.Context) error {
+	c.lastCallSecrets = append(c.lastCallSecrets, testClientSecret{
+		call: "Refresh",
+	})
+	if c.failRefresh {
+		return fmt.Errorf("refresh bad stuff")
+	}
+	return nil
+}
+
+func TestManagerRefresh(t *testing.T) {
+	c := &testRefreshClient{
+		testClient: *NewTestClient(),
+	}
+	c.nothingToDisable = true
+	m := New(c, 0, 0, false,
+		[]config.Secret{
+			{SecretName: "Thomas"},
+		},
+	)
+
+	ctx := context.Background()
+	err := m.DisableSecrets(ctx)
+
+	assert.NoError(t, err, "no error on refresh")
+
+	callSecrets := []testClientSecret{
+		{call: "Refresh"},
+		{call: "LastUpdated", sec: &config.Secret{SecretName: "Thomas"}},
+	}
+
+	assert.Equal(t, callSecrets, c.lastCallSecrets, "refreshed with nothing to disable")
+
+	c.lastCallSecrets = nil
+	c.failRefresh = true
+	err = m.DisableSecrets(ctx)
+
+	assert.Error(t, err, "refresh failure is reported")
+
+	assert.Equal(t, callSecrets, c.lastCallSecrets, "secrets still examined")
+
+	c.lastCallSecrets = nil
+	m = New(c, 0, 0, true,
+		[]config.Secret{
+			{SecretName: "Thomas"},
+		},
+	)
+	err = m.DisableSecrets(ctx)
+
+	assert.NoError(t, err, "no error on dry run")
+
+	callSecrets = []testClientSecret{
+		{call: "LastUpdated", sec: &config.Secret{SecretName: "Thomas"}},
+	}
+
+	assert.Equal(t, callSecrets, c.lastCallSecrets, "not refreshed on dry run")
+}
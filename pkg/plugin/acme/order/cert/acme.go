@@ -0,0 +1,630 @@
+package cert
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin/internal/atomicfile"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+const (
+	// CertKey is the key the new certificate is returned under in PEM format.
+	CertKey = "TLS_CERT"
+
+	// ChainKey is the key the intermediate certificates are returned under in
+	// PEM format.
+	ChainKey = "TLS_CHAIN"
+
+	// FullChainKey is the key the new certificate followed by the intermediate
+	// certificates is returned under in PEM format.
+	FullChainKey = "TLS_FULLCHAIN"
+
+	// KeyKey is the key the new private key is returned under in PKCS #8 PEM
+	// format.
+	KeyKey = "TLS_KEY"
+
+	// ChallengeHTTP01 validates names with the http-01 challenge.
+	ChallengeHTTP01 = "http-01"
+
+	// ChallengeDNS01 validates names with the dns-01 challenge.
+	ChallengeDNS01 = "dns-01"
+
+	// TypeECDSA generates ECDSA keys on the P-256 curve.
+	TypeECDSA = "ecdsa"
+
+	// TypeRSA generates RSA keys.
+	TypeRSA = "rsa"
+)
+
+// Options are the options for ordering certificates. They may be set on the
+// plugin and overridden on each secret.
+type Options struct {
+	// Names are the DNS names of the certificate. If there are none, the
+	// secret name is used.
+	Names []string `mapstructure:"names"`
+
+	// Challenge is the challenge used to validate the names, ChallengeHTTP01
+	// or ChallengeDNS01.
+	Challenge string `mapstructure:"challenge"`
+
+	// KeyType is the type of key to generate, TypeECDSA or TypeRSA.
+	KeyType string `mapstructure:"key_type"`
+
+	// Bits is the size of RSA keys.
+	Bits int `mapstructure:"bits"`
+}
+
+// DefaultOptions returns the default options, which order certificates for
+// ECDSA keys validated with the http-01 challenge.
+func DefaultOptions() Options {
+	return Options{
+		Challenge: ChallengeHTTP01,
+		KeyType:   TypeECDSA,
+		Bits:      2048,
+	}
+}
+
+// Validate returns an error if the options cannot be used to order
+// certificates.
+func (o *Options) Validate() error {
+	switch o.Challenge {
+	case ChallengeHTTP01:
+		for _, name := range o.Names {
+			if strings.HasPrefix(name, "*.") {
+				return fmt.Errorf("wildcard name %q requires the %s challenge", name, ChallengeDNS01)
+			}
+		}
+	case ChallengeDNS01:
+	default:
+		return fmt.Errorf("unknown challenge %q", o.Challenge)
+	}
+
+	switch o.KeyType {
+	case TypeECDSA:
+	case TypeRSA:
+		if o.Bits < 2048 {
+			return fmt.Errorf("RSA keys must be at least 2048 bits, not %d", o.Bits)
+		}
+	default:
+		return fmt.Errorf("unknown key type %q", o.KeyType)
+	}
+
+	return nil
+}
+
+// Client implements the rotate.Client and rotate.Renewer interfaces for
+// obtaining certificates from an ACME certificate authority. The secret name is
+// the DNS name of the certificate unless names are configured.
+//
+// The certificate chain last obtained for each secret is kept in the state
+// directory, so its expiry can be checked. The ACME account key is created in
+// the account key file on first use if the file does not exist.
+type Client struct {
+	hc             *http.Client
+	directoryURL   string
+	email          string
+	accountKeyFile string
+	stateDir       string
+	httpAddress    string
+	dns            DNSProvider
+	dnsWait        time.Duration
+	renewBefore    time.Duration
+	timeout        time.Duration
+	defaults       Options
+
+	mu sync.Mutex
+	ac *acme.Client
+}
+
+// Name returns "ACME certificates".
+func (c *Client) Name() string {
+	return "ACME certificates"
+}
+
+// Keys returns the TLS_CERT, TLS_CHAIN, TLS_FULLCHAIN, and TLS_KEY keys.
+func (c *Client) Keys() secret.Map {
+	return secret.Map{
+		CertKey:      "",
+		ChainKey:     "",
+		FullChainKey: "",
+		KeyKey:       "",
+	}
+}
+
+// options returns the options for the secret, which are the default options of
+// the plugin overridden by any options set on the secret.
+func (c *Client) options(sec secret.Info) (Options, error) {
+	o := c.defaults
+
+	if so, ok := sec.(secret.Options); ok {
+		if err := so.DecodeOptions(&o); err != nil {
+			return Options{}, fmt.Errorf("failed to read ACME certificate options of secret %q: %w", sec.Name(), err)
+		}
+	}
+
+	if len(o.Names) == 0 {
+		o.Names = []string{sec.Name()}
+	}
+
+	if err := o.Validate(); err != nil {
+		return Options{}, fmt.Errorf("invalid ACME certificate options for secret %q: %w", sec.Name(), err)
+	}
+
+	if o.Challenge == ChallengeDNS01 && c.dns == nil {
+		return Options{}, fmt.Errorf("the ACME certificate of secret %q requires a dns_provider for the %s challenge", sec.Name(), ChallengeDNS01)
+	}
+
+	return o, nil
+}
+
+// stateFile returns the file the certificate chain of the secret is kept in.
+func (c *Client) stateFile(sec secret.Info) (string, error) {
+	name := url.PathEscape(sec.Name())
+	if name == "" || name == "." || name == ".." {
+		return "", fmt.Errorf("the secret name %q cannot be used as an ACME certificate name", sec.Name())
+	}
+
+	return filepath.Join(c.stateDir, name+".pem"), nil
+}
+
+// current returns the certificate last obtained for the secret, or nil if
+// there is none.
+func (c *Client) current(sec secret.Info) (*x509.Certificate, error) {
+	file, err := c.stateFile(sec)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read ACME certificate of secret %q: %w", sec.Name(), err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate found in %q", file)
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ACME certificate %q: %w", file, err)
+	}
+
+	return cert, nil
+}
+
+// LastRotated returns the NotBefore time of the certificate last obtained for
+// the secret. If none has been obtained, the zero time is returned.
+func (c *Client) LastRotated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	cert, err := c.current(sec)
+	if err != nil || cert == nil {
+		return time.Time{}, err
+	}
+
+	return cert.NotBefore, nil
+}
+
+// sameNames returns true if the certificate is for exactly the given names.
+func sameNames(cert *x509.Certificate, names []string) bool {
+	have := append([]string{}, cert.DNSNames...)
+	want := append([]string{}, names...)
+	sort.Strings(have)
+	sort.Strings(want)
+
+	if len(have) != len(want) {
+		return false
+	}
+
+	for i := range have {
+		if !strings.EqualFold(have[i], want[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NeedsRenewal returns true if no certificate has been obtained for the
+// secret, if the names configured have changed, or if the certificate expires
+// within renew_before.
+func (c *Client) NeedsRenewal(
+	ctx context.Context,
+	sec secret.Info,
+) (bool, error) {
+	o, err := c.options(sec)
+	if err != nil {
+		return false, err
+	}
+
+	cert, err := c.current(sec)
+	if err != nil {
+		return false, err
+	}
+
+	if cert == nil || !sameNames(cert, o.Names) {
+		return true, nil
+	}
+
+	return time.Until(cert.NotAfter) < c.renewBefore, nil
+}
+
+// accountKey reads the account key, creating it if it does not exist.
+func (c *Client) accountKey() (crypto.Signer, error) {
+	data, err := os.ReadFile(c.accountKeyFile)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		if err := os.MkdirAll(filepath.Dir(c.accountKeyFile), 0o700); err != nil {
+			return nil, err
+		}
+		if err := atomicfile.WriteFile(c.accountKeyFile, data, 0o600); err != nil {
+			return nil, err
+		}
+
+		return key, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in %q", c.accountKeyFile)
+	}
+
+	var key any
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q in %q", block.Type, c.accountKeyFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T in %q", key, c.accountKeyFile)
+	}
+
+	return signer, nil
+}
+
+// client returns the ACME client, registering the account the first time it
+// is needed. Registering an account that already exists is harmless.
+func (c *Client) client(ctx context.Context) (*acme.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ac != nil {
+		return c.ac, nil
+	}
+
+	key, err := c.accountKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ACME account key: %w", err)
+	}
+
+	ac := &acme.Client{
+		Key:          key,
+		HTTPClient:   c.hc,
+		DirectoryURL: c.directoryURL,
+		UserAgent:    "garotate",
+	}
+
+	acct := &acme.Account{}
+	if c.email != "" {
+		acct.Contact = []string{"mailto:" + c.email}
+	}
+
+	_, err = ac.Register(ctx, acct, acme.AcceptTOS)
+	if err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("failed to register ACME account: %w", err)
+	}
+
+	c.ac = ac
+	return ac, nil
+}
+
+// waitPropagation waits for the configured DNS propagation wait after the
+// dns-01 records of an order are published, so that they have reached every
+// name server the certificate authority may ask before the challenges are
+// accepted.
+func (c *Client) waitPropagation(ctx context.Context, sec secret.Info, records int) error {
+	if c.dnsWait <= 0 {
+		return nil
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Debugw(
+		"waiting for ACME dns-01 records to propagate",
+		"secret", sec.Name(),
+		"client", c.Name(),
+		"records", records,
+		"wait", c.dnsWait,
+	)
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(c.dnsWait):
+		return nil
+	}
+}
+
+// dnsRecord is a dns-01 record published for an order.
+type dnsRecord struct {
+	fqdn  string
+	value string
+}
+
+// pendingChallenge is a challenge that is ready to be accepted.
+type pendingChallenge struct {
+	authz *acme.Authorization
+	chal  *acme.Challenge
+}
+
+// authorize completes the authorizations of the order with the challenge
+// configured. Every dns-01 record is published before any challenge is
+// accepted, so the propagation wait is only needed once per order, and all of
+// them are removed again afterward, whether or not authorization succeeded.
+func (c *Client) authorize(
+	ctx context.Context,
+	ac *acme.Client,
+	sec secret.Info,
+	o Options,
+	order *acme.Order,
+) error {
+	var resp *responder
+	if o.Challenge == ChallengeHTTP01 {
+		var err error
+		resp, err = startResponder(c.httpAddress)
+		if err != nil {
+			return fmt.Errorf("failed to start ACME http-01 responder on %q: %w", c.httpAddress, err)
+		}
+		defer resp.stop()
+	}
+
+	var records []dnsRecord
+	err := c.respond(ctx, ac, sec, o, order, resp, &records)
+	c.cleanUp(ctx, sec, records)
+	return err
+}
+
+// respond prepares a response to the challenge of every pending authorization
+// of the order, then accepts the challenges and waits for each authorization
+// to be validated. The dns-01 records published are added to records.
+func (c *Client) respond(
+	ctx context.Context,
+	ac *acme.Client,
+	sec secret.Info,
+	o Options,
+	order *acme.Order,
+	resp *responder,
+	records *[]dnsRecord,
+) error {
+	var pending []pendingChallenge
+	for _, zurl := range order.AuthzURLs {
+		z, err := ac.GetAuthorization(ctx, zurl)
+		if err != nil {
+			return fmt.Errorf("failed to get ACME authorization: %w", err)
+		}
+
+		if z.Status == acme.StatusValid {
+			continue
+		}
+
+		var chal *acme.Challenge
+		for _, ch := range z.Challenges {
+			if ch.Type == o.Challenge {
+				chal = ch
+				break
+			}
+		}
+		if chal == nil {
+			return fmt.Errorf("the ACME server offered no %s challenge for %q", o.Challenge, z.Identifier.Value)
+		}
+
+		switch o.Challenge {
+		case ChallengeHTTP01:
+			response, err := ac.HTTP01ChallengeResponse(chal.Token)
+			if err != nil {
+				return err
+			}
+			resp.set(chal.Token, response)
+
+		case ChallengeDNS01:
+			value, err := ac.DNS01ChallengeRecord(chal.Token)
+			if err != nil {
+				return err
+			}
+
+			fqdn := "_acme-challenge." + strings.TrimSuffix(z.Identifier.Value, ".") + "."
+			if err := c.dns.Present(ctx, fqdn, value); err != nil {
+				return fmt.Errorf("failed to publish ACME dns-01 record %q: %w", fqdn, err)
+			}
+			*records = append(*records, dnsRecord{fqdn: fqdn, value: value})
+		}
+
+		pending = append(pending, pendingChallenge{authz: z, chal: chal})
+	}
+
+	if len(*records) > 0 {
+		if err := c.waitPropagation(ctx, sec, len(*records)); err != nil {
+			return fmt.Errorf("failed waiting for ACME dns-01 records to propagate: %w", err)
+		}
+	}
+
+	for _, p := range pending {
+		if _, err := ac.Accept(ctx, p.chal); err != nil {
+			return fmt.Errorf("failed to accept ACME %s challenge for %q: %w", o.Challenge, p.authz.Identifier.Value, err)
+		}
+
+		if _, err := ac.WaitAuthorization(ctx, p.authz.URI); err != nil {
+			return fmt.Errorf("failed to validate %q with ACME %s challenge: %w", p.authz.Identifier.Value, o.Challenge, err)
+		}
+	}
+
+	return nil
+}
+
+// cleanUp removes the dns-01 records published for an order. Failures are
+// logged, but do not fail the order.
+func (c *Client) cleanUp(ctx context.Context, sec secret.Info, records []dnsRecord) {
+	logger := config.LoggerFrom(ctx).Sugar()
+	for _, r := range records {
+		if err := c.dns.CleanUp(ctx, r.fqdn, r.value); err != nil {
+			logger.Warnw(
+				"failed to clean up ACME dns-01 record",
+				"secret", sec.Name(),
+				"client", c.Name(),
+				"fqdn", r.fqdn,
+				"error", err,
+			)
+		}
+	}
+}
+
+// generateKey generates a new private key according to the options.
+func generateKey(o Options) (crypto.Signer, error) {
+	if o.KeyType == TypeRSA {
+		return rsa.GenerateKey(rand.Reader, o.Bits)
+	}
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+// RotateSecret orders a new certificate for the names of the secret with a new
+// private key. The previous certificate keeps working until it expires.
+func (c *Client) RotateSecret(
+	ctx context.Context,
+	sec secret.Info,
+) (secret.Map, error) {
+	o, err := c.options(sec)
+	if err != nil {
+		return secret.Map{}, err
+	}
+
+	file, err := c.stateFile(sec)
+	if err != nil {
+		return secret.Map{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	ac, err := c.client(ctx)
+	if err != nil {
+		return secret.Map{}, err
+	}
+
+	order, err := ac.AuthorizeOrder(ctx, acme.DomainIDs(o.Names...))
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to create ACME order for secret %q: %w", sec.Name(), err)
+	}
+
+	if err := c.authorize(ctx, ac, sec, o, order); err != nil {
+		return secret.Map{}, fmt.Errorf("failed to authorize ACME order for secret %q: %w", sec.Name(), err)
+	}
+
+	if _, err := ac.WaitOrder(ctx, order.URI); err != nil {
+		return secret.Map{}, fmt.Errorf("ACME order for secret %q was not ready: %w", sec.Name(), err)
+	}
+
+	key, err := generateKey(o)
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to generate TLS key for secret %q: %w", sec.Name(), err)
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: o.Names[0]},
+		DNSNames: o.Names,
+	}, key)
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to create certificate request for secret %q: %w", sec.Name(), err)
+	}
+
+	ders, _, err := ac.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to finalize ACME order for secret %q: %w", sec.Name(), err)
+	}
+
+	cert, err := x509.ParseCertificate(ders[0])
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to parse ACME certificate for secret %q: %w", sec.Name(), err)
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to encode TLS key for secret %q: %w", sec.Name(), err)
+	}
+
+	var chain strings.Builder
+	for _, der := range ders[1:] {
+		chain.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	}
+	leaf := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ders[0]}))
+	fullChain := leaf + chain.String()
+
+	err = os.MkdirAll(filepath.Dir(file), 0o700)
+	if err == nil {
+		err = atomicfile.WriteFile(file, []byte(fullChain), 0o600)
+	}
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to record ACME certificate for secret %q: %w", sec.Name(), err)
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Infow(
+		"obtained ACME certificate",
+		"secret", sec.Name(),
+		"client", c.Name(),
+		"names", o.Names,
+		"not_after", cert.NotAfter,
+	)
+
+	return secret.Map{
+		CertKey:      leaf,
+		ChainKey:     chain.String(),
+		FullChainKey: fullChain,
+		KeyKey:       string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})),
+	}, nil
+}
@@ -0,0 +1,473 @@
+package cert
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/acme"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+)
+
+// These environment variables configure a Pebble ACME server to test against,
+// along with the challenge test server it uses for DNS, such as:
+//
+//	pebble-challtestsrv -defaultIPv4 127.0.0.1 &
+//	pebble -config test/config/pebble-config.json -dnsserver 127.0.0.1:8053 &
+//	GAROTATE_TEST_ACME_DIRECTORY=https://localhost:14000/dir \
+//	GAROTATE_TEST_ACME_CA_FILE=test/certs/pebble.minica.pem \
+//	GAROTATE_TEST_ACME_CHALLTESTSRV=http://localhost:8055 go test ./...
+//
+// The http-01 responder listens on the httpPort of the Pebble configuration,
+// 5002 by default.
+const (
+	testDirectoryEnv    = "GAROTATE_TEST_ACME_DIRECTORY"
+	testCAFileEnv       = "GAROTATE_TEST_ACME_CA_FILE"
+	testChalltestsrvEnv = "GAROTATE_TEST_ACME_CHALLTESTSRV"
+	testHTTPAddressEnv  = "GAROTATE_TEST_ACME_HTTP_ADDRESS"
+)
+
+// challtestsrvProvider implements DNSProvider with the management API of the
+// Pebble challenge test server.
+type challtestsrvProvider struct {
+	url string
+}
+
+func (p *challtestsrvProvider) post(path string, body map[string]string) error {
+	data, _ := json.Marshal(body)
+	res, err := http.Post(p.url+path, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("challtestsrv %s: %s", path, res.Status)
+	}
+	return nil
+}
+
+func (p *challtestsrvProvider) Present(ctx context.Context, fqdn, value string) error {
+	return p.post("/set-txt", map[string]string{"host": fqdn, "value": value})
+}
+
+func (p *challtestsrvProvider) CleanUp(ctx context.Context, fqdn, value string) error {
+	return p.post("/clear-txt", map[string]string{"host": fqdn})
+}
+
+type challtestsrvBuilder struct{}
+
+func (challtestsrvBuilder) Build(ctx context.Context, c *config.Plugin) (DNSProvider, error) {
+	var opts struct {
+		URL string `mapstructure:"url"`
+	}
+	if err := c.DecodeOptions(&opts); err != nil {
+		return nil, err
+	}
+	return &challtestsrvProvider{url: opts.URL}, nil
+}
+
+func init() {
+	RegisterDNSProvider("challtestsrv", challtestsrvBuilder{})
+}
+
+func TestRotateSecret(t *testing.T) {
+	directory := os.Getenv(testDirectoryEnv)
+	if directory == "" {
+		t.Skipf("set %s to test against a Pebble ACME server", testDirectoryEnv)
+	}
+
+	httpAddress := os.Getenv(testHTTPAddressEnv)
+	if httpAddress == "" {
+		httpAddress = ":5002"
+	}
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	opts := map[string]any{
+		"directory_url":     directory,
+		"directory_ca_file": os.Getenv(testCAFileEnv),
+		"email":             "garotate@example.com",
+		"account_key_file":  filepath.Join(dir, "account.pem"),
+		"state_dir":         filepath.Join(dir, "state"),
+		"http_address":      httpAddress,
+	}
+	if u := os.Getenv(testChalltestsrvEnv); u != "" {
+		opts["dns_provider"] = "challtestsrv"
+		opts["dns_provider_option"] = map[string]any{"url": u}
+	}
+
+	inst, err := plugin.Build(ctx, &config.Plugin{
+		Name:    "acme",
+		Package: "github.com/zostay/garotate/pkg/plugin/acme/order/cert",
+		Options: opts,
+	})
+	require.NoError(t, err)
+	c := inst.(*Client)
+
+	secs := []*config.Secret{{SecretName: "www.example.com"}}
+	if os.Getenv(testChalltestsrvEnv) != "" {
+		secs = append(secs, &config.Secret{
+			SecretName: "wildcard",
+			Options: map[string]any{
+				"names":     []string{"example.com", "*.example.com"},
+				"challenge": ChallengeDNS01,
+				"key_type":  TypeRSA,
+			},
+		})
+	}
+
+	for _, sec := range secs {
+		need, err := c.NeedsRenewal(ctx, sec)
+		require.NoError(t, err, sec.SecretName)
+		assert.True(t, need, "%s never obtained", sec.SecretName)
+
+		keys, err := c.RotateSecret(ctx, sec)
+		require.NoError(t, err, sec.SecretName)
+
+		cert := parseCert(t, keys[CertKey])
+		assert.Equal(t, keys[CertKey]+keys[ChainKey], keys[FullChainKey], sec.SecretName)
+		assert.NotEmpty(t, keys[KeyKey], sec.SecretName)
+
+		last, err := c.LastRotated(ctx, sec)
+		require.NoError(t, err, sec.SecretName)
+		assert.Equal(t, cert.NotBefore, last, sec.SecretName)
+
+		need, err = c.NeedsRenewal(ctx, sec)
+		require.NoError(t, err, sec.SecretName)
+		assert.False(t, need, "%s just obtained", sec.SecretName)
+	}
+}
+
+// parseCert parses the first certificate of a PEM bundle.
+func parseCert(t *testing.T, data string) *x509.Certificate {
+	t.Helper()
+
+	block, _ := pem.Decode([]byte(data))
+	require.NotNil(t, block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	return cert
+}
+
+// writeCert writes a self-signed certificate for the names, expiring after the
+// given duration, as the state of the secret.
+func writeCert(t *testing.T, c *Client, name string, names []string, expires time.Duration) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour).Truncate(time.Second),
+		NotAfter:     time.Now().Add(expires),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	require.NoError(t, err)
+
+	file, err := c.stateFile(&config.Secret{SecretName: name})
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Dir(file), 0o700))
+	require.NoError(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+
+	return tmpl
+}
+
+func TestNeedsRenewal(t *testing.T) {
+	ctx := context.Background()
+	c := &Client{
+		stateDir:    t.TempDir(),
+		renewBefore: 30 * 24 * time.Hour,
+		defaults:    DefaultOptions(),
+	}
+
+	sec := &config.Secret{SecretName: "www.example.com"}
+	need, err := c.NeedsRenewal(ctx, sec)
+	require.NoError(t, err)
+	assert.True(t, need, "never obtained")
+
+	last, err := c.LastRotated(ctx, sec)
+	require.NoError(t, err)
+	assert.True(t, last.IsZero(), "never obtained")
+
+	cert := writeCert(t, c, "www.example.com", []string{"www.example.com"}, 60*24*time.Hour)
+	need, err = c.NeedsRenewal(ctx, sec)
+	require.NoError(t, err)
+	assert.False(t, need, "not close to expiry")
+
+	last, err = c.LastRotated(ctx, sec)
+	require.NoError(t, err)
+	assert.True(t, cert.NotBefore.Equal(last), "NotBefore")
+
+	need, err = c.NeedsRenewal(ctx, &config.Secret{
+		SecretName: "www.example.com",
+		Options:    map[string]any{"names": []string{"www.example.com", "example.com"}},
+	})
+	require.NoError(t, err)
+	assert.True(t, need, "names changed")
+
+	writeCert(t, c, "www.example.com", []string{"www.example.com"}, 10*24*time.Hour)
+	need, err = c.NeedsRenewal(ctx, sec)
+	require.NoError(t, err)
+	assert.True(t, need, "close to expiry")
+
+	_, err = c.NeedsRenewal(ctx, &config.Secret{
+		SecretName: "wildcard",
+		Options:    map[string]any{"names": []string{"*.example.com"}},
+	})
+	assert.Error(t, err, "wildcards need dns-01")
+}
+
+func TestAccountKey(t *testing.T) {
+	dir := t.TempDir()
+	c := &Client{accountKeyFile: filepath.Join(dir, "acme", "account.pem")}
+
+	key, err := c.accountKey()
+	require.NoError(t, err, "created in a new directory")
+
+	fi, err := os.Stat(c.accountKeyFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm(), "private")
+
+	entries, err := os.ReadDir(filepath.Dir(c.accountKeyFile))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "no temporary files left behind")
+
+	again, err := c.accountKey()
+	require.NoError(t, err)
+	assert.True(t, key.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(again.Public()), "same key read back")
+}
+
+func TestWaitPropagation(t *testing.T) {
+	ctx := context.Background()
+	sec := &config.Secret{SecretName: "www.example.com"}
+
+	c := &Client{}
+	assert.NoError(t, c.waitPropagation(ctx, sec, 1), "no wait")
+
+	c.dnsWait = 50 * time.Millisecond
+	start := time.Now()
+	require.NoError(t, c.waitPropagation(ctx, sec, 1))
+	assert.GreaterOrEqual(t, time.Since(start), c.dnsWait, "waited")
+
+	c.dnsWait = time.Hour
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	err := c.waitPropagation(cctx, sec, 1)
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "order timeout ends the wait")
+
+	_, err = (&builder{}).Build(ctx, &config.Plugin{Options: map[string]any{
+		"account_key_file":     filepath.Join(t.TempDir(), "account.pem"),
+		"state_dir":            t.TempDir(),
+		"dns_propagation_wait": "10m",
+	}})
+	assert.Error(t, err, "wait longer than the timeout")
+}
+
+// fakeACME is an ACME server supporting just enough of the protocol to
+// validate dns-01 authorizations. It is also the DNS provider, so that it can
+// record the order records are published, challenges accepted, and records
+// removed in.
+type fakeACME struct {
+	mu          sync.Mutex
+	url         string
+	valid       map[string]bool
+	events      []string
+	failPresent string
+}
+
+func (f *fakeACME) event(e string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, e)
+}
+
+func (f *fakeACME) Present(ctx context.Context, fqdn, value string) error {
+	if fqdn == f.failPresent {
+		return fmt.Errorf("no zone for %q", fqdn)
+	}
+	f.event("present " + fqdn)
+	return nil
+}
+
+func (f *fakeACME) CleanUp(ctx context.Context, fqdn, value string) error {
+	f.event("cleanup " + fqdn)
+	return nil
+}
+
+func (f *fakeACME) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", time.Now().UnixNano()))
+	w.Header().Set("Content-Type", "application/json")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var res any
+	switch {
+	case r.URL.Path == "/dir":
+		res = map[string]string{
+			"newNonce":   f.url + "/nonce",
+			"newAccount": f.url + "/account",
+			"newOrder":   f.url + "/order",
+		}
+
+	case r.URL.Path == "/nonce":
+		return
+
+	case strings.HasPrefix(r.URL.Path, "/authz/"):
+		name := strings.TrimPrefix(r.URL.Path, "/authz/")
+		status := acme.StatusPending
+		if f.valid[name] {
+			status = acme.StatusValid
+		}
+		res = map[string]any{
+			"status":     status,
+			"identifier": map[string]string{"type": "dns", "value": name},
+			"challenges": []map[string]string{{
+				"type":   ChallengeDNS01,
+				"url":    f.url + "/chal/" + name,
+				"token":  "token-" + name,
+				"status": status,
+			}},
+		}
+
+	case strings.HasPrefix(r.URL.Path, "/chal/"):
+		name := strings.TrimPrefix(r.URL.Path, "/chal/")
+		f.valid[name] = true
+		f.events = append(f.events, "accept "+name)
+		res = map[string]string{
+			"type":   ChallengeDNS01,
+			"url":    f.url + r.URL.Path,
+			"token":  "token-" + name,
+			"status": acme.StatusProcessing,
+		}
+
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func TestAuthorize(t *testing.T) {
+	ctx := context.Background()
+	sec := &config.Secret{SecretName: "www"}
+	o := DefaultOptions()
+	o.Challenge = ChallengeDNS01
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	authorize := func(failPresent string) ([]string, error) {
+		f := &fakeACME{valid: map[string]bool{}, failPresent: failPresent}
+		srv := httptest.NewServer(f)
+		defer srv.Close()
+		f.url = srv.URL
+
+		ac := &acme.Client{
+			Key:          key,
+			DirectoryURL: srv.URL + "/dir",
+			KID:          acme.KeyID(srv.URL + "/account/1"),
+		}
+		order := &acme.Order{AuthzURLs: []string{
+			srv.URL + "/authz/a.example.com",
+			srv.URL + "/authz/b.example.com",
+		}}
+
+		c := &Client{dns: f, dnsWait: 10 * time.Millisecond}
+		err := c.authorize(ctx, ac, sec, o, order)
+		return f.events, err
+	}
+
+	events, err := authorize("")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"present _acme-challenge.a.example.com.",
+		"present _acme-challenge.b.example.com.",
+		"accept a.example.com",
+		"accept b.example.com",
+		"cleanup _acme-challenge.a.example.com.",
+		"cleanup _acme-challenge.b.example.com.",
+	}, events, "every record is published before any challenge is accepted")
+
+	events, err = authorize("_acme-challenge.b.example.com.")
+	assert.Error(t, err)
+	assert.Equal(t, []string{
+		"present _acme-challenge.a.example.com.",
+		"cleanup _acme-challenge.a.example.com.",
+	}, events, "records already published are removed when publishing fails")
+}
+
+func TestExecProvider(t *testing.T) {
+	ctx := context.Background()
+	log := filepath.Join(t.TempDir(), "log")
+
+	p, err := execBuilder{}.Build(ctx, &config.Plugin{
+		Options: map[string]any{
+			"command": []string{"sh", "-c", `echo "$@" >> ` + log, "provider"},
+		},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, p.Present(ctx, "_acme-challenge.example.com.", "abc"))
+	require.NoError(t, p.CleanUp(ctx, "_acme-challenge.example.com.", "abc"))
+
+	data, err := os.ReadFile(log)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"present _acme-challenge.example.com. abc",
+		"cleanup _acme-challenge.example.com. abc",
+	}, strings.Split(strings.TrimSpace(string(data)), "\n"))
+
+	_, err = execBuilder{}.Build(ctx, &config.Plugin{})
+	assert.Error(t, err, "command required")
+}
+
+func TestResponder(t *testing.T) {
+	r, err := startResponder("127.0.0.1:0")
+	require.NoError(t, err)
+	defer r.stop()
+
+	r.set("token", "token.thumbprint")
+
+	srv := "http://" + r.ln.Addr().String()
+	res, err := http.Get(srv + challengePrefix + "token")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "token.thumbprint", string(body))
+
+	res, err = http.Get(srv + challengePrefix + "other")
+	require.NoError(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
@@ -0,0 +1,154 @@
+package cert
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+)
+
+const (
+	// DefaultDirectoryURL is the ACME directory used if none is configured,
+	// which is that of Let's Encrypt.
+	DefaultDirectoryURL = "https://acme-v02.api.letsencrypt.org/directory"
+
+	// DefaultHTTPAddress is the address the http-01 responder listens on if
+	// none is configured.
+	DefaultHTTPAddress = ":80"
+
+	// DefaultRenewBefore is how long before expiry certificates are renewed if
+	// no renew_before is configured.
+	DefaultRenewBefore = 30 * 24 * time.Hour
+
+	// DefaultTimeout is how long an order may take if no timeout is
+	// configured.
+	DefaultTimeout = 5 * time.Minute
+)
+
+// builder implements the plugin.Builder interface and provides the factory
+// method for constructing a Client.
+type builder struct{}
+
+// options are the plugin options accepted in the configuration. The options
+// for the certificates ordered may be set here as defaults.
+type options struct {
+	DirectoryURL      string         `mapstructure:"directory_url"`
+	DirectoryCAFile   string         `mapstructure:"directory_ca_file"`
+	Email             string         `mapstructure:"email"`
+	AccountKeyFile    string         `mapstructure:"account_key_file"`
+	StateDir          string         `mapstructure:"state_dir"`
+	HTTPAddress       string         `mapstructure:"http_address"`
+	DNSProvider       string         `mapstructure:"dns_provider"`
+	DNSProviderOption map[string]any `mapstructure:"dns_provider_option"`
+	DNSWait           time.Duration  `mapstructure:"dns_propagation_wait"`
+	RenewBefore       time.Duration  `mapstructure:"renew_before"`
+	Timeout           time.Duration  `mapstructure:"timeout"`
+
+	Options `mapstructure:",squash"`
+}
+
+// Build constructs and returns an ACME certificate client.
+func (b *builder) Build(
+	ctx context.Context,
+	c *config.Plugin,
+) (plugin.Instance, error) {
+	opts := options{
+		DirectoryURL: DefaultDirectoryURL,
+		HTTPAddress:  DefaultHTTPAddress,
+		RenewBefore:  DefaultRenewBefore,
+		Timeout:      DefaultTimeout,
+		Options:      DefaultOptions(),
+	}
+	err := c.DecodeOptions(&opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ACME plugin options: %w", err)
+	}
+
+	if opts.AccountKeyFile == "" {
+		return nil, errors.New("the ACME plugin requires an account_key_file option")
+	}
+
+	if opts.StateDir == "" {
+		return nil, errors.New("the ACME plugin requires a state_dir option to keep the certificates it obtains")
+	}
+
+	if opts.RenewBefore <= 0 || opts.Timeout <= 0 {
+		return nil, errors.New("the ACME plugin renew_before and timeout options must be positive")
+	}
+
+	if opts.DNSWait < 0 || opts.DNSWait >= opts.Timeout {
+		return nil, errors.New("the ACME plugin dns_propagation_wait option must not be negative and must be shorter than the timeout")
+	}
+
+	if err := opts.Options.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid ACME plugin options: %w", err)
+	}
+
+	var dns DNSProvider
+	if opts.DNSProvider != "" {
+		db, ok := dnsProviders[opts.DNSProvider]
+		if !ok {
+			return nil, fmt.Errorf("the ACME plugin dns_provider %q is not known", opts.DNSProvider)
+		}
+
+		dns, err = db.Build(ctx, &config.Plugin{
+			Name:    opts.DNSProvider,
+			Options: opts.DNSProviderOption,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Challenge == ChallengeDNS01 && dns == nil {
+		return nil, errors.New("the ACME plugin requires a dns_provider option for the dns-01 challenge")
+	}
+
+	hc := http.DefaultClient
+	if opts.DirectoryCAFile != "" {
+		pem, err := os.ReadFile(opts.DirectoryCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ACME directory CA file: %w", err)
+		}
+
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ACME directory CA file %q", opts.DirectoryCAFile)
+		}
+
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		tr.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+		hc = &http.Client{Transport: tr}
+	}
+
+	return &Client{
+		hc:             hc,
+		directoryURL:   opts.DirectoryURL,
+		email:          opts.Email,
+		accountKeyFile: opts.AccountKeyFile,
+		stateDir:       opts.StateDir,
+		httpAddress:    opts.HTTPAddress,
+		dns:            dns,
+		dnsWait:        opts.DNSWait,
+		renewBefore:    opts.RenewBefore,
+		timeout:        opts.Timeout,
+		defaults:       opts.Options,
+	}, nil
+}
+
+// init registers the plugin.
+func init() {
+	pkg := reflect.TypeOf(Client{}).PkgPath()
+	plugin.Register(pkg, new(builder))
+}
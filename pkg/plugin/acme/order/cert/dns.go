@@ -0,0 +1,96 @@
+package cert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/zostay/garotate/pkg/config"
+)
+
+// DNSProvider publishes the TXT records that answer dns-01 challenges.
+type DNSProvider interface {
+	// Present must publish a TXT record with the given value at the given
+	// fully qualified name, which ends with a dot. It should not return until
+	// the record is visible to the certificate authority.
+	//
+	// The context provides a logger via context tools in the config package.
+	Present(ctx context.Context, fqdn, value string) error
+
+	// CleanUp must remove the TXT record published by Present. Other TXT
+	// records at the same name must be left alone, since several challenges
+	// may share a name.
+	//
+	// The context provides a logger via context tools in the config package.
+	CleanUp(ctx context.Context, fqdn, value string) error
+}
+
+// DNSProviderBuilder constructs a DNSProvider from the dns_provider_option map
+// of the plugin, which is given as the options of the config.Plugin.
+type DNSProviderBuilder interface {
+	Build(ctx context.Context, c *config.Plugin) (DNSProvider, error)
+}
+
+// dnsProviders holds the registered DNS provider builders.
+var dnsProviders = make(map[string]DNSProviderBuilder)
+
+// RegisterDNSProvider should be called during package initialization to make
+// a DNS provider available to the dns_provider option under the given name.
+func RegisterDNSProvider(name string, b DNSProviderBuilder) {
+	if _, alreadyExists := dnsProviders[name]; alreadyExists {
+		panic(fmt.Sprintf("garotate ACME DNS provider %q has already been registered", name))
+	}
+	dnsProviders[name] = b
+}
+
+// execProvider implements DNSProvider by running a program, which is given
+// "present" or "cleanup", the name, and the value as arguments.
+type execProvider struct {
+	command []string
+}
+
+// execBuilder constructs an execProvider.
+type execBuilder struct{}
+
+// Build constructs an execProvider from its command option.
+func (execBuilder) Build(ctx context.Context, c *config.Plugin) (DNSProvider, error) {
+	var opts struct {
+		Command []string `mapstructure:"command"`
+	}
+	if err := c.DecodeOptions(&opts); err != nil {
+		return nil, fmt.Errorf("failed to read exec DNS provider options: %w", err)
+	}
+
+	if len(opts.Command) == 0 {
+		return nil, errors.New("the exec DNS provider requires a command option")
+	}
+
+	return &execProvider{command: opts.Command}, nil
+}
+
+// run runs the command with the action, name, and value.
+func (p *execProvider) run(ctx context.Context, action, fqdn, value string) error {
+	args := append(append([]string{}, p.command[1:]...), action, fqdn, value)
+	out, err := exec.CommandContext(ctx, p.command[0], args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("DNS provider command %q failed to %s %s: %w: %s", p.command[0], action, fqdn, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Present runs the command with "present".
+func (p *execProvider) Present(ctx context.Context, fqdn, value string) error {
+	return p.run(ctx, "present", fqdn, value)
+}
+
+// CleanUp runs the command with "cleanup".
+func (p *execProvider) CleanUp(ctx context.Context, fqdn, value string) error {
+	return p.run(ctx, "cleanup", fqdn, value)
+}
+
+// init registers the built in DNS providers.
+func init() {
+	RegisterDNSProvider("exec", execBuilder{})
+}
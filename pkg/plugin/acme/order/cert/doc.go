@@ -0,0 +1,7 @@
+// Package cert provides a plugin which implements the rotate.Client and
+// rotate.Renewer and is used to obtain certificates from an ACME certificate
+// authority, such as Let's Encrypt. Names are validated with the http-01
+// challenge, answered by a responder the plugin runs while ordering, or the
+// dns-01 challenge, answered by a DNS provider. Renewal is decided by the expiry
+// of the current certificate rather than the rotate_after of the policy.
+package cert
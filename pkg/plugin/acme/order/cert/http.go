@@ -0,0 +1,72 @@
+package cert
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// challengePrefix is the path http-01 challenges are fetched under.
+const challengePrefix = "/.well-known/acme-challenge/"
+
+// responder answers http-01 challenges while an order is being validated.
+type responder struct {
+	mu        sync.Mutex
+	responses map[string]string
+	ln        net.Listener
+	srv       *http.Server
+}
+
+// startResponder listens on the address and serves http-01 challenge
+// responses until stopped.
+func startResponder(addr string) (*responder, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &responder{responses: map[string]string{}, ln: ln}
+	r.srv = &http.Server{
+		Handler:           r,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() { _ = r.srv.Serve(ln) }()
+
+	return r, nil
+}
+
+// set makes the responder answer the challenge for the token.
+func (r *responder) set(token, response string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses[token] = response
+}
+
+// ServeHTTP answers a challenge request.
+func (r *responder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !strings.HasPrefix(req.URL.Path, challengePrefix) {
+		http.NotFound(w, req)
+		return
+	}
+
+	r.mu.Lock()
+	response, ok := r.responses[strings.TrimPrefix(req.URL.Path, challengePrefix)]
+	r.mu.Unlock()
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte(response))
+}
+
+// stop shuts the responder down.
+func (r *responder) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = r.srv.Shutdown(ctx)
+}
@@ -0,0 +1,68 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/rotate"
+)
+
+// builder implements the plugin.Builder interface and provides the factory
+// method for constructing a Client.
+type builder struct{}
+
+// options are the plugin options accepted in the configuration.
+type options struct {
+	Client   string   `mapstructure:"client"`
+	Suffixes []string `mapstructure:"suffixes"`
+	UserKey  string   `mapstructure:"user_key"`
+}
+
+// Build constructs and returns an alternating users client.
+func (b *builder) Build(
+	ctx context.Context,
+	c *config.Plugin,
+) (plugin.Instance, error) {
+	plugins := plugin.ManagerFrom(ctx)
+	if plugins == nil {
+		return nil, errors.New("the alternating users plugin must be built by a plugin manager to find the client it wraps")
+	}
+
+	var opts options
+	err := c.DecodeOptions(&opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alternating users plugin options: %w", err)
+	}
+
+	if opts.Client == "" {
+		return nil, errors.New("the alternating users plugin requires the client option")
+	}
+
+	if opts.Suffixes != nil && len(opts.Suffixes) < 2 {
+		return nil, errors.New("the alternating users plugin requires at least two suffixes")
+	}
+
+	inst, err := plugins.Instance(ctx, opts.Client)
+	if err != nil {
+		return nil, err
+	}
+
+	rc, ok := inst.(rotate.Client)
+	if !ok {
+		return nil, fmt.Errorf("expected rotation plugin for client named %q, but got %T instead", opts.Client, inst)
+	}
+
+	return &Client{
+		Alternating: rotate.NewAlternating(rc, plugins, opts.Suffixes, opts.UserKey),
+	}, nil
+}
+
+// init registers the plugin.
+func init() {
+	pkg := reflect.TypeOf(Client{}).PkgPath()
+	plugin.Register(pkg, new(builder))
+}
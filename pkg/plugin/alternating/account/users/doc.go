@@ -0,0 +1,5 @@
+// Package users provides a plugin which wraps another rotation plugin with the
+// alternating strategy of the rotate package. Each secret is backed by two or
+// more accounts, so systems that hold only one password per account can be
+// rotated without breaking running consumers.
+package users
@@ -0,0 +1,10 @@
+package users
+
+import "github.com/zostay/garotate/pkg/rotate"
+
+// Client implements the rotate.Client and disable.Client interfaces by
+// alternating between the accounts of each secret using the configured
+// rotation client. See rotate.Alternating for details.
+type Client struct {
+	*rotate.Alternating
+}
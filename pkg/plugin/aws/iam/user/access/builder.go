@@ -2,10 +2,12 @@ package access
 
 import (
 	"context"
+	"fmt"
 	"reflect"
 
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
 
 	"github.com/zostay/garotate/pkg/config"
 	"github.com/zostay/garotate/pkg/plugin"
@@ -17,10 +19,25 @@ type builder struct{}
 
 // Build constructs and returns an IAM client.
 func (b *builder) Build(ctx context.Context, c *config.Plugin) (plugin.Instance, error) {
+	opts := DefaultOptions()
+	err := c.DecodeOptions(&opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read IAM plugin options: %w", err)
+	}
+
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid IAM plugin options: %w", err)
+	}
+
 	session := session.Must(session.NewSession())
 	svcIam := iam.New(session)
 
-	return &Client{svcIam}, nil
+	return &Client{
+		session:  session,
+		svcIam:   svcIam,
+		defaults: opts,
+		assumed:  map[Options]iamiface.IAMAPI{},
+	}, nil
 }
 
 // init registers the plugin.
@@ -1,4 +1,6 @@
 // Package iam provides a plugin which implements both the rotate.Client and the
 // disable.Client and is used to rotate IAM AWS user accounts and disable
-// inactive access keys associated with those accounts.
+// inactive access keys associated with those accounts. It also implements
+// disable.Deleter to delete the access keys it has made inactive and
+// disable.UsageChecker so that keys still in use are not disabled.
 package access
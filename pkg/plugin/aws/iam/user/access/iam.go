@@ -2,13 +2,21 @@ package access
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"regexp"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
 
 	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
 	"github.com/zostay/garotate/pkg/secret"
 )
 
@@ -20,14 +28,74 @@ const (
 	// This is the key that will be used to map to the AWS IAM secret key when
 	// returned from RotateSecret()
 	SecretKeyName = "AWS_SECRET_ACCESS_KEY"
+
+	// DefaultSessionName is the role session name used when assuming a role
+	// if none is configured.
+	DefaultSessionName = "garotate"
 )
 
+// sessionNameRx matches the role session names permitted by STS.
+var sessionNameRx = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+
+// Options select the role assumed to manage the access keys of a user. They
+// may be set on the plugin and overridden on each secret, so that users in
+// several AWS accounts can be managed by one configuration.
+type Options struct {
+	// RoleARN is the ARN of the role to assume. If it is empty, the
+	// credentials garotate runs with are used directly.
+	RoleARN string `mapstructure:"role_arn"`
+
+	// ExternalID is the external ID required by the trust policy of the role,
+	// if any.
+	ExternalID string `mapstructure:"external_id"`
+
+	// SessionName is the name of the role session, which is recorded in
+	// CloudTrail.
+	SessionName string `mapstructure:"session_name"`
+}
+
+// DefaultOptions returns the default options, which assume no role.
+func DefaultOptions() Options {
+	return Options{
+		SessionName: DefaultSessionName,
+	}
+}
+
+// Validate returns an error if the options cannot be used to assume a role.
+func (o *Options) Validate() error {
+	if o.RoleARN == "" {
+		if o.ExternalID != "" {
+			return errors.New("external_id requires a role_arn")
+		}
+		return nil
+	}
+
+	if !arn.IsARN(o.RoleARN) {
+		return fmt.Errorf("role_arn must be an ARN, but got %q", o.RoleARN)
+	}
+
+	if !sessionNameRx.MatchString(o.SessionName) {
+		return fmt.Errorf("session_name must be 2 to 64 letters, digits, or any of _+=,.@-, but got %q", o.SessionName)
+	}
+
+	return nil
+}
+
 // gotkeys is the cache used to store the keys cached from a previous AWS fetch.
 type gotkeys struct{}
 
 // Client implements both the rotate.Client and disable.Client interfaces.
+//
+// When a role is configured for a secret, the role is assumed and the access
+// keys of the user are managed with the temporary credentials of the role.
+// The credentials are kept and refreshed for each role as needed.
 type Client struct {
-	svcIam *iam.IAM
+	session  client.ConfigProvider
+	svcIam   iamiface.IAMAPI
+	defaults Options
+
+	mu      sync.Mutex
+	assumed map[Options]iamiface.IAMAPI
 }
 
 // clearCache is a helper for clearing the cache of keys fetched from AWS.
@@ -63,12 +131,66 @@ func (c *Client) Keys() secret.Map {
 	}
 }
 
+// options returns the options for the secret, which are the default options of
+// the plugin overridden by any options set on the secret.
+func (c *Client) options(sec secret.Info) (Options, error) {
+	o := c.defaults
+
+	if so, ok := sec.(secret.Options); ok {
+		if err := so.DecodeOptions(&o); err != nil {
+			return Options{}, fmt.Errorf("failed to read IAM options of secret %q: %w", sec.Name(), err)
+		}
+	}
+
+	if err := o.Validate(); err != nil {
+		return Options{}, fmt.Errorf("invalid IAM options for secret %q: %w", sec.Name(), err)
+	}
+
+	return o, nil
+}
+
+// iam returns the IAM service client to manage the access keys of the secret
+// with, which assumes the role configured for the secret, if any.
+func (c *Client) iam(sec secret.Info) (iamiface.IAMAPI, error) {
+	o, err := c.options(sec)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.RoleARN == "" {
+		return c.svcIam, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if svc, ok := c.assumed[o]; ok {
+		return svc, nil
+	}
+
+	creds := stscreds.NewCredentials(c.session, o.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+		p.RoleSessionName = o.SessionName
+		if o.ExternalID != "" {
+			p.ExternalID = aws.String(o.ExternalID)
+		}
+	})
+
+	svc := iam.New(c.session, &aws.Config{Credentials: creds})
+	c.assumed[o] = svc
+	return svc, nil
+}
+
 // LastRotated will return the data of the newest key on the IAM account.
 func (c *Client) LastRotated(
 	ctx context.Context,
 	sec secret.Info,
 ) (time.Time, error) {
-	_, newKey, err := c.getAccessKeys(ctx, sec)
+	svc, err := c.iam(sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	_, newKey, err := c.getAccessKeys(ctx, svc, sec)
 	if err != nil {
 		return time.Time{}, err
 	}
@@ -97,7 +219,12 @@ func (c *Client) RotateSecret(
 		"secret", sec.Name(),
 	)
 
-	oldKey, newKey, err := c.getAccessKeys(ctx, sec)
+	svc, err := c.iam(sec)
+	if err != nil {
+		return secret.Map{}, err
+	}
+
+	oldKey, newKey, err := c.getAccessKeys(ctx, svc, sec)
 	if err != nil {
 		return secret.Map{}, fmt.Errorf("failed to retrieve IAM access key metadata for IAM user %q: %w", sec.Name(), err)
 	}
@@ -110,9 +237,15 @@ func (c *Client) RotateSecret(
 		nak = aws.StringValue(newKey.AccessKeyId)
 	}
 
+	if oldKey != nil && oak != nak {
+		c.reportUsage(ctx, svc, sec, oldKey, newKey)
+	} else if newKey != nil {
+		c.reportUsage(ctx, svc, sec, newKey)
+	}
+
 	if oldKey != nil && oak != nak {
 		clearCache(sec)
-		_, err := c.svcIam.DeleteAccessKey(
+		_, err := svc.DeleteAccessKey(
 			&iam.DeleteAccessKeyInput{
 				UserName:    aws.String(sec.Name()),
 				AccessKeyId: oldKey.AccessKeyId,
@@ -125,7 +258,7 @@ func (c *Client) RotateSecret(
 
 	var accessKey, secretKey string
 	clearCache(sec)
-	ck, err := c.svcIam.CreateAccessKey(
+	ck, err := svc.CreateAccessKey(
 		&iam.CreateAccessKeyInput{
 			UserName: aws.String(sec.Name()),
 		},
@@ -143,25 +276,52 @@ func (c *Client) RotateSecret(
 	}, nil
 }
 
-// LastUpdated returns the date of the old key associated with the IAM user.
+// LastUpdated returns the date of the old key associated with the IAM user. If
+// the user has fewer than two keys, there is no old key to disable.
 func (c *Client) LastUpdated(
 	ctx context.Context,
 	sec secret.Info,
 ) (time.Time, error) {
-	oldKey, _, err := c.getAccessKeys(ctx, sec)
+	svc, err := c.iam(sec)
 	if err != nil {
-		return time.Time{}, nil
+		return time.Time{}, err
+	}
+
+	oldKey, newKey, err := c.getAccessKeys(ctx, svc, sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if oldKey == nil || aws.StringValue(oldKey.AccessKeyId) == aws.StringValue(newKey.AccessKeyId) {
+		return time.Time{}, disable.ErrNothingToDisable
 	}
 
 	return aws.TimeValue(oldKey.CreateDate), nil
 }
 
-// DisableSecret performs disabling of the old key on AWS IAM.
+// disabledTagPrefix begins the user tag the time an access key was made
+// inactive is recorded in. The access key ID completes the tag key.
+const disabledTagPrefix = "garotate:disabled:"
+
+// disabledTag returns the key of the user tag the time the access key was made
+// inactive is recorded in.
+func disabledTag(key *iam.AccessKeyMetadata) string {
+	return disabledTagPrefix + aws.StringValue(key.AccessKeyId)
+}
+
+// DisableSecret performs disabling of the old key on AWS IAM. The time the key
+// is made inactive is recorded in a tag on the user, since IAM does not record
+// it, so that deletion can count its retention period from then.
 func (c *Client) DisableSecret(
 	ctx context.Context,
 	sec secret.Info,
 ) error {
-	okey, _, err := c.getAccessKeys(ctx, sec)
+	svc, err := c.iam(sec)
+	if err != nil {
+		return err
+	}
+
+	okey, _, err := c.getAccessKeys(ctx, svc, sec)
 	if err != nil {
 		return fmt.Errorf("failed to retrieve IAM access key metadata for IAM user %q: %w", sec.Name(), err)
 	}
@@ -172,8 +332,10 @@ func (c *Client) DisableSecret(
 		"user", sec.Name(),
 	)
 
+	wasInactive := aws.StringValue(okey.Status) == iam.StatusTypeInactive
+
 	clearCache(sec)
-	_, err = c.svcIam.UpdateAccessKey(
+	_, err = svc.UpdateAccessKey(
 		&iam.UpdateAccessKeyInput{
 			AccessKeyId: okey.AccessKeyId,
 			Status:      aws.String(iam.StatusTypeInactive),
@@ -184,6 +346,269 @@ func (c *Client) DisableSecret(
 		return fmt.Errorf("failed to update access key status to inactive of old IAM access key for use %q: %w", sec.Name(), err)
 	}
 
+	// a key disabled before is left with the time it was first disabled
+	if wasInactive {
+		return nil
+	}
+
+	// the key is inactive now, so failing would only disable it again; without
+	// the tag, deletion counts from the creation of the new key instead
+	_, err = svc.TagUser(
+		&iam.TagUserInput{
+			UserName: aws.String(sec.Name()),
+			Tags: []*iam.Tag{
+				{
+					Key:   aws.String(disabledTag(okey)),
+					Value: aws.String(time.Now().UTC().Format(time.RFC3339)),
+				},
+			},
+		},
+	)
+	if err != nil {
+		logger.Warnw(
+			"failed to record when the old IAM access key was disabled",
+			"user", sec.Name(),
+			"access_key_id", aws.StringValue(okey.AccessKeyId),
+			"error", err,
+		)
+	}
+
+	return nil
+}
+
+// disabledAt returns the time the access key was made inactive as recorded in
+// the tags of the user, if it was recorded.
+func disabledAt(
+	svc iamiface.IAMAPI,
+	sec secret.Info,
+	key *iam.AccessKeyMetadata,
+) (time.Time, bool, error) {
+	tags, err := svc.ListUserTags(
+		&iam.ListUserTagsInput{
+			UserName: aws.String(sec.Name()),
+		},
+	)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to list tags of IAM user %q: %w", sec.Name(), err)
+	}
+
+	name := disabledTag(key)
+	for _, tag := range tags.Tags {
+		if aws.StringValue(tag.Key) != name {
+			continue
+		}
+
+		at, err := time.Parse(time.RFC3339, aws.StringValue(tag.Value))
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("failed to read tag %q of IAM user %q: %w", name, sec.Name(), err)
+		}
+		return at, true, nil
+	}
+
+	return time.Time{}, false, nil
+}
+
+// lastUsed returns the record of the last use of the access key.
+func lastUsed(
+	svc iamiface.IAMAPI,
+	key *iam.AccessKeyMetadata,
+) (*iam.AccessKeyLastUsed, error) {
+	out, err := svc.GetAccessKeyLastUsed(
+		&iam.GetAccessKeyLastUsedInput{
+			AccessKeyId: key.AccessKeyId,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if out.AccessKeyLastUsed == nil {
+		return &iam.AccessKeyLastUsed{}, nil
+	}
+
+	return out.AccessKeyLastUsed, nil
+}
+
+// reportUsage logs the time, service, and region of the last use of each of
+// the access keys of the IAM user. Failing to look up usage is logged, but is
+// not an error.
+func (c *Client) reportUsage(
+	ctx context.Context,
+	svc iamiface.IAMAPI,
+	sec secret.Info,
+	keys ...*iam.AccessKeyMetadata,
+) {
+	logger := config.LoggerFrom(ctx).Sugar()
+	for _, key := range keys {
+		used, err := lastUsed(svc, key)
+		if err != nil {
+			logger.Warnw(
+				"unable to check last use of IAM access key",
+				"user", sec.Name(),
+				"access_key_id", aws.StringValue(key.AccessKeyId),
+				"error", err,
+			)
+			continue
+		}
+
+		logger.Infow(
+			"IAM access key last used",
+			"user", sec.Name(),
+			"access_key_id", aws.StringValue(key.AccessKeyId),
+			"status", aws.StringValue(key.Status),
+			"last_used_ts", aws.TimeValue(used.LastUsedDate),
+			"service", aws.StringValue(used.ServiceName),
+			"region", aws.StringValue(used.Region),
+		)
+	}
+}
+
+// LastUsed returns the time the old access key of the IAM user was last used.
+// If the user has only one key or the old key has never been used, the zero
+// time is returned.
+func (c *Client) LastUsed(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	svc, err := c.iam(sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	oldKey, newKey, err := c.getAccessKeys(ctx, svc, sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if oldKey == nil || newKey == nil || aws.StringValue(oldKey.AccessKeyId) == aws.StringValue(newKey.AccessKeyId) {
+		return time.Time{}, nil
+	}
+
+	used, err := lastUsed(svc, oldKey)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to check last use of old access key for IAM user %q: %w", sec.Name(), err)
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Debugw(
+		"old IAM access key last used",
+		"user", sec.Name(),
+		"access_key_id", aws.StringValue(oldKey.AccessKeyId),
+		"last_used_ts", aws.TimeValue(used.LastUsedDate),
+		"service", aws.StringValue(used.ServiceName),
+		"region", aws.StringValue(used.Region),
+	)
+
+	return aws.TimeValue(used.LastUsedDate), nil
+}
+
+// disabledKey returns the old access key of the user if it is inactive and
+// distinct from the new key, which makes it ready for deletion. Otherwise, it
+// returns nil.
+func disabledKey(oldKey, newKey *iam.AccessKeyMetadata) *iam.AccessKeyMetadata {
+	if oldKey == nil || newKey == nil {
+		return nil
+	}
+
+	if aws.StringValue(oldKey.AccessKeyId) == aws.StringValue(newKey.AccessKeyId) {
+		return nil
+	}
+
+	if aws.StringValue(oldKey.Status) != iam.StatusTypeInactive {
+		return nil
+	}
+
+	return oldKey
+}
+
+// LastDisabled returns the time the old key of the IAM user was made inactive,
+// as recorded in a tag on the user by DisableSecret. If no time was recorded,
+// such as for a key made inactive by hand, the creation date of the new key is
+// returned instead. If there is no inactive key, there is nothing to delete.
+func (c *Client) LastDisabled(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	svc, err := c.iam(sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	oldKey, newKey, err := c.getAccessKeys(ctx, svc, sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	dkey := disabledKey(oldKey, newKey)
+	if dkey == nil {
+		return time.Time{}, disable.ErrNothingToDelete
+	}
+
+	at, ok, err := disabledAt(svc, sec, dkey)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if ok {
+		return at, nil
+	}
+
+	return aws.TimeValue(newKey.CreateDate), nil
+}
+
+// DeleteSecret deletes the old key of the IAM user if it is inactive, which
+// frees the slot it holds so the next rotation does not have to.
+func (c *Client) DeleteSecret(
+	ctx context.Context,
+	sec secret.Info,
+) error {
+	svc, err := c.iam(sec)
+	if err != nil {
+		return err
+	}
+
+	oldKey, newKey, err := c.getAccessKeys(ctx, svc, sec)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve IAM access key metadata for IAM user %q: %w", sec.Name(), err)
+	}
+
+	dkey := disabledKey(oldKey, newKey)
+	if dkey == nil {
+		return nil
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Infow(
+		"deleting inactive IAM account key",
+		"user", sec.Name(),
+		"access_key_id", aws.StringValue(dkey.AccessKeyId),
+	)
+
+	clearCache(sec)
+	_, err = svc.DeleteAccessKey(
+		&iam.DeleteAccessKeyInput{
+			AccessKeyId: dkey.AccessKeyId,
+			UserName:    aws.String(sec.Name()),
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete inactive IAM access key for user %q: %w", sec.Name(), err)
+	}
+
+	_, err = svc.UntagUser(
+		&iam.UntagUserInput{
+			UserName: aws.String(sec.Name()),
+			TagKeys:  []*string{aws.String(disabledTag(dkey))},
+		},
+	)
+	if err != nil {
+		logger.Warnw(
+			"failed to remove the record of when the deleted IAM access key was disabled",
+			"user", sec.Name(),
+			"access_key_id", aws.StringValue(dkey.AccessKeyId),
+			"error", err,
+		)
+	}
+
 	return nil
 }
 
@@ -193,13 +618,14 @@ func (c *Client) DisableSecret(
 // set then the first and second key returned will be equal.
 func (c *Client) getAccessKeys(
 	ctx context.Context,
+	svc iamiface.IAMAPI,
 	sec secret.Info,
 ) (*iam.AccessKeyMetadata, *iam.AccessKeyMetadata, error) {
 	if o, n, ok := getCache(sec); ok {
 		return o, n, nil
 	}
 
-	ak, err := c.svcIam.ListAccessKeys(
+	ak, err := svc.ListAccessKeys(
 		&iam.ListAccessKeysInput{
 			UserName: aws.String(sec.Name()),
 		},
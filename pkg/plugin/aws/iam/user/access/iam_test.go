@@ -0,0 +1,325 @@
+package access
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+)
+
+// fakeIAM keeps the access keys of the users of one account.
+type fakeIAM struct {
+	iamiface.IAMAPI
+
+	next    int
+	listErr error
+	keys    map[string][]*iam.AccessKeyMetadata
+	used    map[string]*iam.AccessKeyLastUsed
+	tags    map[string]map[string]string
+}
+
+func newFakeIAM() *fakeIAM {
+	return &fakeIAM{
+		keys: map[string][]*iam.AccessKeyMetadata{},
+		used: map[string]*iam.AccessKeyLastUsed{},
+		tags: map[string]map[string]string{},
+	}
+}
+
+func (f *fakeIAM) TagUser(in *iam.TagUserInput) (*iam.TagUserOutput, error) {
+	user := aws.StringValue(in.UserName)
+	if f.tags[user] == nil {
+		f.tags[user] = map[string]string{}
+	}
+	for _, t := range in.Tags {
+		f.tags[user][aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+	return &iam.TagUserOutput{}, nil
+}
+
+func (f *fakeIAM) UntagUser(in *iam.UntagUserInput) (*iam.UntagUserOutput, error) {
+	for _, k := range in.TagKeys {
+		delete(f.tags[aws.StringValue(in.UserName)], aws.StringValue(k))
+	}
+	return &iam.UntagUserOutput{}, nil
+}
+
+func (f *fakeIAM) ListUserTags(in *iam.ListUserTagsInput) (*iam.ListUserTagsOutput, error) {
+	var tags []*iam.Tag
+	for k, v := range f.tags[aws.StringValue(in.UserName)] {
+		tags = append(tags, &iam.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	return &iam.ListUserTagsOutput{Tags: tags}, nil
+}
+
+func (f *fakeIAM) GetAccessKeyLastUsed(in *iam.GetAccessKeyLastUsedInput) (*iam.GetAccessKeyLastUsedOutput, error) {
+	used, ok := f.used[aws.StringValue(in.AccessKeyId)]
+	if !ok {
+		used = &iam.AccessKeyLastUsed{
+			Region:      aws.String("N/A"),
+			ServiceName: aws.String("N/A"),
+		}
+	}
+	return &iam.GetAccessKeyLastUsedOutput{AccessKeyLastUsed: used}, nil
+}
+
+func (f *fakeIAM) ListAccessKeys(in *iam.ListAccessKeysInput) (*iam.ListAccessKeysOutput, error) {
+	if f.listErr != nil {
+		return nil, f.listErr
+	}
+	return &iam.ListAccessKeysOutput{
+		AccessKeyMetadata: f.keys[aws.StringValue(in.UserName)],
+	}, nil
+}
+
+func (f *fakeIAM) CreateAccessKey(in *iam.CreateAccessKeyInput) (*iam.CreateAccessKeyOutput, error) {
+	f.next++
+	user := aws.StringValue(in.UserName)
+	id := fmt.Sprintf("AKIA%d", f.next)
+	f.keys[user] = append(f.keys[user], &iam.AccessKeyMetadata{
+		AccessKeyId: aws.String(id),
+		CreateDate:  aws.Time(time.Now().Add(-time.Hour + time.Duration(f.next)*time.Millisecond)),
+		Status:      aws.String(iam.StatusTypeActive),
+		UserName:    in.UserName,
+	})
+	return &iam.CreateAccessKeyOutput{
+		AccessKey: &iam.AccessKey{
+			AccessKeyId:     aws.String(id),
+			SecretAccessKey: aws.String("secret-" + id),
+		},
+	}, nil
+}
+
+func (f *fakeIAM) UpdateAccessKey(in *iam.UpdateAccessKeyInput) (*iam.UpdateAccessKeyOutput, error) {
+	for _, k := range f.keys[aws.StringValue(in.UserName)] {
+		if aws.StringValue(k.AccessKeyId) == aws.StringValue(in.AccessKeyId) {
+			k.Status = in.Status
+		}
+	}
+	return &iam.UpdateAccessKeyOutput{}, nil
+}
+
+func (f *fakeIAM) DeleteAccessKey(in *iam.DeleteAccessKeyInput) (*iam.DeleteAccessKeyOutput, error) {
+	user := aws.StringValue(in.UserName)
+	for i, k := range f.keys[user] {
+		if aws.StringValue(k.AccessKeyId) == aws.StringValue(in.AccessKeyId) {
+			f.keys[user] = append(f.keys[user][:i], f.keys[user][i+1:]...)
+			break
+		}
+	}
+	return &iam.DeleteAccessKeyOutput{}, nil
+}
+
+func TestAssumeRolePerSecret(t *testing.T) {
+	ctx := context.Background()
+
+	local := newFakeIAM()
+	prod := newFakeIAM()
+	prodOpts := Options{
+		RoleARN:     "arn:aws:iam::111111111111:role/garotate",
+		ExternalID:  "xyzzy",
+		SessionName: DefaultSessionName,
+	}
+
+	c := &Client{
+		session:  session.Must(session.NewSession()),
+		svcIam:   local,
+		defaults: DefaultOptions(),
+		assumed:  map[Options]iamiface.IAMAPI{prodOpts: prod},
+	}
+
+	sec := &config.Secret{SecretName: "deploy"}
+	_, err := c.RotateSecret(ctx, sec)
+	require.NoError(t, err)
+	assert.Len(t, local.keys["deploy"], 1, "no role uses the plugin credentials")
+	assert.Empty(t, prod.keys)
+
+	sec = &config.Secret{
+		SecretName: "deploy",
+		Options: map[string]any{
+			"role_arn":    prodOpts.RoleARN,
+			"external_id": prodOpts.ExternalID,
+		},
+	}
+	keys, err := c.RotateSecret(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, "AKIA1", keys[AccessKeyName])
+	assert.Len(t, prod.keys["deploy"], 1, "secret role assumed")
+	assert.Len(t, local.keys["deploy"], 1)
+
+	last, err := c.LastRotated(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, aws.TimeValue(prod.keys["deploy"][0].CreateDate), last)
+
+	// a client is made and kept for each new role
+	other := &config.Secret{
+		SecretName: "deploy",
+		Options:    map[string]any{"role_arn": "arn:aws:iam::222222222222:role/garotate"},
+	}
+	svc, err := c.iam(other)
+	require.NoError(t, err)
+	assert.IsType(t, &iam.IAM{}, svc)
+	again, err := c.iam(other)
+	require.NoError(t, err)
+	assert.Same(t, svc, again)
+	assert.Len(t, c.assumed, 2)
+
+	_, err = c.iam(&config.Secret{
+		SecretName: "deploy",
+		Options:    map[string]any{"external_id": "xyzzy"},
+	})
+	assert.Error(t, err, "external ID without role")
+}
+
+func TestOptionsValidate(t *testing.T) {
+	o := DefaultOptions()
+	assert.NoError(t, o.Validate(), "no role")
+
+	o.ExternalID = "xyzzy"
+	assert.Error(t, o.Validate(), "external ID without role")
+
+	o.RoleARN = "arn:aws:iam::111111111111:role/garotate"
+	assert.NoError(t, o.Validate(), "role with external ID")
+
+	o.SessionName = "has spaces"
+	assert.Error(t, o.Validate(), "bad session name")
+
+	o = DefaultOptions()
+	o.RoleARN = "garotate"
+	assert.Error(t, o.Validate(), "not an ARN")
+}
+
+func TestLastUpdated(t *testing.T) {
+	ctx := context.Background()
+
+	svc := newFakeIAM()
+	c := &Client{
+		svcIam:   svc,
+		defaults: DefaultOptions(),
+		assumed:  map[Options]iamiface.IAMAPI{},
+	}
+
+	sec := &config.Secret{SecretName: "deploy"}
+	_, err := c.LastUpdated(ctx, sec)
+	assert.ErrorIs(t, err, disable.ErrNothingToDisable, "no keys, nothing to disable")
+
+	_, err = c.RotateSecret(ctx, sec)
+	require.NoError(t, err)
+
+	_, err = c.LastUpdated(ctx, sec)
+	assert.ErrorIs(t, err, disable.ErrNothingToDisable, "one key, nothing to disable")
+
+	_, err = c.RotateSecret(ctx, sec)
+	require.NoError(t, err)
+
+	last, err := c.LastUpdated(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, aws.TimeValue(svc.keys["deploy"][0].CreateDate), last, "old key")
+
+	svc.listErr = fmt.Errorf("throttled")
+	_, err = c.LastUpdated(ctx, &config.Secret{SecretName: "other"})
+	assert.Error(t, err, "listing fails")
+	assert.NotErrorIs(t, err, disable.ErrNothingToDisable)
+}
+
+func TestDeleteSecret(t *testing.T) {
+	ctx := context.Background()
+
+	svc := newFakeIAM()
+	c := &Client{
+		svcIam:   svc,
+		defaults: DefaultOptions(),
+		assumed:  map[Options]iamiface.IAMAPI{},
+	}
+
+	sec := &config.Secret{SecretName: "deploy"}
+	_, err := c.RotateSecret(ctx, sec)
+	require.NoError(t, err)
+
+	_, err = c.LastDisabled(ctx, sec)
+	assert.ErrorIs(t, err, disable.ErrNothingToDelete, "one key, nothing to delete")
+
+	_, err = c.RotateSecret(ctx, sec)
+	require.NoError(t, err)
+
+	_, err = c.LastDisabled(ctx, sec)
+	assert.ErrorIs(t, err, disable.ErrNothingToDelete, "old key active, nothing to delete")
+
+	require.NoError(t, c.DeleteSecret(ctx, sec))
+	assert.Len(t, svc.keys["deploy"], 2, "active key is not deleted")
+
+	require.NoError(t, c.DisableSecret(ctx, sec))
+	assert.Equal(t, iam.StatusTypeInactive, aws.StringValue(svc.keys["deploy"][0].Status))
+
+	last, err := c.LastDisabled(ctx, sec)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), last, time.Minute, "disabled just now")
+	assert.True(t, last.After(aws.TimeValue(svc.keys["deploy"][1].CreateDate)), "not when the new key was created")
+
+	// disabling again does not extend the retention period
+	svc.tags["deploy"][disabledTagPrefix+"AKIA1"] = "2022-01-02T03:04:05Z"
+	require.NoError(t, c.DisableSecret(ctx, sec))
+	last, err = c.LastDisabled(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC), last, "first disabled")
+
+	require.NoError(t, c.DeleteSecret(ctx, sec))
+	require.Len(t, svc.keys["deploy"], 1, "inactive key deleted")
+	assert.Equal(t, "AKIA2", aws.StringValue(svc.keys["deploy"][0].AccessKeyId))
+	assert.Empty(t, svc.tags["deploy"], "record of the deleted key removed")
+
+	// a key made inactive by hand has no record
+	_, err = c.RotateSecret(ctx, sec)
+	require.NoError(t, err)
+	svc.keys["deploy"][0].Status = aws.String(iam.StatusTypeInactive)
+	last, err = c.LastDisabled(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, aws.TimeValue(svc.keys["deploy"][1].CreateDate), last, "replaced when the new key was created")
+}
+
+func TestLastUsed(t *testing.T) {
+	ctx := context.Background()
+
+	svc := newFakeIAM()
+	c := &Client{
+		svcIam:   svc,
+		defaults: DefaultOptions(),
+		assumed:  map[Options]iamiface.IAMAPI{},
+	}
+
+	sec := &config.Secret{SecretName: "deploy"}
+	_, err := c.RotateSecret(ctx, sec)
+	require.NoError(t, err)
+
+	used, err := c.LastUsed(ctx, sec)
+	require.NoError(t, err)
+	assert.True(t, used.IsZero(), "only one key, nothing in use to disable")
+
+	_, err = c.RotateSecret(ctx, sec)
+	require.NoError(t, err)
+
+	used, err = c.LastUsed(ctx, sec)
+	require.NoError(t, err)
+	assert.True(t, used.IsZero(), "old key never used")
+
+	lastUsed := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	svc.used["AKIA1"] = &iam.AccessKeyLastUsed{
+		LastUsedDate: aws.Time(lastUsed),
+		Region:       aws.String("us-east-1"),
+		ServiceName:  aws.String("s3"),
+	}
+
+	used, err = c.LastUsed(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, lastUsed, used, "old key recently used")
+}
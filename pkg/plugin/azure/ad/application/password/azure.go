@@ -0,0 +1,241 @@
+package password
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin/internal/jsonapi"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+const (
+	// ClientIDKey is the key the application (client) ID is returned under.
+	ClientIDKey = "AZURE_CLIENT_ID"
+
+	// ClientSecretKey is the key the new client secret is returned under.
+	ClientSecretKey = "AZURE_CLIENT_SECRET"
+
+	// TenantIDKey is the key the tenant ID is returned under.
+	TenantIDKey = "AZURE_TENANT_ID"
+)
+
+// Client implements the rotate.Client and disable.Client interfaces for
+// rotating the client secrets of Microsoft Entra ID app registrations. The
+// secret name is the application (client) ID of the app registration.
+//
+// Each password credential added is given a display name of the configured
+// prefix followed by the time it was added. Only password credentials with that
+// prefix are considered; client secrets added by other means are left alone.
+type Client struct {
+	graph      *jsonapi.Client
+	tenantID   string
+	namePrefix string
+	lifetime   time.Duration
+}
+
+// passwordCredential is the subset of the Microsoft Graph passwordCredential
+// resource used by the client.
+type passwordCredential struct {
+	KeyID         string    `json:"keyId"`
+	DisplayName   string    `json:"displayName"`
+	StartDateTime time.Time `json:"startDateTime"`
+	EndDateTime   time.Time `json:"endDateTime"`
+	SecretText    string    `json:"secretText"`
+}
+
+// graphError is the error body returned by Microsoft Graph.
+type graphError struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// errorMessage returns the message of the error body returned by Microsoft
+// Graph.
+func errorMessage(body []byte) string {
+	var gErr graphError
+	if err := json.Unmarshal(body, &gErr); err != nil {
+		return ""
+	}
+	return gErr.Error.Message
+}
+
+// Name returns "Azure AD application passwords".
+func (c *Client) Name() string {
+	return "Azure AD application passwords"
+}
+
+// Keys returns the AZURE_CLIENT_ID, AZURE_CLIENT_SECRET, and AZURE_TENANT_ID
+// keys.
+func (c *Client) Keys() secret.Map {
+	return secret.Map{
+		ClientIDKey:     "",
+		ClientSecretKey: "",
+		TenantIDKey:     "",
+	}
+}
+
+// call sends a request to the application named by the secret in Microsoft
+// Graph, with the action appended to its path, and decodes the response into
+// out, if out is not nil.
+func (c *Client) call(
+	ctx context.Context,
+	method string,
+	sec secret.Info,
+	action string,
+	in any,
+	out any,
+) error {
+	appID := strings.ReplaceAll(sec.Name(), "'", "''")
+	ref := &url.URL{Path: "v1.0/applications(appId='" + appID + "')" + action}
+	return c.graph.Call(ctx, method, ref.EscapedPath(), nil, nil, in, out)
+}
+
+// passwordCredentials returns the password credentials of the application
+// added by this client, oldest first.
+func (c *Client) passwordCredentials(
+	ctx context.Context,
+	sec secret.Info,
+) ([]passwordCredential, error) {
+	var app struct {
+		PasswordCredentials []passwordCredential `json:"passwordCredentials"`
+	}
+
+	err := c.call(ctx, http.MethodGet, sec, "", nil, &app)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up Azure AD application %q: %w", sec.Name(), err)
+	}
+
+	var creds []passwordCredential
+	for _, pc := range app.PasswordCredentials {
+		if strings.HasPrefix(pc.DisplayName, c.namePrefix+" ") {
+			creds = append(creds, pc)
+		}
+	}
+
+	sort.Slice(creds, func(i, j int) bool {
+		if creds[i].StartDateTime.Equal(creds[j].StartDateTime) {
+			return creds[i].KeyID < creds[j].KeyID
+		}
+		return creds[i].StartDateTime.Before(creds[j].StartDateTime)
+	})
+
+	return creds, nil
+}
+
+// LastRotated returns the time the newest password credential added by this
+// client became valid. If there is none, the zero time is returned.
+func (c *Client) LastRotated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	creds, err := c.passwordCredentials(ctx, sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if len(creds) == 0 {
+		return time.Time{}, nil
+	}
+
+	return creds[len(creds)-1].StartDateTime, nil
+}
+
+// RotateSecret adds a new password credential to the application, valid for
+// the configured lifetime. The older client secrets keep working until
+// disabled.
+func (c *Client) RotateSecret(
+	ctx context.Context,
+	sec secret.Info,
+) (secret.Map, error) {
+	now := time.Now().UTC()
+	in := map[string]any{
+		"passwordCredential": map[string]any{
+			"displayName": c.namePrefix + " " + now.Format(time.RFC3339),
+			"endDateTime": now.Add(c.lifetime),
+		},
+	}
+
+	var pc passwordCredential
+	err := c.call(ctx, http.MethodPost, sec, "/addPassword", in, &pc)
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to add password to Azure AD application %q: %w", sec.Name(), err)
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Infow(
+		"added Azure AD application password",
+		"secret", sec.Name(),
+		"client", c.Name(),
+		"key_id", pc.KeyID,
+		"expires", pc.EndDateTime,
+	)
+
+	return secret.Map{
+		ClientIDKey:     sec.Name(),
+		ClientSecretKey: pc.SecretText,
+		TenantIDKey:     c.tenantID,
+	}, nil
+}
+
+// LastUpdated returns the time the newest password credential became valid,
+// which is when the older ones became inactive. If there is only one, there is
+// nothing to disable.
+func (c *Client) LastUpdated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	creds, err := c.passwordCredentials(ctx, sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if len(creds) < 2 {
+		return time.Time{}, disable.ErrNothingToDisable
+	}
+
+	return creds[len(creds)-1].StartDateTime, nil
+}
+
+// DisableSecret removes every password credential added by this client except
+// the newest.
+func (c *Client) DisableSecret(
+	ctx context.Context,
+	sec secret.Info,
+) error {
+	creds, err := c.passwordCredentials(ctx, sec)
+	if err != nil {
+		return err
+	}
+
+	if len(creds) < 2 {
+		return nil
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	for _, pc := range creds[:len(creds)-1] {
+		logger.Infow(
+			"removing old Azure AD application password",
+			"secret", sec.Name(),
+			"client", c.Name(),
+			"key_id", pc.KeyID,
+		)
+
+		in := map[string]string{"keyId": pc.KeyID}
+		err := c.call(ctx, http.MethodPost, sec, "/removePassword", in, nil)
+		if err != nil {
+			return fmt.Errorf("failed to remove password %q from Azure AD application %q: %w", pc.KeyID, sec.Name(), err)
+		}
+	}
+
+	return nil
+}
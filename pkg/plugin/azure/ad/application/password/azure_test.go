@@ -0,0 +1,186 @@
+package password
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin"
+)
+
+const (
+	testTenant = "00000000-0000-0000-0000-000000000001"
+	testApp    = "00000000-0000-0000-0000-000000000002"
+)
+
+// fakeGraph serves a token endpoint and the password credential endpoints of
+// Microsoft Graph for a single application.
+type fakeGraph struct {
+	mu    sync.Mutex
+	next  int
+	creds []passwordCredential
+}
+
+func (f *fakeGraph) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == "/login/"+testTenant+"/oauth2/v2.0/token" {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"token","token_type":"Bearer","expires_in":3600}`))
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	const app = "/graph/v1.0/applications(appId='" + testApp + "')"
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == app:
+		_ = json.NewEncoder(w).Encode(map[string]any{"passwordCredentials": f.creds})
+
+	case r.Method == http.MethodPost && r.URL.Path == app+"/addPassword":
+		var in struct {
+			PasswordCredential passwordCredential `json:"passwordCredential"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&in)
+
+		f.next++
+		pc := in.PasswordCredential
+		pc.KeyID = fmt.Sprintf("key-%d", f.next)
+		pc.StartDateTime = time.Now().UTC().Add(time.Duration(f.next) * time.Millisecond)
+		f.creds = append(f.creds, pc)
+
+		pc.SecretText = fmt.Sprintf("secret-%d", f.next)
+		_ = json.NewEncoder(w).Encode(pc)
+
+	case r.Method == http.MethodPost && r.URL.Path == app+"/removePassword":
+		var in struct {
+			KeyID string `json:"keyId"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&in)
+
+		for i, pc := range f.creds {
+			if pc.KeyID == in.KeyID {
+				f.creds = append(f.creds[:i], f.creds[i+1:]...)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusBadRequest)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":{"code":"Request_ResourceNotFound","message":"not found"}}`))
+	}
+}
+
+func TestRotateAndDisable(t *testing.T) {
+	ctx := context.Background()
+	graph := &fakeGraph{
+		creds: []passwordCredential{
+			{KeyID: "manual", DisplayName: "added by hand", StartDateTime: time.Now().Add(-time.Hour)},
+		},
+	}
+	srv := httptest.NewServer(graph)
+	t.Cleanup(srv.Close)
+
+	inst, err := plugin.Build(ctx, &config.Plugin{
+		Name:    "azure",
+		Package: "github.com/zostay/garotate/pkg/plugin/azure/ad/application/password",
+		Options: map[string]any{
+			"tenant_id":     testTenant,
+			"client_id":     "admin",
+			"client_secret": "admin-secret",
+			"graph_url":     srv.URL + "/graph",
+			"login_url":     srv.URL + "/login",
+			"lifetime":      "720h",
+		},
+	})
+	require.NoError(t, err)
+	c := inst.(*Client)
+
+	sec := &config.Secret{SecretName: testApp}
+
+	last, err := c.LastRotated(ctx, sec)
+	require.NoError(t, err)
+	assert.True(t, last.IsZero(), "other client secrets are ignored")
+
+	keys, err := c.RotateSecret(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, testApp, keys[ClientIDKey])
+	assert.Equal(t, "secret-1", keys[ClientSecretKey])
+	assert.Equal(t, testTenant, keys[TenantIDKey])
+	assert.WithinDuration(t, time.Now().Add(720*time.Hour), graph.creds[1].EndDateTime, time.Minute, "lifetime")
+
+	_, err = c.LastUpdated(ctx, sec)
+	assert.ErrorIs(t, err, disable.ErrNothingToDisable, "nothing to disable yet")
+
+	_, err = c.RotateSecret(ctx, sec)
+	require.NoError(t, err)
+
+	last, err = c.LastRotated(ctx, sec)
+	require.NoError(t, err)
+	assert.True(t, graph.creds[2].StartDateTime.Equal(last), "newest password")
+
+	upd, err := c.LastUpdated(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, last, upd, "old password inactive since rotation")
+
+	require.NoError(t, c.DisableSecret(ctx, sec))
+
+	require.Len(t, graph.creds, 2)
+	assert.Equal(t, "manual", graph.creds[0].KeyID, "other client secret kept")
+	assert.Equal(t, "key-2", graph.creds[1].KeyID, "newest password kept")
+
+	_, err = c.RotateSecret(ctx, &config.Secret{SecretName: "missing"})
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestAppIDQuoting(t *testing.T) {
+	ctx := context.Background()
+
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login/"+testTenant+"/oauth2/v2.0/token" {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"access_token":"token","token_type":"Bearer","expires_in":3600}`))
+			return
+		}
+
+		paths = append(paths, r.URL.Path)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":{"code":"Request_BadRequest","message":"Invalid object identifier"}}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	inst, err := plugin.Build(ctx, &config.Plugin{
+		Name:    "azure",
+		Package: "github.com/zostay/garotate/pkg/plugin/azure/ad/application/password",
+		Options: map[string]any{
+			"tenant_id":     testTenant,
+			"client_id":     "admin",
+			"client_secret": "admin-secret",
+			"graph_url":     srv.URL + "/graph",
+			"login_url":     srv.URL + "/login",
+		},
+	})
+	require.NoError(t, err)
+	c := inst.(*Client)
+
+	_, err = c.LastRotated(ctx, &config.Secret{SecretName: "o'brien app"})
+	assert.ErrorContains(t, err, "Invalid object identifier (400 Bad Request)", "Graph error message")
+	assert.Equal(t, []string{"/graph/v1.0/applications(appId='o''brien app')"}, paths, "quote doubled")
+}
@@ -0,0 +1,153 @@
+package password
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2/clientcredentials"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/plugin/internal/jsonapi"
+)
+
+const (
+	// DefaultGraphURL is the Microsoft Graph endpoint used if no graph_url is
+	// configured.
+	DefaultGraphURL = "https://graph.microsoft.com/"
+
+	// DefaultLoginURL is the Microsoft identity platform endpoint used to get
+	// tokens if no login_url is configured.
+	DefaultLoginURL = "https://login.microsoftonline.com/"
+
+	// DefaultDisplayNamePrefix begins the display name of every password
+	// credential added if no prefix is configured.
+	DefaultDisplayNamePrefix = "garotate"
+
+	// DefaultLifetime is how long new password credentials are valid if no
+	// lifetime is configured.
+	DefaultLifetime = 180 * 24 * time.Hour
+)
+
+// builder implements the plugin.Builder interface and provides the factory
+// method for constructing a Client.
+type builder struct{}
+
+// options are the plugin options accepted in the configuration.
+type options struct {
+	TenantID          string        `mapstructure:"tenant_id"`
+	ClientID          string        `mapstructure:"client_id"`
+	ClientSecret      string        `mapstructure:"client_secret"`
+	GraphURL          string        `mapstructure:"graph_url"`
+	LoginURL          string        `mapstructure:"login_url"`
+	DisplayNamePrefix string        `mapstructure:"display_name_prefix"`
+	Lifetime          time.Duration `mapstructure:"lifetime"`
+	NoAuth            bool          `mapstructure:"no_auth"`
+}
+
+// parseURL parses a URL option, making sure it ends with a slash so that
+// references resolve beneath it.
+func parseURL(name, raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("the Azure AD application password plugin %s option must be a URL, but got %q", name, raw)
+	}
+
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+
+	return u, nil
+}
+
+// Build constructs and returns an Azure AD application password client.
+func (b *builder) Build(
+	ctx context.Context,
+	c *config.Plugin,
+) (plugin.Instance, error) {
+	opts := options{
+		GraphURL:          DefaultGraphURL,
+		LoginURL:          DefaultLoginURL,
+		DisplayNamePrefix: DefaultDisplayNamePrefix,
+		Lifetime:          DefaultLifetime,
+	}
+	err := c.DecodeOptions(&opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Azure AD application password plugin options: %w", err)
+	}
+
+	if opts.TenantID == "" {
+		opts.TenantID = os.Getenv("AZURE_TENANT_ID")
+	}
+	if opts.TenantID == "" {
+		return nil, errors.New("the Azure AD application password plugin requires a tenant_id option or AZURE_TENANT_ID environment variable")
+	}
+
+	if opts.DisplayNamePrefix == "" {
+		return nil, errors.New("the Azure AD application password plugin display_name_prefix option must not be empty")
+	}
+
+	if opts.Lifetime <= 0 {
+		return nil, fmt.Errorf("the Azure AD application password plugin lifetime option must be positive, but got %v", opts.Lifetime)
+	}
+
+	graph, err := parseURL("graph_url", opts.GraphURL)
+	if err != nil {
+		return nil, err
+	}
+
+	hc := http.DefaultClient
+	if !opts.NoAuth {
+		if opts.ClientID == "" {
+			opts.ClientID = os.Getenv("AZURE_CLIENT_ID")
+		}
+		if opts.ClientSecret == "" {
+			opts.ClientSecret = os.Getenv("AZURE_CLIENT_SECRET")
+		}
+		if opts.ClientID == "" || opts.ClientSecret == "" {
+			return nil, errors.New("the Azure AD application password plugin requires client_id and client_secret options or AZURE_CLIENT_ID and AZURE_CLIENT_SECRET environment variables")
+		}
+
+		login, err := parseURL("login_url", opts.LoginURL)
+		if err != nil {
+			return nil, err
+		}
+
+		tokenURL := login.ResolveReference(&url.URL{
+			Path: opts.TenantID + "/oauth2/v2.0/token",
+		})
+		scope := graph.ResolveReference(&url.URL{Path: ".default"})
+
+		cc := &clientcredentials.Config{
+			ClientID:     opts.ClientID,
+			ClientSecret: opts.ClientSecret,
+			TokenURL:     tokenURL.String(),
+			Scopes:       []string{scope.String()},
+		}
+		hc = cc.Client(ctx)
+	}
+
+	return &Client{
+		graph: &jsonapi.Client{
+			HTTP:         hc,
+			Base:         graph,
+			ErrorMessage: errorMessage,
+		},
+		tenantID:   opts.TenantID,
+		namePrefix: opts.DisplayNamePrefix,
+		lifetime:   opts.Lifetime,
+	}, nil
+}
+
+// init registers the plugin.
+func init() {
+	pkg := reflect.TypeOf(Client{}).PkgPath()
+	plugin.Register(pkg, new(builder))
+}
@@ -0,0 +1,6 @@
+// Package password provides a plugin which implements both the rotate.Client
+// and the disable.Client and is used to rotate the client secrets of Microsoft
+// Entra ID (Azure AD) app registrations through Microsoft Graph. Rotation adds
+// a new password credential to the application. Disablement removes the older
+// password credentials it added.
+package password
@@ -3,9 +3,11 @@ package plugin
 import (
 	"context"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/errors"
 )
 
 // Manager provides a mechanism for building plugis lazily and caching them.
@@ -36,6 +38,9 @@ func NewManager(plugins config.PluginList) *Manager {
 //
 // If an error occurs building the plugin, it will return an nil instance and an
 // error.
+//
+// The context passed to the plugin's builder carries this Manager, which may be
+// retrieved with ManagerFrom.
 func (m *Manager) Instance(ctx context.Context, name string) (Instance, error) {
 	if inst, ok := m.cache[name]; ok {
 		return inst, nil
@@ -47,7 +52,7 @@ func (m *Manager) Instance(ctx context.Context, name string) (Instance, error) {
 		return nil, fmt.Errorf("no plugin configuration found for name %q", name)
 	}
 
-	inst, err := Build(ctx, &c)
+	inst, err := Build(WithManager(ctx, m), &c)
 	if err != nil {
 		return nil, fmt.Errorf("error while building plugin %q in package %q: %w", name, c.Package, err)
 	}
@@ -56,3 +61,23 @@ func (m *Manager) Instance(ctx context.Context, name string) (Instance, error) {
 
 	return inst, nil
 }
+
+// Close calls Close on every cached instance that implements io.Closer, such as
+// plugins that run a separate process, and empties the cache. It returns an
+// error aggregating any errors returned.
+func (m *Manager) Close() error {
+	var errs []error
+	for name, inst := range m.cache {
+		if c, ok := inst.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("error while closing plugin %q: %w", name, err))
+			}
+		}
+		delete(m.cache, name)
+	}
+
+	if len(errs) > 0 {
+		return errors.NewAggregate(errs)
+	}
+	return nil
+}
@@ -27,6 +27,37 @@ func (*nopInstance) Name() string {
 	return "nop"
 }
 
+type managerPlugin struct{}
+type managerInstance struct {
+	m *Manager
+}
+
+func (*managerPlugin) Build(ctx context.Context, c *config.Plugin) (Instance, error) {
+	return &managerInstance{ManagerFrom(ctx)}, nil
+}
+
+func (*managerInstance) Name() string {
+	return "manager"
+}
+
+type closePlugin struct{}
+type closeInstance struct {
+	closed int
+}
+
+func (*closePlugin) Build(ctx context.Context, c *config.Plugin) (Instance, error) {
+	return new(closeInstance), nil
+}
+
+func (*closeInstance) Name() string {
+	return "close"
+}
+
+func (c *closeInstance) Close() error {
+	c.closed++
+	return fmt.Errorf("close stuff")
+}
+
 func init() {
 	Register(
 		"github.com/zostay/garotate/pkg/plugin/builder_test/error",
@@ -36,6 +67,16 @@ func init() {
 		"github.com/zostay/garotate/pkg/plugin/builder_test/nop",
 		new(nopPlugin),
 	)
+	Register(
+		"github.com/zostay/garotate/pkg/plugin/builder_test/manager",
+		new(managerPlugin),
+	)
+	Register(
+		"github.com/zostay/garotate/pkg/plugin/builder_test/close",
+		new(closePlugin),
+	)
+	RegisterPrefix("builder_test_error:", new(errorPlugin))
+	RegisterPrefix("builder_test_error:nop:", new(nopPlugin))
 }
 
 func TestSadMissingPlugin(t *testing.T) {
@@ -94,6 +135,52 @@ func TestHappyPlugin(t *testing.T) {
 	assert.Same(t, inst, inst2, "second retrieval was the cached value")
 }
 
+func TestHappyClose(t *testing.T) {
+	m := NewManager(
+		config.PluginList{
+			"nop": config.Plugin{
+				Package: "github.com/zostay/garotate/pkg/plugin/builder_test/nop",
+			},
+			"close": config.Plugin{
+				Package: "github.com/zostay/garotate/pkg/plugin/builder_test/close",
+			},
+		},
+	)
+	require.NotNil(t, m, "got a manager")
+
+	ctx := context.Background()
+	_, err := m.Instance(ctx, "nop")
+	require.NoError(t, err, "no error building nop")
+	inst, err := m.Instance(ctx, "close")
+	require.NoError(t, err, "no error building close")
+
+	err = m.Close()
+	assert.ErrorContains(t, err, "close stuff", "error from closing is returned")
+	assert.Equal(t, 1, inst.(*closeInstance).closed, "instance was closed")
+
+	inst2, err := m.Instance(ctx, "close")
+	require.NoError(t, err, "no error building close again")
+	assert.NotSame(t, inst, inst2, "closed instance is no longer cached")
+}
+
+func TestHappyManagerInContext(t *testing.T) {
+	m := NewManager(
+		config.PluginList{
+			"manager": config.Plugin{
+				Package: "github.com/zostay/garotate/pkg/plugin/builder_test/manager",
+			},
+		},
+	)
+	require.NotNil(t, m, "got a manager")
+
+	ctx := context.Background()
+	assert.Nil(t, ManagerFrom(ctx), "no manager in an empty context")
+
+	inst, err := m.Instance(ctx, "manager")
+	require.NoError(t, err, "no error building manager")
+	assert.Same(t, m, inst.(*managerInstance).m, "builder got the manager")
+}
+
 func TestSadBuildFuncMissingPlugin(t *testing.T) {
 	ctx := context.Background()
 	inst, err := Build(ctx, &config.Plugin{
@@ -116,3 +203,30 @@ func TestSadPanicOnReRegister(t *testing.T) {
 		"registering a plugin again results in panic",
 	)
 }
+
+func TestHappyPrefixPlugin(t *testing.T) {
+	ctx := context.Background()
+	inst, err := Build(ctx, &config.Plugin{
+		Name:    "foo",
+		Package: "builder_test_error:nop:anything",
+	})
+	assert.NoError(t, err, "no error with longest prefix")
+	require.NotNil(t, inst, "plugin works with longest prefix")
+	assert.Equal(t, "nop", inst.Name(), "got the expected plugin")
+
+	inst, err = Build(ctx, &config.Plugin{
+		Name:    "foo",
+		Package: "builder_test_error:anything",
+	})
+	assert.Nil(t, inst, "shorter prefix picks the other plugin")
+	assert.ErrorContains(t, err, "bad stuff", "error from the shorter prefix plugin")
+}
+
+func TestSadPanicOnReRegisterPrefix(t *testing.T) {
+	assert.Panics(t,
+		func() {
+			RegisterPrefix("builder_test_error:", new(nopPlugin))
+		},
+		"registering a plugin prefix again results in panic",
+	)
+}
@@ -0,0 +1,81 @@
+package roll
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+
+	"golang.org/x/oauth2"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/plugin/internal/jsonapi"
+)
+
+// DefaultAPIURL is the Cloudflare API endpoint used if no api_url is configured.
+const DefaultAPIURL = "https://api.cloudflare.com/client/v4/"
+
+// builder implements the plugin.Builder interface and provides the factory
+// method for constructing a Client.
+type builder struct{}
+
+// options are the plugin options accepted in the configuration.
+type options struct {
+	APIURL    string `mapstructure:"api_url"`
+	APIToken  string `mapstructure:"api_token"`
+	AccountID string `mapstructure:"account_id"`
+}
+
+// Build constructs and returns a Cloudflare API token client.
+func (b *builder) Build(
+	ctx context.Context,
+	c *config.Plugin,
+) (plugin.Instance, error) {
+	opts := options{
+		APIURL: DefaultAPIURL,
+	}
+	err := c.DecodeOptions(&opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Cloudflare API token plugin options: %w", err)
+	}
+
+	api, err := url.Parse(opts.APIURL)
+	if err != nil || api.Host == "" {
+		return nil, fmt.Errorf("the Cloudflare API token plugin api_url option must be a URL, but got %q", opts.APIURL)
+	}
+	if !strings.HasSuffix(api.Path, "/") {
+		api.Path += "/"
+	}
+
+	if opts.APIToken == "" {
+		opts.APIToken = os.Getenv("CLOUDFLARE_API_TOKEN")
+	}
+	if opts.APIToken == "" {
+		return nil, errors.New("the Cloudflare API token plugin requires an api_token option or CLOUDFLARE_API_TOKEN environment variable")
+	}
+
+	ts := oauth2.StaticTokenSource(
+		&oauth2.Token{
+			AccessToken: opts.APIToken,
+		},
+	)
+
+	return &Client{
+		api: &jsonapi.Client{
+			HTTP:         oauth2.NewClient(ctx, ts),
+			Base:         api,
+			ErrorMessage: errorMessage,
+		},
+		accountID: opts.AccountID,
+	}, nil
+}
+
+// init registers the plugin.
+func init() {
+	pkg := reflect.TypeOf(Client{}).PkgPath()
+	plugin.Register(pkg, new(builder))
+}
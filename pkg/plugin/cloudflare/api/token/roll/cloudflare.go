@@ -0,0 +1,170 @@
+package roll
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin/internal/jsonapi"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+// TokenKey is the key the new token value is returned under.
+const TokenKey = "CLOUDFLARE_API_TOKEN"
+
+// Client implements the rotate.Client interface for rolling Cloudflare API
+// tokens. The secret name is the ID of the token.
+//
+// Tokens owned by a user are rolled unless an account ID is configured for the
+// plugin or set as an account_id secret option, in which case the token is
+// taken to be owned by that account.
+type Client struct {
+	api       *jsonapi.Client
+	accountID string
+}
+
+// secretOptions are the options that may be set on each secret.
+type secretOptions struct {
+	AccountID string `mapstructure:"account_id"`
+}
+
+// token is the subset of the Cloudflare API token resource used by the client.
+type token struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Status     string    `json:"status"`
+	ModifiedOn time.Time `json:"modified_on"`
+}
+
+// response is the envelope of every Cloudflare API response.
+type response struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+// errorMessage returns the errors reported in the response.
+func (r *response) errorMessage() string {
+	msgs := make([]string, len(r.Errors))
+	for i, e := range r.Errors {
+		msgs[i] = fmt.Sprintf("%s (%d)", e.Message, e.Code)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// errorMessage returns the errors reported in the body of an unsuccessful
+// response.
+func errorMessage(body []byte) string {
+	var r response
+	if err := json.Unmarshal(body, &r); err != nil {
+		return ""
+	}
+	return r.errorMessage()
+}
+
+// Name returns "Cloudflare API tokens".
+func (c *Client) Name() string {
+	return "Cloudflare API tokens"
+}
+
+// Keys returns the CLOUDFLARE_API_TOKEN key.
+func (c *Client) Keys() secret.Map {
+	return secret.Map{
+		TokenKey: "",
+	}
+}
+
+// tokenPath returns the API path of the token named by the secret.
+func (c *Client) tokenPath(sec secret.Info) (string, error) {
+	o := secretOptions{AccountID: c.accountID}
+	if so, ok := sec.(secret.Options); ok {
+		if err := so.DecodeOptions(&o); err != nil {
+			return "", fmt.Errorf("failed to read Cloudflare API token options of secret %q: %w", sec.Name(), err)
+		}
+	}
+
+	id := url.PathEscape(sec.Name())
+	if o.AccountID != "" {
+		return "accounts/" + url.PathEscape(o.AccountID) + "/tokens/" + id, nil
+	}
+
+	return "user/tokens/" + id, nil
+}
+
+// call sends a request to the Cloudflare API at the given path, relative to the
+// API endpoint, and decodes the result into out.
+func (c *Client) call(
+	ctx context.Context,
+	method string,
+	p string,
+	in any,
+	out any,
+) error {
+	var r response
+	if err := c.api.Call(ctx, method, p, nil, nil, in, &r); err != nil {
+		return err
+	}
+
+	if !r.Success {
+		return fmt.Errorf("request failed: %s", r.errorMessage())
+	}
+
+	return json.Unmarshal(r.Result, out)
+}
+
+// LastRotated returns the time the token was last modified, which is when it
+// was last rolled, if it has been rolled since its permissions were changed.
+func (c *Client) LastRotated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	p, err := c.tokenPath(sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var t token
+	err = c.call(ctx, http.MethodGet, p, nil, &t)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to look up Cloudflare API token %q: %w", sec.Name(), err)
+	}
+
+	return t.ModifiedOn, nil
+}
+
+// RotateSecret rolls the token and returns the new value. The old value stops
+// working immediately.
+func (c *Client) RotateSecret(
+	ctx context.Context,
+	sec secret.Info,
+) (secret.Map, error) {
+	p, err := c.tokenPath(sec)
+	if err != nil {
+		return secret.Map{}, err
+	}
+
+	var value string
+	err = c.call(ctx, http.MethodPut, p+"/value", struct{}{}, &value)
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to roll Cloudflare API token %q: %w", sec.Name(), err)
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Infow(
+		"rolled Cloudflare API token",
+		"secret", sec.Name(),
+		"client", c.Name(),
+	)
+
+	return secret.Map{
+		TokenKey: value,
+	}, nil
+}
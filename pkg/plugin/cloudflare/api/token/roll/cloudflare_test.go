@@ -0,0 +1,115 @@
+package roll
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+)
+
+func TestRollToken(t *testing.T) {
+	ctx := context.Background()
+	modified := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer admin-token" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"success":false,"errors":[{"code":9109,"message":"Invalid access token"}]}`))
+			return
+		}
+
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		switch r.Method + " " + r.URL.Path {
+		case "GET /client/v4/user/tokens/abc", "GET /client/v4/accounts/acct/tokens/abc":
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"success": true,
+				"result":  token{ID: "abc", Name: "deploy", Status: "active", ModifiedOn: modified},
+			})
+		case "PUT /client/v4/user/tokens/abc/value":
+			modified = time.Date(2023, 2, 3, 4, 5, 6, 0, time.UTC)
+			_, _ = w.Write([]byte(`{"success":true,"errors":[],"result":"new-token-value"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"success":false,"errors":[{"code":1000,"message":"not found"}]}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	inst, err := plugin.Build(ctx, &config.Plugin{
+		Name:    "cloudflare",
+		Package: "github.com/zostay/garotate/pkg/plugin/cloudflare/api/token/roll",
+		Options: map[string]any{
+			"api_url":   srv.URL + "/client/v4",
+			"api_token": "admin-token",
+		},
+	})
+	require.NoError(t, err)
+	c := inst.(*Client)
+
+	sec := &config.Secret{SecretName: "abc"}
+
+	last, err := c.LastRotated(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, modified, last)
+
+	keys, err := c.RotateSecret(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, "new-token-value", keys[TokenKey])
+
+	last, err = c.LastRotated(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, modified, last, "modified by roll")
+
+	_, err = c.LastRotated(ctx, &config.Secret{
+		SecretName: "abc",
+		Options:    map[string]any{"account_id": "acct"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "GET /client/v4/accounts/acct/tokens/abc", paths[len(paths)-1], "account owned token")
+
+	_, err = c.RotateSecret(ctx, &config.Secret{SecretName: "missing"})
+	assert.ErrorContains(t, err, "not found (1000)")
+}
+
+func TestRequestFailed(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			// Cloudflare reports some failures in the envelope of a 200
+			_, _ = w.Write([]byte(`{"success":false,"errors":[{"code":1001,"message":"token is disabled"},{"code":1002,"message":"try again"}],"result":null}`))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"success":false,"errors":[{"code":9109,"message":"Unauthorized to access requested resource"}]}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	inst, err := plugin.Build(ctx, &config.Plugin{
+		Name:    "cloudflare",
+		Package: "github.com/zostay/garotate/pkg/plugin/cloudflare/api/token/roll",
+		Options: map[string]any{
+			"api_url":   srv.URL + "/client/v4",
+			"api_token": "admin-token",
+		},
+	})
+	require.NoError(t, err)
+	c := inst.(*Client)
+
+	sec := &config.Secret{SecretName: "abc"}
+
+	_, err = c.LastRotated(ctx, sec)
+	assert.ErrorContains(t, err, "request failed: token is disabled (1001); try again (1002)", "unsuccessful envelope")
+
+	_, err = c.RotateSecret(ctx, sec)
+	assert.ErrorContains(t, err, "Unauthorized to access requested resource (9109) (403 Forbidden)", "error status")
+}
@@ -0,0 +1,4 @@
+// Package roll provides a plugin which implements the rotate.Client and is used
+// to roll Cloudflare API tokens. Rolling replaces the value of the token while
+// keeping its ID and permissions, so the old value stops working immediately.
+package roll
@@ -0,0 +1,19 @@
+package plugin
+
+import "context"
+
+type managerKey struct{}
+
+// WithManager puts the given Manager into the given context and returns the
+// modified context. The Manager does this itself when building instances, so
+// plugins that need other plugins may find them with ManagerFrom.
+func WithManager(p context.Context, m *Manager) context.Context {
+	return context.WithValue(p, managerKey{}, m)
+}
+
+// ManagerFrom returns the *Manager for the given context or nil if no Manager
+// has been attached to the context.
+func ManagerFrom(ctx context.Context) *Manager {
+	m, _ := ctx.Value(managerKey{}).(*Manager)
+	return m
+}
@@ -0,0 +1,117 @@
+package key
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/plugin/internal/jsonapi"
+)
+
+const (
+	// DefaultSite is the Datadog site used if no site is configured.
+	DefaultSite = "datadoghq.com"
+
+	// DefaultNameSuffix follows the secret name in the name of every key
+	// created if no suffix is configured.
+	DefaultNameSuffix = "garotate"
+)
+
+// builder implements the plugin.Builder interface and provides the factory
+// method for constructing a Client.
+type builder struct{}
+
+// options are the plugin options accepted in the configuration.
+type options struct {
+	Site       string   `mapstructure:"site"`
+	APIURL     string   `mapstructure:"api_url"`
+	APIKey     string   `mapstructure:"api_key"`
+	AppKey     string   `mapstructure:"app_key"`
+	KeyType    string   `mapstructure:"key_type"`
+	NameSuffix string   `mapstructure:"name_suffix"`
+	Scopes     []string `mapstructure:"scopes"`
+}
+
+// Build constructs and returns a Datadog key client.
+func (b *builder) Build(
+	ctx context.Context,
+	c *config.Plugin,
+) (plugin.Instance, error) {
+	opts := options{
+		KeyType:    KeyTypeAPI,
+		NameSuffix: DefaultNameSuffix,
+	}
+	err := c.DecodeOptions(&opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Datadog plugin options: %w", err)
+	}
+
+	if opts.Site == "" {
+		opts.Site = os.Getenv("DD_SITE")
+	}
+	if opts.Site == "" {
+		opts.Site = DefaultSite
+	}
+	if opts.APIURL == "" {
+		opts.APIURL = "https://api." + opts.Site + "/"
+	}
+
+	api, err := url.Parse(opts.APIURL)
+	if err != nil || api.Host == "" {
+		return nil, fmt.Errorf("the Datadog plugin api_url option must be a URL, but got %q", opts.APIURL)
+	}
+	if !strings.HasSuffix(api.Path, "/") {
+		api.Path += "/"
+	}
+
+	if opts.APIKey == "" {
+		opts.APIKey = os.Getenv("DD_ADMIN_API_KEY")
+	}
+	if opts.AppKey == "" {
+		opts.AppKey = os.Getenv("DD_ADMIN_APP_KEY")
+	}
+	if opts.APIKey == "" || opts.AppKey == "" {
+		return nil, errors.New("the Datadog plugin requires api_key and app_key options or DD_ADMIN_API_KEY and DD_ADMIN_APP_KEY environment variables")
+	}
+
+	switch opts.KeyType {
+	case KeyTypeAPI:
+		if len(opts.Scopes) > 0 {
+			return nil, errors.New("the Datadog plugin scopes option only applies to application keys")
+		}
+	case KeyTypeApplication:
+	default:
+		return nil, fmt.Errorf("the Datadog plugin key_type option must be %q or %q, but got %q", KeyTypeAPI, KeyTypeApplication, opts.KeyType)
+	}
+
+	if opts.NameSuffix == "" {
+		return nil, errors.New("the Datadog plugin name_suffix option must not be empty")
+	}
+
+	return &Client{
+		api: &jsonapi.Client{
+			Base: api,
+			Header: http.Header{
+				"Dd-Api-Key":         {opts.APIKey},
+				"Dd-Application-Key": {opts.AppKey},
+			},
+			ErrorMessage: errorMessage,
+		},
+		keyType:    opts.KeyType,
+		nameSuffix: opts.NameSuffix,
+		scopes:     opts.Scopes,
+	}, nil
+}
+
+// init registers the plugin.
+func init() {
+	pkg := reflect.TypeOf(Client{}).PkgPath()
+	plugin.Register(pkg, new(builder))
+}
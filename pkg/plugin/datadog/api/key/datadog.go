@@ -0,0 +1,290 @@
+package key
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin/internal/jsonapi"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+const (
+	// KeyTypeAPI selects rotation of API keys, which are returned as
+	// DD_API_KEY.
+	KeyTypeAPI = "api"
+
+	// KeyTypeApplication selects rotation of application keys, which are
+	// returned as DD_APP_KEY.
+	KeyTypeApplication = "application"
+
+	// APIKey is the key a new API key is returned under.
+	APIKey = "DD_API_KEY"
+
+	// AppKey is the key a new application key is returned under.
+	AppKey = "DD_APP_KEY"
+
+	// pageSize is the number of keys listed per request.
+	pageSize = 100
+)
+
+// Client implements the rotate.Client and disable.Client interfaces for
+// rotating Datadog API keys or application keys, depending on the configured
+// key type. Application keys belong to the user owning the application key the
+// plugin is configured with.
+//
+// Each key created is named with the secret name, the configured suffix, and
+// the time it was created. Only keys with such a name are considered; keys
+// created by other means are left alone.
+type Client struct {
+	api        *jsonapi.Client
+	keyType    string
+	nameSuffix string
+	scopes     []string
+}
+
+// key is the subset of the Datadog API key and application key resources used
+// by the client.
+type key struct {
+	ID         string `json:"id"`
+	Attributes struct {
+		Name      string    `json:"name"`
+		Key       string    `json:"key,omitempty"`
+		CreatedAt time.Time `json:"created_at"`
+	} `json:"attributes"`
+}
+
+// apiError is the error body returned by the Datadog API.
+type apiError struct {
+	Errors []string `json:"errors"`
+}
+
+// errorMessage returns the messages of the error body returned by the Datadog
+// API.
+func errorMessage(body []byte) string {
+	var apiErr apiError
+	if err := json.Unmarshal(body, &apiErr); err != nil {
+		return ""
+	}
+	return strings.Join(apiErr.Errors, "; ")
+}
+
+// Name returns "Datadog API keys" or "Datadog application keys".
+func (c *Client) Name() string {
+	if c.keyType == KeyTypeApplication {
+		return "Datadog application keys"
+	}
+	return "Datadog API keys"
+}
+
+// Keys returns the DD_API_KEY key for API keys or the DD_APP_KEY key for
+// application keys.
+func (c *Client) Keys() secret.Map {
+	return secret.Map{
+		c.secretKey(): "",
+	}
+}
+
+// secretKey returns the key the new key is returned under.
+func (c *Client) secretKey() string {
+	if c.keyType == KeyTypeApplication {
+		return AppKey
+	}
+	return APIKey
+}
+
+// path returns the API path of the collection of keys rotated.
+func (c *Client) path() string {
+	if c.keyType == KeyTypeApplication {
+		return "api/v2/current_user/application_keys"
+	}
+	return "api/v2/api_keys"
+}
+
+// resourceType returns the JSON:API resource type of the keys rotated.
+func (c *Client) resourceType() string {
+	if c.keyType == KeyTypeApplication {
+		return "application_keys"
+	}
+	return "api_keys"
+}
+
+// call sends a request to the Datadog API at the given path and query and
+// decodes the response into out, if out is not nil.
+func (c *Client) call(
+	ctx context.Context,
+	method string,
+	p string,
+	query url.Values,
+	in any,
+	out any,
+) error {
+	return c.api.Call(ctx, method, p, query, nil, in, out)
+}
+
+// name returns the beginning of the name of every key of the secret.
+func (c *Client) name(sec secret.Info) string {
+	return sec.Name() + " " + c.nameSuffix + " "
+}
+
+// keys returns the keys of the secret created by this client, oldest first.
+func (c *Client) keys(
+	ctx context.Context,
+	sec secret.Info,
+) ([]key, error) {
+	var keys []key
+	for page := 0; ; page++ {
+		var res struct {
+			Data []key `json:"data"`
+		}
+
+		query := url.Values{
+			"filter":       {c.name(sec)},
+			"page[number]": {strconv.Itoa(page)},
+			"page[size]":   {strconv.Itoa(pageSize)},
+		}
+		err := c.call(ctx, http.MethodGet, c.path(), query, nil, &res)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s of secret %q: %w", c.Name(), sec.Name(), err)
+		}
+
+		// the filter matches anywhere in the name, so check the prefix
+		for _, k := range res.Data {
+			if strings.HasPrefix(k.Attributes.Name, c.name(sec)) {
+				keys = append(keys, k)
+			}
+		}
+
+		if len(res.Data) < pageSize {
+			break
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i].Attributes, keys[j].Attributes
+		if a.CreatedAt.Equal(b.CreatedAt) {
+			return a.Name < b.Name
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+
+	return keys, nil
+}
+
+// LastRotated returns the time the newest key of the secret was created. If
+// there is none, the zero time is returned.
+func (c *Client) LastRotated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	keys, err := c.keys(ctx, sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if len(keys) == 0 {
+		return time.Time{}, nil
+	}
+
+	return keys[len(keys)-1].Attributes.CreatedAt, nil
+}
+
+// RotateSecret creates a new key for the secret. The older keys keep working
+// until disabled.
+func (c *Client) RotateSecret(
+	ctx context.Context,
+	sec secret.Info,
+) (secret.Map, error) {
+	attrs := map[string]any{
+		"name": c.name(sec) + time.Now().UTC().Format(time.RFC3339),
+	}
+	if len(c.scopes) > 0 {
+		attrs["scopes"] = c.scopes
+	}
+
+	var res struct {
+		Data key `json:"data"`
+	}
+	err := c.call(ctx, http.MethodPost, c.path(), nil, map[string]any{
+		"data": map[string]any{
+			"type":       c.resourceType(),
+			"attributes": attrs,
+		},
+	}, &res)
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to create %s for secret %q: %w", c.Name(), sec.Name(), err)
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Infow(
+		"created Datadog key",
+		"secret", sec.Name(),
+		"client", c.Name(),
+		"key_id", res.Data.ID,
+	)
+
+	return secret.Map{
+		c.secretKey(): res.Data.Attributes.Key,
+	}, nil
+}
+
+// LastUpdated returns the time the newest key of the secret was created, which
+// is when the older keys became inactive. If there are no older keys, there is
+// nothing to disable.
+func (c *Client) LastUpdated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	keys, err := c.keys(ctx, sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if len(keys) < 2 {
+		return time.Time{}, disable.ErrNothingToDisable
+	}
+
+	return keys[len(keys)-1].Attributes.CreatedAt, nil
+}
+
+// DisableSecret revokes every key of the secret except the newest. Datadog keys
+// cannot be deactivated, so revoked keys are deleted.
+func (c *Client) DisableSecret(
+	ctx context.Context,
+	sec secret.Info,
+) error {
+	keys, err := c.keys(ctx, sec)
+	if err != nil {
+		return err
+	}
+
+	if len(keys) < 2 {
+		return nil
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	for _, k := range keys[:len(keys)-1] {
+		logger.Infow(
+			"revoking old Datadog key",
+			"secret", sec.Name(),
+			"client", c.Name(),
+			"key_id", k.ID,
+		)
+
+		p := c.path() + "/" + url.PathEscape(k.ID)
+		err := c.call(ctx, http.MethodDelete, p, nil, nil, nil)
+		if err != nil {
+			return fmt.Errorf("failed to revoke %s %q of secret %q: %w", c.Name(), k.ID, sec.Name(), err)
+		}
+	}
+
+	return nil
+}
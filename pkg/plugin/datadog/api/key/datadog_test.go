@@ -0,0 +1,284 @@
+package key
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin"
+)
+
+// fakeDatadog serves the API key and current user application key endpoints
+// of the Datadog API.
+type fakeDatadog struct {
+	mu    sync.Mutex
+	next  int
+	keys  map[string][]*key
+	types map[string]string
+}
+
+func newFakeDatadog() *fakeDatadog {
+	return &fakeDatadog{
+		keys: map[string][]*key{},
+		types: map[string]string{
+			"/api/v2/api_keys":                      "api_keys",
+			"/api/v2/current_user/application_keys": "application_keys",
+		},
+	}
+}
+
+func (f *fakeDatadog) add(coll, name string, created time.Time) {
+	f.next++
+	k := &key{ID: fmt.Sprintf("id-%d", f.next)}
+	k.Attributes.Name = name
+	k.Attributes.CreatedAt = created
+	f.keys[coll] = append(f.keys[coll], k)
+}
+
+func (f *fakeDatadog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("DD-API-KEY") != "admin-api" || r.Header.Get("DD-APPLICATION-KEY") != "admin-app" {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"errors":["Forbidden"]}`))
+		return
+	}
+
+	coll, id := r.URL.Path, ""
+	if _, ok := f.types[coll]; !ok {
+		i := strings.LastIndex(coll, "/")
+		coll, id = coll[:i], coll[i+1:]
+	}
+	typ, ok := f.types[coll]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"errors":["Not found"]}`))
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		// one key per page to exercise paging, with filtering like the real
+		// API that matches anywhere in the name
+		var matched []*key
+		for _, k := range f.keys[coll] {
+			if strings.Contains(k.Attributes.Name, r.URL.Query().Get("filter")) {
+				matched = append(matched, k)
+			}
+		}
+		var page int
+		_, _ = fmt.Sscan(r.URL.Query().Get("page[number]"), &page)
+		size := len(matched)
+		_, _ = fmt.Sscan(r.URL.Query().Get("page[size]"), &size)
+		data := []*key{}
+		if lo := page * size; lo < len(matched) {
+			hi := lo + size
+			if hi > len(matched) {
+				hi = len(matched)
+			}
+			data = matched[lo:hi]
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+
+	case r.Method == http.MethodPost && id == "":
+		var in struct {
+			Data struct {
+				Type       string `json:"type"`
+				Attributes struct {
+					Name   string   `json:"name"`
+					Scopes []string `json:"scopes"`
+				} `json:"attributes"`
+			} `json:"data"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		if in.Data.Type != typ {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":["wrong type"]}`))
+			return
+		}
+		f.add(coll, in.Data.Attributes.Name, time.Now().UTC().Add(time.Duration(f.next)*time.Millisecond))
+		res := *f.keys[coll][len(f.keys[coll])-1]
+		res.Attributes.Key = fmt.Sprintf("secret-%d", f.next)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": res})
+
+	case r.Method == http.MethodDelete:
+		for i, k := range f.keys[coll] {
+			if k.ID == id {
+				f.keys[coll] = append(f.keys[coll][:i], f.keys[coll][i+1:]...)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"errors":["Not found"]}`))
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestRotateAndDisable(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		keyType string
+		coll    string
+		key     string
+	}{
+		{KeyTypeAPI, "/api/v2/api_keys", APIKey},
+		{KeyTypeApplication, "/api/v2/current_user/application_keys", AppKey},
+	} {
+		t.Run(tc.keyType, func(t *testing.T) {
+			dd := newFakeDatadog()
+			dd.add(tc.coll, "by hand", time.Now().Add(-time.Hour))
+			dd.add(tc.coll, "other-service garotate 2022-01-01T00:00:00Z", time.Now().Add(-time.Hour))
+			dd.add(tc.coll, "old service garotate 2022-01-01T00:00:00Z", time.Now().Add(-time.Hour))
+			srv := httptest.NewServer(dd)
+			defer srv.Close()
+
+			inst, err := plugin.Build(ctx, &config.Plugin{
+				Name:    "datadog",
+				Package: "github.com/zostay/garotate/pkg/plugin/datadog/api/key",
+				Options: map[string]any{
+					"api_url":  srv.URL,
+					"api_key":  "admin-api",
+					"app_key":  "admin-app",
+					"key_type": tc.keyType,
+				},
+			})
+			require.NoError(t, err)
+			c := inst.(*Client)
+			assert.Contains(t, c.Keys(), tc.key)
+
+			sec := &config.Secret{SecretName: "service"}
+
+			last, err := c.LastRotated(ctx, sec)
+			require.NoError(t, err)
+			assert.True(t, last.IsZero(), "never rotated")
+
+			first, err := c.RotateSecret(ctx, sec)
+			require.NoError(t, err)
+			assert.Equal(t, "secret-4", first[tc.key])
+			assert.True(t, strings.HasPrefix(dd.keys[tc.coll][3].Attributes.Name, "service garotate "), "named")
+
+			_, err = c.LastUpdated(ctx, sec)
+			assert.ErrorIs(t, err, disable.ErrNothingToDisable, "nothing to disable yet")
+
+			second, err := c.RotateSecret(ctx, sec)
+			require.NoError(t, err)
+			assert.Equal(t, "secret-5", second[tc.key])
+
+			last, err = c.LastRotated(ctx, sec)
+			require.NoError(t, err)
+			assert.Equal(t, dd.keys[tc.coll][4].Attributes.CreatedAt, last, "newest key")
+
+			upd, err := c.LastUpdated(ctx, sec)
+			require.NoError(t, err)
+			assert.Equal(t, dd.keys[tc.coll][4].Attributes.CreatedAt, upd, "old key to disable")
+
+			require.NoError(t, c.DisableSecret(ctx, sec))
+			var ids []string
+			for _, k := range dd.keys[tc.coll] {
+				ids = append(ids, k.ID)
+			}
+			assert.Equal(t, []string{"id-1", "id-2", "id-3", "id-5"}, ids, "only the old key revoked")
+
+			c.api.Header.Set("DD-APPLICATION-KEY", "wrong")
+			_, err = c.RotateSecret(ctx, sec)
+			assert.ErrorContains(t, err, "Forbidden")
+		})
+	}
+}
+
+func TestBuild(t *testing.T) {
+	t.Setenv("DD_SITE", "")
+	t.Setenv("DD_ADMIN_API_KEY", "")
+	t.Setenv("DD_ADMIN_APP_KEY", "")
+
+	build := func(opts map[string]any) (*Client, error) {
+		inst, err := (&builder{}).Build(context.Background(), &config.Plugin{Options: opts})
+		if err != nil {
+			return nil, err
+		}
+		return inst.(*Client), nil
+	}
+
+	creds := func(more map[string]any) map[string]any {
+		opts := map[string]any{"api_key": "admin-api", "app_key": "admin-app"}
+		for k, v := range more {
+			opts[k] = v
+		}
+		return opts
+	}
+
+	c, err := build(creds(nil))
+	require.NoError(t, err)
+	assert.Equal(t, "https://api.datadoghq.com/", c.api.Base.String())
+	assert.Equal(t, "Datadog API keys", c.Name())
+
+	c, err = build(creds(map[string]any{"site": "datadoghq.eu"}))
+	require.NoError(t, err)
+	assert.Equal(t, "https://api.datadoghq.eu/", c.api.Base.String())
+
+	c, err = build(creds(map[string]any{"key_type": "application", "scopes": []string{"dashboards_read"}}))
+	require.NoError(t, err)
+	assert.Equal(t, "Datadog application keys", c.Name())
+	assert.Equal(t, []string{"dashboards_read"}, c.scopes)
+
+	_, err = build(map[string]any{})
+	assert.Error(t, err, "no credentials")
+	_, err = build(creds(map[string]any{"api_url": "not a url"}))
+	assert.Error(t, err, "bad api_url")
+	_, err = build(creds(map[string]any{"key_type": "client"}))
+	assert.Error(t, err, "unknown key type")
+	_, err = build(creds(map[string]any{"scopes": []string{"dashboards_read"}}))
+	assert.Error(t, err, "scopes on API keys")
+	_, err = build(creds(map[string]any{"name_suffix": ""}))
+	assert.Error(t, err, "empty name suffix")
+
+	t.Setenv("DD_SITE", "us5.datadoghq.com")
+	t.Setenv("DD_ADMIN_API_KEY", "admin-api")
+	t.Setenv("DD_ADMIN_APP_KEY", "admin-app")
+	c, err = build(map[string]any{})
+	require.NoError(t, err, "credentials from environment")
+	assert.Equal(t, "https://api.us5.datadoghq.com/", c.api.Base.String())
+}
+
+func TestErrorMessage(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"errors":["Invalid scope","Name is too long"]}`))
+	}))
+	defer srv.Close()
+
+	inst, err := plugin.Build(ctx, &config.Plugin{
+		Name:    "datadog",
+		Package: "github.com/zostay/garotate/pkg/plugin/datadog/api/key",
+		Options: map[string]any{
+			"api_url": srv.URL,
+			"api_key": "admin-api",
+			"app_key": "admin-app",
+		},
+	})
+	require.NoError(t, err)
+	c := inst.(*Client)
+
+	_, err = c.RotateSecret(ctx, &config.Secret{SecretName: "service"})
+	assert.ErrorContains(t, err, "Invalid scope; Name is too long (400 Bad Request)", "all errors reported")
+
+	assert.Empty(t, errorMessage([]byte(`{"errors":[]}`)), "no errors")
+	assert.Empty(t, errorMessage([]byte(`Bad Gateway`)), "not JSON")
+}
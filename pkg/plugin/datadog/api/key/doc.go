@@ -0,0 +1,5 @@
+// Package key provides a plugin which implements the rotate.Client and
+// disable.Client and is used to rotate Datadog API keys or application keys.
+// Each rotation creates a new key named for the secret. Disablement revokes the
+// older keys the plugin created.
+package key
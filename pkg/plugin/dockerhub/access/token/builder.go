@@ -0,0 +1,99 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/plugin/internal/jsonapi"
+)
+
+const (
+	// DefaultAPIURL is the Docker Hub API endpoint used if no api_url is
+	// configured.
+	DefaultAPIURL = "https://hub.docker.com/v2/"
+
+	// DefaultLabelPrefix begins the label of every token created if no prefix
+	// is configured.
+	DefaultLabelPrefix = "garotate"
+)
+
+// builder implements the plugin.Builder interface and provides the factory
+// method for constructing a Client.
+type builder struct{}
+
+// options are the plugin options accepted in the configuration.
+type options struct {
+	APIURL      string   `mapstructure:"api_url"`
+	Username    string   `mapstructure:"username"`
+	Password    string   `mapstructure:"password"`
+	LabelPrefix string   `mapstructure:"label_prefix"`
+	Scopes      []string `mapstructure:"scopes"`
+}
+
+// Build constructs and returns a Docker Hub access token client.
+func (b *builder) Build(
+	ctx context.Context,
+	c *config.Plugin,
+) (plugin.Instance, error) {
+	opts := options{
+		APIURL:      DefaultAPIURL,
+		LabelPrefix: DefaultLabelPrefix,
+		Scopes:      DefaultScopes(),
+	}
+	err := c.DecodeOptions(&opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Docker Hub plugin options: %w", err)
+	}
+
+	api, err := url.Parse(opts.APIURL)
+	if err != nil || api.Host == "" {
+		return nil, fmt.Errorf("the Docker Hub plugin api_url option must be a URL, but got %q", opts.APIURL)
+	}
+	if !strings.HasSuffix(api.Path, "/") {
+		api.Path += "/"
+	}
+
+	if opts.Username == "" {
+		opts.Username = os.Getenv("DOCKER_ADMIN_USERNAME")
+	}
+	if opts.Password == "" {
+		opts.Password = os.Getenv("DOCKER_ADMIN_PASSWORD")
+	}
+	if opts.Username == "" || opts.Password == "" {
+		return nil, errors.New("the Docker Hub plugin requires username and password options or DOCKER_ADMIN_USERNAME and DOCKER_ADMIN_PASSWORD environment variables")
+	}
+
+	if opts.LabelPrefix == "" {
+		return nil, errors.New("the Docker Hub plugin label_prefix option must not be empty")
+	}
+
+	if len(opts.Scopes) == 0 {
+		return nil, errors.New("the Docker Hub plugin scopes option must not be empty")
+	}
+
+	return &Client{
+		api: &jsonapi.Client{
+			HTTP:         http.DefaultClient,
+			Base:         api,
+			ErrorMessage: errorMessage,
+		},
+		username:    opts.Username,
+		password:    opts.Password,
+		labelPrefix: opts.LabelPrefix,
+		scopes:      opts.Scopes,
+	}, nil
+}
+
+// init registers the plugin.
+func init() {
+	pkg := reflect.TypeOf(Client{}).PkgPath()
+	plugin.Register(pkg, new(builder))
+}
@@ -0,0 +1,6 @@
+// Package token provides a plugin which implements the rotate.Client and
+// disable.Deleter and is used to rotate Docker Hub personal access tokens, such
+// as those CI pipelines push images with. Each rotation creates a new labeled
+// token. Disablement deactivates the older tokens and deletion removes them
+// once they have been inactive long enough.
+package token
@@ -0,0 +1,374 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin/internal/jsonapi"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+const (
+	// UserKey is the key the user name of the account is returned under.
+	UserKey = "DOCKER_USERNAME"
+
+	// PasswordKey is the key the new access token is returned under.
+	PasswordKey = "DOCKER_PASSWORD"
+)
+
+// DefaultScopes returns the scopes of the tokens created if none are
+// configured, which permit pushing and pulling images.
+func DefaultScopes() []string {
+	return []string{"repo:write"}
+}
+
+// Client implements the rotate.Client and disable.Deleter interfaces for
+// rotating Docker Hub personal access tokens of the configured account. The
+// secret name tells apart the tokens of several secrets rotated for the same
+// account.
+//
+// Each token created is labeled with the configured prefix, the secret name,
+// and the time it was created. Only tokens with that label are considered;
+// tokens created by other means are left alone.
+type Client struct {
+	api         *jsonapi.Client
+	username    string
+	password    string
+	labelPrefix string
+	scopes      []string
+}
+
+// accessToken is the subset of the Docker Hub access token resource used by the
+// client.
+type accessToken struct {
+	UUID      string    `json:"uuid"`
+	Label     string    `json:"token_label"`
+	Token     string    `json:"token,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	IsActive  bool      `json:"is_active"`
+}
+
+// apiError is the error body returned by the Docker Hub API.
+type apiError struct {
+	Detail  string `json:"detail"`
+	Message string `json:"message"`
+}
+
+// Name returns "Docker Hub access tokens".
+func (c *Client) Name() string {
+	return "Docker Hub access tokens"
+}
+
+// Keys returns the DOCKER_USERNAME and DOCKER_PASSWORD keys.
+func (c *Client) Keys() secret.Map {
+	return secret.Map{
+		UserKey:     "",
+		PasswordKey: "",
+	}
+}
+
+// call sends a request to the Docker Hub API at the given path and query,
+// authorized with the bearer token, if any, and decodes the response into out,
+// if out is not nil.
+func (c *Client) call(
+	ctx context.Context,
+	bearer string,
+	method string,
+	p string,
+	query url.Values,
+	in any,
+	out any,
+) error {
+	var header http.Header
+	if bearer != "" {
+		header = http.Header{"Authorization": {"Bearer " + bearer}}
+	}
+	return c.api.Call(ctx, method, p, query, header, in, out)
+}
+
+// errorMessage returns the detail or message of the error body returned by the
+// Docker Hub API.
+func errorMessage(body []byte) string {
+	var apiErr apiError
+	if err := json.Unmarshal(body, &apiErr); err != nil {
+		return ""
+	}
+	if apiErr.Detail != "" {
+		return apiErr.Detail
+	}
+	return apiErr.Message
+}
+
+// login logs in as the account and returns the bearer token that authorizes
+// managing its access tokens.
+func (c *Client) login(ctx context.Context) (string, error) {
+	var res struct {
+		Token string `json:"token"`
+	}
+
+	err := c.call(ctx, "", http.MethodPost, "users/login", nil, map[string]string{
+		"username": c.username,
+		"password": c.password,
+	}, &res)
+	if err != nil {
+		return "", fmt.Errorf("failed to log in to Docker Hub as %q: %w", c.username, err)
+	}
+
+	return res.Token, nil
+}
+
+// label returns the beginning of the label of every token of the secret.
+func (c *Client) label(sec secret.Info) string {
+	return c.labelPrefix + " " + sec.Name() + " "
+}
+
+// accessTokens returns the access tokens of the secret created by this client,
+// oldest first.
+func (c *Client) accessTokens(
+	ctx context.Context,
+	bearer string,
+	sec secret.Info,
+) ([]accessToken, error) {
+	var tokens []accessToken
+	for page := 1; ; page++ {
+		var res struct {
+			Next    string        `json:"next"`
+			Results []accessToken `json:"results"`
+		}
+
+		query := url.Values{
+			"page":      {strconv.Itoa(page)},
+			"page_size": {"100"},
+		}
+		err := c.call(ctx, bearer, http.MethodGet, "access-tokens", query, nil, &res)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list Docker Hub access tokens of %q: %w", c.username, err)
+		}
+
+		for _, t := range res.Results {
+			if strings.HasPrefix(t.Label, c.label(sec)) {
+				tokens = append(tokens, t)
+			}
+		}
+
+		if res.Next == "" || len(res.Results) == 0 {
+			break
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].CreatedAt.Equal(tokens[j].CreatedAt) {
+			return tokens[i].Label < tokens[j].Label
+		}
+		return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+	})
+
+	return tokens, nil
+}
+
+// LastRotated returns the time the newest access token of the secret was
+// created. If there is none, the zero time is returned.
+func (c *Client) LastRotated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	bearer, err := c.login(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	tokens, err := c.accessTokens(ctx, bearer, sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if len(tokens) == 0 {
+		return time.Time{}, nil
+	}
+
+	return tokens[len(tokens)-1].CreatedAt, nil
+}
+
+// RotateSecret creates a new access token for the secret. The older tokens
+// keep working until disabled.
+func (c *Client) RotateSecret(
+	ctx context.Context,
+	sec secret.Info,
+) (secret.Map, error) {
+	bearer, err := c.login(ctx)
+	if err != nil {
+		return secret.Map{}, err
+	}
+
+	var token accessToken
+	label := c.label(sec) + time.Now().UTC().Format(time.RFC3339)
+	err = c.call(ctx, bearer, http.MethodPost, "access-tokens", nil, map[string]any{
+		"token_label": label,
+		"scopes":      c.scopes,
+	}, &token)
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to create Docker Hub access token for secret %q: %w", sec.Name(), err)
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Infow(
+		"created Docker Hub access token",
+		"secret", sec.Name(),
+		"client", c.Name(),
+		"token", token.UUID,
+	)
+
+	return secret.Map{
+		UserKey:     c.username,
+		PasswordKey: token.Token,
+	}, nil
+}
+
+// LastUpdated returns the time the newest access token of the secret was
+// created, which is when the older tokens became inactive. If there are no
+// older tokens, there is nothing to disable.
+func (c *Client) LastUpdated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	bearer, err := c.login(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	tokens, err := c.accessTokens(ctx, bearer, sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if len(tokens) < 2 {
+		return time.Time{}, disable.ErrNothingToDisable
+	}
+
+	return tokens[len(tokens)-1].CreatedAt, nil
+}
+
+// DisableSecret deactivates every access token of the secret except the
+// newest. Tokens that are already inactive are left for DeleteSecret.
+func (c *Client) DisableSecret(
+	ctx context.Context,
+	sec secret.Info,
+) error {
+	bearer, err := c.login(ctx)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := c.accessTokens(ctx, bearer, sec)
+	if err != nil {
+		return err
+	}
+
+	if len(tokens) < 2 {
+		return nil
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	for _, token := range tokens[:len(tokens)-1] {
+		if !token.IsActive {
+			continue
+		}
+
+		logger.Infow(
+			"deactivating old Docker Hub access token",
+			"secret", sec.Name(),
+			"client", c.Name(),
+			"token", token.UUID,
+		)
+
+		p := "access-tokens/" + url.PathEscape(token.UUID)
+		err := c.call(ctx, bearer, http.MethodPatch, p, nil, map[string]bool{
+			"is_active": false,
+		}, nil)
+		if err != nil {
+			return fmt.Errorf("failed to deactivate Docker Hub access token %q of secret %q: %w", token.UUID, sec.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// LastDisabled returns the time the token that replaced the newest inactive
+// token of the secret was created. Docker Hub does not record when a token was
+// deactivated, so this is as near to it as the client can tell. The newest
+// token is never deleted, so if no older token is inactive, there is nothing
+// to delete.
+func (c *Client) LastDisabled(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	bearer, err := c.login(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	tokens, err := c.accessTokens(ctx, bearer, sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for i := len(tokens) - 2; i >= 0; i-- {
+		if !tokens[i].IsActive {
+			return tokens[i+1].CreatedAt, nil
+		}
+	}
+
+	return time.Time{}, disable.ErrNothingToDelete
+}
+
+// DeleteSecret deletes every inactive access token of the secret except the
+// newest. Tokens that are still active are left alone.
+func (c *Client) DeleteSecret(
+	ctx context.Context,
+	sec secret.Info,
+) error {
+	bearer, err := c.login(ctx)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := c.accessTokens(ctx, bearer, sec)
+	if err != nil {
+		return err
+	}
+
+	if len(tokens) < 2 {
+		return nil
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	for _, token := range tokens[:len(tokens)-1] {
+		if token.IsActive {
+			continue
+		}
+
+		logger.Infow(
+			"deleting inactive Docker Hub access token",
+			"secret", sec.Name(),
+			"client", c.Name(),
+			"token", token.UUID,
+		)
+
+		p := "access-tokens/" + url.PathEscape(token.UUID)
+		err := c.call(ctx, bearer, http.MethodDelete, p, nil, nil, nil)
+		if err != nil {
+			return fmt.Errorf("failed to delete Docker Hub access token %q of secret %q: %w", token.UUID, sec.Name(), err)
+		}
+	}
+
+	return nil
+}
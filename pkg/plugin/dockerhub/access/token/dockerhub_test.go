@@ -0,0 +1,259 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin"
+)
+
+// fakeHub serves the login and access token endpoints of the Docker Hub API
+// for a single account.
+type fakeHub struct {
+	mu     sync.Mutex
+	next   int
+	tokens []*accessToken
+}
+
+func (f *fakeHub) find(uuid string) *accessToken {
+	for _, t := range f.tokens {
+		if t.UUID == uuid {
+			return t
+		}
+	}
+	return nil
+}
+
+func (f *fakeHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == "/v2/users/login" {
+		var in map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		if in["username"] != "ci-bot" || in["password"] != "hunter2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"detail":"Incorrect authentication credentials"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"token":"jwt"}`))
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer jwt" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	uuid := strings.TrimPrefix(r.URL.Path, "/v2/access-tokens/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v2/access-tokens":
+		// one token per page to exercise paging
+		page := 1
+		_, _ = fmt.Sscan(r.URL.Query().Get("page"), &page)
+		res := map[string]any{"count": len(f.tokens), "results": []any{}}
+		if page <= len(f.tokens) {
+			res["results"] = []any{f.tokens[page-1]}
+		}
+		if page < len(f.tokens) {
+			res["next"] = fmt.Sprintf("http://%s/v2/access-tokens?page=%d", r.Host, page+1)
+		}
+		_ = json.NewEncoder(w).Encode(res)
+
+	case r.Method == http.MethodPost && r.URL.Path == "/v2/access-tokens":
+		var in struct {
+			Label  string   `json:"token_label"`
+			Scopes []string `json:"scopes"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		f.next++
+		t := &accessToken{
+			UUID:      fmt.Sprintf("uuid-%d", f.next),
+			Label:     in.Label,
+			CreatedAt: time.Now().UTC().Add(time.Duration(f.next) * time.Millisecond),
+			IsActive:  true,
+		}
+		f.tokens = append(f.tokens, t)
+		res := *t
+		res.Token = fmt.Sprintf("dckr_pat_%d", f.next)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(res)
+
+	case r.Method == http.MethodPatch && f.find(uuid) != nil:
+		var in map[string]bool
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		f.find(uuid).IsActive = in["is_active"]
+		_ = json.NewEncoder(w).Encode(f.find(uuid))
+
+	case r.Method == http.MethodDelete && f.find(uuid) != nil:
+		for i, t := range f.tokens {
+			if t.UUID == uuid {
+				f.tokens = append(f.tokens[:i], f.tokens[i+1:]...)
+				break
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"message":"not found"}`))
+	}
+}
+
+func TestRotateAndDisable(t *testing.T) {
+	ctx := context.Background()
+	hub := &fakeHub{
+		tokens: []*accessToken{
+			{UUID: "by-hand", Label: "laptop", CreatedAt: time.Now().Add(-time.Hour), IsActive: true},
+		},
+	}
+	srv := httptest.NewServer(hub)
+	defer srv.Close()
+
+	inst, err := plugin.Build(ctx, &config.Plugin{
+		Name:    "dockerhub",
+		Package: "github.com/zostay/garotate/pkg/plugin/dockerhub/access/token",
+		Options: map[string]any{
+			"api_url":  srv.URL + "/v2",
+			"username": "ci-bot",
+			"password": "hunter2",
+		},
+	})
+	require.NoError(t, err)
+	c := inst.(*Client)
+
+	sec := &config.Secret{SecretName: "builds"}
+
+	last, err := c.LastRotated(ctx, sec)
+	require.NoError(t, err)
+	assert.True(t, last.IsZero(), "never rotated")
+
+	first, err := c.RotateSecret(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, "ci-bot", first[UserKey])
+	assert.Equal(t, "dckr_pat_1", first[PasswordKey])
+	assert.True(t, strings.HasPrefix(hub.tokens[1].Label, "garotate builds "), "labeled")
+
+	_, err = c.LastUpdated(ctx, sec)
+	assert.ErrorIs(t, err, disable.ErrNothingToDisable, "nothing to disable yet")
+
+	second, err := c.RotateSecret(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, "dckr_pat_2", second[PasswordKey])
+
+	last, err = c.LastRotated(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, hub.tokens[2].CreatedAt, last, "newest token")
+
+	upd, err := c.LastUpdated(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, hub.tokens[2].CreatedAt, upd, "old token to disable")
+
+	_, err = c.LastDisabled(ctx, sec)
+	assert.ErrorIs(t, err, disable.ErrNothingToDelete, "old token still active")
+
+	require.NoError(t, c.DisableSecret(ctx, sec))
+	require.Len(t, hub.tokens, 3, "deactivated, not deleted")
+	assert.True(t, hub.tokens[0].IsActive, "other tokens left alone")
+	assert.False(t, hub.tokens[1].IsActive, "old token deactivated")
+	assert.True(t, hub.tokens[2].IsActive, "newest token kept")
+
+	require.NoError(t, c.DisableSecret(ctx, sec))
+	require.Len(t, hub.tokens, 3, "deactivating again does not delete")
+
+	dis, err := c.LastDisabled(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, hub.tokens[2].CreatedAt, dis, "inactive since the new token was created")
+
+	require.NoError(t, c.DeleteSecret(ctx, sec))
+	require.Len(t, hub.tokens, 2, "deactivated token deleted")
+	assert.Equal(t, "by-hand", hub.tokens[0].UUID)
+	assert.Equal(t, "uuid-2", hub.tokens[1].UUID)
+
+	_, err = c.LastDisabled(ctx, sec)
+	assert.ErrorIs(t, err, disable.ErrNothingToDelete, "nothing left to delete")
+
+	c.password = "wrong"
+	_, err = c.RotateSecret(ctx, sec)
+	assert.ErrorContains(t, err, "Incorrect authentication credentials")
+}
+
+func TestBuild(t *testing.T) {
+	t.Setenv("DOCKER_ADMIN_USERNAME", "")
+	t.Setenv("DOCKER_ADMIN_PASSWORD", "")
+
+	build := func(opts map[string]any) error {
+		_, err := (&builder{}).Build(context.Background(), &config.Plugin{Options: opts})
+		return err
+	}
+
+	creds := func(more map[string]any) map[string]any {
+		opts := map[string]any{"username": "ci-bot", "password": "hunter2"}
+		for k, v := range more {
+			opts[k] = v
+		}
+		return opts
+	}
+
+	assert.NoError(t, build(creds(nil)))
+	assert.Error(t, build(map[string]any{}), "no credentials")
+	assert.Error(t, build(creds(map[string]any{"api_url": "not a url"})), "bad api_url")
+	assert.Error(t, build(creds(map[string]any{"label_prefix": ""})), "empty label prefix")
+
+	t.Setenv("DOCKER_ADMIN_USERNAME", "ci-bot")
+	t.Setenv("DOCKER_ADMIN_PASSWORD", "hunter2")
+	assert.NoError(t, build(map[string]any{}), "credentials from environment")
+}
+
+func TestErrorMessage(t *testing.T) {
+	assert.Equal(t, "bad token", errorMessage([]byte(`{"detail":"bad token","message":"ignored"}`)), "detail first")
+	assert.Equal(t, "rate limited", errorMessage([]byte(`{"message":"rate limited"}`)), "message without detail")
+	assert.Empty(t, errorMessage([]byte(`<html>bad gateway</html>`)), "not JSON")
+}
+
+func TestBearerAfterLogin(t *testing.T) {
+	ctx := context.Background()
+
+	var auths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auths = append(auths, r.URL.Path+" "+r.Header.Get("Authorization"))
+		if r.URL.Path == "/v2/users/login" {
+			_, _ = w.Write([]byte(`{"token":"jwt"}`))
+			return
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"message":"rate limit exceeded"}`))
+	}))
+	defer srv.Close()
+
+	inst, err := plugin.Build(ctx, &config.Plugin{
+		Name:    "dockerhub",
+		Package: "github.com/zostay/garotate/pkg/plugin/dockerhub/access/token",
+		Options: map[string]any{
+			"api_url":  srv.URL + "/v2",
+			"username": "ci-bot",
+			"password": "hunter2",
+		},
+	})
+	require.NoError(t, err)
+	c := inst.(*Client)
+
+	_, err = c.LastRotated(ctx, &config.Secret{SecretName: "builds"})
+	assert.ErrorContains(t, err, "rate limit exceeded (429 Too Many Requests)")
+	assert.Equal(t, []string{
+		"/v2/users/login ",
+		"/v2/access-tokens Bearer jwt",
+	}, auths, "bearer only after login")
+}
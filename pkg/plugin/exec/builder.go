@@ -0,0 +1,49 @@
+package exec
+
+import (
+	"context"
+	"fmt"
+	osexec "os/exec"
+	"strings"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+)
+
+// builder implements the plugin.Builder interface and provides the factory
+// method for constructing a Client.
+type builder struct{}
+
+// Build finds the program named by the package and constructs a client for
+// it. It calls the Name method to make sure the program works.
+func (b *builder) Build(
+	ctx context.Context,
+	c *config.Plugin,
+) (plugin.Instance, error) {
+	prog := strings.TrimPrefix(c.Package, PackagePrefix)
+	path, err := osexec.LookPath(prog)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find external plugin program %q: %w", prog, err)
+	}
+
+	cli := &Client{
+		path:    path,
+		options: c.Options,
+	}
+
+	res, err := cli.call(ctx, &Request{Method: MethodName})
+	if err != nil {
+		return nil, err
+	}
+	if res.Name == "" {
+		return nil, fmt.Errorf("external plugin %q did not respond with a name", path)
+	}
+	cli.name = res.Name
+
+	return cli, nil
+}
+
+// init registers the plugin.
+func init() {
+	plugin.RegisterPrefix(PackagePrefix, new(builder))
+}
@@ -0,0 +1,56 @@
+// Package exec provides a plugin that runs an external program to implement
+// the rotate.Client, rotate.Storage, and disable.Client interfaces. This allows
+// plugins to be written in any language without being compiled into garotate.
+//
+// An external plugin is configured by setting the package to "exec:" followed
+// by the path to the program. If the path contains no slash, the program is
+// found by searching the PATH:
+//
+//	plugins:
+//	  vault:
+//	    package: exec:/usr/local/libexec/garotate-vault
+//	    option:
+//	      mount: secret
+//
+// # Protocol
+//
+// The program is run once for every method call. garotate writes a single JSON
+// encoded Request to the program's standard input and closes it. The program
+// must write a single JSON encoded Response to standard output and exit with a
+// zero status. Anything written to standard error is logged. For example, a
+// call to LastRotated sends:
+//
+//	{
+//	  "protocol": 1,
+//	  "method": "LastRotated",
+//	  "options": {"mount": "secret"},
+//	  "secret": {"name": "s3sync-builder"}
+//	}
+//
+// And the program might respond:
+//
+//	{"time": "2022-05-09T00:04:29Z"}
+//
+// The methods, the request fields they use, and the response fields they
+// require are:
+//
+//   - Name: no request fields; responds with "name".
+//   - Keys: no request fields; responds with "keys", whose values are ignored.
+//   - LastRotated: "secret"; responds with "time".
+//   - RotateSecret: "secret"; responds with "keys" holding the new values.
+//   - LastSaved: "storage" and "key"; responds with "time".
+//   - SaveKeys: "storage" and "keys"; responds with an empty object.
+//   - LastUpdated: "secret"; responds with "time".
+//   - DisableSecret: "secret"; responds with an empty object.
+//
+// A program need only implement the methods relevant to its role. Name is
+// always called when the plugin is loaded. Any method may fail by responding
+// with an "error" message. LastSaved should respond with an "error_code" of
+// "key_not_found" when the key has never been stored, and LastUpdated with
+// "nothing_to_disable" when there is no inactive secret to disable. Any
+// program that does not understand the protocol version or method should fail.
+//
+// Times are formatted as RFC 3339. Each method call is given the plugin's
+// configured options and is run with garotate's environment, so credentials
+// may be passed in either.
+package exec
@@ -0,0 +1,199 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	osexec "os/exec"
+	"strings"
+	"time"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+// Client implements the rotate.Client, rotate.Storage, and disable.Client
+// interfaces by running an external program for each method call.
+type Client struct {
+	path    string
+	options map[string]any
+	name    string
+	keys    secret.Map
+}
+
+// call runs the program with the given request and returns the response. The
+// program is killed if the context is canceled first.
+func (c *Client) call(ctx context.Context, req *Request) (*Response, error) {
+	req.Protocol = ProtocolVersion
+	req.Options = c.options
+
+	in, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s request for external plugin %q: %w", req.Method, c.path, err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := osexec.CommandContext(ctx, c.path)
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+
+	if stderr.Len() > 0 {
+		logger := config.LoggerFrom(ctx).Sugar()
+		logger.Debugw(
+			"external plugin wrote to standard error",
+			"plugin", c.path,
+			"method", req.Method,
+			"stderr", strings.TrimSpace(stderr.String()),
+		)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("external plugin %q failed during %s: %w", c.path, req.Method, err)
+	}
+
+	var res Response
+	err = json.Unmarshal(stdout.Bytes(), &res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s response from external plugin %q: %w", req.Method, c.path, err)
+	}
+
+	if res.Error != "" {
+		err := errors.New(res.Error)
+		switch res.ErrorCode {
+		case ErrorCodeKeyNotFound:
+			err = fmt.Errorf("%w: %s", secret.ErrKeyNotFound, res.Error)
+		case ErrorCodeNothingToDisable:
+			err = fmt.Errorf("%w: %s", disable.ErrNothingToDisable, res.Error)
+		}
+		return nil, fmt.Errorf("external plugin %q failed during %s: %w", c.path, req.Method, err)
+	}
+
+	return &res, nil
+}
+
+// callTime is a helper for methods that respond with a time.
+func (c *Client) callTime(ctx context.Context, req *Request) (time.Time, error) {
+	res, err := c.call(ctx, req)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if res.Time == nil {
+		return time.Time{}, fmt.Errorf("external plugin %q did not respond to %s with a time", c.path, req.Method)
+	}
+	return *res.Time, nil
+}
+
+// Name returns the name reported by the program when it was loaded.
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Keys returns the keys reported by the program. The program is only asked
+// the first time. If it fails, the error is logged and no keys are returned.
+func (c *Client) Keys() secret.Map {
+	if c.keys != nil {
+		return c.keys
+	}
+
+	ctx := context.Background()
+	res, err := c.call(ctx, &Request{Method: MethodKeys})
+	if err != nil {
+		logger := config.LoggerFrom(ctx).Sugar()
+		logger.Errorw(
+			"failed to retrieve keys from external plugin",
+			"client", c.Name(),
+			"error", err,
+		)
+		return secret.Map{}
+	}
+
+	c.keys = res.Keys
+	if c.keys == nil {
+		c.keys = secret.Map{}
+	}
+	return c.keys
+}
+
+// LastRotated asks the program for the last rotation time of the secret.
+func (c *Client) LastRotated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	return c.callTime(ctx, &Request{
+		Method: MethodLastRotated,
+		Secret: &Target{Name: sec.Name()},
+	})
+}
+
+// RotateSecret asks the program to rotate the secret and returns the new
+// values it responds with.
+func (c *Client) RotateSecret(
+	ctx context.Context,
+	sec secret.Info,
+) (secret.Map, error) {
+	res, err := c.call(ctx, &Request{
+		Method: MethodRotateSecret,
+		Secret: &Target{Name: sec.Name()},
+	})
+	if err != nil {
+		return secret.Map{}, err
+	}
+	return res.Keys, nil
+}
+
+// LastSaved asks the program when the key was last saved to the storage.
+func (c *Client) LastSaved(
+	ctx context.Context,
+	store secret.Storage,
+	key string,
+) (time.Time, error) {
+	return c.callTime(ctx, &Request{
+		Method:  MethodLastSaved,
+		Storage: &Target{Name: store.Name()},
+		Key:     key,
+	})
+}
+
+// SaveKeys asks the program to save the keys to the storage.
+func (c *Client) SaveKeys(
+	ctx context.Context,
+	store secret.Storage,
+	ss secret.Map,
+) error {
+	_, err := c.call(ctx, &Request{
+		Method:  MethodSaveKeys,
+		Storage: &Target{Name: store.Name()},
+		Keys:    ss,
+	})
+	return err
+}
+
+// LastUpdated asks the program for the time the newest inactive secret was
+// last updated.
+func (c *Client) LastUpdated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	return c.callTime(ctx, &Request{
+		Method: MethodLastUpdated,
+		Secret: &Target{Name: sec.Name()},
+	})
+}
+
+// DisableSecret asks the program to disable the inactive secrets.
+func (c *Client) DisableSecret(
+	ctx context.Context,
+	sec secret.Info,
+) error {
+	_, err := c.call(ctx, &Request{
+		Method: MethodDisableSecret,
+		Secret: &Target{Name: sec.Name()},
+	})
+	return err
+}
@@ -0,0 +1,156 @@
+package exec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/rotate"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+// testPluginEnv is set in the environment to make the test binary act as an
+// external plugin program.
+const testPluginEnv = "GAROTATE_EXEC_TEST_PLUGIN"
+
+var testTime = time.Date(2022, time.May, 9, 0, 4, 29, 0, time.UTC)
+
+func TestMain(m *testing.M) {
+	if os.Getenv(testPluginEnv) == "1" {
+		os.Exit(testPlugin())
+	}
+	os.Exit(m.Run())
+}
+
+// testPlugin implements a simple external plugin speaking the protocol.
+func testPlugin() int {
+	var req Request
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "called %s\n", req.Method)
+
+	var res Response
+	switch req.Method {
+	case MethodName:
+		res.Name = "test plugin"
+	case MethodKeys:
+		res.Keys = secret.Map{"password": ""}
+	case MethodLastRotated:
+		res.Time = &testTime
+	case MethodLastUpdated:
+		if req.Secret.Name == "current" {
+			res.Error = "only one password"
+			res.ErrorCode = ErrorCodeNothingToDisable
+		} else {
+			res.Time = &testTime
+		}
+	case MethodRotateSecret:
+		res.Keys = secret.Map{"password": fmt.Sprint(req.Options["prefix"], req.Secret.Name)}
+	case MethodLastSaved:
+		if req.Key == "missing" {
+			res.Error = "no such key"
+			res.ErrorCode = ErrorCodeKeyNotFound
+		} else {
+			res.Time = &testTime
+		}
+	case MethodSaveKeys:
+		if req.Keys["password"] == "" {
+			res.Error = "no password given"
+		}
+	case MethodDisableSecret:
+		if req.Secret.Name == "crash" {
+			return 2
+		}
+	default:
+		res.Error = "unknown method"
+	}
+
+	if err := json.NewEncoder(os.Stdout).Encode(&res); err != nil {
+		return 1
+	}
+	return 0
+}
+
+func buildTestClient(t *testing.T) *Client {
+	t.Helper()
+	t.Setenv(testPluginEnv, "1")
+
+	exe, err := os.Executable()
+	require.NoError(t, err)
+
+	inst, err := plugin.Build(context.Background(), &config.Plugin{
+		Name:    "test",
+		Package: PackagePrefix + exe,
+		Options: map[string]any{"prefix": "new-"},
+	})
+	require.NoError(t, err)
+	require.IsType(t, &Client{}, inst)
+
+	return inst.(*Client)
+}
+
+func TestClient(t *testing.T) {
+	c := buildTestClient(t)
+
+	var (
+		_ rotate.Client  = c
+		_ rotate.Storage = c
+		_ disable.Client = c
+	)
+
+	ctx := context.Background()
+	sec := &config.Secret{SecretName: "builder"}
+	store := &config.StorageMap{StorageName: "project"}
+
+	assert.Equal(t, "test plugin", c.Name())
+	assert.Equal(t, secret.Map{"password": ""}, c.Keys())
+
+	lr, err := c.LastRotated(ctx, sec)
+	assert.NoError(t, err)
+	assert.True(t, testTime.Equal(lr))
+
+	keys, err := c.RotateSecret(ctx, sec)
+	assert.NoError(t, err)
+	assert.Equal(t, secret.Map{"password": "new-builder"}, keys)
+
+	ls, err := c.LastSaved(ctx, store, "password")
+	assert.NoError(t, err)
+	assert.True(t, testTime.Equal(ls))
+
+	_, err = c.LastSaved(ctx, store, "missing")
+	assert.True(t, errors.Is(err, secret.ErrKeyNotFound))
+
+	assert.NoError(t, c.SaveKeys(ctx, store, keys))
+	assert.ErrorContains(t, c.SaveKeys(ctx, store, secret.Map{}), "no password given")
+
+	lu, err := c.LastUpdated(ctx, sec)
+	assert.NoError(t, err)
+	assert.True(t, testTime.Equal(lu))
+
+	_, err = c.LastUpdated(ctx, &config.Secret{SecretName: "current"})
+	assert.True(t, errors.Is(err, disable.ErrNothingToDisable))
+
+	assert.NoError(t, c.DisableSecret(ctx, sec))
+	assert.Error(t, c.DisableSecret(ctx, &config.Secret{SecretName: "crash"}))
+}
+
+func TestBuildMissingProgram(t *testing.T) {
+	_, err := plugin.Build(context.Background(), &config.Plugin{
+		Name:    "test",
+		Package: PackagePrefix + "/does/not/exist/garotate-plugin",
+	})
+	assert.Error(t, err)
+}
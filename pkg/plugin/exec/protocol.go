@@ -0,0 +1,84 @@
+package exec
+
+import (
+	"time"
+
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+// ProtocolVersion is the version of the protocol spoken by this package. It is
+// sent with every request.
+const ProtocolVersion = 1
+
+// PackagePrefix is the prefix of the configured package that marks the rest
+// as the path to an external plugin program.
+const PackagePrefix = "exec:"
+
+// These are the methods that may be named in a Request.
+const (
+	MethodName          = "Name"
+	MethodKeys          = "Keys"
+	MethodLastRotated   = "LastRotated"
+	MethodRotateSecret  = "RotateSecret"
+	MethodLastSaved     = "LastSaved"
+	MethodSaveKeys      = "SaveKeys"
+	MethodLastUpdated   = "LastUpdated"
+	MethodDisableSecret = "DisableSecret"
+)
+
+// ErrorCodeKeyNotFound is the error code a plugin responds with to report that
+// a key has never been stored. It is turned into secret.ErrKeyNotFound.
+const ErrorCodeKeyNotFound = "key_not_found"
+
+// ErrorCodeNothingToDisable is the error code a plugin responds with to report
+// that there is no inactive secret to disable. It is turned into
+// disable.ErrNothingToDisable.
+const ErrorCodeNothingToDisable = "nothing_to_disable"
+
+// Target describes the secret or storage a method is called for.
+type Target struct {
+	// Name is the configured name of the secret or storage.
+	Name string `json:"name"`
+}
+
+// Request is the JSON object written to the standard input of the plugin.
+type Request struct {
+	// Protocol is the ProtocolVersion.
+	Protocol int `json:"protocol"`
+
+	// Method is the name of the method to perform.
+	Method string `json:"method"`
+
+	// Options are the options configured for the plugin.
+	Options map[string]any `json:"options,omitempty"`
+
+	// Secret describes the secret for rotation and disablement methods.
+	Secret *Target `json:"secret,omitempty"`
+
+	// Storage describes the storage for storage methods.
+	Storage *Target `json:"storage,omitempty"`
+
+	// Key is the key to check for LastSaved.
+	Key string `json:"key,omitempty"`
+
+	// Keys are the values to store for SaveKeys.
+	Keys secret.Map `json:"keys,omitempty"`
+}
+
+// Response is the JSON object the plugin must write to its standard output.
+type Response struct {
+	// Name is the descriptive name of the plugin in response to Name.
+	Name string `json:"name,omitempty"`
+
+	// Keys holds the keys in response to Keys or RotateSecret.
+	Keys secret.Map `json:"keys,omitempty"`
+
+	// Time is the time in response to LastRotated, LastSaved, or LastUpdated.
+	Time *time.Time `json:"time,omitempty"`
+
+	// Error is set to a message describing the failure when the method fails.
+	Error string `json:"error,omitempty"`
+
+	// ErrorCode may be set with Error to identify particular failures.
+	ErrorCode string `json:"error_code,omitempty"`
+}
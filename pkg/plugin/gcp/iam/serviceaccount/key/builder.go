@@ -0,0 +1,97 @@
+package key
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/plugin/internal/jsonapi"
+)
+
+// DefaultEndpoint is the Google Cloud IAM API endpoint used if no endpoint is
+// configured.
+const DefaultEndpoint = "https://iam.googleapis.com/"
+
+// scope is the OAuth2 scope requested for talking to the IAM API.
+const scope = "https://www.googleapis.com/auth/cloud-platform"
+
+// builder implements the plugin.Builder interface and provides the factory
+// method for constructing a Client.
+type builder struct{}
+
+// options are the plugin options accepted in the configuration.
+type options struct {
+	Endpoint        string `mapstructure:"endpoint"`
+	CredentialsFile string `mapstructure:"credentials_file"`
+	NoAuth          bool   `mapstructure:"no_auth"`
+	Base64          bool   `mapstructure:"base64"`
+}
+
+// Build constructs and returns a Google Cloud service account key client.
+func (b *builder) Build(
+	ctx context.Context,
+	c *config.Plugin,
+) (plugin.Instance, error) {
+	opts := options{
+		Endpoint: DefaultEndpoint,
+	}
+	err := c.DecodeOptions(&opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GCP service account key plugin options: %w", err)
+	}
+
+	endpoint, err := url.Parse(opts.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("the GCP service account key plugin endpoint option must be a URL, but got %q", opts.Endpoint)
+	}
+	if !strings.HasSuffix(endpoint.Path, "/") {
+		endpoint.Path += "/"
+	}
+
+	hc := http.DefaultClient
+	if !opts.NoAuth {
+		var creds *google.Credentials
+		if opts.CredentialsFile != "" {
+			data, err := os.ReadFile(opts.CredentialsFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read GCP credentials file %q: %w", opts.CredentialsFile, err)
+			}
+
+			creds, err = google.CredentialsFromJSON(ctx, data, scope)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load GCP credentials file %q: %w", opts.CredentialsFile, err)
+			}
+		} else {
+			creds, err = google.FindDefaultCredentials(ctx, scope)
+			if err != nil {
+				return nil, fmt.Errorf("failed to find GCP application default credentials: %w", err)
+			}
+		}
+
+		hc = oauth2.NewClient(ctx, creds.TokenSource)
+	}
+
+	return &Client{
+		api: &jsonapi.Client{
+			HTTP:         hc,
+			Base:         endpoint,
+			ErrorMessage: errorMessage,
+		},
+		base64: opts.Base64,
+	}, nil
+}
+
+// init registers the plugin.
+func init() {
+	pkg := reflect.TypeOf(Client{}).PkgPath()
+	plugin.Register(pkg, new(builder))
+}
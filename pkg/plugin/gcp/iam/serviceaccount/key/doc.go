@@ -0,0 +1,6 @@
+// Package key provides a plugin which implements both the rotate.Client and the
+// disable.Deleter and is used to rotate the keys of Google Cloud IAM service
+// accounts. Each rotation creates a new user-managed key and returns its JSON
+// credential. Disablement disables the keys it superseded and deletion removes
+// them once they have been disabled long enough.
+package key
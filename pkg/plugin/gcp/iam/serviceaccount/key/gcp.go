@@ -0,0 +1,302 @@
+package key
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin/internal/jsonapi"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+const (
+	// CredentialsKey is the key the JSON credential of the new key is returned
+	// under.
+	CredentialsKey = "GOOGLE_CREDENTIALS"
+
+	// Base64Key is the key the Base64 encoded JSON credential of the new key is
+	// returned under when the base64 option is set.
+	Base64Key = "GOOGLE_CREDENTIALS_BASE64"
+)
+
+// Client implements the rotate.Client and disable.Deleter interfaces for
+// rotating the keys of Google Cloud IAM service accounts. The secret name is
+// the email address of the service account.
+//
+// Only user-managed keys are considered. The keys Google manages for the
+// service account itself are left alone.
+type Client struct {
+	api    *jsonapi.Client
+	base64 bool
+}
+
+// serviceAccountKey is the subset of the IAM API ServiceAccountKey resource
+// used by the client.
+type serviceAccountKey struct {
+	Name           string    `json:"name"`
+	ValidAfterTime time.Time `json:"validAfterTime"`
+	Disabled       bool      `json:"disabled"`
+	PrivateKeyData string    `json:"privateKeyData,omitempty"`
+}
+
+// apiError is the error body returned by the IAM API.
+type apiError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+// errorMessage returns the message of the error body returned by the IAM API.
+func errorMessage(body []byte) string {
+	var apiErr apiError
+	if err := json.Unmarshal(body, &apiErr); err != nil {
+		return ""
+	}
+	return apiErr.Error.Message
+}
+
+// Name returns "GCP service account keys".
+func (c *Client) Name() string {
+	return "GCP service account keys"
+}
+
+// Keys returns the GOOGLE_CREDENTIALS key and, when the base64 option is set,
+// the GOOGLE_CREDENTIALS_BASE64 key.
+func (c *Client) Keys() secret.Map {
+	keys := secret.Map{
+		CredentialsKey: "",
+	}
+
+	if c.base64 {
+		keys[Base64Key] = ""
+	}
+
+	return keys
+}
+
+// call sends a request to the IAM API at the given path and query, relative to
+// the v1 API, and decodes the response into out, if out is not nil.
+func (c *Client) call(
+	ctx context.Context,
+	method string,
+	p string,
+	query url.Values,
+	in any,
+	out any,
+) error {
+	return c.api.Call(ctx, method, "v1/"+p, query, nil, in, out)
+}
+
+// keysPath returns the API path of the keys of the service account.
+func keysPath(sec secret.Info) string {
+	return "projects/-/serviceAccounts/" + url.PathEscape(sec.Name()) + "/keys"
+}
+
+// serviceAccountKeys returns the user-managed keys of the service account,
+// oldest first.
+func (c *Client) serviceAccountKeys(
+	ctx context.Context,
+	sec secret.Info,
+) ([]serviceAccountKey, error) {
+	var res struct {
+		Keys []serviceAccountKey `json:"keys"`
+	}
+
+	query := url.Values{"keyTypes": {"USER_MANAGED"}}
+	err := c.call(ctx, http.MethodGet, keysPath(sec), query, nil, &res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys of GCP service account %q: %w", sec.Name(), err)
+	}
+
+	keys := res.Keys
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].ValidAfterTime.Equal(keys[j].ValidAfterTime) {
+			return keys[i].Name < keys[j].Name
+		}
+		return keys[i].ValidAfterTime.Before(keys[j].ValidAfterTime)
+	})
+
+	return keys, nil
+}
+
+// LastRotated returns the time the newest user-managed key of the service
+// account became valid. If there is none, the zero time is returned.
+func (c *Client) LastRotated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	keys, err := c.serviceAccountKeys(ctx, sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if len(keys) == 0 {
+		return time.Time{}, nil
+	}
+
+	return keys[len(keys)-1].ValidAfterTime, nil
+}
+
+// RotateSecret creates a new key for the service account and returns its JSON
+// credential. The older keys keep working until disabled.
+func (c *Client) RotateSecret(
+	ctx context.Context,
+	sec secret.Info,
+) (secret.Map, error) {
+	var key serviceAccountKey
+	err := c.call(ctx, http.MethodPost, keysPath(sec), nil, map[string]string{
+		"privateKeyType": "TYPE_GOOGLE_CREDENTIALS_FILE",
+	}, &key)
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to create key for GCP service account %q: %w", sec.Name(), err)
+	}
+
+	creds, err := base64.StdEncoding.DecodeString(key.PrivateKeyData)
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to decode new key of GCP service account %q: %w", sec.Name(), err)
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Infow(
+		"created GCP service account key",
+		"secret", sec.Name(),
+		"client", c.Name(),
+		"key", path.Base(key.Name),
+	)
+
+	keys := secret.Map{
+		CredentialsKey: string(creds),
+	}
+
+	if c.base64 {
+		keys[Base64Key] = key.PrivateKeyData
+	}
+
+	return keys, nil
+}
+
+// LastUpdated returns the time the newest key became valid, which is when the
+// older keys became inactive. If there are no older keys, there is nothing to
+// disable.
+func (c *Client) LastUpdated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	keys, err := c.serviceAccountKeys(ctx, sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if len(keys) < 2 {
+		return time.Time{}, disable.ErrNothingToDisable
+	}
+
+	return keys[len(keys)-1].ValidAfterTime, nil
+}
+
+// DisableSecret disables every user-managed key of the service account except
+// the newest. Keys that are already disabled are left for DeleteSecret.
+func (c *Client) DisableSecret(
+	ctx context.Context,
+	sec secret.Info,
+) error {
+	keys, err := c.serviceAccountKeys(ctx, sec)
+	if err != nil {
+		return err
+	}
+
+	if len(keys) < 2 {
+		return nil
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	for _, key := range keys[:len(keys)-1] {
+		if key.Disabled {
+			continue
+		}
+
+		logger.Infow(
+			"disabling old GCP service account key",
+			"secret", sec.Name(),
+			"client", c.Name(),
+			"key", path.Base(key.Name),
+		)
+
+		err := c.call(ctx, http.MethodPost, key.Name+":disable", nil, struct{}{}, nil)
+		if err != nil {
+			return fmt.Errorf("failed to disable key %q of GCP service account %q: %w", path.Base(key.Name), sec.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// LastDisabled returns the time the key that replaced the newest disabled key
+// of the service account became valid. The IAM API does not record when a key
+// was disabled, so this is as near to it as the client can tell. The newest
+// key is never deleted, so if no older key is disabled, there is nothing to
+// delete.
+func (c *Client) LastDisabled(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	keys, err := c.serviceAccountKeys(ctx, sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for i := len(keys) - 2; i >= 0; i-- {
+		if keys[i].Disabled {
+			return keys[i+1].ValidAfterTime, nil
+		}
+	}
+
+	return time.Time{}, disable.ErrNothingToDelete
+}
+
+// DeleteSecret deletes every disabled user-managed key of the service account
+// except the newest. Keys that are still enabled are left alone.
+func (c *Client) DeleteSecret(
+	ctx context.Context,
+	sec secret.Info,
+) error {
+	keys, err := c.serviceAccountKeys(ctx, sec)
+	if err != nil {
+		return err
+	}
+
+	if len(keys) < 2 {
+		return nil
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	for _, key := range keys[:len(keys)-1] {
+		if !key.Disabled {
+			continue
+		}
+
+		logger.Infow(
+			"deleting disabled GCP service account key",
+			"secret", sec.Name(),
+			"client", c.Name(),
+			"key", path.Base(key.Name),
+		)
+
+		err := c.call(ctx, http.MethodDelete, key.Name, nil, nil, nil)
+		if err != nil {
+			return fmt.Errorf("failed to delete key %q of GCP service account %q: %w", path.Base(key.Name), sec.Name(), err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package key
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin"
+)
+
+const testAccount = "deploy@example.iam.gserviceaccount.com"
+
+// fakeIAM serves the service account key endpoints of the IAM API for a single
+// service account.
+type fakeIAM struct {
+	mu   sync.Mutex
+	next int
+	keys []*serviceAccountKey
+}
+
+func (f *fakeIAM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	const prefix = "/v1/projects/-/serviceAccounts/" + testAccount + "/keys"
+	p := r.URL.Path
+	switch {
+	case r.Method == http.MethodGet && p == prefix:
+		if r.URL.Query().Get("keyTypes") != "USER_MANAGED" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": f.keys})
+
+	case r.Method == http.MethodPost && p == prefix:
+		f.next++
+		name := fmt.Sprintf("projects/example/serviceAccounts/%s/keys/%d", testAccount, f.next)
+		creds := fmt.Sprintf(`{"type":"service_account","private_key_id":"%d"}`, f.next)
+		f.keys = append(f.keys, &serviceAccountKey{
+			Name:           name,
+			ValidAfterTime: time.Now().UTC().Add(time.Duration(f.next) * time.Millisecond),
+		})
+		_ = json.NewEncoder(w).Encode(serviceAccountKey{
+			Name:           name,
+			PrivateKeyData: base64.StdEncoding.EncodeToString([]byte(creds)),
+		})
+
+	case r.Method == http.MethodPost && strings.HasSuffix(p, ":disable"):
+		f.find(strings.TrimSuffix(p, ":disable")).Disabled = true
+		_, _ = w.Write([]byte("{}"))
+
+	case r.Method == http.MethodDelete:
+		for i, k := range f.keys {
+			if "/v1/"+k.Name == p {
+				f.keys = append(f.keys[:i], f.keys[i+1:]...)
+				_, _ = w.Write([]byte("{}"))
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":{"code":404,"message":"not found","status":"NOT_FOUND"}}`))
+	}
+}
+
+// find returns the key with the given API path.
+func (f *fakeIAM) find(p string) *serviceAccountKey {
+	for _, k := range f.keys {
+		if "/v1/"+k.Name == p {
+			return k
+		}
+	}
+	return &serviceAccountKey{}
+}
+
+func TestRotateAndDisable(t *testing.T) {
+	ctx := context.Background()
+	iam := &fakeIAM{}
+	srv := httptest.NewServer(iam)
+	t.Cleanup(srv.Close)
+
+	inst, err := plugin.Build(ctx, &config.Plugin{
+		Name:    "gcp",
+		Package: "github.com/zostay/garotate/pkg/plugin/gcp/iam/serviceaccount/key",
+		Options: map[string]any{
+			"endpoint": srv.URL,
+			"no_auth":  true,
+			"base64":   true,
+		},
+	})
+	require.NoError(t, err)
+	c := inst.(*Client)
+
+	sec := &config.Secret{SecretName: testAccount}
+
+	last, err := c.LastRotated(ctx, sec)
+	require.NoError(t, err)
+	assert.True(t, last.IsZero(), "never rotated")
+
+	keys, err := c.RotateSecret(ctx, sec)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"service_account","private_key_id":"1"}`, keys[CredentialsKey])
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte(keys[CredentialsKey])), keys[Base64Key])
+
+	_, err = c.LastUpdated(ctx, sec)
+	assert.ErrorIs(t, err, disable.ErrNothingToDisable, "nothing to disable yet")
+
+	_, err = c.RotateSecret(ctx, sec)
+	require.NoError(t, err)
+
+	last, err = c.LastRotated(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, iam.keys[1].ValidAfterTime, last, "newest key")
+
+	upd, err := c.LastUpdated(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, last, upd, "old key inactive since rotation")
+
+	_, err = c.LastDisabled(ctx, sec)
+	assert.ErrorIs(t, err, disable.ErrNothingToDelete, "old key still enabled")
+
+	require.NoError(t, c.DeleteSecret(ctx, sec))
+	require.Len(t, iam.keys, 2, "enabled key not deleted")
+
+	require.NoError(t, c.DisableSecret(ctx, sec))
+	require.Len(t, iam.keys, 2, "old key disabled, not deleted")
+	assert.True(t, iam.keys[0].Disabled, "old key disabled")
+	assert.False(t, iam.keys[1].Disabled, "new key enabled")
+
+	require.NoError(t, c.DisableSecret(ctx, sec))
+	require.Len(t, iam.keys, 2, "disabling again does not delete")
+
+	dis, err := c.LastDisabled(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, iam.keys[1].ValidAfterTime, dis, "inactive since the new key became valid")
+
+	require.NoError(t, c.DeleteSecret(ctx, sec))
+	require.Len(t, iam.keys, 1, "disabled key deleted")
+	assert.True(t, strings.HasSuffix(iam.keys[0].Name, "/2"), "new key kept")
+
+	_, err = c.LastDisabled(ctx, sec)
+	assert.ErrorIs(t, err, disable.ErrNothingToDelete, "nothing left to delete")
+
+	_, err = c.RotateSecret(ctx, &config.Secret{SecretName: "missing@example.iam.gserviceaccount.com"})
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestAPIError(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"error":{"code":403,"message":"Permission 'iam.serviceAccountKeys.create' denied","status":"PERMISSION_DENIED"}}`))
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`upstream connect error`))
+	}))
+	t.Cleanup(srv.Close)
+
+	inst, err := plugin.Build(ctx, &config.Plugin{
+		Name:    "gcp",
+		Package: "github.com/zostay/garotate/pkg/plugin/gcp/iam/serviceaccount/key",
+		Options: map[string]any{
+			"endpoint": srv.URL,
+			"no_auth":  true,
+		},
+	})
+	require.NoError(t, err)
+	c := inst.(*Client)
+
+	sec := &config.Secret{SecretName: testAccount}
+
+	_, err = c.RotateSecret(ctx, sec)
+	assert.ErrorContains(t, err, "Permission 'iam.serviceAccountKeys.create' denied (403 Forbidden)", "IAM error message")
+
+	_, err = c.LastRotated(ctx, sec)
+	assert.ErrorContains(t, err, "unexpected response 503 Service Unavailable", "body without an IAM error")
+}
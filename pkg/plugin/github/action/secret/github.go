@@ -2,16 +2,15 @@ package secret
 
 import (
 	"context"
-	"crypto/rand"
 	"encoding/base64"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/google/go-github/v42/github"
-	"golang.org/x/crypto/nacl/box"
 
 	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin/internal/sealbox"
 	"github.com/zostay/garotate/pkg/secret"
 )
 
@@ -115,13 +114,12 @@ func (c *Client) SaveKeys(
 	if err != nil {
 		return fmt.Errorf("failed to decode github project public key string for project %q: %w", store.Name(), err)
 	}
-	keyStr = string(decKeyBytes)
 
 	keyIDStr := pubKey.GetKeyID()
 
 	logger := config.LoggerFrom(ctx).Sugar()
 	for key, sec := range ss {
-		keyEncSealed, err := sealedBox(keyStr, sec)
+		keyEncSealed, err := sealbox.Seal(decKeyBytes, sec)
 		if err != nil {
 			return err
 		}
@@ -148,20 +146,3 @@ func (c *Client) SaveKeys(
 
 	return nil
 }
-
-// sealedBox handles sealing the secret for sending and encoding it as Base64.
-func sealedBox(pk, secret string) (string, error) {
-	var pkBytes [32]byte
-	copy(pkBytes[:], pk)
-	secretBytes := []byte(secret)
-
-	out := make([]byte, 0, len(secretBytes)+box.Overhead+len(pkBytes))
-
-	enc, err := box.SealAnonymous(out, secretBytes, &pkBytes, rand.Reader)
-	if err != nil {
-		return "", err
-	}
-	encEnc := base64.StdEncoding.EncodeToString(enc)
-
-	return encEnc, nil
-}
@@ -0,0 +1,78 @@
+package deploykey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+
+	"github.com/google/go-github/v42/github"
+	"golang.org/x/oauth2"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/plugin/ssh/key/pair"
+)
+
+// DefaultTitlePrefix begins the title of every deploy key registered if no
+// prefix is configured.
+const DefaultTitlePrefix = "garotate"
+
+// builder implements the plugin.Builder interface and provides the factory
+// method for constructing a Client.
+type builder struct{}
+
+// options are the plugin options accepted in the configuration.
+type options struct {
+	TitlePrefix string `mapstructure:"title_prefix"`
+	ReadOnly    bool   `mapstructure:"read_only"`
+
+	pair.Options `mapstructure:",squash"`
+}
+
+// Build constructs and returns a github deploy key client.
+func (b *builder) Build(
+	ctx context.Context,
+	c *config.Plugin,
+) (plugin.Instance, error) {
+	opts := options{
+		TitlePrefix: DefaultTitlePrefix,
+		ReadOnly:    true,
+		Options:     pair.DefaultOptions(),
+	}
+	err := c.DecodeOptions(&opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read github deploy key plugin options: %w", err)
+	}
+
+	if opts.TitlePrefix == "" {
+		return nil, errors.New("the github deploy key plugin title_prefix option must not be empty")
+	}
+
+	if err := opts.Options.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid github deploy key plugin options: %w", err)
+	}
+
+	token := os.Getenv("GITHUB_TOKEN")
+	ts := oauth2.StaticTokenSource(
+		&oauth2.Token{
+			AccessToken: token,
+		},
+	)
+	oc := oauth2.NewClient(ctx, ts)
+	gc := github.NewClient(oc)
+
+	return &Client{
+		gc:          gc,
+		titlePrefix: opts.TitlePrefix,
+		readOnly:    opts.ReadOnly,
+		defaults:    opts.Options,
+	}, nil
+}
+
+// init registers the plugin.
+func init() {
+	pkg := reflect.TypeOf(Client{}).PkgPath()
+	plugin.Register(pkg, new(builder))
+}
@@ -0,0 +1,230 @@
+package deploykey
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v42/github"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin/ssh/key/pair"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+// Client implements the rotate.Client and disable.Client interfaces for
+// rotating the deploy keys of github repositories. The secret name is the
+// repository in owner/repo form.
+//
+// Each deploy key registered is titled with the configured prefix followed by
+// the time it was registered. Only deploy keys with that prefix are considered;
+// deploy keys added by other means are left alone.
+//
+// To use this client, a GITHUB_TOKEN environment variable must be set to a
+// github access token with adequate permissions to manage deploy keys.
+type Client struct {
+	gc          *github.Client
+	titlePrefix string
+	readOnly    bool
+	defaults    pair.Options
+}
+
+// parts splits a repository name into the owner/repo form used for github
+// repositories.
+func parts(sec secret.Info) (string, string) {
+	o, r, _ := strings.Cut(sec.Name(), "/")
+	return o, r
+}
+
+// Name returns "github deploy keys".
+func (c *Client) Name() string {
+	return "github deploy keys"
+}
+
+// Keys returns the SSH_PRIVATE_KEY key.
+func (c *Client) Keys() secret.Map {
+	return secret.Map{
+		pair.PrivateKey: "",
+	}
+}
+
+// options returns the keypair options for the secret, which are the default
+// options of the plugin overridden by any options set on the secret.
+func (c *Client) options(sec secret.Info) (pair.Options, error) {
+	o := c.defaults
+
+	if so, ok := sec.(secret.Options); ok {
+		if err := so.DecodeOptions(&o); err != nil {
+			return pair.Options{}, fmt.Errorf("failed to read github deploy key options of secret %q: %w", sec.Name(), err)
+		}
+	}
+
+	if err := o.Validate(); err != nil {
+		return pair.Options{}, fmt.Errorf("invalid github deploy key options for secret %q: %w", sec.Name(), err)
+	}
+
+	return o, nil
+}
+
+// deployKeys returns the deploy keys of the repository registered by this
+// client, oldest first.
+func (c *Client) deployKeys(
+	ctx context.Context,
+	sec secret.Info,
+) ([]*github.Key, error) {
+	owner, repo := parts(sec)
+
+	var keys []*github.Key
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		page, res, err := c.gc.Repositories.ListKeys(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list deploy keys of github repository %q: %w", sec.Name(), err)
+		}
+
+		for _, k := range page {
+			if strings.HasPrefix(k.GetTitle(), c.titlePrefix+" ") {
+				keys = append(keys, k)
+			}
+		}
+
+		if res.NextPage == 0 {
+			break
+		}
+		opts.Page = res.NextPage
+	}
+
+	// creation times only have second precision, so break ties by ID, which
+	// always increases
+	sort.Slice(keys, func(i, j int) bool {
+		return isOlder(keys[i], keys[j])
+	})
+
+	return keys, nil
+}
+
+// isOlder returns true if key a was created before key b.
+func isOlder(a, b *github.Key) bool {
+	at, bt := a.GetCreatedAt().Time, b.GetCreatedAt().Time
+	if at.Equal(bt) {
+		return a.GetID() < b.GetID()
+	}
+	return at.Before(bt)
+}
+
+// LastRotated returns the time the newest deploy key registered by this client
+// was created. If there is none, the zero time is returned.
+func (c *Client) LastRotated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	keys, err := c.deployKeys(ctx, sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if len(keys) == 0 {
+		return time.Time{}, nil
+	}
+
+	return keys[len(keys)-1].GetCreatedAt().Time, nil
+}
+
+// RotateSecret generates a new keypair and registers the public key as a
+// deploy key of the repository. The older deploy keys keep working until
+// disabled.
+func (c *Client) RotateSecret(
+	ctx context.Context,
+	sec secret.Info,
+) (secret.Map, error) {
+	o, err := c.options(sec)
+	if err != nil {
+		return secret.Map{}, err
+	}
+
+	kp, err := pair.Generate(o, pair.CommentPrefix+sec.Name())
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to generate SSH key for secret %q: %w", sec.Name(), err)
+	}
+
+	owner, repo := parts(sec)
+	title := c.titlePrefix + " " + time.Now().UTC().Format(time.RFC3339)
+	_, _, err = c.gc.Repositories.CreateKey(ctx, owner, repo, &github.Key{
+		Title:    github.String(title),
+		Key:      github.String(kp.PublicKey),
+		ReadOnly: github.Bool(c.readOnly),
+	})
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to add deploy key to github repository %q: %w", sec.Name(), err)
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Infow(
+		"added new deploy key to github repository",
+		"secret", sec.Name(),
+		"client", c.Name(),
+		"title", title,
+		"fingerprint", kp.Fingerprint,
+		"read_only", c.readOnly,
+	)
+
+	return secret.Map{
+		pair.PrivateKey: kp.PrivateKey,
+	}, nil
+}
+
+// LastUpdated returns the time the newest deploy key was created, which is when
+// the older deploy keys became inactive. If there is only one deploy key, there
+// is nothing to disable.
+func (c *Client) LastUpdated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	keys, err := c.deployKeys(ctx, sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if len(keys) < 2 {
+		return time.Time{}, disable.ErrNothingToDisable
+	}
+
+	return keys[len(keys)-1].GetCreatedAt().Time, nil
+}
+
+// DisableSecret deletes every deploy key registered by this client except the
+// newest.
+func (c *Client) DisableSecret(
+	ctx context.Context,
+	sec secret.Info,
+) error {
+	keys, err := c.deployKeys(ctx, sec)
+	if err != nil {
+		return err
+	}
+
+	if len(keys) < 2 {
+		return nil
+	}
+
+	owner, repo := parts(sec)
+	logger := config.LoggerFrom(ctx).Sugar()
+	for _, k := range keys[:len(keys)-1] {
+		logger.Infow(
+			"deleting superseded deploy key from github repository",
+			"secret", sec.Name(),
+			"client", c.Name(),
+			"title", k.GetTitle(),
+		)
+
+		_, err := c.gc.Repositories.DeleteKey(ctx, owner, repo, k.GetID())
+		if err != nil {
+			return fmt.Errorf("failed to delete deploy key %q from github repository %q: %w", k.GetTitle(), sec.Name(), err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package deploykey
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v42/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin/ssh/key/pair"
+)
+
+// fakeRepo serves the deploy key endpoints of a single repository.
+type fakeRepo struct {
+	mu     sync.Mutex
+	nextID int64
+	keys   []*github.Key
+}
+
+func (f *fakeRepo) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	const base = "/repos/zostay/garotate/keys"
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == base:
+		_ = json.NewEncoder(w).Encode(f.keys)
+
+	case r.Method == http.MethodPost && r.URL.Path == base:
+		var k github.Key
+		_ = json.NewDecoder(r.Body).Decode(&k)
+		f.nextID++
+		k.ID = github.Int64(f.nextID)
+		k.CreatedAt = &github.Timestamp{Time: time.Now().Truncate(time.Second)}
+		f.keys = append(f.keys, &k)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(k)
+
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, base+"/"):
+		id, _ := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, base+"/"), 10, 64)
+		for i, k := range f.keys {
+			if k.GetID() == id {
+				f.keys = append(f.keys[:i], f.keys[i+1:]...)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestRotateAndDisable(t *testing.T) {
+	ctx := context.Background()
+	repo := &fakeRepo{
+		nextID: 1,
+		keys: []*github.Key{
+			{
+				ID:        github.Int64(1),
+				Title:     github.String("laptop"),
+				CreatedAt: &github.Timestamp{Time: time.Now().Add(-time.Hour)},
+			},
+		},
+	}
+	srv := httptest.NewServer(repo)
+	t.Cleanup(srv.Close)
+
+	gc := github.NewClient(srv.Client())
+	gc.BaseURL, _ = url.Parse(srv.URL + "/")
+
+	c := &Client{
+		gc:          gc,
+		titlePrefix: DefaultTitlePrefix,
+		readOnly:    true,
+		defaults:    pair.DefaultOptions(),
+	}
+	sec := &config.Secret{SecretName: "zostay/garotate"}
+
+	last, err := c.LastRotated(ctx, sec)
+	require.NoError(t, err)
+	assert.True(t, last.IsZero(), "unmanaged keys are ignored")
+
+	keys, err := c.RotateSecret(ctx, sec)
+	require.NoError(t, err)
+	_, err = ssh.ParsePrivateKey([]byte(keys[pair.PrivateKey]))
+	require.NoError(t, err, "private key parses")
+
+	_, err = c.LastUpdated(ctx, sec)
+	assert.ErrorIs(t, err, disable.ErrNothingToDisable, "nothing to disable yet")
+
+	_, err = c.RotateSecret(ctx, sec)
+	require.NoError(t, err)
+
+	last, err = c.LastRotated(ctx, sec)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), last, time.Minute, "just rotated")
+
+	require.NoError(t, c.DisableSecret(ctx, sec))
+
+	require.Len(t, repo.keys, 2)
+	assert.Equal(t, "laptop", repo.keys[0].GetTitle(), "unmanaged key kept")
+	assert.Equal(t, int64(3), repo.keys[1].GetID(), "newest key kept")
+	assert.True(t, repo.keys[1].GetReadOnly(), "registered read-only")
+	assert.True(t, strings.HasPrefix(repo.keys[1].GetTitle(), "garotate "), "title prefixed")
+}
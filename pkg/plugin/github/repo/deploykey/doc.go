@@ -0,0 +1,6 @@
+// Package deploykey provides a plugin which implements both the rotate.Client
+// and the disable.Client and is used to rotate the deploy keys of github
+// repositories. Each rotation generates a new SSH keypair and registers the
+// public key with the repository. Disablement deletes the deploy keys it
+// superseded.
+package deploykey
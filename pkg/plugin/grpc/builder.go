@@ -0,0 +1,45 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	osexec "os/exec"
+	"strings"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+)
+
+// builder implements the plugin.Builder interface and provides the factory
+// method for constructing a Client.
+type builder struct{}
+
+// Build finds the program named by the package, starts it, and configures it.
+func (b *builder) Build(
+	ctx context.Context,
+	c *config.Plugin,
+) (plugin.Instance, error) {
+	prog := strings.TrimPrefix(c.Package, PackagePrefix)
+	path, err := osexec.LookPath(prog)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find plugin program %q: %w", prog, err)
+	}
+
+	cli := &Client{
+		path:    path,
+		config:  c,
+		logger:  config.LoggerFrom(ctx),
+		plugins: plugin.ManagerFrom(ctx),
+	}
+
+	if _, err := cli.client(ctx); err != nil {
+		return nil, err
+	}
+
+	return cli, nil
+}
+
+// init registers the plugin.
+func init() {
+	plugin.RegisterPrefix(PackagePrefix, new(builder))
+}
@@ -0,0 +1,378 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/plugin/grpc/pb"
+	"github.com/zostay/garotate/pkg/rotate"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+// Client implements the rotate.Client, rotate.Storage, and disable.Client
+// interfaces by calling a supervised plugin process.
+type Client struct {
+	path    string
+	config  *config.Plugin
+	logger  *zap.Logger
+	plugins *plugin.Manager
+
+	mu   sync.Mutex
+	proc *process
+	name string
+	keys secret.Map
+}
+
+// client returns the client for the plugin process. It starts and configures
+// the process first, if it is not running or has become unhealthy.
+func (c *Client) client(ctx context.Context) (pb.PluginClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	slog := c.logger.Sugar()
+	if c.proc != nil && !c.proc.running() {
+		slog.Warnw("plugin process exited unexpectedly; restarting",
+			"plugin", c.path,
+			"error", c.proc.waitErr,
+		)
+		_ = c.proc.stop()
+		c.proc = nil
+	}
+
+	if c.proc != nil && time.Since(c.proc.lastCheck) > healthInterval {
+		if err := c.proc.check(ctx); err != nil {
+			slog.Warnw("plugin process failed health check; restarting",
+				"plugin", c.path,
+				"error", err,
+			)
+			_ = c.proc.stop()
+			c.proc = nil
+		}
+	}
+
+	if c.proc != nil {
+		return c.proc.plugin, nil
+	}
+
+	proc, err := startProcess(ctx, c.path, c.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := structpb.NewStruct(c.config.Options)
+	if err != nil {
+		_ = proc.stop()
+		return nil, fmt.Errorf("failed to encode options for plugin process %q: %w", c.path, err)
+	}
+
+	res, err := proc.plugin.Configure(ctx, &pb.ConfigureRequest{
+		Name:    c.config.Name,
+		Package: c.config.Package,
+		Options: opts,
+	})
+	if err != nil {
+		_ = proc.stop()
+		return nil, callError(c.path, "Configure", err)
+	}
+
+	c.proc = proc
+	c.name = res.Name
+	return proc.plugin, nil
+}
+
+// callError turns the status of a failed call into an error. If the plugin
+// process could not be reached, its health will be checked before the next
+// call, so it will be restarted if it has gone away.
+func (c *Client) callError(method string, err error) error {
+	if status.Code(err) == codes.Unavailable {
+		c.mu.Lock()
+		if c.proc != nil {
+			c.proc.lastCheck = time.Time{}
+		}
+		c.mu.Unlock()
+	}
+	return callError(c.path, method, err)
+}
+
+// callError turns the status of a failed call to the plugin process at the
+// given path into an error. The NOT_FOUND status is reported as
+// disable.ErrNothingToDisable from LastUpdated and as secret.ErrKeyNotFound
+// from anything else.
+func callError(path, method string, err error) error {
+	if st, ok := status.FromError(err); ok && st.Code() == codes.NotFound {
+		notFound := secret.ErrKeyNotFound
+		if method == "LastUpdated" {
+			notFound = disable.ErrNothingToDisable
+		}
+		err = fmt.Errorf("%w: %s", notFound, st.Message())
+	}
+	return fmt.Errorf("plugin process %q failed during %s: %w", path, method, err)
+}
+
+// Close stops the plugin process.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.proc == nil {
+		return nil
+	}
+
+	err := c.proc.stop()
+	c.proc = nil
+	return err
+}
+
+// Name returns the name reported by the plugin process when configured.
+func (c *Client) Name() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.name
+}
+
+// Keys returns the keys reported by the plugin process. The process is only
+// asked the first time. If it fails, the error is logged and no keys are
+// returned.
+func (c *Client) Keys() secret.Map {
+	c.mu.Lock()
+	keys := c.keys
+	c.mu.Unlock()
+	if keys != nil {
+		return keys
+	}
+
+	// c.mu is not held while calling the process, as starting it needs c.mu
+	ctx := context.Background()
+	res, err := c.keysOf(ctx)
+	if err != nil {
+		slog := c.logger.Sugar()
+		slog.Errorw(
+			"failed to retrieve keys from plugin process",
+			"client", c.Name(),
+			"error", err,
+		)
+		return secret.Map{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keys == nil {
+		c.keys = res
+	}
+	return c.keys
+}
+
+// keysOf calls Keys on the plugin process.
+func (c *Client) keysOf(ctx context.Context) (secret.Map, error) {
+	cli, err := c.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := cli.Keys(ctx, &pb.KeysRequest{})
+	if err != nil {
+		return nil, c.callError("Keys", err)
+	}
+
+	keys := secret.Map(res.Keys)
+	if keys == nil {
+		keys = secret.Map{}
+	}
+	return keys, nil
+}
+
+// secretRequest returns the request describing the secret to the plugin
+// process. The options and storages of the secret are only sent if it is a
+// *config.Secret.
+func (c *Client) secretRequest(sec secret.Info) (*pb.SecretRequest, error) {
+	req := &pb.SecretRequest{Name: sec.Name()}
+
+	s, ok := sec.(*config.Secret)
+	if !ok {
+		return req, nil
+	}
+
+	opts, err := structpb.NewStruct(s.Options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode options of secret %q for plugin process %q: %w", sec.Name(), c.path, err)
+	}
+	req.Options = opts
+
+	for i := range s.Storages {
+		sm := &s.Storages[i]
+		req.Storages = append(req.Storages, &pb.SecretStorage{
+			Plugin: sm.StorageClient,
+			Name:   sm.Name(),
+		})
+	}
+
+	return req, nil
+}
+
+// LastRotated asks the plugin process for the last rotation time of the
+// secret. The process cannot reach the storages of the secret, so the time
+// rotate.LastStored returns for it is sent along for plugins that rely on it.
+func (c *Client) LastRotated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	cli, err := c.client(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	req, err := c.secretRequest(sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if s, ok := sec.(*config.Secret); ok && c.plugins != nil {
+		stored, err := rotate.LastStored(ctx, c.plugins, c.Keys(), s)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to find when secret %q was last stored for plugin process %q: %w", sec.Name(), c.path, err)
+		}
+		req.LastStored = timestamppb.New(stored)
+	}
+
+	res, err := cli.LastRotated(ctx, req)
+	if err != nil {
+		return time.Time{}, c.callError("LastRotated", err)
+	}
+
+	return c.timeOf("LastRotated", res)
+}
+
+// RotateSecret asks the plugin process to rotate the secret and returns the
+// new values.
+func (c *Client) RotateSecret(
+	ctx context.Context,
+	sec secret.Info,
+) (secret.Map, error) {
+	cli, err := c.client(ctx)
+	if err != nil {
+		return secret.Map{}, err
+	}
+
+	req, err := c.secretRequest(sec)
+	if err != nil {
+		return secret.Map{}, err
+	}
+
+	res, err := cli.RotateSecret(ctx, req)
+	if err != nil {
+		return secret.Map{}, c.callError("RotateSecret", err)
+	}
+
+	return secret.Map(res.Keys), nil
+}
+
+// LastSaved asks the plugin process when the key was last saved to the
+// storage.
+func (c *Client) LastSaved(
+	ctx context.Context,
+	store secret.Storage,
+	key string,
+) (time.Time, error) {
+	cli, err := c.client(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	res, err := cli.LastSaved(ctx, &pb.LastSavedRequest{
+		Name: store.Name(),
+		Key:  key,
+	})
+	if err != nil {
+		return time.Time{}, c.callError("LastSaved", err)
+	}
+
+	return c.timeOf("LastSaved", res)
+}
+
+// SaveKeys asks the plugin process to save the keys to the storage.
+func (c *Client) SaveKeys(
+	ctx context.Context,
+	store secret.Storage,
+	ss secret.Map,
+) error {
+	cli, err := c.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = cli.SaveKeys(ctx, &pb.SaveKeysRequest{
+		Name: store.Name(),
+		Keys: ss,
+	})
+	if err != nil {
+		return c.callError("SaveKeys", err)
+	}
+
+	return nil
+}
+
+// LastUpdated asks the plugin process for the time the newest inactive secret
+// was last updated.
+func (c *Client) LastUpdated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	cli, err := c.client(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	req, err := c.secretRequest(sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	res, err := cli.LastUpdated(ctx, req)
+	if err != nil {
+		return time.Time{}, c.callError("LastUpdated", err)
+	}
+
+	return c.timeOf("LastUpdated", res)
+}
+
+// DisableSecret asks the plugin process to disable the inactive secrets.
+func (c *Client) DisableSecret(
+	ctx context.Context,
+	sec secret.Info,
+) error {
+	cli, err := c.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	req, err := c.secretRequest(sec)
+	if err != nil {
+		return err
+	}
+
+	_, err = cli.DisableSecret(ctx, req)
+	if err != nil {
+		return c.callError("DisableSecret", err)
+	}
+
+	return nil
+}
+
+// timeOf returns the time in the response or an error if it is missing.
+func (c *Client) timeOf(method string, res *pb.TimeResponse) (time.Time, error) {
+	if res.Time == nil {
+		return time.Time{}, fmt.Errorf("plugin process %q did not respond to %s with a time", c.path, method)
+	}
+	return res.Time.AsTime(), nil
+}
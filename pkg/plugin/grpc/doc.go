@@ -0,0 +1,70 @@
+// Package grpc provides a plugin that launches and supervises a long-lived
+// plugin process serving the gRPC service defined in the pb package. The
+// service mirrors the rotate.Client, rotate.Storage, and disable.Client
+// interfaces, so plugins may be written in any language with gRPC support. It
+// also provides Serve, which turns any plugin.Builder into such a program.
+//
+// A plugin process is configured by setting the package to "grpc:" followed
+// by the path to the program. If the path contains no slash, the program is
+// found by searching the PATH:
+//
+//	plugins:
+//	  vault:
+//	    package: grpc:/usr/local/libexec/garotate-vault
+//	    option:
+//	      mount: secret
+//
+// # Handshake
+//
+// The program is started with its standard input connected to a pipe and the
+// following environment variables set in addition to garotate's own:
+//
+//   - GAROTATE_PLUGIN_COOKIE is set to CookieValue. A program that does not
+//     find this should tell the user it is meant to be run by garotate and
+//     exit.
+//   - GAROTATE_PLUGIN_PROTOCOLS is a comma separated list of the protocol
+//     versions garotate speaks. Currently, this is just "1".
+//
+// The program must choose one of the versions offered, start serving the
+// Plugin service on a unix socket or a loopback TCP address, and write a
+// single line to standard output:
+//
+//	<version>|<network>|<address>
+//
+// For example, "1|unix|/tmp/garotate-plugin1234/plugin.sock" or
+// "1|tcp|127.0.0.1:41953". The program must also serve the standard gRPC
+// health service and report the "garotate.plugin.v1.Plugin" service as
+// SERVING when it is ready. Garotate then calls Configure with the configured
+// options before any other method.
+//
+// Anything else the program writes to standard output or standard error is
+// logged. When garotate closes the standard input of the program, the program
+// should finish any calls in progress and exit.
+//
+// # Supervision
+//
+// The health of the process is checked before a method is called if it has
+// not been checked recently. If the process has exited or is not healthy, it
+// is stopped and a new process is started and configured in its place.
+//
+// Each method call carries the deadline and cancellation of the context it is
+// made with to the plugin process, just as with any gRPC call.
+//
+// # Secrets
+//
+// Every call naming a secret also sends the options configured for the secret
+// and the plugin and name of each of its storages. Serve passes these to the
+// plugin as a secret.Info that implements secret.Options and
+// rotate.StoredSecret, keeping only the storages that use the plugin itself.
+// The process cannot reach the other plugins configured in garotate, so
+// LastRotated also sends the time rotate.LastStored finds for the secret,
+// which is what plugins that judge rotation by their storages need.
+//
+// # Errors
+//
+// A plugin should fail LastSaved with the NOT_FOUND status code when the key
+// has never been stored, which is reported as secret.ErrKeyNotFound. It should
+// fail LastUpdated with NOT_FOUND when there is nothing to disable, which is
+// reported as disable.ErrNothingToDisable. Methods a plugin does not support
+// should fail with UNIMPLEMENTED.
+package grpc
@@ -0,0 +1,297 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/rotate"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+var testTime = time.Date(2022, time.May, 9, 0, 4, 29, 0, time.UTC)
+
+func TestMain(m *testing.M) {
+	if os.Getenv(CookieEnv) == CookieValue {
+		if err := Serve(new(testBuilder)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+type testBuilder struct{}
+
+type testPlugin struct {
+	prefix  string
+	plugins *plugin.Manager
+}
+
+// rotations is the cache key used to count rotations of a secret.
+type rotations struct{}
+
+func (*testBuilder) Build(ctx context.Context, c *config.Plugin) (plugin.Instance, error) {
+	plugins := plugin.ManagerFrom(ctx)
+	if plugins == nil {
+		return nil, errors.New("the test plugin must be built by a plugin manager")
+	}
+
+	prefix, _ := c.Options["prefix"].(string)
+	return &testPlugin{prefix, plugins}, nil
+}
+
+func (*testPlugin) Name() string {
+	return "test plugin"
+}
+
+func (*testPlugin) Keys() secret.Map {
+	return secret.Map{"password": ""}
+}
+
+func (p *testPlugin) LastRotated(ctx context.Context, sec secret.Info) (time.Time, error) {
+	if sec.Name() == "generated" {
+		return rotate.LastStored(ctx, p.plugins, p.Keys(), sec)
+	}
+	return testTime, nil
+}
+
+func (p *testPlugin) RotateSecret(ctx context.Context, sec secret.Info) (secret.Map, error) {
+	var opts struct {
+		Suffix string `mapstructure:"suffix"`
+	}
+	if so, ok := sec.(secret.Options); ok {
+		if err := so.DecodeOptions(&opts); err != nil {
+			return nil, err
+		}
+	}
+
+	n, _ := sec.CacheGet(rotations{})
+	count, _ := n.(int)
+	count++
+	sec.CacheSet(rotations{}, count)
+
+	return secret.Map{"password": fmt.Sprintf("%s%s-%d%s", p.prefix, sec.Name(), count, opts.Suffix)}, nil
+}
+
+func (*testPlugin) LastSaved(ctx context.Context, store secret.Storage, key string) (time.Time, error) {
+	if key == "missing" {
+		return time.Time{}, secret.ErrKeyNotFound
+	}
+	return testTime, nil
+}
+
+func (*testPlugin) SaveKeys(ctx context.Context, store secret.Storage, ss secret.Map) error {
+	if ss["password"] == "" {
+		return errors.New("no password given")
+	}
+	return nil
+}
+
+// LastUpdated returns testTime plus an hour for every storage of the secret
+// that uses this plugin.
+func (p *testPlugin) LastUpdated(ctx context.Context, sec secret.Info) (time.Time, error) {
+	if sec.Name() == "current" {
+		return time.Time{}, disable.ErrNothingToDisable
+	}
+
+	names, err := rotate.StorageNames(ctx, p.plugins, p, sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return testTime.Add(time.Duration(len(names)) * time.Hour), nil
+}
+
+func (*testPlugin) DisableSecret(ctx context.Context, sec secret.Info) error {
+	switch sec.Name() {
+	case "crash":
+		os.Exit(3)
+	case "slow":
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return nil
+}
+
+func buildTestClient(t *testing.T) *Client {
+	t.Helper()
+
+	exe, err := os.Executable()
+	require.NoError(t, err)
+
+	inst, err := plugin.Build(context.Background(), &config.Plugin{
+		Name:    "test",
+		Package: PackagePrefix + exe,
+		Options: map[string]any{"prefix": "new-"},
+	})
+	require.NoError(t, err)
+	require.IsType(t, &Client{}, inst)
+
+	c := inst.(*Client)
+	t.Cleanup(func() { assert.NoError(t, c.Close()) })
+	return c
+}
+
+func TestClient(t *testing.T) {
+	c := buildTestClient(t)
+
+	var (
+		_ rotate.Client  = c
+		_ rotate.Storage = c
+		_ disable.Client = c
+	)
+
+	ctx := context.Background()
+	sec := &config.Secret{SecretName: "builder"}
+	store := &config.StorageMap{StorageName: "project"}
+
+	assert.Equal(t, "test plugin", c.Name())
+	assert.Equal(t, secret.Map{"password": ""}, c.Keys())
+
+	lr, err := c.LastRotated(ctx, sec)
+	assert.NoError(t, err)
+	assert.True(t, testTime.Equal(lr))
+
+	keys, err := c.RotateSecret(ctx, sec)
+	assert.NoError(t, err)
+	assert.Equal(t, secret.Map{"password": "new-builder-1"}, keys)
+
+	keys, err = c.RotateSecret(ctx, sec)
+	assert.NoError(t, err)
+	assert.Equal(t, secret.Map{"password": "new-builder-2"}, keys, "cache lasts between calls")
+
+	ls, err := c.LastSaved(ctx, store, "password")
+	assert.NoError(t, err)
+	assert.True(t, testTime.Equal(ls))
+
+	_, err = c.LastSaved(ctx, store, "missing")
+	assert.True(t, errors.Is(err, secret.ErrKeyNotFound))
+
+	assert.NoError(t, c.SaveKeys(ctx, store, keys))
+	assert.ErrorContains(t, c.SaveKeys(ctx, store, secret.Map{}), "no password given")
+
+	lu, err := c.LastUpdated(ctx, sec)
+	assert.NoError(t, err)
+	assert.True(t, testTime.Equal(lu))
+
+	_, err = c.LastUpdated(ctx, &config.Secret{SecretName: "current"})
+	assert.True(t, errors.Is(err, disable.ErrNothingToDisable))
+
+	assert.NoError(t, c.DisableSecret(ctx, sec))
+}
+
+func TestClientSecret(t *testing.T) {
+	exe, err := os.Executable()
+	require.NoError(t, err)
+
+	plugins := plugin.NewManager(config.PluginList{
+		"test":  {Name: "test", Package: PackagePrefix + exe},
+		"other": {Name: "other", Package: PackagePrefix + exe},
+	})
+	t.Cleanup(func() { assert.NoError(t, plugins.Close()) })
+
+	ctx := context.Background()
+	inst, err := plugins.Instance(ctx, "test")
+	require.NoError(t, err)
+	require.IsType(t, &Client{}, inst)
+	c := inst.(*Client)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, secret.Map{"password": ""}, c.Keys())
+		}()
+	}
+	wg.Wait()
+
+	sec := &config.Secret{
+		SecretName: "generated",
+		Options:    map[string]any{"suffix": "!"},
+		Storages: []config.StorageMap{
+			{StorageClient: "test", StorageName: "project", Keys: config.KeyMap{"password": "missing"}},
+			{StorageClient: "other", StorageName: "elsewhere", Keys: config.KeyMap{"password": "missing"}},
+			{StorageClient: "test", StorageName: "archive", Keys: config.KeyMap{"password": "missing"}},
+		},
+	}
+
+	lr, err := c.LastRotated(ctx, sec)
+	assert.NoError(t, err)
+	assert.True(t, lr.IsZero(), "never stored")
+
+	sec.Storages[1].Keys = nil
+	lr, err = c.LastRotated(ctx, sec)
+	assert.NoError(t, err)
+	assert.True(t, testTime.Equal(lr), "last stored found by garotate")
+
+	keys, err := c.RotateSecret(ctx, sec)
+	assert.NoError(t, err)
+	assert.Equal(t, secret.Map{"password": "generated-1!"}, keys, "secret options sent")
+
+	lu, err := c.LastUpdated(ctx, sec)
+	assert.NoError(t, err)
+	assert.True(t, testTime.Add(2*time.Hour).Equal(lu), "only storages using the plugin")
+}
+
+func TestClientCancel(t *testing.T) {
+	c := buildTestClient(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := c.DisableSecret(ctx, &config.Secret{SecretName: "slow"})
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestClientRestart(t *testing.T) {
+	c := buildTestClient(t)
+
+	ctx := context.Background()
+	sec := &config.Secret{SecretName: "builder"}
+
+	_, err := c.RotateSecret(ctx, sec)
+	assert.NoError(t, err)
+
+	assert.Error(t, c.DisableSecret(ctx, &config.Secret{SecretName: "crash"}))
+
+	keys, err := c.RotateSecret(ctx, sec)
+	assert.NoError(t, err)
+	assert.Equal(t, secret.Map{"password": "new-builder-1"}, keys, "process was restarted")
+}
+
+func TestServeNotPlugin(t *testing.T) {
+	assert.Equal(t, ErrNotPluginProcess, Serve(new(testBuilder)))
+}
+
+func TestParseHandshake(t *testing.T) {
+	hs, err := parseHandshake("1|unix|/tmp/plugin.sock\n")
+	require.NoError(t, err)
+	assert.Equal(t, "unix:///tmp/plugin.sock", hs.target())
+
+	hs, err = parseHandshake("1|tcp|127.0.0.1:1234")
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:1234", hs.target())
+
+	_, err = parseHandshake("2|tcp|127.0.0.1:1234")
+	assert.Error(t, err)
+
+	_, err = parseHandshake("1|udp|127.0.0.1:1234")
+	assert.Error(t, err)
+
+	_, err = parseHandshake("hello, world")
+	assert.Error(t, err)
+}
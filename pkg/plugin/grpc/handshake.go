@@ -0,0 +1,106 @@
+package grpc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zostay/garotate/pkg/plugin/grpc/pb"
+)
+
+// PackagePrefix is the prefix of the configured package that marks the rest
+// as the path to a plugin program.
+const PackagePrefix = "grpc:"
+
+// ProtocolVersion is the version of the handshake and service spoken by this
+// package.
+const ProtocolVersion = 1
+
+const (
+	// CookieEnv is the environment variable garotate sets to CookieValue when
+	// starting a plugin process.
+	CookieEnv = "GAROTATE_PLUGIN_COOKIE"
+
+	// CookieValue is the value of CookieEnv. It is only used to tell a plugin
+	// program whether it has been started by garotate.
+	CookieValue = "3c8ab3e1f67b4ae6b3b9b9aa5bd8b0d8"
+
+	// ProtocolsEnv is the environment variable garotate sets to the comma
+	// separated list of protocol versions it speaks.
+	ProtocolsEnv = "GAROTATE_PLUGIN_PROTOCOLS"
+)
+
+// ServiceName is the name of the service the plugin reports on through the
+// gRPC health service.
+var ServiceName = pb.Plugin_ServiceDesc.ServiceName
+
+const (
+	// startTimeout is how long to wait for a plugin process to complete the
+	// handshake and become healthy.
+	startTimeout = 30 * time.Second
+
+	// stopTimeout is how long to wait for a plugin process to exit after its
+	// standard input has been closed before killing it.
+	stopTimeout = 5 * time.Second
+
+	// healthInterval is how long a successful health check is trusted.
+	healthInterval = 30 * time.Second
+)
+
+// handshake is the line a plugin process writes to report where it is
+// serving.
+type handshake struct {
+	version int
+	network string
+	address string
+}
+
+// parseHandshake parses the handshake line written by the plugin process.
+func parseHandshake(line string) (*handshake, error) {
+	parts := strings.Split(strings.TrimSpace(line), "|")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed plugin handshake %q", line)
+	}
+
+	version, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed protocol version in plugin handshake %q", line)
+	}
+	if version != ProtocolVersion {
+		return nil, fmt.Errorf("plugin chose protocol version %d, but only version %d is supported", version, ProtocolVersion)
+	}
+
+	hs := &handshake{version, parts[1], parts[2]}
+	switch hs.network {
+	case "unix", "tcp":
+	default:
+		return nil, fmt.Errorf("unsupported network %q in plugin handshake", hs.network)
+	}
+
+	return hs, nil
+}
+
+// String returns the handshake line.
+func (hs *handshake) String() string {
+	return fmt.Sprintf("%d|%s|%s", hs.version, hs.network, hs.address)
+}
+
+// target returns the gRPC dial target for the address.
+func (hs *handshake) target() string {
+	if hs.network == "unix" {
+		return "unix://" + hs.address
+	}
+	return hs.address
+}
+
+// supportsProtocol returns true if the comma separated list of protocol
+// versions includes ProtocolVersion.
+func supportsProtocol(versions string) bool {
+	for _, v := range strings.Split(versions, ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n == ProtocolVersion {
+			return true
+		}
+	}
+	return false
+}
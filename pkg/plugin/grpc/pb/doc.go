@@ -0,0 +1,5 @@
+// Package pb holds the protocol buffer messages and gRPC service generated from
+// plugin.proto, which is the service served by plugin processes.
+package pb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative plugin.proto
@@ -0,0 +1,392 @@
+// This is the service served by long-lived garotate plugin processes. See the
+// documentation of the github.com/zostay/garotate/pkg/plugin/grpc package for
+// a description of how plugin processes are launched.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: plugin.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Plugin_Configure_FullMethodName     = "/garotate.plugin.v1.Plugin/Configure"
+	Plugin_Keys_FullMethodName          = "/garotate.plugin.v1.Plugin/Keys"
+	Plugin_LastRotated_FullMethodName   = "/garotate.plugin.v1.Plugin/LastRotated"
+	Plugin_RotateSecret_FullMethodName  = "/garotate.plugin.v1.Plugin/RotateSecret"
+	Plugin_LastSaved_FullMethodName     = "/garotate.plugin.v1.Plugin/LastSaved"
+	Plugin_SaveKeys_FullMethodName      = "/garotate.plugin.v1.Plugin/SaveKeys"
+	Plugin_LastUpdated_FullMethodName   = "/garotate.plugin.v1.Plugin/LastUpdated"
+	Plugin_DisableSecret_FullMethodName = "/garotate.plugin.v1.Plugin/DisableSecret"
+)
+
+// PluginClient is the client API for Plugin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type PluginClient interface {
+	// Configure is called once after the process starts and before any other
+	// method. It passes the configured options and returns the plugin name.
+	Configure(ctx context.Context, in *ConfigureRequest, opts ...grpc.CallOption) (*ConfigureResponse, error)
+	// Keys returns the keys RotateSecret returns values for.
+	Keys(ctx context.Context, in *KeysRequest, opts ...grpc.CallOption) (*KeysResponse, error)
+	// LastRotated returns the time the secret was last rotated.
+	LastRotated(ctx context.Context, in *SecretRequest, opts ...grpc.CallOption) (*TimeResponse, error)
+	// RotateSecret rotates the secret and returns the new values.
+	RotateSecret(ctx context.Context, in *SecretRequest, opts ...grpc.CallOption) (*KeysResponse, error)
+	// LastSaved returns the time the key was last saved to the storage. It
+	// fails with NOT_FOUND if the key has never been saved.
+	LastSaved(ctx context.Context, in *LastSavedRequest, opts ...grpc.CallOption) (*TimeResponse, error)
+	// SaveKeys saves the keys to the storage.
+	SaveKeys(ctx context.Context, in *SaveKeysRequest, opts ...grpc.CallOption) (*SaveKeysResponse, error)
+	// LastUpdated returns the time the newest inactive secret was updated.
+	LastUpdated(ctx context.Context, in *SecretRequest, opts ...grpc.CallOption) (*TimeResponse, error)
+	// DisableSecret disables the inactive secrets.
+	DisableSecret(ctx context.Context, in *SecretRequest, opts ...grpc.CallOption) (*DisableSecretResponse, error)
+}
+
+type pluginClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPluginClient(cc grpc.ClientConnInterface) PluginClient {
+	return &pluginClient{cc}
+}
+
+func (c *pluginClient) Configure(ctx context.Context, in *ConfigureRequest, opts ...grpc.CallOption) (*ConfigureResponse, error) {
+	out := new(ConfigureResponse)
+	err := c.cc.Invoke(ctx, Plugin_Configure_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pluginClient) Keys(ctx context.Context, in *KeysRequest, opts ...grpc.CallOption) (*KeysResponse, error) {
+	out := new(KeysResponse)
+	err := c.cc.Invoke(ctx, Plugin_Keys_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pluginClient) LastRotated(ctx context.Context, in *SecretRequest, opts ...grpc.CallOption) (*TimeResponse, error) {
+	out := new(TimeResponse)
+	err := c.cc.Invoke(ctx, Plugin_LastRotated_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pluginClient) RotateSecret(ctx context.Context, in *SecretRequest, opts ...grpc.CallOption) (*KeysResponse, error) {
+	out := new(KeysResponse)
+	err := c.cc.Invoke(ctx, Plugin_RotateSecret_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pluginClient) LastSaved(ctx context.Context, in *LastSavedRequest, opts ...grpc.CallOption) (*TimeResponse, error) {
+	out := new(TimeResponse)
+	err := c.cc.Invoke(ctx, Plugin_LastSaved_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pluginClient) SaveKeys(ctx context.Context, in *SaveKeysRequest, opts ...grpc.CallOption) (*SaveKeysResponse, error) {
+	out := new(SaveKeysResponse)
+	err := c.cc.Invoke(ctx, Plugin_SaveKeys_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pluginClient) LastUpdated(ctx context.Context, in *SecretRequest, opts ...grpc.CallOption) (*TimeResponse, error) {
+	out := new(TimeResponse)
+	err := c.cc.Invoke(ctx, Plugin_LastUpdated_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pluginClient) DisableSecret(ctx context.Context, in *SecretRequest, opts ...grpc.CallOption) (*DisableSecretResponse, error) {
+	out := new(DisableSecretResponse)
+	err := c.cc.Invoke(ctx, Plugin_DisableSecret_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PluginServer is the server API for Plugin service.
+// All implementations must embed UnimplementedPluginServer
+// for forward compatibility
+type PluginServer interface {
+	// Configure is called once after the process starts and before any other
+	// method. It passes the configured options and returns the plugin name.
+	Configure(context.Context, *ConfigureRequest) (*ConfigureResponse, error)
+	// Keys returns the keys RotateSecret returns values for.
+	Keys(context.Context, *KeysRequest) (*KeysResponse, error)
+	// LastRotated returns the time the secret was last rotated.
+	LastRotated(context.Context, *SecretRequest) (*TimeResponse, error)
+	// RotateSecret rotates the secret and returns the new values.
+	RotateSecret(context.Context, *SecretRequest) (*KeysResponse, error)
+	// LastSaved returns the time the key was last saved to the storage. It
+	// fails with NOT_FOUND if the key has never been saved.
+	LastSaved(context.Context, *LastSavedRequest) (*TimeResponse, error)
+	// SaveKeys saves the keys to the storage.
+	SaveKeys(context.Context, *SaveKeysRequest) (*SaveKeysResponse, error)
+	// LastUpdated returns the time the newest inactive secret was updated.
+	LastUpdated(context.Context, *SecretRequest) (*TimeResponse, error)
+	// DisableSecret disables the inactive secrets.
+	DisableSecret(context.Context, *SecretRequest) (*DisableSecretResponse, error)
+	mustEmbedUnimplementedPluginServer()
+}
+
+// UnimplementedPluginServer must be embedded to have forward compatible implementations.
+type UnimplementedPluginServer struct {
+}
+
+func (UnimplementedPluginServer) Configure(context.Context, *ConfigureRequest) (*ConfigureResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Configure not implemented")
+}
+func (UnimplementedPluginServer) Keys(context.Context, *KeysRequest) (*KeysResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Keys not implemented")
+}
+func (UnimplementedPluginServer) LastRotated(context.Context, *SecretRequest) (*TimeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LastRotated not implemented")
+}
+func (UnimplementedPluginServer) RotateSecret(context.Context, *SecretRequest) (*KeysResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RotateSecret not implemented")
+}
+func (UnimplementedPluginServer) LastSaved(context.Context, *LastSavedRequest) (*TimeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LastSaved not implemented")
+}
+func (UnimplementedPluginServer) SaveKeys(context.Context, *SaveKeysRequest) (*SaveKeysResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SaveKeys not implemented")
+}
+func (UnimplementedPluginServer) LastUpdated(context.Context, *SecretRequest) (*TimeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LastUpdated not implemented")
+}
+func (UnimplementedPluginServer) DisableSecret(context.Context, *SecretRequest) (*DisableSecretResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DisableSecret not implemented")
+}
+func (UnimplementedPluginServer) mustEmbedUnimplementedPluginServer() {}
+
+// UnsafePluginServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PluginServer will
+// result in compilation errors.
+type UnsafePluginServer interface {
+	mustEmbedUnimplementedPluginServer()
+}
+
+func RegisterPluginServer(s grpc.ServiceRegistrar, srv PluginServer) {
+	s.RegisterService(&Plugin_ServiceDesc, srv)
+}
+
+func _Plugin_Configure_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConfigureRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PluginServer).Configure(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Plugin_Configure_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginServer).Configure(ctx, req.(*ConfigureRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Plugin_Keys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeysRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PluginServer).Keys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Plugin_Keys_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginServer).Keys(ctx, req.(*KeysRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Plugin_LastRotated_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SecretRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PluginServer).LastRotated(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Plugin_LastRotated_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginServer).LastRotated(ctx, req.(*SecretRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Plugin_RotateSecret_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SecretRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PluginServer).RotateSecret(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Plugin_RotateSecret_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginServer).RotateSecret(ctx, req.(*SecretRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Plugin_LastSaved_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LastSavedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PluginServer).LastSaved(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Plugin_LastSaved_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginServer).LastSaved(ctx, req.(*LastSavedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Plugin_SaveKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SaveKeysRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PluginServer).SaveKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Plugin_SaveKeys_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginServer).SaveKeys(ctx, req.(*SaveKeysRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Plugin_LastUpdated_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SecretRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PluginServer).LastUpdated(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Plugin_LastUpdated_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginServer).LastUpdated(ctx, req.(*SecretRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Plugin_DisableSecret_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SecretRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PluginServer).DisableSecret(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Plugin_DisableSecret_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginServer).DisableSecret(ctx, req.(*SecretRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Plugin_ServiceDesc is the grpc.ServiceDesc for Plugin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Plugin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "garotate.plugin.v1.Plugin",
+	HandlerType: (*PluginServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Configure",
+			Handler:    _Plugin_Configure_Handler,
+		},
+		{
+			MethodName: "Keys",
+			Handler:    _Plugin_Keys_Handler,
+		},
+		{
+			MethodName: "LastRotated",
+			Handler:    _Plugin_LastRotated_Handler,
+		},
+		{
+			MethodName: "RotateSecret",
+			Handler:    _Plugin_RotateSecret_Handler,
+		},
+		{
+			MethodName: "LastSaved",
+			Handler:    _Plugin_LastSaved_Handler,
+		},
+		{
+			MethodName: "SaveKeys",
+			Handler:    _Plugin_SaveKeys_Handler,
+		},
+		{
+			MethodName: "LastUpdated",
+			Handler:    _Plugin_LastUpdated_Handler,
+		},
+		{
+			MethodName: "DisableSecret",
+			Handler:    _Plugin_DisableSecret_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "plugin.proto",
+}
@@ -0,0 +1,213 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	osexec "os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/zostay/garotate/pkg/errors"
+	"github.com/zostay/garotate/pkg/plugin/grpc/pb"
+)
+
+// process is a running plugin process and the connection to it.
+type process struct {
+	cmd    *osexec.Cmd
+	stdin  io.WriteCloser
+	conn   *grpclib.ClientConn
+	plugin pb.PluginClient
+	health healthpb.HealthClient
+
+	exited  chan struct{}
+	waitErr error
+
+	lastCheck time.Time
+}
+
+// lineWriter is an io.Writer that calls a function with each complete line
+// written to it.
+type lineWriter struct {
+	mu   sync.Mutex
+	buf  []byte
+	line func(string)
+}
+
+// Write buffers p and calls the line function for each complete line.
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.line(string(bytes.TrimRight(w.buf[:i], "\r")))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// startProcess runs the plugin program, waits for the handshake, connects to
+// it, and waits for it to report that it is healthy.
+func startProcess(
+	ctx context.Context,
+	path string,
+	logger *zap.Logger,
+) (*process, error) {
+	slog := logger.Sugar()
+
+	p := &process{exited: make(chan struct{})}
+
+	handshakes := make(chan string, 1)
+	first := true
+	stdout := &lineWriter{line: func(line string) {
+		if first {
+			first = false
+			handshakes <- line
+			return
+		}
+		slog.Debugw("plugin process wrote to standard output",
+			"plugin", path,
+			"output", line,
+		)
+	}}
+	stderr := &lineWriter{line: func(line string) {
+		slog.Debugw("plugin process wrote to standard error",
+			"plugin", path,
+			"output", line,
+		)
+	}}
+
+	p.cmd = osexec.Command(path)
+	p.cmd.Env = append(os.Environ(),
+		CookieEnv+"="+CookieValue,
+		ProtocolsEnv+"="+strconv.Itoa(ProtocolVersion),
+	)
+	p.cmd.Stdout = stdout
+	p.cmd.Stderr = stderr
+
+	var err error
+	p.stdin, err = p.cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to plugin process %q: %w", path, err)
+	}
+
+	if err := p.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start plugin process %q: %w", path, err)
+	}
+
+	go func() {
+		p.waitErr = p.cmd.Wait()
+		close(p.exited)
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, startTimeout)
+	defer cancel()
+
+	var line string
+	select {
+	case line = <-handshakes:
+	case <-p.exited:
+		return nil, fmt.Errorf("plugin process %q exited before completing the handshake: %v", path, p.waitErr)
+	case <-ctx.Done():
+		p.stop()
+		return nil, fmt.Errorf("plugin process %q did not complete the handshake: %w", path, ctx.Err())
+	}
+
+	hs, err := parseHandshake(line)
+	if err != nil {
+		p.stop()
+		return nil, fmt.Errorf("plugin process %q failed the handshake: %w", path, err)
+	}
+
+	slog.Debugw("plugin process started",
+		"plugin", path,
+		"pid", p.cmd.Process.Pid,
+		"handshake", hs.String(),
+	)
+
+	p.conn, err = grpclib.Dial(hs.target(),
+		grpclib.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		p.stop()
+		return nil, fmt.Errorf("failed to connect to plugin process %q: %w", path, err)
+	}
+
+	p.plugin = pb.NewPluginClient(p.conn)
+	p.health = healthpb.NewHealthClient(p.conn)
+
+	if err := p.check(ctx, grpclib.WaitForReady(true)); err != nil {
+		p.stop()
+		return nil, fmt.Errorf("plugin process %q is not healthy: %w", path, err)
+	}
+
+	return p, nil
+}
+
+// running returns false if the process has exited.
+func (p *process) running() bool {
+	select {
+	case <-p.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// check asks the plugin process whether the plugin service is serving. It
+// returns an error if it is not.
+func (p *process) check(ctx context.Context, opts ...grpclib.CallOption) error {
+	res, err := p.health.Check(ctx, &healthpb.HealthCheckRequest{
+		Service: ServiceName,
+	}, opts...)
+	if err != nil {
+		return err
+	}
+
+	if res.Status != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("plugin service status is %s", res.Status)
+	}
+
+	p.lastCheck = time.Now()
+	return nil
+}
+
+// stop closes the connection and the standard input of the process, which
+// asks it to exit. If it does not exit promptly, it is killed.
+func (p *process) stop() error {
+	var errs []error
+	if p.conn != nil {
+		if err := p.conn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	_ = p.stdin.Close()
+
+	select {
+	case <-p.exited:
+	case <-time.After(stopTimeout):
+		if err := p.cmd.Process.Kill(); err != nil {
+			errs = append(errs, err)
+		}
+		<-p.exited
+	}
+
+	if len(errs) > 0 {
+		return errors.NewAggregate(errs)
+	}
+	return nil
+}
@@ -0,0 +1,433 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/plugin/grpc/pb"
+	"github.com/zostay/garotate/pkg/rotate"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+// ErrNotPluginProcess is returned by Serve when the program was not started by
+// garotate as a plugin process.
+var ErrNotPluginProcess = errors.New("this program is a garotate plugin and must be run by garotate")
+
+// Serve runs the current program as a plugin process serving the plugin built
+// by the given builder. The builder is called when garotate configures the
+// plugin. Serve returns when garotate closes the standard input of the
+// process. It returns ErrNotPluginProcess if the program was not started by
+// garotate.
+//
+// A plugin program may be as simple as:
+//
+//	func main() {
+//		if err := grpc.Serve(new(builder)); err != nil {
+//			fmt.Fprintln(os.Stderr, err)
+//			os.Exit(1)
+//		}
+//	}
+func Serve(b plugin.Builder) error {
+	if os.Getenv(CookieEnv) != CookieValue {
+		return ErrNotPluginProcess
+	}
+
+	if !supportsProtocol(os.Getenv(ProtocolsEnv)) {
+		return fmt.Errorf("garotate does not support plugin protocol version %d", ProtocolVersion)
+	}
+
+	lis, cleanup, err := listen()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	srv := grpclib.NewServer()
+	pb.RegisterPluginServer(srv, &server{builder: b})
+
+	hs := health.NewServer()
+	hs.SetServingStatus(ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv, hs)
+
+	go func() {
+		_, _ = io.Copy(io.Discard, os.Stdin)
+		hs.Shutdown()
+		srv.GracefulStop()
+	}()
+
+	fmt.Println((&handshake{
+		version: ProtocolVersion,
+		network: lis.Addr().Network(),
+		address: lis.Addr().String(),
+	}).String())
+
+	return srv.Serve(lis)
+}
+
+// listen listens on a unix socket in a private temporary directory. If that
+// is not possible, it listens on a loopback TCP port. It returns a function
+// to clean up after the listener.
+func listen() (net.Listener, func(), error) {
+	dir, err := os.MkdirTemp("", "garotate-plugin")
+	if err == nil {
+		lis, err := net.Listen("unix", filepath.Join(dir, "plugin.sock"))
+		if err == nil {
+			return lis, func() { _ = os.RemoveAll(dir) }, nil
+		}
+		_ = os.RemoveAll(dir)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to listen for garotate: %w", err)
+	}
+	return lis, func() {}, nil
+}
+
+// cache holds the values cached with a secret or storage. The cache of each
+// secret and storage lasts as long as the process.
+type cache struct {
+	mu     sync.Mutex
+	values map[any]any
+}
+
+// CacheSet sets a cache key associated with the secret or storage.
+func (c *cache) CacheSet(k, v any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[k] = v
+}
+
+// CacheGet returns a set cache key and a boolean indicating whether it has
+// been set.
+func (c *cache) CacheGet(k any) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.values[k]
+	return v, ok
+}
+
+// CacheClear deletes the cache key.
+func (c *cache) CacheClear(k any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.values, k)
+}
+
+// target implements secret.Info, secret.Options, secret.Storage, and
+// rotate.StoredSecret for the secret or storage named in a call. Every target
+// naming the same secret or storage shares the same cache.
+type target struct {
+	*cache
+
+	name       string
+	options    map[string]any
+	storages   []string
+	lastStored time.Time
+	stored     bool
+}
+
+// Name returns the name of the secret or storage.
+func (t *target) Name() string {
+	return t.name
+}
+
+// DecodeOptions decodes the options configured for the secret into the given
+// value, just like config.Secret.DecodeOptions.
+func (t *target) DecodeOptions(out any) error {
+	return (&config.Secret{Options: t.options}).DecodeOptions(out)
+}
+
+// LastStored returns the time garotate found the secret was last stored and
+// true, or false if garotate did not send it.
+func (t *target) LastStored() (time.Time, bool) {
+	return t.lastStored, t.stored
+}
+
+// StorageNames returns the names of the storages of the secret that use this
+// plugin.
+func (t *target) StorageNames() []string {
+	return t.storages
+}
+
+// server implements the Plugin service using an instance built by a
+// plugin.Builder.
+type server struct {
+	pb.UnimplementedPluginServer
+
+	builder plugin.Builder
+
+	mu       sync.Mutex
+	name     string
+	inst     plugin.Instance
+	secrets  map[string]*cache
+	storages map[string]*cache
+}
+
+// secretTarget returns the target for the secret described in the request.
+// Only the storages of the secret that use this plugin are kept.
+func (s *server) secretTarget(req *pb.SecretRequest) *target {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := &target{
+		cache:   getCache(s.secrets, req.Name),
+		name:    req.Name,
+		options: req.Options.AsMap(),
+	}
+
+	for _, sm := range req.Storages {
+		if strings.EqualFold(sm.Plugin, s.name) {
+			t.storages = append(t.storages, sm.Name)
+		}
+	}
+
+	if req.LastStored != nil {
+		t.lastStored = req.LastStored.AsTime()
+		t.stored = true
+	}
+
+	return t
+}
+
+// storageTarget returns the target for the named storage.
+func (s *server) storageTarget(name string) *target {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &target{cache: getCache(s.storages, name), name: name}
+}
+
+// getCache returns the cache with the given name, creating it if needed.
+func getCache(caches map[string]*cache, name string) *cache {
+	c, ok := caches[name]
+	if !ok {
+		c = &cache{values: make(map[any]any)}
+		caches[name] = c
+	}
+	return c
+}
+
+// instance returns the configured instance or fails if Configure has not been
+// called.
+func (s *server) instance() (plugin.Instance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inst == nil {
+		return nil, status.Error(codes.FailedPrecondition, "plugin has not been configured")
+	}
+	return s.inst, nil
+}
+
+// rotateClient returns the instance as a rotate.Client.
+func (s *server) rotateClient() (rotate.Client, error) {
+	inst, err := s.instance()
+	if err != nil {
+		return nil, err
+	}
+	c, ok := inst.(rotate.Client)
+	if !ok {
+		return nil, status.Errorf(codes.Unimplemented, "plugin %q is not a rotation client", inst.Name())
+	}
+	return c, nil
+}
+
+// storage returns the instance as a rotate.Storage.
+func (s *server) storage() (rotate.Storage, error) {
+	inst, err := s.instance()
+	if err != nil {
+		return nil, err
+	}
+	c, ok := inst.(rotate.Storage)
+	if !ok {
+		return nil, status.Errorf(codes.Unimplemented, "plugin %q is not a storage client", inst.Name())
+	}
+	return c, nil
+}
+
+// disableClient returns the instance as a disable.Client.
+func (s *server) disableClient() (disable.Client, error) {
+	inst, err := s.instance()
+	if err != nil {
+		return nil, err
+	}
+	c, ok := inst.(disable.Client)
+	if !ok {
+		return nil, status.Errorf(codes.Unimplemented, "plugin %q is not a disablement client", inst.Name())
+	}
+	return c, nil
+}
+
+// toStatus turns an error returned by the instance into a status.
+func toStatus(err error) error {
+	if errors.Is(err, secret.ErrKeyNotFound) || errors.Is(err, disable.ErrNothingToDisable) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	if errors.Is(err, context.Canceled) {
+		return status.Error(codes.Canceled, err.Error())
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
+
+// Configure builds the instance using the given configuration. The builder is
+// given a plugin manager, as some plugins require one, but it has no other
+// plugins configured. The secrets passed to the instance carry what those
+// plugins would look up with it instead.
+func (s *server) Configure(
+	ctx context.Context,
+	req *pb.ConfigureRequest,
+) (*pb.ConfigureResponse, error) {
+	ctx = plugin.WithManager(ctx, plugin.NewManager(config.PluginList{}))
+	inst, err := s.builder.Build(ctx, &config.Plugin{
+		Name:    req.Name,
+		Package: req.Package,
+		Options: req.Options.AsMap(),
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = req.Name
+	s.inst = inst
+	s.secrets = make(map[string]*cache)
+	s.storages = make(map[string]*cache)
+
+	return &pb.ConfigureResponse{Name: inst.Name()}, nil
+}
+
+// Keys returns the keys of the rotation client.
+func (s *server) Keys(
+	ctx context.Context,
+	req *pb.KeysRequest,
+) (*pb.KeysResponse, error) {
+	c, err := s.rotateClient()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.KeysResponse{Keys: c.Keys()}, nil
+}
+
+// LastRotated calls LastRotated on the rotation client.
+func (s *server) LastRotated(
+	ctx context.Context,
+	req *pb.SecretRequest,
+) (*pb.TimeResponse, error) {
+	c, err := s.rotateClient()
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := c.LastRotated(ctx, s.secretTarget(req))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.TimeResponse{Time: timestamppb.New(t)}, nil
+}
+
+// RotateSecret calls RotateSecret on the rotation client.
+func (s *server) RotateSecret(
+	ctx context.Context,
+	req *pb.SecretRequest,
+) (*pb.KeysResponse, error) {
+	c, err := s.rotateClient()
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := c.RotateSecret(ctx, s.secretTarget(req))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.KeysResponse{Keys: keys}, nil
+}
+
+// LastSaved calls LastSaved on the storage client.
+func (s *server) LastSaved(
+	ctx context.Context,
+	req *pb.LastSavedRequest,
+) (*pb.TimeResponse, error) {
+	c, err := s.storage()
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := c.LastSaved(ctx, s.storageTarget(req.Name), req.Key)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.TimeResponse{Time: timestamppb.New(t)}, nil
+}
+
+// SaveKeys calls SaveKeys on the storage client.
+func (s *server) SaveKeys(
+	ctx context.Context,
+	req *pb.SaveKeysRequest,
+) (*pb.SaveKeysResponse, error) {
+	c, err := s.storage()
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.SaveKeys(ctx, s.storageTarget(req.Name), req.Keys)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.SaveKeysResponse{}, nil
+}
+
+// LastUpdated calls LastUpdated on the disablement client.
+func (s *server) LastUpdated(
+	ctx context.Context,
+	req *pb.SecretRequest,
+) (*pb.TimeResponse, error) {
+	c, err := s.disableClient()
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := c.LastUpdated(ctx, s.secretTarget(req))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.TimeResponse{Time: timestamppb.New(t)}, nil
+}
+
+// DisableSecret calls DisableSecret on the disablement client.
+func (s *server) DisableSecret(
+	ctx context.Context,
+	req *pb.SecretRequest,
+) (*pb.DisableSecretResponse, error) {
+	c, err := s.disableClient()
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.DisableSecret(ctx, s.secretTarget(req))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.DisableSecretResponse{}, nil
+}
@@ -0,0 +1,47 @@
+// Package atomicfile provides the file replacement shared by plugins that keep
+// state or publish documents in local files. Files are written to a temporary
+// file alongside them and renamed into place, so readers never see them partly
+// written and a failed write leaves the old file as it was.
+package atomicfile
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Write replaces the named file with whatever the write function writes. The
+// new file is given the permissions in perm. The directory of the file must
+// already exist.
+func Write(name string, perm os.FileMode, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if err := write(tmp); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err := tmp.Chmod(perm); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
+
+// WriteFile replaces the named file with data, like os.WriteFile.
+func WriteFile(name string, data []byte, perm os.FileMode) error {
+	return Write(name, perm, func(w io.Writer) error {
+		_, err := io.Copy(w, bytes.NewReader(data))
+		return err
+	})
+}
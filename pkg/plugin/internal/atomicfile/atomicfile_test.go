@@ -0,0 +1,58 @@
+package atomicfile
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "state.pem")
+
+	require.NoError(t, WriteFile(name, []byte("first"), 0o600))
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(data))
+
+	fi, err := os.Stat(name)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+	require.NoError(t, WriteFile(name, []byte("second"), 0o644))
+	data, err = os.ReadFile(name)
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(data), "replaced")
+
+	fi, err = os.Stat(name)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o644), fi.Mode().Perm())
+
+	assert.Error(t, WriteFile(filepath.Join(dir, "missing", "state.pem"), nil, 0o600), "directory must exist")
+}
+
+func TestWriteFailure(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "db.kdbx")
+	require.NoError(t, os.WriteFile(name, []byte("original"), 0o600))
+
+	boom := errors.New("boom")
+	err := Write(name, 0o600, func(w io.Writer) error {
+		_, _ = io.WriteString(w, "partial")
+		return boom
+	})
+	assert.ErrorIs(t, err, boom)
+
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+	assert.Equal(t, "original", string(data), "left as it was")
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "temporary file removed")
+}
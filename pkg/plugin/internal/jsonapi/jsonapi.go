@@ -0,0 +1,132 @@
+// Package jsonapi provides the client for JSON over HTTP APIs shared by the
+// plugins that rotate secrets through such an API.
+package jsonapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// maxErrorBody is the most of an unsuccessful response that is read to find
+// the error message.
+const maxErrorBody = 64 << 10
+
+// Client sends requests with JSON bodies to an API and decodes the JSON
+// responses.
+type Client struct {
+	// HTTP is the client used to send requests. If it is nil,
+	// http.DefaultClient is used.
+	HTTP *http.Client
+
+	// Base is the URL every request path is resolved against.
+	Base *url.URL
+
+	// Header holds headers set on every request, such as credentials.
+	Header http.Header
+
+	// ErrorMessage finds the error message in the body of an unsuccessful
+	// response. It returns an empty string if there is none. If it is nil,
+	// no message is looked for.
+	ErrorMessage func(body []byte) string
+}
+
+// StatusError is returned when the API responds with a status other than 2xx.
+type StatusError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+
+	// Status is the HTTP status of the response, such as "404 Not Found".
+	Status string
+
+	// Message is the error message found in the response, if any.
+	Message string
+}
+
+// Error returns the message of the API and the status or, if there is no
+// message, just the status.
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%s (%s)", e.Message, e.Status)
+	}
+	return fmt.Sprintf("unexpected response %s", e.Status)
+}
+
+// Call sends a request to the given path, which must already be escaped, and
+// query, resolved against the base URL, with the JSON encoding of in as the
+// body, if in is not nil. The given headers are set in addition to the headers
+// of the client. A 2xx response is decoded into out, if out is not nil. Any
+// other response is returned as a *StatusError.
+func (c *Client) Call(
+	ctx context.Context,
+	method string,
+	p string,
+	query url.Values,
+	header http.Header,
+	in any,
+	out any,
+) error {
+	ref, err := url.Parse(p)
+	if err != nil {
+		return err
+	}
+	ref.RawQuery = query.Encode()
+	u := c.Base.ResolveReference(ref)
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return err
+	}
+	for _, h := range []http.Header{c.Header, header} {
+		for k, vs := range h {
+			req.Header[k] = vs
+		}
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	hc := c.HTTP
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		sErr := &StatusError{StatusCode: res.StatusCode, Status: res.Status}
+		if c.ErrorMessage != nil {
+			data, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+			sErr.Message = c.ErrorMessage(data)
+		}
+		return sErr
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
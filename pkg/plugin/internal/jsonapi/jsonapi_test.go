@@ -0,0 +1,93 @@
+package jsonapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCall(t *testing.T) {
+	ctx := context.Background()
+
+	var got *http.Request
+	var gotBody map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody = nil
+		_ = json.NewDecoder(r.Body).Decode(&gotBody)
+
+		switch r.URL.Path {
+		case "/api/things/a%2Fb", "/api/things/a/b":
+			_, _ = w.Write([]byte(`{"name":"thing"}`))
+		case "/api/garbled":
+			_, _ = w.Write([]byte(`{"name":`))
+		case "/api/quiet":
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte(`<html>bad gateway</html>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"no such thing"}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	base, err := url.Parse(srv.URL + "/api/")
+	require.NoError(t, err)
+
+	c := &Client{
+		Base:   base,
+		Header: http.Header{"X-Api-Key": {"admin"}, "X-Both": {"client"}},
+		ErrorMessage: func(body []byte) string {
+			var e struct {
+				Message string `json:"message"`
+			}
+			_ = json.Unmarshal(body, &e)
+			return e.Message
+		},
+	}
+
+	var out struct {
+		Name string `json:"name"`
+	}
+	err = c.Call(ctx, http.MethodPost, "things/"+url.PathEscape("a/b"),
+		url.Values{"page": {"2"}},
+		http.Header{"X-Both": {"call"}},
+		map[string]string{"in": "put"}, &out)
+	require.NoError(t, err)
+	assert.Equal(t, "thing", out.Name)
+	assert.Equal(t, "/api/things/a%2Fb", got.URL.EscapedPath(), "escaped path kept")
+	assert.Equal(t, "2", got.URL.Query().Get("page"))
+	assert.Equal(t, "admin", got.Header.Get("X-Api-Key"), "client header")
+	assert.Equal(t, "call", got.Header.Get("X-Both"), "call header wins")
+	assert.Equal(t, "application/json", got.Header.Get("Content-Type"))
+	assert.Equal(t, "application/json", got.Header.Get("Accept"))
+	assert.Equal(t, map[string]string{"in": "put"}, gotBody)
+
+	err = c.Call(ctx, http.MethodGet, "things/a/b", nil, nil, nil, nil)
+	require.NoError(t, err, "no output wanted")
+	assert.Empty(t, got.Header.Get("Content-Type"), "no body, no content type")
+	assert.Empty(t, got.URL.RawQuery)
+
+	err = c.Call(ctx, http.MethodGet, "garbled", nil, nil, nil, &out)
+	assert.ErrorContains(t, err, "failed to decode response")
+
+	err = c.Call(ctx, http.MethodGet, "missing", nil, nil, nil, &out)
+	var sErr *StatusError
+	require.True(t, errors.As(err, &sErr), "status error")
+	assert.Equal(t, http.StatusNotFound, sErr.StatusCode)
+	assert.Equal(t, "no such thing (404 Not Found)", err.Error())
+
+	err = c.Call(ctx, http.MethodGet, "quiet", nil, nil, nil, &out)
+	assert.EqualError(t, err, "unexpected response 502 Bad Gateway", "no message found")
+
+	c.ErrorMessage = nil
+	err = c.Call(ctx, http.MethodGet, "missing", nil, nil, nil, &out)
+	assert.EqualError(t, err, "unexpected response 404 Not Found", "no message looked for")
+}
@@ -0,0 +1,37 @@
+// Package sealbox provides the NaCl anonymous sealed box encryption shared by
+// plugins that must encrypt secrets to a recipient's public key before sending
+// them.
+package sealbox
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// KeySize is the size of a Curve25519 public key in bytes.
+const KeySize = 32
+
+// Seal handles sealing the secret for sending to the holder of the given
+// public key and encoding it as Base64.
+func Seal(pk []byte, secret string) (string, error) {
+	if len(pk) != KeySize {
+		return "", fmt.Errorf("public key must be %d bytes, but got %d", KeySize, len(pk))
+	}
+
+	var pkBytes [KeySize]byte
+	copy(pkBytes[:], pk)
+	secretBytes := []byte(secret)
+
+	out := make([]byte, 0, len(secretBytes)+box.AnonymousOverhead)
+
+	enc, err := box.SealAnonymous(out, secretBytes, &pkBytes, rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	encEnc := base64.StdEncoding.EncodeToString(enc)
+
+	return encEnc, nil
+}
@@ -0,0 +1,31 @@
+package sealbox
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/nacl/box"
+)
+
+func TestHappySeal(t *testing.T) {
+	pub, priv, err := box.GenerateKey(rand.Reader)
+	require.NoError(t, err, "generated a key pair")
+
+	sealed, err := Seal(pub[:], "hunter2")
+	require.NoError(t, err, "sealing works")
+
+	enc, err := base64.StdEncoding.DecodeString(sealed)
+	require.NoError(t, err, "sealed value is base64")
+
+	plain, ok := box.OpenAnonymous(nil, enc, pub, priv)
+	assert.True(t, ok, "sealed value opens")
+	assert.Equal(t, "hunter2", string(plain), "sealed value is the secret")
+}
+
+func TestSadSealBadKey(t *testing.T) {
+	_, err := Seal([]byte("short"), "hunter2")
+	assert.ErrorContains(t, err, "public key must be", "short keys are rejected")
+}
@@ -0,0 +1,50 @@
+package entry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+)
+
+// DefaultKey is the storage key holding the public JWK if none is configured.
+const DefaultKey = "JWT_PUBLIC_JWK"
+
+// builder implements the plugin.Builder interface and provides the factory
+// method for constructing a Client.
+type builder struct{}
+
+// options are the plugin options accepted in the configuration.
+type options struct {
+	Key string `mapstructure:"key"`
+}
+
+// Build constructs and returns a JWKS storage client.
+func (b *builder) Build(
+	ctx context.Context,
+	c *config.Plugin,
+) (plugin.Instance, error) {
+	opts := options{Key: DefaultKey}
+	err := c.DecodeOptions(&opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS plugin options: %w", err)
+	}
+
+	if opts.Key == "" {
+		return nil, errors.New("the JWKS plugin key option must not be empty")
+	}
+
+	return &Client{
+		plugins: plugin.ManagerFrom(ctx),
+		key:     opts.Key,
+	}, nil
+}
+
+// init registers the plugin.
+func init() {
+	pkg := reflect.TypeOf(Client{}).PkgPath()
+	plugin.Register(pkg, new(builder))
+}
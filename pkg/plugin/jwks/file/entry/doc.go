@@ -0,0 +1,7 @@
+// Package entry provides a plugin which implements the rotate.Storage and
+// disable.Client and is used to publish public keys in a JWKS document, such as
+// those generated by the github.com/zostay/garotate/pkg/plugin/jwt/signing/key
+// plugin. Keys added by rotation are kept alongside the previous keys, so
+// verifiers accept tokens signed by either while the new key is rolled out,
+// until disablement removes the old ones.
+package entry
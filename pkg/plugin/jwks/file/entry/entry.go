@@ -0,0 +1,369 @@
+package entry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/plugin/internal/atomicfile"
+	"github.com/zostay/garotate/pkg/rotate"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+const (
+	// SavedAtMember is the JWK member recording when a key was added. Only
+	// keys with this member are managed by the plugin. Verifiers ignore
+	// members they do not understand.
+	SavedAtMember = "garotate_saved_at"
+
+	// TagMember is the JWK member holding the tag of the storage a key was
+	// added by, if the storage name has one.
+	TagMember = "garotate_tag"
+)
+
+// Client implements the rotate.Storage interface by adding public keys to a
+// JWKS document. Each storage name is the path to the document. Adding "#tag"
+// to the name sets the tag, which is needed to tell keys apart when several
+// secrets share a document.
+//
+// Each added key is marked with the time it was added and the tag. Other keys
+// of the document are left alone. Only the configured key is added; any other
+// keys, such as the private key, are ignored and are considered saved whenever
+// the public key is.
+//
+// Client also implements the disable.Client interface. Disablement removes
+// every marked key but the newest from each JWKS storage of the secret.
+type Client struct {
+	plugins *plugin.Manager
+	key     string
+}
+
+// jwks is a JWKS document. Members of the document other than the keys are
+// kept as they are.
+type jwks struct {
+	members map[string]json.RawMessage
+	keys    []jwk
+}
+
+// jwk is a key of a JWKS document.
+type jwk struct {
+	members map[string]any
+	savedAt time.Time
+	managed bool
+}
+
+// Name returns "JWKS".
+func (c *Client) Name() string {
+	return "JWKS"
+}
+
+// parseLocation splits the storage name into the path and tag.
+func parseLocation(name string) (string, string, error) {
+	path, tag := name, ""
+	if i := strings.LastIndex(name, "#"); i >= 0 {
+		path, tag = name[:i], name[i+1:]
+	}
+
+	if path == "" {
+		return "", "", fmt.Errorf("the JWKS storage name %q has no path", name)
+	}
+
+	return path, tag, nil
+}
+
+// str returns the member as a string, or "" if it is not one.
+func str(members map[string]any, name string) string {
+	s, _ := members[name].(string)
+	return s
+}
+
+// parseJWKS parses the document, marking the keys added with the tag.
+func parseJWKS(data []byte, tag string) (*jwks, error) {
+	doc := &jwks{members: map[string]json.RawMessage{}}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return doc, nil
+	}
+
+	if err := json.Unmarshal(data, &doc.members); err != nil {
+		return nil, err
+	}
+
+	var keys []map[string]any
+	if raw, ok := doc.members["keys"]; ok {
+		if err := json.Unmarshal(raw, &keys); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, members := range keys {
+		k := jwk{members: members}
+		if t, err := time.Parse(time.RFC3339, str(members, SavedAtMember)); err == nil && str(members, TagMember) == tag {
+			k.savedAt = t
+			k.managed = true
+		}
+		doc.keys = append(doc.keys, k)
+	}
+
+	return doc, nil
+}
+
+// marshal returns the content of the document.
+func (d *jwks) marshal() ([]byte, error) {
+	keys := make([]map[string]any, len(d.keys))
+	for i, k := range d.keys {
+		keys[i] = k.members
+	}
+
+	raw, err := json.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+	d.members["keys"] = raw
+
+	data, err := json.MarshalIndent(d.members, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(data, '\n'), nil
+}
+
+// newest returns the index of the most recently added managed key or -1.
+func (d *jwks) newest() int {
+	idx := -1
+	for i, k := range d.keys {
+		if k.managed && (idx < 0 || !k.savedAt.Before(d.keys[idx].savedAt)) {
+			idx = i
+		}
+	}
+	return idx
+}
+
+// managed returns the number of managed keys.
+func (d *jwks) managed() int {
+	n := 0
+	for _, k := range d.keys {
+		if k.managed {
+			n++
+		}
+	}
+	return n
+}
+
+// load reads and parses the document named by the storage name. A missing
+// document has no keys.
+func load(name string) (string, string, *jwks, error) {
+	path, tag, err := parseLocation(name)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", "", nil, fmt.Errorf("failed to read JWKS %q: %w", name, err)
+	}
+
+	doc, err := parseJWKS(data, tag)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("failed to parse JWKS %q: %w", name, err)
+	}
+
+	return path, tag, doc, nil
+}
+
+// write writes the document by renaming a temporary file into place, so it
+// is never served partly written. The mode of an existing document is kept.
+func write(path string, doc *jwks) error {
+	data, err := doc.marshal()
+	if err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0o644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+
+	return atomicfile.WriteFile(path, data, mode)
+}
+
+// LastSaved returns the time the newest managed key was added. It returns
+// secret.ErrKeyNotFound if no managed key is present.
+func (c *Client) LastSaved(
+	ctx context.Context,
+	store secret.Storage,
+	key string,
+) (time.Time, error) {
+	_, _, doc, err := load(store.Name())
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if i := doc.newest(); i >= 0 {
+		return doc.keys[i].savedAt, nil
+	}
+
+	return time.Time{}, secret.ErrKeyNotFound
+}
+
+// SaveKeys adds the public JWK, marked with the current time. Older keys are
+// left in place until disabled.
+func (c *Client) SaveKeys(
+	ctx context.Context,
+	store secret.Storage,
+	ss secret.Map,
+) error {
+	value, ok := ss[c.key]
+	if !ok {
+		return fmt.Errorf("no %q key to add to JWKS %q", c.key, store.Name())
+	}
+
+	var members map[string]any
+	if err := json.Unmarshal([]byte(value), &members); err != nil {
+		return fmt.Errorf("failed to parse JWK to add to JWKS %q: %w", store.Name(), err)
+	}
+
+	kid := str(members, "kid")
+	if str(members, "kty") == "" || kid == "" {
+		return fmt.Errorf("the JWK to add to JWKS %q must have kty and kid members", store.Name())
+	}
+
+	if _, private := members["d"]; private {
+		return fmt.Errorf("refusing to add a private JWK to JWKS %q", store.Name())
+	}
+
+	path, tag, doc, err := load(store.Name())
+	if err != nil {
+		return err
+	}
+
+	// drop any earlier copy of the same key so it is only published once
+	kept := make([]jwk, 0, len(doc.keys)+1)
+	for _, k := range doc.keys {
+		if str(k.members, "kid") != kid {
+			kept = append(kept, k)
+		}
+	}
+
+	members[SavedAtMember] = time.Now().UTC().Format(time.RFC3339)
+	if tag != "" {
+		members[TagMember] = tag
+	}
+	doc.keys = append(kept, jwk{members: members})
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Infow(
+		"adding public key to JWKS",
+		"client", c.Name(),
+		"storage", store.Name(),
+		"kid", kid,
+	)
+
+	if err := write(path, doc); err != nil {
+		return fmt.Errorf("failed to write JWKS %q: %w", store.Name(), err)
+	}
+
+	return nil
+}
+
+// storages returns the names of the storages of the secret that use this
+// client.
+func (c *Client) storages(ctx context.Context, sec secret.Info) ([]string, error) {
+	if c.plugins == nil {
+		return nil, errors.New("the JWKS plugin must be built by a plugin manager to find the storages it disables")
+	}
+
+	return rotate.StorageNames(ctx, c.plugins, c, sec)
+}
+
+// LastUpdated returns the time the newest managed key was added to any of the
+// JWKS storages of the secret that hold older managed keys, as that is when
+// the older keys became inactive. If there are no older keys, there is nothing
+// to disable.
+func (c *Client) LastUpdated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	names, err := c.storages(ctx, sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var updated time.Time
+	for _, name := range names {
+		_, _, doc, err := load(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if doc.managed() < 2 {
+			continue
+		}
+
+		if t := doc.keys[doc.newest()].savedAt; t.After(updated) {
+			updated = t
+		}
+	}
+
+	if updated.IsZero() {
+		return time.Time{}, disable.ErrNothingToDisable
+	}
+
+	return updated, nil
+}
+
+// DisableSecret removes every managed key but the newest from each of the
+// JWKS storages of the secret.
+func (c *Client) DisableSecret(
+	ctx context.Context,
+	sec secret.Info,
+) error {
+	names, err := c.storages(ctx, sec)
+	if err != nil {
+		return err
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	for _, name := range names {
+		path, _, doc, err := load(name)
+		if err != nil {
+			return err
+		}
+
+		keep := doc.newest()
+		kept := make([]jwk, 0, len(doc.keys))
+		for i, k := range doc.keys {
+			if !k.managed || i == keep {
+				kept = append(kept, k)
+				continue
+			}
+
+			logger.Infow(
+				"removing old public key from JWKS",
+				"secret", sec.Name(),
+				"client", c.Name(),
+				"storage", name,
+				"kid", str(k.members, "kid"),
+			)
+		}
+
+		if len(kept) == len(doc.keys) {
+			continue
+		}
+
+		doc.keys = kept
+		if err := write(path, doc); err != nil {
+			return fmt.Errorf("failed to write JWKS %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package entry
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/plugin/jwt/signing/key"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+// newJWK returns a new public JWK and its key ID.
+func newJWK(t *testing.T) (string, string) {
+	t.Helper()
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	kid, err := key.Thumbprint(pub)
+	require.NoError(t, err)
+
+	jwk, err := key.PublicJWK(pub, key.AlgEdDSA, kid)
+	require.NoError(t, err)
+
+	return jwk, kid
+}
+
+// kids returns the key IDs published in the document, in order.
+func kids(t *testing.T, path string) []string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var doc struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			D   string `json:"d"`
+		} `json:"keys"`
+	}
+	require.NoError(t, json.Unmarshal(data, &doc))
+
+	var ids []string
+	for _, k := range doc.Keys {
+		assert.Empty(t, k.D, "no private members")
+		ids = append(ids, k.Kid)
+	}
+	return ids
+}
+
+func TestParseLocation(t *testing.T) {
+	path, tag, err := parseLocation("/srv/www/.well-known/jwks.json")
+	require.NoError(t, err)
+	assert.Equal(t, "/srv/www/.well-known/jwks.json", path)
+	assert.Equal(t, "", tag)
+
+	path, tag, err = parseLocation("jwks.json#api")
+	require.NoError(t, err)
+	assert.Equal(t, "jwks.json", path)
+	assert.Equal(t, "api", tag)
+
+	_, _, err = parseLocation("#api")
+	assert.Error(t, err, "path required")
+}
+
+func TestSaveAndDisable(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"keys":[{"kty":"oct","kid":"by-hand","k":"AAAA"}],"note":"kept"}`), 0o640))
+
+	plugins := plugin.NewManager(config.PluginList{
+		"jwks": config.Plugin{
+			Name:    "jwks",
+			Package: "github.com/zostay/garotate/pkg/plugin/jwks/file/entry",
+		},
+	})
+
+	inst, err := plugins.Instance(ctx, "jwks")
+	require.NoError(t, err)
+	c := inst.(*Client)
+
+	sec := &config.Secret{
+		SecretName: "tokens",
+		Storages: []config.StorageMap{
+			{StorageClient: "jwks", StorageName: path + "#api"},
+		},
+	}
+	store := &sec.Storages[0]
+
+	_, err = c.LastSaved(ctx, store, DefaultKey)
+	assert.ErrorIs(t, err, secret.ErrKeyNotFound, "nothing added yet")
+
+	first, firstKid := newJWK(t)
+	require.NoError(t, c.SaveKeys(ctx, store, secret.Map{DefaultKey: first, key.PrivateKey: "private"}))
+
+	saved, err := c.LastSaved(ctx, store, key.PrivateKey)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), saved, time.Minute, "just added")
+
+	_, err = c.LastUpdated(ctx, sec)
+	assert.ErrorIs(t, err, disable.ErrNothingToDisable, "nothing to disable yet")
+
+	second, secondKid := newJWK(t)
+	require.NoError(t, c.SaveKeys(ctx, store, secret.Map{DefaultKey: second}))
+	assert.Equal(t, []string{"by-hand", firstKid, secondKid}, kids(t, path), "current and previous keys published")
+
+	require.NoError(t, c.SaveKeys(ctx, store, secret.Map{DefaultKey: second}))
+	assert.Equal(t, []string{"by-hand", firstKid, secondKid}, kids(t, path), "same key published once")
+
+	upd, err := c.LastUpdated(ctx, sec)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), upd, time.Minute, "old key to disable")
+
+	require.NoError(t, c.DisableSecret(ctx, sec))
+	assert.Equal(t, []string{"by-hand", secondKid}, kids(t, path), "old key removed")
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"note": "kept"`, "other members kept")
+	assert.Contains(t, string(data), `"garotate_tag": "api"`, "tagged")
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o640), fi.Mode().Perm(), "mode kept")
+
+	private := `{"kty":"OKP","crv":"Ed25519","kid":"x","x":"AAAA","d":"AAAA"}`
+	assert.Error(t, c.SaveKeys(ctx, store, secret.Map{DefaultKey: private}), "private keys are refused")
+}
@@ -0,0 +1,6 @@
+// Package key provides a plugin which implements the rotate.Client and is used
+// to generate JWT signing keys. The private key is meant for the service that
+// signs tokens and the public key, as a JWK, for the JWKS document verifiers
+// fetch, such as one managed by the
+// github.com/zostay/garotate/pkg/plugin/jwks/file/entry plugin.
+package key
@@ -0,0 +1,267 @@
+package key
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/rotate"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+const (
+	// KeyIDKey is the key the key ID is returned under.
+	KeyIDKey = "JWT_KEY_ID"
+
+	// PrivateKey is the key the private key is returned under in PKCS #8 PEM
+	// format.
+	PrivateKey = "JWT_PRIVATE_KEY"
+
+	// PublicJWKKey is the key the public key is returned under as a JWK.
+	PublicJWKKey = "JWT_PUBLIC_JWK"
+
+	// AlgES256 signs with ECDSA on the P-256 curve.
+	AlgES256 = "ES256"
+
+	// AlgRS256 signs with RSA PKCS #1 v1.5.
+	AlgRS256 = "RS256"
+
+	// AlgEdDSA signs with Ed25519.
+	AlgEdDSA = "EdDSA"
+)
+
+// Options are the options for generating keys. They may be set on the plugin
+// and overridden on each secret.
+type Options struct {
+	// Algorithm is the JWS algorithm the key is for, AlgES256, AlgRS256, or
+	// AlgEdDSA.
+	Algorithm string `mapstructure:"algorithm"`
+
+	// Bits is the size of RSA keys.
+	Bits int `mapstructure:"bits"`
+}
+
+// DefaultOptions returns the default options, which generate ES256 keys.
+func DefaultOptions() Options {
+	return Options{
+		Algorithm: AlgES256,
+		Bits:      2048,
+	}
+}
+
+// Validate returns an error if the options cannot be used to generate keys.
+func (o *Options) Validate() error {
+	switch o.Algorithm {
+	case AlgES256, AlgEdDSA:
+	case AlgRS256:
+		if o.Bits < 2048 {
+			return fmt.Errorf("RSA keys must be at least 2048 bits, not %d", o.Bits)
+		}
+	default:
+		return fmt.Errorf("unknown algorithm %q", o.Algorithm)
+	}
+	return nil
+}
+
+// Client implements the rotate.Client interface by generating JWT signing
+// keys. As there is no upstream service that knows when a key was generated,
+// the storages of each secret are consulted instead.
+type Client struct {
+	plugins  *plugin.Manager
+	defaults Options
+}
+
+// Name returns "JWT signing key generator".
+func (c *Client) Name() string {
+	return "JWT signing key generator"
+}
+
+// Keys returns the JWT_KEY_ID, JWT_PRIVATE_KEY, and JWT_PUBLIC_JWK keys.
+func (c *Client) Keys() secret.Map {
+	return secret.Map{
+		KeyIDKey:     "",
+		PrivateKey:   "",
+		PublicJWKKey: "",
+	}
+}
+
+// options returns the options for the secret, which are the default options of
+// the plugin overridden by any options set on the secret.
+func (c *Client) options(sec secret.Info) (Options, error) {
+	o := c.defaults
+
+	if so, ok := sec.(secret.Options); ok {
+		if err := so.DecodeOptions(&o); err != nil {
+			return Options{}, fmt.Errorf("failed to read JWT signing key options of secret %q: %w", sec.Name(), err)
+		}
+	}
+
+	if err := o.Validate(); err != nil {
+		return Options{}, fmt.Errorf("invalid JWT signing key options for secret %q: %w", sec.Name(), err)
+	}
+
+	return o, nil
+}
+
+// LastRotated returns the time the signing key was rotated, judged by the
+// earliest time any of its keys was last saved to one of the storages of the
+// secret. If they have never been saved, the zero time is returned, which will
+// cause rotation.
+func (c *Client) LastRotated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	return rotate.LastStored(ctx, c.plugins, c.Keys(), sec)
+}
+
+// b64 encodes bytes as JWK members are encoded.
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// fixed returns the big-endian bytes of n padded to size bytes, as JWK
+// requires for EC coordinates.
+func fixed(n *big.Int, size int) []byte {
+	b := make([]byte, size)
+	return n.FillBytes(b)
+}
+
+// publicMembers returns the members of the JWK that describe the public key.
+// They are the required members used to compute the RFC 7638 thumbprint.
+func publicMembers(pub crypto.PublicKey) (map[string]string, error) {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		return map[string]string{
+			"kty": "EC",
+			"crv": "P-256",
+			"x":   b64(fixed(k.X, 32)),
+			"y":   b64(fixed(k.Y, 32)),
+		}, nil
+	case *rsa.PublicKey:
+		return map[string]string{
+			"kty": "RSA",
+			"n":   b64(k.N.Bytes()),
+			"e":   b64(big.NewInt(int64(k.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return map[string]string{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"x":   b64(k),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
+
+// Thumbprint returns the RFC 7638 SHA-256 thumbprint of the public key, which
+// is used as the key ID.
+func Thumbprint(pub crypto.PublicKey) (string, error) {
+	members, err := publicMembers(pub)
+	if err != nil {
+		return "", err
+	}
+
+	// encoding/json sorts map keys, giving the lexicographic order required
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return b64(sum[:]), nil
+}
+
+// PublicJWK returns the JWK of the public key for the algorithm with the given
+// key ID.
+func PublicJWK(pub crypto.PublicKey, alg, kid string) (string, error) {
+	jwk, err := publicMembers(pub)
+	if err != nil {
+		return "", err
+	}
+
+	jwk["alg"] = alg
+	jwk["use"] = "sig"
+	jwk["kid"] = kid
+
+	data, err := json.Marshal(jwk)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// generateKey generates a new private key for the algorithm.
+func generateKey(o Options) (crypto.Signer, error) {
+	switch o.Algorithm {
+	case AlgRS256:
+		return rsa.GenerateKey(rand.Reader, o.Bits)
+	case AlgEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+}
+
+// RotateSecret generates a new signing key. Its key ID is the thumbprint of
+// the public key.
+func (c *Client) RotateSecret(
+	ctx context.Context,
+	sec secret.Info,
+) (secret.Map, error) {
+	o, err := c.options(sec)
+	if err != nil {
+		return secret.Map{}, err
+	}
+
+	key, err := generateKey(o)
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to generate JWT signing key for secret %q: %w", sec.Name(), err)
+	}
+
+	kid, err := Thumbprint(key.Public())
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to compute JWT key ID for secret %q: %w", sec.Name(), err)
+	}
+
+	jwk, err := PublicJWK(key.Public(), o.Algorithm, kid)
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to encode JWK for secret %q: %w", sec.Name(), err)
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to encode JWT signing key for secret %q: %w", sec.Name(), err)
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Infow(
+		"generated new JWT signing key",
+		"secret", sec.Name(),
+		"client", c.Name(),
+		"algorithm", o.Algorithm,
+		"kid", kid,
+	)
+
+	return secret.Map{
+		KeyIDKey:     kid,
+		PrivateKey:   string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})),
+		PublicJWKKey: jwk,
+	}, nil
+}
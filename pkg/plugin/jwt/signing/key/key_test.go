@@ -0,0 +1,100 @@
+package key
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zostay/garotate/pkg/config"
+)
+
+// parseJWK rebuilds the public key described by a JWK.
+func parseJWK(t *testing.T, jwk map[string]string) crypto.PublicKey {
+	t.Helper()
+
+	dec := func(s string) []byte {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		require.NoError(t, err)
+		return b
+	}
+
+	switch jwk["kty"] {
+	case "EC":
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(dec(jwk["x"])),
+			Y:     new(big.Int).SetBytes(dec(jwk["y"])),
+		}
+	case "RSA":
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(dec(jwk["n"])),
+			E: int(new(big.Int).SetBytes(dec(jwk["e"])).Int64()),
+		}
+	case "OKP":
+		return ed25519.PublicKey(dec(jwk["x"]))
+	}
+
+	t.Fatalf("unknown kty %q", jwk["kty"])
+	return nil
+}
+
+func TestRotateSecret(t *testing.T) {
+	c := &Client{defaults: DefaultOptions()}
+
+	for _, alg := range []string{AlgES256, AlgRS256, AlgEdDSA} {
+		sec := &config.Secret{
+			SecretName: "tokens",
+			Options:    map[string]any{"algorithm": alg},
+		}
+
+		keys, err := c.RotateSecret(context.Background(), sec)
+		require.NoError(t, err, alg)
+
+		block, _ := pem.Decode([]byte(keys[PrivateKey]))
+		require.NotNil(t, block, alg)
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		require.NoError(t, err, "%s private key parses", alg)
+
+		var jwk map[string]string
+		require.NoError(t, json.Unmarshal([]byte(keys[PublicJWKKey]), &jwk), alg)
+		assert.Equal(t, alg, jwk["alg"])
+		assert.Equal(t, "sig", jwk["use"], alg)
+		assert.Equal(t, keys[KeyIDKey], jwk["kid"], alg)
+		assert.NotContains(t, jwk, "d", "%s no private members", alg)
+
+		pub := key.(crypto.Signer).Public()
+		assert.True(t, pub.(interface{ Equal(crypto.PublicKey) bool }).Equal(parseJWK(t, jwk)), "%s JWK matches", alg)
+
+		kid, err := Thumbprint(pub)
+		require.NoError(t, err, alg)
+		assert.Equal(t, kid, keys[KeyIDKey], "%s key ID is the thumbprint", alg)
+	}
+
+	_, err := c.RotateSecret(context.Background(), &config.Secret{
+		SecretName: "tokens",
+		Options:    map[string]any{"algorithm": "HS256"},
+	})
+	assert.Error(t, err, "symmetric algorithms are refused")
+}
+
+func TestThumbprint(t *testing.T) {
+	// RFC 8037, appendix A.3
+	x, err := base64.RawURLEncoding.DecodeString("11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo")
+	require.NoError(t, err)
+
+	kid, err := Thumbprint(ed25519.PublicKey(x))
+	require.NoError(t, err)
+	assert.Equal(t, "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k", kid)
+}
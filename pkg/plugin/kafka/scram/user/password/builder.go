@@ -0,0 +1,148 @@
+package password
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/plugin/random/password/generator"
+)
+
+const (
+	// DefaultTrackingTopic is the topic the time of each rotation is recorded
+	// in if none is configured.
+	DefaultTrackingTopic = "garotate-rotations"
+
+	// DefaultIterations is the number of SCRAM iterations used if none is
+	// configured. Kafka requires at least 4096.
+	DefaultIterations = 8192
+
+	// DefaultTimeout is the request timeout used if none is configured.
+	DefaultTimeout = 30 * time.Second
+)
+
+// builder implements the plugin.Builder interface and provides the factory
+// method for constructing a Client.
+type builder struct{}
+
+// options are the plugin options accepted in the configuration.
+type options struct {
+	Brokers       []string      `mapstructure:"brokers"`
+	SASLMechanism string        `mapstructure:"sasl_mechanism"`
+	Username      string        `mapstructure:"username"`
+	Password      string        `mapstructure:"password"`
+	TLS           bool          `mapstructure:"tls"`
+	Mechanism     string        `mapstructure:"mechanism"`
+	Iterations    int           `mapstructure:"iterations"`
+	TrackingTopic string        `mapstructure:"tracking_topic"`
+	Timeout       time.Duration `mapstructure:"timeout"`
+
+	generator.Policy `mapstructure:",squash"`
+}
+
+// saslMechanism returns the SASL mechanism used to authenticate the
+// administrator connection, or nil if none is configured.
+func saslMechanism(opts *options) (sasl.Mechanism, error) {
+	switch strings.ToUpper(opts.SASLMechanism) {
+	case "":
+		return nil, nil
+	case "PLAIN":
+		return plain.Mechanism{Username: opts.Username, Password: opts.Password}, nil
+	case MechanismSHA256:
+		return scram.Mechanism(scram.SHA256, opts.Username, opts.Password)
+	case MechanismSHA512:
+		return scram.Mechanism(scram.SHA512, opts.Username, opts.Password)
+	default:
+		return nil, fmt.Errorf("the Kafka plugin sasl_mechanism option must be PLAIN, %s, or %s, but got %q", MechanismSHA256, MechanismSHA512, opts.SASLMechanism)
+	}
+}
+
+// Build constructs and returns a Kafka SCRAM credential client.
+func (b *builder) Build(
+	ctx context.Context,
+	c *config.Plugin,
+) (plugin.Instance, error) {
+	opts := options{
+		Mechanism:     MechanismSHA512,
+		Iterations:    DefaultIterations,
+		TrackingTopic: DefaultTrackingTopic,
+		Timeout:       DefaultTimeout,
+		Policy:        generator.ConnectionSafePolicy(),
+	}
+	err := generator.DecodePolicy(c, &opts, &opts.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Kafka plugin options: %w", err)
+	}
+
+	if err := opts.Policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid Kafka password policy: %w", err)
+	}
+
+	mech, ok := mechanisms[strings.ToUpper(opts.Mechanism)]
+	if !ok {
+		return nil, fmt.Errorf("the Kafka plugin mechanism option must be %s or %s, but got %q", MechanismSHA256, MechanismSHA512, opts.Mechanism)
+	}
+
+	if opts.Iterations < 4096 {
+		return nil, fmt.Errorf("the Kafka plugin iterations option must be at least 4096, but got %d", opts.Iterations)
+	}
+
+	if opts.TrackingTopic == "" {
+		return nil, errors.New("the Kafka plugin tracking_topic option must not be empty")
+	}
+
+	if len(opts.Brokers) == 0 {
+		if brokers := os.Getenv("KAFKA_BROKERS"); brokers != "" {
+			opts.Brokers = strings.Split(brokers, ",")
+		}
+	}
+	if len(opts.Brokers) == 0 {
+		return nil, errors.New("the Kafka plugin requires a brokers option or KAFKA_BROKERS environment variable")
+	}
+
+	if opts.Password == "" {
+		opts.Password = os.Getenv("KAFKA_ADMIN_PASSWORD")
+	}
+
+	saslMech, err := saslMechanism(&opts)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &kafka.Transport{
+		SASL: saslMech,
+	}
+	if opts.TLS {
+		transport.TLS = &tls.Config{}
+	}
+
+	return &Client{
+		kc: &kafka.Client{
+			Addr:      kafka.TCP(opts.Brokers...),
+			Timeout:   opts.Timeout,
+			Transport: transport,
+		},
+		mechanism:     mech,
+		iterations:    opts.Iterations,
+		trackingTopic: opts.TrackingTopic,
+		policy:        opts.Policy,
+	}, nil
+}
+
+// init registers the plugin.
+func init() {
+	pkg := reflect.TypeOf(Client{}).PkgPath()
+	plugin.Register(pkg, new(builder))
+}
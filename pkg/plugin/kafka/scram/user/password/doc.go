@@ -0,0 +1,5 @@
+// Package password provides a plugin which implements the rotate.Client and is
+// used to rotate the SASL/SCRAM credentials of Kafka principals through the
+// AlterUserScramCredentials admin API. Kafka does not record when credentials
+// were changed, so the time of each rotation is kept in a compacted topic.
+package password
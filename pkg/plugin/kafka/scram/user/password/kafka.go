@@ -0,0 +1,303 @@
+package password
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"golang.org/x/crypto/pbkdf2"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin/random/password/generator"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+const (
+	// UserKey is the key the principal name is returned under.
+	UserKey = "KAFKA_USERNAME"
+
+	// PasswordKey is the key the new password is returned under.
+	PasswordKey = "KAFKA_PASSWORD"
+
+	// MechanismSHA256 names the SCRAM-SHA-256 mechanism.
+	MechanismSHA256 = "SCRAM-SHA-256"
+
+	// MechanismSHA512 names the SCRAM-SHA-512 mechanism.
+	MechanismSHA512 = "SCRAM-SHA-512"
+)
+
+// saltSize is the number of random bytes in each salt.
+const saltSize = 32
+
+// mechanism describes a SCRAM mechanism Kafka supports.
+type mechanism struct {
+	name  string
+	kafka kafka.ScramMechanism
+	hash  func() hash.Hash
+}
+
+// mechanisms are the SCRAM mechanisms credentials may be set for.
+var mechanisms = map[string]mechanism{
+	MechanismSHA256: {MechanismSHA256, kafka.ScramMechanismSha256, sha256.New},
+	MechanismSHA512: {MechanismSHA512, kafka.ScramMechanismSha512, sha512.New},
+}
+
+// Client implements the rotate.Client interface for rotating the SCRAM
+// credentials of Kafka principals. The secret name is the user name of the
+// principal.
+//
+// Each rotation is recorded in a single partition compacted topic, keyed by
+// the user name, which is created when first needed. The topic is read once,
+// when the first secret is checked, and the rotations recorded after that are
+// added to what was read.
+type Client struct {
+	kc            *kafka.Client
+	mechanism     mechanism
+	iterations    int
+	trackingTopic string
+	policy        generator.Policy
+
+	mu   sync.Mutex
+	rots map[string]rotation
+}
+
+// rotation is the record of the last rotation of a principal kept in the
+// tracking topic.
+type rotation struct {
+	RotatedAt time.Time `json:"rotated_at"`
+	Mechanism string    `json:"mechanism"`
+}
+
+// Name returns "Kafka SCRAM users".
+func (c *Client) Name() string {
+	return "Kafka SCRAM users"
+}
+
+// Keys returns the KAFKA_USERNAME and KAFKA_PASSWORD keys.
+func (c *Client) Keys() secret.Map {
+	return secret.Map{
+		UserKey:     "",
+		PasswordKey: "",
+	}
+}
+
+// saltedPassword computes the SCRAM SaltedPassword, which is what Kafka stores
+// in place of the password.
+func (m mechanism) saltedPassword(password string, salt []byte, iterations int) []byte {
+	return pbkdf2.Key([]byte(password), salt, iterations, m.hash().Size(), m.hash)
+}
+
+// rotations reads the tracking topic and returns the last rotation of each
+// principal recorded there. If the topic does not exist yet, nothing has been
+// recorded.
+func (c *Client) rotations(ctx context.Context) (map[string]rotation, error) {
+	rots := map[string]rotation{}
+	offset := kafka.FirstOffset
+	for {
+		res, err := c.kc.Fetch(ctx, &kafka.FetchRequest{
+			Topic:    c.trackingTopic,
+			Offset:   offset,
+			MaxBytes: 1 << 20,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if errors.Is(res.Error, kafka.UnknownTopicOrPartition) {
+			return rots, nil
+		} else if res.Error != nil {
+			return nil, res.Error
+		}
+
+		read := 0
+		for {
+			rec, err := res.Records.ReadRecord()
+			if errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+
+			// batches may start before the offset asked for
+			if offset >= 0 && rec.Offset < offset {
+				continue
+			}
+			offset = rec.Offset + 1
+			read++
+
+			key, err := kafka.ReadAll(rec.Key)
+			if err != nil {
+				return nil, err
+			}
+
+			if rec.Value == nil {
+				delete(rots, string(key))
+				continue
+			}
+
+			value, err := kafka.ReadAll(rec.Value)
+			if err != nil {
+				return nil, err
+			}
+
+			var r rotation
+			if err := json.Unmarshal(value, &r); err == nil {
+				rots[string(key)] = r
+			}
+		}
+
+		if read == 0 || offset >= res.HighWatermark {
+			return rots, nil
+		}
+	}
+}
+
+// record creates the tracking topic, if needed, and records the rotation of
+// the principal in it.
+func (c *Client) record(ctx context.Context, name string, r rotation) error {
+	cres, err := c.kc.CreateTopics(ctx, &kafka.CreateTopicsRequest{
+		Topics: []kafka.TopicConfig{
+			{
+				Topic:             c.trackingTopic,
+				NumPartitions:     1,
+				ReplicationFactor: -1,
+				ConfigEntries: []kafka.ConfigEntry{
+					{ConfigName: "cleanup.policy", ConfigValue: "compact"},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create tracking topic %q: %w", c.trackingTopic, err)
+	}
+	if err := cres.Errors[c.trackingTopic]; err != nil && !errors.Is(err, kafka.TopicAlreadyExists) {
+		return fmt.Errorf("failed to create tracking topic %q: %w", c.trackingTopic, err)
+	}
+
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	pres, err := c.kc.Produce(ctx, &kafka.ProduceRequest{
+		Topic:        c.trackingTopic,
+		RequiredAcks: kafka.RequireAll,
+		Records: kafka.NewRecordReader(kafka.Record{
+			Time:  r.RotatedAt,
+			Key:   kafka.NewBytes([]byte(name)),
+			Value: kafka.NewBytes(value),
+		}),
+	})
+	if err == nil {
+		err = pres.Error
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write to tracking topic %q: %w", c.trackingTopic, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.rots != nil {
+		c.rots[name] = r
+	}
+
+	return nil
+}
+
+// LastRotated returns the time the principal was last rotated according to
+// the tracking topic. If garotate has never rotated the principal, the zero
+// time is returned.
+func (c *Client) LastRotated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.rots == nil {
+		rots, err := c.rotations(ctx)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to read last rotation of Kafka user %q: %w", sec.Name(), err)
+		}
+		c.rots = rots
+	}
+
+	return c.rots[sec.Name()].RotatedAt, nil
+}
+
+// RotateSecret sets new SCRAM credentials for the principal, creating them if
+// it has none, and records the rotation in the tracking topic. The old
+// password stops working immediately.
+func (c *Client) RotateSecret(
+	ctx context.Context,
+	sec secret.Info,
+) (secret.Map, error) {
+	password, _, err := c.policy.NewValue()
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to generate password for Kafka user %q: %w", sec.Name(), err)
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return secret.Map{}, fmt.Errorf("failed to generate salt for Kafka user %q: %w", sec.Name(), err)
+	}
+
+	res, err := c.kc.AlterUserScramCredentials(ctx, &kafka.AlterUserScramCredentialsRequest{
+		Upsertions: []kafka.UserScramCredentialsUpsertion{
+			{
+				Name:           sec.Name(),
+				Mechanism:      c.mechanism.kafka,
+				Iterations:     c.iterations,
+				Salt:           salt,
+				SaltedPassword: c.mechanism.saltedPassword(password, salt, c.iterations),
+			},
+		},
+	})
+	if err == nil {
+		for _, r := range res.Results {
+			if r.Error != nil {
+				err = r.Error
+			}
+		}
+	}
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to set SCRAM credentials of Kafka user %q: %w", sec.Name(), err)
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Infow(
+		"set Kafka SCRAM credentials",
+		"secret", sec.Name(),
+		"client", c.Name(),
+		"mechanism", c.mechanism.name,
+	)
+
+	// the password has already changed, so failing now would keep it from
+	// reaching the storages; the next run rotates again instead
+	err = c.record(ctx, sec.Name(), rotation{
+		RotatedAt: time.Now(),
+		Mechanism: c.mechanism.name,
+	})
+	if err != nil {
+		logger.Warnw(
+			"failed to record Kafka SCRAM rotation",
+			"secret", sec.Name(),
+			"client", c.Name(),
+			"error", err,
+		)
+	}
+
+	return secret.Map{
+		UserKey:     sec.Name(),
+		PasswordKey: password,
+	}, nil
+}
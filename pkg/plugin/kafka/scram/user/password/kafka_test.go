@@ -0,0 +1,173 @@
+package password
+
+import (
+	"context"
+	"crypto/hmac"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	kscram "github.com/segmentio/kafka-go/sasl/scram"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xdg-go/scram"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+)
+
+// testBrokersEnv names the environment variable holding the comma separated
+// brokers of a Kafka 2.7 or later cluster to test against, which must offer a
+// SASL_PLAINTEXT listener with SCRAM-SHA-512 enabled and no authorization, such
+// as a disposable container.
+const testBrokersEnv = "GAROTATE_TEST_KAFKA_BROKERS"
+
+// storedKey computes the SCRAM StoredKey from the SaltedPassword, which is how
+// a server checks the proof a client sends.
+func (m mechanism) storedKey(salted []byte) []byte {
+	mac := hmac.New(m.hash, salted)
+	mac.Write([]byte("Client Key"))
+	h := m.hash()
+	h.Write(mac.Sum(nil))
+	return h.Sum(nil)
+}
+
+func TestSaltedPassword(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	for name, hgf := range map[string]scram.HashGeneratorFcn{
+		MechanismSHA256: scram.SHA256,
+		MechanismSHA512: scram.SHA512,
+	} {
+		m := mechanisms[name]
+
+		client, err := hgf.NewClient("app", "correct horse battery staple", "")
+		require.NoError(t, err)
+		want := client.GetStoredCredentials(scram.KeyFactors{Salt: string(salt), Iters: 4096})
+
+		salted := m.saltedPassword("correct horse battery staple", salt, 4096)
+		assert.Equal(t, want.StoredKey, m.storedKey(salted), name)
+	}
+}
+
+func TestLastRotatedCached(t *testing.T) {
+	then := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// no Kafka client, so the tracking topic cannot be read again
+	c := &Client{rots: map[string]rotation{"app": {RotatedAt: then}}}
+
+	last, err := c.LastRotated(context.Background(), &config.Secret{SecretName: "app"})
+	require.NoError(t, err)
+	assert.Equal(t, then, last, "read from what was read before")
+
+	last, err = c.LastRotated(context.Background(), &config.Secret{SecretName: "other"})
+	require.NoError(t, err)
+	assert.True(t, last.IsZero(), "never rotated")
+}
+
+// login reports whether the user can authenticate with the password.
+func login(t *testing.T, brokers []string, user, password string) error {
+	t.Helper()
+
+	mech, err := kscram.Mechanism(kscram.SHA512, user, password)
+	require.NoError(t, err)
+
+	kc := &kafka.Client{
+		Addr:      kafka.TCP(brokers...),
+		Timeout:   10 * time.Second,
+		Transport: &kafka.Transport{SASL: mech},
+	}
+	_, err = kc.Metadata(context.Background(), &kafka.MetadataRequest{})
+	return err
+}
+
+func TestRotateUser(t *testing.T) {
+	env := os.Getenv(testBrokersEnv)
+	if env == "" {
+		t.Skipf("set %s to test against a Kafka cluster", testBrokersEnv)
+	}
+	brokers := strings.Split(env, ",")
+
+	ctx := context.Background()
+	user := fmt.Sprintf("garotate_test_%d", time.Now().UnixNano())
+	topic := fmt.Sprintf("garotate-test-rotations-%d", time.Now().UnixNano())
+
+	inst, err := plugin.Build(ctx, &config.Plugin{
+		Name:    "kafka",
+		Package: "github.com/zostay/garotate/pkg/plugin/kafka/scram/user/password",
+		Options: map[string]any{
+			"brokers":        brokers,
+			"tracking_topic": topic,
+		},
+	})
+	require.NoError(t, err)
+	c := inst.(*Client)
+
+	t.Cleanup(func() {
+		_, _ = c.kc.AlterUserScramCredentials(ctx, &kafka.AlterUserScramCredentialsRequest{
+			Deletions: []kafka.UserScramCredentialsDeletion{
+				{Name: user, Mechanism: kafka.ScramMechanismSha512},
+			},
+		})
+		_, _ = c.kc.DeleteTopics(ctx, &kafka.DeleteTopicsRequest{Topics: []string{topic}})
+	})
+
+	sec := &config.Secret{SecretName: user}
+
+	last, err := c.LastRotated(ctx, sec)
+	require.NoError(t, err)
+	assert.True(t, last.IsZero(), "never rotated")
+
+	first, err := c.RotateSecret(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, user, first[UserKey])
+	assert.Len(t, first[PasswordKey], 32)
+
+	last, err = c.LastRotated(ctx, sec)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), last, time.Minute, "just rotated")
+
+	c.rots = nil
+	reread, err := c.LastRotated(ctx, sec)
+	require.NoError(t, err)
+	assert.WithinDuration(t, last, reread, time.Millisecond, "recorded in the tracking topic")
+
+	second, err := c.RotateSecret(ctx, sec)
+	require.NoError(t, err)
+
+	// credential changes reach the brokers asynchronously
+	require.Eventually(t, func() bool {
+		return login(t, brokers, user, second[PasswordKey]) == nil
+	}, 30*time.Second, time.Second, "new password works")
+	assert.Error(t, login(t, brokers, user, first[PasswordKey]), "old password does not")
+
+	newer, err := c.LastRotated(ctx, sec)
+	require.NoError(t, err)
+	assert.False(t, newer.Before(last), "second rotation recorded")
+}
+
+func TestBuild(t *testing.T) {
+	t.Setenv("KAFKA_BROKERS", "")
+
+	build := func(opts map[string]any) error {
+		_, err := (&builder{}).Build(context.Background(), &config.Plugin{Options: opts})
+		return err
+	}
+
+	assert.NoError(t, build(map[string]any{"brokers": []string{"localhost:9092"}}))
+	assert.Error(t, build(map[string]any{}), "no brokers")
+	assert.Error(t, build(map[string]any{
+		"brokers":   []string{"localhost:9092"},
+		"mechanism": "SCRAM-SHA-1",
+	}), "unknown mechanism")
+	assert.Error(t, build(map[string]any{
+		"brokers":    []string{"localhost:9092"},
+		"iterations": 1000,
+	}), "too few iterations")
+	assert.Error(t, build(map[string]any{
+		"brokers":        []string{"localhost:9092"},
+		"sasl_mechanism": "GSSAPI",
+	}), "unsupported SASL mechanism")
+}
@@ -0,0 +1,326 @@
+package kdbx
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// argon2Type identifies the Argon2 variant to compute. The values match the
+// type identifiers used within the Argon2 specification.
+type argon2Type uint32
+
+const (
+	argon2d  argon2Type = 0
+	argon2id argon2Type = 2
+)
+
+const (
+	// argon2Version is the only version of Argon2 supported, 1.3.
+	argon2Version = 0x13
+
+	// argon2SyncPoints is the number of slices each lane is divided into.
+	argon2SyncPoints = 4
+
+	// argon2BlockWords is the number of 64-bit words in each 1KiB block.
+	argon2BlockWords = 128
+)
+
+// argon2Block is a single 1KiB block of Argon2 memory.
+type argon2Block [argon2BlockWords]uint64
+
+// argon2Key derives a key using Argon2d or Argon2id. The golang.org/x/crypto
+// package only provides Argon2i and Argon2id, but KeePass databases usually
+// use Argon2d, so this is a straightforward implementation of RFC 9106 that
+// can compute either. Memory is given in KiB.
+func argon2Key(
+	mode argon2Type,
+	password, salt, secret, data []byte,
+	time, memory, threads, keyLen uint32,
+) []byte {
+	if time < 1 {
+		time = 1
+	}
+	if threads < 1 {
+		threads = 1
+	}
+
+	h0 := argon2InitHash(mode, password, salt, secret, data, time, memory, threads, keyLen)
+
+	memory = memory / (argon2SyncPoints * threads) * (argon2SyncPoints * threads)
+	if memory < 2*argon2SyncPoints*threads {
+		memory = 2 * argon2SyncPoints * threads
+	}
+
+	laneLen := memory / threads
+	segLen := laneLen / argon2SyncPoints
+
+	b := make([]argon2Block, memory)
+	var buf [1024]byte
+	for lane := uint32(0); lane < threads; lane++ {
+		for i := uint32(0); i < 2; i++ {
+			binary.LittleEndian.PutUint32(h0[blake2b.Size:], i)
+			binary.LittleEndian.PutUint32(h0[blake2b.Size+4:], lane)
+			argon2Hash(buf[:], h0[:])
+			for j := range b[lane*laneLen+i] {
+				b[lane*laneLen+i][j] = binary.LittleEndian.Uint64(buf[j*8:])
+			}
+		}
+	}
+
+	for pass := uint32(0); pass < time; pass++ {
+		for slice := uint32(0); slice < argon2SyncPoints; slice++ {
+			var wg sync.WaitGroup
+			for lane := uint32(0); lane < threads; lane++ {
+				wg.Add(1)
+				go func(lane uint32) {
+					defer wg.Done()
+					argon2Segment(b, mode, pass, slice, lane, time, memory, threads, laneLen, segLen)
+				}(lane)
+			}
+			wg.Wait()
+		}
+	}
+
+	final := b[laneLen-1]
+	for lane := uint32(1); lane < threads; lane++ {
+		for i, v := range b[lane*laneLen+laneLen-1] {
+			final[i] ^= v
+		}
+	}
+
+	for i, v := range final {
+		binary.LittleEndian.PutUint64(buf[i*8:], v)
+	}
+
+	key := make([]byte, keyLen)
+	argon2Hash(key, buf[:])
+	return key
+}
+
+// argon2InitHash computes H0 followed by 8 spare bytes used to hold the block
+// and lane numbers when filling the first blocks of each lane.
+func argon2InitHash(
+	mode argon2Type,
+	password, salt, secret, data []byte,
+	time, memory, threads, keyLen uint32,
+) [blake2b.Size + 8]byte {
+	var h0 [blake2b.Size + 8]byte
+
+	h, _ := blake2b.New512(nil)
+	le32 := func(v uint32) {
+		var tmp [4]byte
+		binary.LittleEndian.PutUint32(tmp[:], v)
+		h.Write(tmp[:])
+	}
+	withLen := func(b []byte) {
+		le32(uint32(len(b)))
+		h.Write(b)
+	}
+
+	le32(threads)
+	le32(keyLen)
+	le32(memory)
+	le32(time)
+	le32(argon2Version)
+	le32(uint32(mode))
+	withLen(password)
+	withLen(salt)
+	withLen(secret)
+	withLen(data)
+
+	h.Sum(h0[:0])
+	return h0
+}
+
+// argon2Hash is the variable length hash function H' from the specification.
+// It fills out completely.
+func argon2Hash(out, in []byte) {
+	var prefix [4]byte
+	binary.LittleEndian.PutUint32(prefix[:], uint32(len(out)))
+
+	if len(out) <= blake2b.Size {
+		h, _ := blake2b.New(len(out), nil)
+		h.Write(prefix[:])
+		h.Write(in)
+		h.Sum(out[:0])
+		return
+	}
+
+	h, _ := blake2b.New512(nil)
+	h.Write(prefix[:])
+	h.Write(in)
+	v := h.Sum(nil)
+
+	n := copy(out, v[:32])
+	for len(out)-n > blake2b.Size {
+		sum := blake2b.Sum512(v)
+		v = sum[:]
+		n += copy(out[n:], v[:32])
+	}
+
+	h, _ = blake2b.New(len(out)-n, nil)
+	h.Write(v)
+	h.Sum(out[n:n])
+}
+
+// argon2Segment fills in a single segment of a single lane for the given pass
+// and slice.
+func argon2Segment(
+	b []argon2Block,
+	mode argon2Type,
+	pass, slice, lane, time, memory, threads, laneLen, segLen uint32,
+) {
+	dataIndependent := mode == argon2id && pass == 0 && slice < argon2SyncPoints/2
+
+	var addresses, input, zero argon2Block
+	if dataIndependent {
+		input[0] = uint64(pass)
+		input[1] = uint64(lane)
+		input[2] = uint64(slice)
+		input[3] = uint64(memory)
+		input[4] = uint64(time)
+		input[5] = uint64(mode)
+	}
+
+	nextAddresses := func() {
+		input[6]++
+		argon2Compress(&addresses, &zero, &input, false)
+		argon2Compress(&addresses, &zero, &addresses, false)
+	}
+
+	start := uint32(0)
+	if pass == 0 && slice == 0 {
+		// the first two blocks of each lane are already filled
+		start = 2
+		if dataIndependent {
+			nextAddresses()
+		}
+	}
+
+	for index := start; index < segLen; index++ {
+		cur := lane*laneLen + slice*segLen + index
+		prev := cur - 1
+		if cur%laneLen == 0 {
+			prev = cur + laneLen - 1
+		}
+
+		var rand uint64
+		if dataIndependent {
+			if index%argon2BlockWords == 0 {
+				nextAddresses()
+			}
+			rand = addresses[index%argon2BlockWords]
+		} else {
+			rand = b[prev][0]
+		}
+
+		ref := argon2RefIndex(rand, pass, slice, lane, index, threads, laneLen, segLen)
+		argon2Compress(&b[cur], &b[prev], &b[ref], pass > 0)
+	}
+}
+
+// argon2RefIndex maps the pseudo-random value onto the index of the reference
+// block to use when computing the next block.
+func argon2RefIndex(
+	rand uint64,
+	pass, slice, lane, index, threads, laneLen, segLen uint32,
+) uint32 {
+	refLane := uint32(rand>>32) % threads
+	if pass == 0 && slice == 0 {
+		refLane = lane
+	}
+	sameLane := refLane == lane
+
+	var area, start uint32
+	if pass == 0 {
+		area = slice * segLen
+		if sameLane {
+			area += index - 1
+		} else if index == 0 {
+			area--
+		}
+	} else {
+		area = laneLen - segLen
+		if sameLane {
+			area += index - 1
+		} else if index == 0 {
+			area--
+		}
+		start = ((slice + 1) % argon2SyncPoints) * segLen
+	}
+
+	x := rand & 0xFFFFFFFF
+	x = (x * x) >> 32
+	x = (uint64(area) * x) >> 32
+	rel := uint64(area) - 1 - x
+
+	return refLane*laneLen + uint32((uint64(start)+rel)%uint64(laneLen))
+}
+
+// argon2Compress is the compression function G. When xor is set, the result is
+// combined with the existing contents of out, as required by version 1.3 for
+// every pass after the first.
+func argon2Compress(out, x, y *argon2Block, xor bool) {
+	var r, q argon2Block
+	for i := range r {
+		r[i] = x[i] ^ y[i]
+	}
+	q = r
+
+	for i := 0; i < 8; i++ {
+		argon2Permute(&q,
+			16*i, 16*i+1, 16*i+2, 16*i+3,
+			16*i+4, 16*i+5, 16*i+6, 16*i+7,
+			16*i+8, 16*i+9, 16*i+10, 16*i+11,
+			16*i+12, 16*i+13, 16*i+14, 16*i+15,
+		)
+	}
+	for i := 0; i < 8; i++ {
+		argon2Permute(&q,
+			2*i, 2*i+1, 2*i+16, 2*i+17,
+			2*i+32, 2*i+33, 2*i+48, 2*i+49,
+			2*i+64, 2*i+65, 2*i+80, 2*i+81,
+			2*i+96, 2*i+97, 2*i+112, 2*i+113,
+		)
+	}
+
+	for i := range q {
+		if xor {
+			out[i] ^= q[i] ^ r[i]
+		} else {
+			out[i] = q[i] ^ r[i]
+		}
+	}
+}
+
+// argon2Permute applies the permutation P to the 16 words of the block named
+// by the given indexes.
+func argon2Permute(b *argon2Block, i0, i1, i2, i3, i4, i5, i6, i7, i8, i9, i10, i11, i12, i13, i14, i15 int) {
+	argon2Mix(b, i0, i4, i8, i12)
+	argon2Mix(b, i1, i5, i9, i13)
+	argon2Mix(b, i2, i6, i10, i14)
+	argon2Mix(b, i3, i7, i11, i15)
+	argon2Mix(b, i0, i5, i10, i15)
+	argon2Mix(b, i1, i6, i11, i12)
+	argon2Mix(b, i2, i7, i8, i13)
+	argon2Mix(b, i3, i4, i9, i14)
+}
+
+// argon2Mix is the BlaMka variant of the BLAKE2b mixing function, GB.
+func argon2Mix(b *argon2Block, ia, ib, ic, id int) {
+	a, bb, c, d := b[ia], b[ib], b[ic], b[id]
+
+	a += bb + 2*uint64(uint32(a))*uint64(uint32(bb))
+	d = bits.RotateLeft64(d^a, -32)
+	c += d + 2*uint64(uint32(c))*uint64(uint32(d))
+	bb = bits.RotateLeft64(bb^c, -24)
+	a += bb + 2*uint64(uint32(a))*uint64(uint32(bb))
+	d = bits.RotateLeft64(d^a, -16)
+	c += d + 2*uint64(uint32(c))*uint64(uint32(d))
+	bb = bits.RotateLeft64(bb^c, -63)
+
+	b[ia], b[ib], b[ic], b[id] = a, bb, c, d
+}
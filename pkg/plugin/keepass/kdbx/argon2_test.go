@@ -0,0 +1,71 @@
+package kdbx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/argon2"
+)
+
+// rfc9106Vector runs the test vectors from RFC 9106, section 5.
+func rfc9106Vector(mode argon2Type) []byte {
+	return argon2Key(mode,
+		bytes.Repeat([]byte{0x01}, 32),
+		bytes.Repeat([]byte{0x02}, 16),
+		bytes.Repeat([]byte{0x03}, 8),
+		bytes.Repeat([]byte{0x04}, 12),
+		3, 32, 4, 32,
+	)
+}
+
+func TestArgon2dVector(t *testing.T) {
+	assert.Equal(t,
+		"512b391b6f1162975371d30919734294f868e3be3984f3c1a13a4db9fabe4acb",
+		hex.EncodeToString(rfc9106Vector(argon2d)),
+		"argon2d matches RFC 9106",
+	)
+}
+
+// TestArgon2dReferenceVectors checks the output of the reference
+// implementation's CLI for a range of parameters, which exercises the lane and
+// segment handling more than the single RFC 9106 vector.
+func TestArgon2dReferenceVectors(t *testing.T) {
+	for _, v := range []struct {
+		time, memory, threads uint32
+		hash                  string
+	}{
+		{1, 64, 1, "8727405fd07c32c78d64f547f24150d3f2e703a89f981a19"},
+		{2, 64, 1, "3be9ec79a69b75d3752acb59a1fbb8b295a46529c48fbb75"},
+		{2, 64, 2, "68e2462c98b8bc6bb60ec68db418ae2c9ed24fc6748a40e9"},
+		{3, 256, 2, "f4f0669218eaf3641f39cc97efb915721102f4b128211ef2"},
+		{4, 4096, 4, "935598181aa8dc2b720914aa6435ac8d3e3a4210c5b0fb2d"},
+		{4, 1024, 8, "83604fc2ad0589b9d055578f4d3cc55bc616df3578a896e9"},
+		{2, 64, 3, "22474a423bda2ccd36ec9afd5119e5c8949798cadf659f51"},
+		{3, 1024, 6, "a3351b0319a53229152023d9206902f4ef59661cdca89481"},
+	} {
+		got := argon2Key(argon2d, []byte("password"), []byte("somesalt"), nil, nil, v.time, v.memory, v.threads, 24)
+		assert.Equal(t, v.hash, hex.EncodeToString(got),
+			"argon2d with t=%d m=%d p=%d", v.time, v.memory, v.threads)
+	}
+}
+
+func TestArgon2idVector(t *testing.T) {
+	assert.Equal(t,
+		"0d640df58d78766c08c037a34a8b53c9d01ef0452d75b65eb52520e96b01e659",
+		hex.EncodeToString(rfc9106Vector(argon2id)),
+		"argon2id matches RFC 9106",
+	)
+}
+
+func TestArgon2idMatchesXCrypto(t *testing.T) {
+	password := []byte("hunter2")
+	salt := []byte("somesaltysaltsalt")
+
+	for _, threads := range []uint8{1, 2, 3} {
+		want := argon2.IDKey(password, salt, 2, 256, threads, 32)
+		got := argon2Key(argon2id, password, salt, nil, nil, 2, 256, uint32(threads), 32)
+		assert.Equal(t, want, got, "argon2id matches x/crypto with %d threads", threads)
+	}
+}
@@ -0,0 +1,307 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/salsa20"
+	"golang.org/x/crypto/twofish"
+)
+
+var (
+	// Outer cipher identifiers.
+	cipherAES256   = []byte{0x31, 0xc1, 0xf2, 0xe6, 0xbf, 0x71, 0x43, 0x50, 0xbe, 0x58, 0x05, 0x21, 0x6a, 0xfc, 0x5a, 0xff}
+	cipherChaCha20 = []byte{0xd6, 0x03, 0x8a, 0x2b, 0x8b, 0x6f, 0x4c, 0xb5, 0xa5, 0x24, 0x33, 0x9a, 0x31, 0xdb, 0xb5, 0x9a}
+	cipherTwofish  = []byte{0xad, 0x68, 0xf2, 0x9f, 0x57, 0x6f, 0x4b, 0xb9, 0xa3, 0x6a, 0xd4, 0x7a, 0xf9, 0x65, 0x34, 0x6c}
+
+	// Key derivation function identifiers.
+	kdfAESKDBX3 = []byte{0xc9, 0xd9, 0xf3, 0x9a, 0x62, 0x8a, 0x44, 0x60, 0xbf, 0x74, 0x0d, 0x08, 0xc1, 0x8a, 0x4f, 0xea}
+	kdfAESKDBX4 = []byte{0x7c, 0x02, 0xbb, 0x82, 0x79, 0xa7, 0x4a, 0xc0, 0x92, 0x7d, 0x11, 0x4a, 0x00, 0x64, 0x82, 0x38}
+	kdfArgon2d  = []byte{0xef, 0x63, 0x6d, 0xdf, 0x8c, 0x29, 0x44, 0x4b, 0x91, 0xf7, 0xa9, 0xa4, 0x03, 0xe3, 0x0a, 0x0c}
+	kdfArgon2id = []byte{0x9e, 0x29, 0x8b, 0x19, 0x56, 0xdb, 0x47, 0x73, 0xb2, 0x3d, 0xfc, 0x3e, 0xc6, 0xf0, 0xa1, 0xe6}
+
+	// salsa20Nonce is the fixed nonce used for the Salsa20 inner stream.
+	salsa20Nonce = []byte{0xe8, 0x30, 0x09, 0x4b, 0x97, 0x20, 0x5d, 0x2a}
+)
+
+// blockSize is the size of the HMAC blocks written. KeePass uses 1MiB.
+const blockSize = 1024 * 1024
+
+// ErrInvalidCredentials is returned when the database cannot be opened
+// because the password or key file are wrong.
+var ErrInvalidCredentials = errors.New("invalid credentials or corrupt KeePass database")
+
+// transformKey runs the composite key through the KDF described by the header.
+func transformKey(kdf *variantDict, composite []byte) ([]byte, error) {
+	uuid, _ := kdf.get("$UUID")
+	switch {
+	case bytes.Equal(uuid, kdfAESKDBX3), bytes.Equal(uuid, kdfAESKDBX4):
+		rounds, ok := kdf.getUint("R")
+		seed, _ := kdf.get("S")
+		if !ok || len(seed) != 32 {
+			return nil, errors.New("malformed AES-KDF parameters")
+		}
+		return aesKDF(composite, seed, rounds)
+
+	case bytes.Equal(uuid, kdfArgon2d), bytes.Equal(uuid, kdfArgon2id):
+		mode := argon2d
+		if bytes.Equal(uuid, kdfArgon2id) {
+			mode = argon2id
+		}
+
+		salt, _ := kdf.get("S")
+		secret, _ := kdf.get("K")
+		data, _ := kdf.get("A")
+		memory, okM := kdf.getUint("M")
+		iterations, okI := kdf.getUint("I")
+		parallelism, okP := kdf.getUint("P")
+		if !okM || !okI || !okP {
+			return nil, errors.New("malformed Argon2 parameters")
+		}
+		if version, ok := kdf.getUint("V"); ok && version != argon2Version {
+			return nil, fmt.Errorf("unsupported Argon2 version %#x", version)
+		}
+		if memory/1024 > math.MaxUint32 || iterations > math.MaxUint32 || parallelism > math.MaxUint32 {
+			return nil, errors.New("Argon2 parameters are out of range")
+		}
+
+		return argon2Key(mode, composite, salt, secret, data,
+			uint32(iterations), uint32(memory/1024), uint32(parallelism), 32,
+		), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key derivation function %x", uuid)
+}
+
+// aesKDF performs the AES-KDF key transformation.
+func aesKDF(composite, seed []byte, rounds uint64) ([]byte, error) {
+	c, err := aes.NewCipher(seed)
+	if err != nil {
+		return nil, err
+	}
+
+	key := make([]byte, len(composite))
+	copy(key, composite)
+	for i := uint64(0); i < rounds; i++ {
+		c.Encrypt(key[0:16], key[0:16])
+		c.Encrypt(key[16:32], key[16:32])
+	}
+
+	sum := sha256.Sum256(key)
+	return sum[:], nil
+}
+
+// cipherKey computes the key used for the outer encryption.
+func cipherKey(masterSeed, transformed []byte) []byte {
+	h := sha256.New()
+	h.Write(masterSeed)
+	h.Write(transformed)
+	return h.Sum(nil)
+}
+
+// hmacBaseKey computes the key from which each HMAC block key is derived.
+func hmacBaseKey(masterSeed, transformed []byte) []byte {
+	h := sha512.New()
+	h.Write(masterSeed)
+	h.Write(transformed)
+	h.Write([]byte{0x01})
+	return h.Sum(nil)
+}
+
+// blockHMACKey returns the HMAC key for the block with the given index. The
+// header HMAC uses the maximum index.
+func blockHMACKey(base []byte, index uint64) []byte {
+	var idx [8]byte
+	binary.LittleEndian.PutUint64(idx[:], index)
+
+	h := sha512.New()
+	h.Write(idx[:])
+	h.Write(base)
+	return h.Sum(nil)
+}
+
+// blockHMAC computes the HMAC for a single block of the block stream.
+func blockHMAC(base []byte, index uint64, data []byte) []byte {
+	var prefix [12]byte
+	binary.LittleEndian.PutUint64(prefix[:8], index)
+	binary.LittleEndian.PutUint32(prefix[8:], uint32(len(data)))
+
+	m := hmac.New(sha256.New, blockHMACKey(base, index))
+	m.Write(prefix[:])
+	m.Write(data)
+	return m.Sum(nil)
+}
+
+// headerHMAC computes the HMAC that follows the header.
+func headerHMAC(base, raw []byte) []byte {
+	m := hmac.New(sha256.New, blockHMACKey(base, math.MaxUint64))
+	m.Write(raw)
+	return m.Sum(nil)
+}
+
+// readBlocks reads and verifies the HMAC block stream, returning the still
+// encrypted payload.
+func readBlocks(r io.Reader, base []byte) ([]byte, error) {
+	out := new(bytes.Buffer)
+	for index := uint64(0); ; index++ {
+		var mac [32]byte
+		if _, err := io.ReadFull(r, mac[:]); err != nil {
+			return nil, fmt.Errorf("failed to read block: %w", err)
+		}
+
+		var size int32
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+			return nil, fmt.Errorf("failed to read block: %w", err)
+		}
+		if size < 0 {
+			return nil, errors.New("malformed block size")
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("failed to read block: %w", err)
+		}
+
+		if !hmac.Equal(mac[:], blockHMAC(base, index, data)) {
+			return nil, fmt.Errorf("block %d failed integrity check", index)
+		}
+
+		if size == 0 {
+			return out.Bytes(), nil
+		}
+
+		out.Write(data)
+	}
+}
+
+// writeBlocks writes the encrypted payload as an HMAC block stream.
+func writeBlocks(w io.Writer, base, payload []byte) error {
+	for index := uint64(0); ; index++ {
+		n := len(payload)
+		if n > blockSize {
+			n = blockSize
+		}
+		data := payload[:n]
+		payload = payload[n:]
+
+		var size [4]byte
+		binary.LittleEndian.PutUint32(size[:], uint32(n))
+
+		for _, b := range [][]byte{blockHMAC(base, index, data), size[:], data} {
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+		}
+
+		if n == 0 {
+			return nil
+		}
+	}
+}
+
+// ivSize returns the size of the encryption IV required by the cipher.
+func ivSize(cipherID []byte) int {
+	if bytes.Equal(cipherID, cipherChaCha20) {
+		return chacha20.NonceSize
+	}
+	return aes.BlockSize
+}
+
+// decrypt removes the outer encryption from the payload.
+func decrypt(cipherID, key, iv, data []byte) ([]byte, error) {
+	switch {
+	case bytes.Equal(cipherID, cipherChaCha20):
+		c, err := chacha20.NewUnauthenticatedCipher(key, iv)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, len(data))
+		c.XORKeyStream(out, data)
+		return out, nil
+
+	case bytes.Equal(cipherID, cipherAES256), bytes.Equal(cipherID, cipherTwofish):
+		b, err := blockCipher(cipherID, key)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) == 0 || len(data)%b.BlockSize() != 0 || len(iv) != b.BlockSize() {
+			return nil, ErrInvalidCredentials
+		}
+		out := make([]byte, len(data))
+		cipher.NewCBCDecrypter(b, iv).CryptBlocks(out, data)
+
+		pad := int(out[len(out)-1])
+		if pad == 0 || pad > b.BlockSize() {
+			return nil, ErrInvalidCredentials
+		}
+		return out[:len(out)-pad], nil
+	}
+
+	return nil, fmt.Errorf("unsupported cipher %x", cipherID)
+}
+
+// encrypt applies the outer encryption to the payload.
+func encrypt(cipherID, key, iv, data []byte) ([]byte, error) {
+	switch {
+	case bytes.Equal(cipherID, cipherChaCha20):
+		return decrypt(cipherID, key, iv, data)
+
+	case bytes.Equal(cipherID, cipherAES256), bytes.Equal(cipherID, cipherTwofish):
+		b, err := blockCipher(cipherID, key)
+		if err != nil {
+			return nil, err
+		}
+		pad := b.BlockSize() - len(data)%b.BlockSize()
+		in := make([]byte, len(data)+pad)
+		copy(in, data)
+		for i := len(data); i < len(in); i++ {
+			in[i] = byte(pad)
+		}
+		out := make([]byte, len(in))
+		cipher.NewCBCEncrypter(b, iv).CryptBlocks(out, in)
+		return out, nil
+	}
+
+	return nil, fmt.Errorf("unsupported cipher %x", cipherID)
+}
+
+// blockCipher constructs the block cipher for CBC mode ciphers.
+func blockCipher(cipherID, key []byte) (cipher.Block, error) {
+	if bytes.Equal(cipherID, cipherTwofish) {
+		return twofish.NewCipher(key)
+	}
+	return aes.NewCipher(key)
+}
+
+// keystream returns n bytes of the inner random stream used to protect
+// values within the XML document.
+func keystream(streamID uint32, key []byte, n int) ([]byte, error) {
+	out := make([]byte, n)
+	switch streamID {
+	case innerStreamChaCha:
+		h := sha512.Sum512(key)
+		c, err := chacha20.NewUnauthenticatedCipher(h[:32], h[32:44])
+		if err != nil {
+			return nil, err
+		}
+		c.XORKeyStream(out, out)
+		return out, nil
+
+	case innerStreamSalsa:
+		h := sha256.Sum256(key)
+		salsa20.XORKeyStream(out, out, salsa20Nonce, &h)
+		return out, nil
+	}
+
+	return nil, fmt.Errorf("unsupported inner random stream %d", streamID)
+}
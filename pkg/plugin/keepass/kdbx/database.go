@@ -0,0 +1,233 @@
+package kdbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Database is a decrypted KeePass database.
+type Database struct {
+	hdr   *header
+	inner *innerHeader
+	doc   *node
+
+	key         *Key
+	transformed []byte
+}
+
+// New creates a new, empty database protected by the given key. It uses the
+// same defaults as KeePassXC: AES-256 encryption, gzip compression, and
+// Argon2d key derivation.
+func New(key *Key) *Database {
+	kdf := &variantDict{}
+	kdf.set(vdByteArray, "$UUID", kdfArgon2d)
+	kdf.set(vdByteArray, "S", randomBytes(32))
+	kdf.setUint32("P", 2)
+	kdf.setUint64("M", 64*1024*1024)
+	kdf.setUint64("I", 10)
+	kdf.setUint32("V", argon2Version)
+
+	doc := &node{}
+	doc.XMLName.Local = "KeePassFile"
+
+	meta := doc.add("Meta", "")
+	meta.add("Generator", "garotate")
+	meta.add("DatabaseName", "")
+	meta.add("HistoryMaxItems", "10")
+	meta.add("HistoryMaxSize", "6291456")
+
+	root := doc.add("Root", "")
+	newGroup(root, "Root")
+	root.add("DeletedObjects", "")
+
+	return &Database{
+		hdr: &header{
+			version:     version4,
+			cipherID:    cipherAES256,
+			compression: compressionGzip,
+			kdf:         kdf,
+		},
+		inner: &innerHeader{streamID: innerStreamChaCha},
+		doc:   doc,
+		key:   key,
+	}
+}
+
+// SetArgon2 sets the Argon2 parameters used to derive the key when the
+// database is next encoded: the number of iterations, the memory in bytes, and
+// the parallelism. The variant of Argon2 used is kept, but a database using
+// AES-KDF is switched to Argon2d. The defaults of New match KeePassXC and should
+// only be lowered where opening the database quickly matters more than
+// resisting guesses of the key.
+func (db *Database) SetArgon2(iterations, memory uint64, parallelism uint32) {
+	uuid, _ := db.hdr.kdf.get("$UUID")
+	if !bytes.Equal(uuid, kdfArgon2d) && !bytes.Equal(uuid, kdfArgon2id) {
+		kdf := &variantDict{}
+		kdf.set(vdByteArray, "$UUID", kdfArgon2d)
+		kdf.set(vdByteArray, "S", randomBytes(32))
+		kdf.setUint32("V", argon2Version)
+		db.hdr.kdf = kdf
+	}
+
+	db.hdr.kdf.setUint64("I", iterations)
+	db.hdr.kdf.setUint64("M", memory)
+	db.hdr.kdf.setUint32("P", parallelism)
+}
+
+// Decode reads and decrypts a KDBX 4 database. It returns
+// ErrInvalidCredentials if the key does not unlock the database.
+func Decode(r io.Reader, key *Key) (*Database, error) {
+	hdr, raw, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if hdr.kdf == nil || hdr.cipherID == nil || len(hdr.masterSeed) != 32 {
+		return nil, errors.New("KeePass database header is incomplete")
+	}
+
+	var hash, mac [32]byte
+	if _, err := io.ReadFull(r, hash[:]); err != nil {
+		return nil, fmt.Errorf("failed to read header hash: %w", err)
+	}
+	if sum := sha256.Sum256(raw); !bytes.Equal(hash[:], sum[:]) {
+		return nil, errors.New("KeePass database header is corrupt")
+	}
+	if _, err := io.ReadFull(r, mac[:]); err != nil {
+		return nil, fmt.Errorf("failed to read header HMAC: %w", err)
+	}
+
+	transformed, err := transformKey(hdr.kdf, key.composite)
+	if err != nil {
+		return nil, err
+	}
+
+	base := hmacBaseKey(hdr.masterSeed, transformed)
+	if !hmac.Equal(mac[:], headerHMAC(base, raw)) {
+		return nil, ErrInvalidCredentials
+	}
+
+	payload, err := readBlocks(r, base)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err = decrypt(hdr.cipherID, cipherKey(hdr.masterSeed, transformed), hdr.encryptionIV, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var pr io.Reader = bytes.NewReader(payload)
+	if hdr.compression == compressionGzip {
+		gz, err := gzip.NewReader(pr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress KeePass database: %w", err)
+		}
+		defer gz.Close()
+		pr = gz
+	}
+
+	inner, err := readInnerHeader(pr)
+	if err != nil {
+		return nil, err
+	}
+
+	xmlData, err := io.ReadAll(pr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress KeePass database: %w", err)
+	}
+
+	doc, err := parseDocument(xmlData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse KeePass database XML: %w", err)
+	}
+
+	if err := doc.unprotect(inner); err != nil {
+		return nil, fmt.Errorf("failed to decode protected values: %w", err)
+	}
+
+	return &Database{
+		hdr:         hdr,
+		inner:       inner,
+		doc:         doc,
+		key:         key,
+		transformed: transformed,
+	}, nil
+}
+
+// Encode encrypts and writes the database using the key it was opened or
+// created with. Fresh random seeds are generated on every write.
+func (db *Database) Encode(w io.Writer) error {
+	if db.transformed == nil {
+		transformed, err := transformKey(db.hdr.kdf, db.key.composite)
+		if err != nil {
+			return err
+		}
+		db.transformed = transformed
+	}
+
+	db.hdr.masterSeed = randomBytes(32)
+	db.hdr.encryptionIV = randomBytes(ivSize(db.hdr.cipherID))
+	db.inner.streamID = innerStreamChaCha
+	db.inner.streamKey = randomBytes(64)
+
+	restore, err := db.doc.protect(db.inner)
+	if err != nil {
+		return fmt.Errorf("failed to encode protected values: %w", err)
+	}
+	xmlData, err := db.doc.marshal()
+	restore()
+	if err != nil {
+		return fmt.Errorf("failed to generate KeePass database XML: %w", err)
+	}
+
+	payload := new(bytes.Buffer)
+	var pw io.Writer = payload
+	var gz *gzip.Writer
+	if db.hdr.compression == compressionGzip {
+		gz = gzip.NewWriter(payload)
+		pw = gz
+	}
+	if _, err := pw.Write(db.inner.bytes()); err != nil {
+		return err
+	}
+	if _, err := pw.Write(xmlData); err != nil {
+		return err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return err
+		}
+	}
+
+	enc, err := encrypt(db.hdr.cipherID, cipherKey(db.hdr.masterSeed, db.transformed), db.hdr.encryptionIV, payload.Bytes())
+	if err != nil {
+		return err
+	}
+
+	raw := db.hdr.bytes()
+	hash := sha256.Sum256(raw)
+	base := hmacBaseKey(db.hdr.masterSeed, db.transformed)
+
+	for _, b := range [][]byte{raw, hash[:], headerHMAC(base, raw)} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+
+	return writeBlocks(w, base, enc)
+}
+
+// randomBytes returns n cryptographically random bytes.
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("unable to read random bytes: %v", err))
+	}
+	return b
+}
@@ -0,0 +1,248 @@
+package kdbx
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cheapDatabase returns a new database with a KDF cheap enough for tests.
+func cheapDatabase(t *testing.T, key *Key) *Database {
+	db := New(key)
+	db.SetArgon2(1, 64*1024, 2)
+	return db
+}
+
+// roundTrip encodes the database and decodes it again with the given key.
+func roundTrip(t *testing.T, db *Database, key *Key) (*Database, error) {
+	buf := new(bytes.Buffer)
+	require.NoError(t, db.Encode(buf), "encode works")
+	return Decode(bytes.NewReader(buf.Bytes()), key)
+}
+
+func TestHappyRoundTrip(t *testing.T) {
+	key, err := NewKey("hunter2", nil)
+	require.NoError(t, err, "password key works")
+
+	db := cheapDatabase(t, key)
+	e := db.EnsureEntry([]string{"CI", "deploy"}, "s3sync")
+	e.Set("UserName", "s3sync-builder", false)
+	e.Set("Password", "sekrit", true)
+
+	db2, err := roundTrip(t, db, key)
+	require.NoError(t, err, "decode works")
+
+	e2 := db2.FindEntry([]string{"CI", "deploy"}, "s3sync")
+	require.NotNil(t, e2, "entry is found after round trip")
+
+	v, ok := e2.Get("UserName")
+	assert.True(t, ok, "user name is set")
+	assert.Equal(t, "s3sync-builder", v, "user name survives")
+
+	v, ok = e2.Get("Password")
+	assert.True(t, ok, "password is set")
+	assert.Equal(t, "sekrit", v, "protected password survives")
+
+	_, ok = e2.Get("Nope")
+	assert.False(t, ok, "missing field is missing")
+
+	assert.Nil(t, db2.FindEntry([]string{"CI"}, "s3sync"), "entry is only in its own group")
+}
+
+func TestHappyCiphersAndKDFs(t *testing.T) {
+	key, err := NewKey("", []byte("any old file contents will do"))
+	require.NoError(t, err, "key file key works")
+
+	for _, cipherID := range [][]byte{cipherAES256, cipherChaCha20, cipherTwofish} {
+		db := cheapDatabase(t, key)
+		db.hdr.cipherID = cipherID
+		db.hdr.kdf = &variantDict{}
+		db.hdr.kdf.set(vdByteArray, "$UUID", kdfAESKDBX4)
+		db.hdr.kdf.set(vdByteArray, "S", randomBytes(32))
+		db.hdr.kdf.setUint64("R", 1000)
+		db.EnsureEntry(nil, "top").Set("Password", "value", true)
+
+		db2, err := roundTrip(t, db, key)
+		require.NoErrorf(t, err, "decode works with cipher %x", cipherID)
+
+		e := db2.FindEntry(nil, "top")
+		require.NotNil(t, e, "entry is found")
+		v, _ := e.Get("Password")
+		assert.Equal(t, "value", v, "value survives cipher %x", cipherID)
+	}
+}
+
+// fixturePassword is the password of every database in testdata. Each holds a
+// CI/s3sync entry whose password is "first". See testdata/README.md.
+const fixturePassword = "hunter2"
+
+func TestHappyFixtures(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.kdbx"))
+	require.NoError(t, err, "fixtures are listed")
+	require.NotEmpty(t, paths, "fixtures are present")
+
+	key, err := NewKey(fixturePassword, nil)
+	require.NoError(t, err, "password key works")
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err, "fixture %s is read", path)
+
+		db, err := Decode(bytes.NewReader(data), key)
+		require.NoError(t, err, "fixture %s decodes", path)
+
+		e := db.FindEntry([]string{"CI"}, "s3sync")
+		require.NotNil(t, e, "entry is found in %s", path)
+		assert.Equal(t, "first", e.mustGet(t, "Password"), "value is read from %s", path)
+
+		e.Backup()
+		e.Set("Password", "second", true)
+
+		db2, err := roundTrip(t, db, key)
+		require.NoError(t, err, "fixture %s decodes after update", path)
+
+		e2 := db2.FindEntry([]string{"CI"}, "s3sync")
+		require.NotNil(t, e2, "entry is found in updated %s", path)
+		assert.Equal(t, "second", e2.mustGet(t, "Password"), "value is updated in %s", path)
+		assert.NotNil(t, e2.n.child("History"), "old value is kept in %s", path)
+	}
+}
+
+func TestSadWrongKey(t *testing.T) {
+	key, err := NewKey("hunter2", nil)
+	require.NoError(t, err, "password key works")
+	bad, err := NewKey("hunter3", nil)
+	require.NoError(t, err, "other password key works")
+
+	_, err = roundTrip(t, cheapDatabase(t, key), bad)
+	assert.ErrorIs(t, err, ErrInvalidCredentials, "wrong password is rejected")
+}
+
+func TestSadNoKey(t *testing.T) {
+	_, err := NewKey("", nil)
+	assert.Error(t, err, "a key needs something")
+}
+
+func TestHappyHistory(t *testing.T) {
+	key, err := NewKey("hunter2", nil)
+	require.NoError(t, err, "password key works")
+
+	db := cheapDatabase(t, key)
+	e := db.EnsureEntry([]string{"CI"}, "thing")
+	e.Set("Password", "one", true)
+
+	then := time.Date(2022, time.May, 1, 12, 0, 0, 0, time.UTC)
+	for i, v := range []string{"two", "three"} {
+		e.Backup()
+		e.Set("Password", v, true)
+		e.Touch(then.Add(time.Duration(i) * time.Hour))
+	}
+
+	db2, err := roundTrip(t, db, key)
+	require.NoError(t, err, "decode works")
+
+	e2 := db2.FindEntry([]string{"CI"}, "thing")
+	require.NotNil(t, e2, "entry is found")
+	assert.Equal(t, then.Add(time.Hour), e2.LastModified(), "modification time survives")
+
+	v, _ := e2.Get("Password")
+	assert.Equal(t, "three", v, "current value is newest")
+
+	hist := e2.n.child("History")
+	require.NotNil(t, hist, "entry has history")
+	require.Len(t, hist.Nodes, 2, "two old versions are kept")
+
+	var old []string
+	for _, hn := range hist.Nodes {
+		he := &Entry{db2, hn}
+		v, _ := he.Get("Password")
+		old = append(old, v)
+		assert.Nil(t, hn.child("History"), "history entries have no history")
+	}
+	assert.Equal(t, []string{"one", "two"}, old, "old values are kept in order")
+}
+
+func TestHappyHistoryMaxItems(t *testing.T) {
+	key, err := NewKey("hunter2", nil)
+	require.NoError(t, err, "password key works")
+
+	db := cheapDatabase(t, key)
+	db.doc.child("Meta").child("HistoryMaxItems").Text = "2"
+
+	e := db.EnsureEntry(nil, "thing")
+	for _, v := range []string{"one", "two", "three", "four"} {
+		e.Backup()
+		e.Set("Password", v, true)
+	}
+
+	assert.Len(t, e.n.child("History").Nodes, 2, "history is trimmed")
+}
+
+func TestHappyHistoryMaxSize(t *testing.T) {
+	key, err := NewKey("hunter2", nil)
+	require.NoError(t, err, "password key works")
+
+	db := cheapDatabase(t, key)
+	db.doc.child("Meta").child("HistoryMaxItems").Text = "-1"
+
+	e := db.EnsureEntry(nil, "thing")
+	e.Set("Password", "one", true)
+	e.Backup()
+	max := historySize(e.n.child("History").Nodes[0])
+	db.doc.child("Meta").child("HistoryMaxSize").Text = strconv.Itoa(2*max + max/2)
+
+	for _, v := range []string{"two", "six", "ten", "won"} {
+		e.Set("Password", v, true)
+		e.Backup()
+	}
+
+	hist := e.n.child("History").Nodes
+	require.Len(t, hist, 2, "history is trimmed to fit the size")
+
+	var kept []string
+	for _, hn := range hist {
+		kept = append(kept, (&Entry{db: db, n: hn}).mustGet(t, "Password"))
+	}
+	assert.Equal(t, []string{"ten", "won"}, kept, "newest items are kept")
+
+	db.doc.child("Meta").child("HistoryMaxSize").Text = "0"
+	e.Backup()
+	assert.Empty(t, e.n.child("History").Nodes, "no history fits in no space")
+}
+
+// mustGet returns the value of the field, failing the test if it is missing.
+func (e *Entry) mustGet(t *testing.T, key string) string {
+	v, ok := e.Get(key)
+	require.True(t, ok, "field %q is set", key)
+	return v
+}
+
+func TestHappyKeyFiles(t *testing.T) {
+	raw := bytes.Repeat([]byte{0x42}, 32)
+
+	xmlV1 := []byte(`<?xml version="1.0" encoding="utf-8"?>
+<KeyFile><Meta><Version>1.00</Version></Meta><Key><Data>QkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkI=</Data></Key></KeyFile>`)
+	xmlV2 := []byte(`<?xml version="1.0" encoding="utf-8"?>
+<KeyFile>
+	<Meta><Version>2.0</Version></Meta>
+	<Key>
+		<Data Hash="425ED4E4">
+			42424242 42424242 42424242 42424242
+			42424242 42424242 42424242 42424242
+		</Data>
+	</Key>
+</KeyFile>`)
+	hexFile := bytes.Repeat([]byte("42"), 32)
+
+	for _, kf := range [][]byte{raw, xmlV1, xmlV2, hexFile} {
+		k, err := keyFileKey(kf)
+		assert.NoError(t, err, "key file parses")
+		assert.Equal(t, raw, k, "key file has the expected key")
+	}
+}
@@ -0,0 +1,4 @@
+// Package kdbx provides just enough of the KeePass KDBX 4 file format for the
+// keepass storage plugin to read a database, update entries, and write it back
+// without disturbing anything else stored in it.
+package kdbx
@@ -0,0 +1,252 @@
+package kdbx
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entry is a single entry in the database.
+type Entry struct {
+	db *Database
+	n  *node
+}
+
+// rootGroup returns the top-level group of the database.
+func (db *Database) rootGroup() *node {
+	root := db.doc.child("Root")
+	if root == nil {
+		return nil
+	}
+	return root.child("Group")
+}
+
+// FindEntry locates the entry with the given title within the given groups,
+// which are named relative to the top-level group. It returns nil if no such
+// entry exists.
+func (db *Database) FindEntry(groups []string, title string) *Entry {
+	g := db.rootGroup()
+	for _, name := range groups {
+		if g == nil {
+			return nil
+		}
+		g = findGroup(g, name)
+	}
+	if g == nil {
+		return nil
+	}
+
+	for _, en := range g.children("Entry") {
+		e := &Entry{db, en}
+		if t, _ := e.Get("Title"); t == title {
+			return e
+		}
+	}
+	return nil
+}
+
+// EnsureEntry works just like FindEntry, but creates the entry and any missing
+// groups if they do not yet exist.
+func (db *Database) EnsureEntry(groups []string, title string) *Entry {
+	if e := db.FindEntry(groups, title); e != nil {
+		return e
+	}
+
+	g := db.rootGroup()
+	if g == nil {
+		g = newGroup(db.doc.ensure("Root"), "Root")
+	}
+	for _, name := range groups {
+		if sg := findGroup(g, name); sg != nil {
+			g = sg
+		} else {
+			g = newGroup(g, name)
+		}
+	}
+
+	now := time.Now()
+	en := g.add("Entry", "")
+	en.add("UUID", newUUID())
+	en.add("IconID", "0")
+	addTimes(en, now)
+
+	e := &Entry{db, en}
+	e.Set("Title", title, false)
+	return e
+}
+
+// findGroup returns the subgroup of g with the given name or nil.
+func findGroup(g *node, name string) *node {
+	for _, sg := range g.children("Group") {
+		if n := sg.child("Name"); n != nil && n.Text == name {
+			return sg
+		}
+	}
+	return nil
+}
+
+// newGroup adds a new group with the given name to the parent.
+func newGroup(parent *node, name string) *node {
+	g := parent.add("Group", "")
+	g.add("UUID", newUUID())
+	g.add("Name", name)
+	g.add("IconID", "48")
+	addTimes(g, time.Now())
+	g.add("IsExpanded", "True")
+	return g
+}
+
+// addTimes adds a fresh Times element to the given group or entry.
+func addTimes(n *node, now time.Time) {
+	ts := formatTime(now)
+	t := n.add("Times", "")
+	t.add("CreationTime", ts)
+	t.add("LastModificationTime", ts)
+	t.add("LastAccessTime", ts)
+	t.add("ExpiryTime", ts)
+	t.add("Expires", "False")
+	t.add("UsageCount", "0")
+	t.add("LocationChanged", ts)
+}
+
+// newUUID returns a random UUID encoded as KeePass expects.
+func newUUID() string {
+	return base64.StdEncoding.EncodeToString(randomBytes(16))
+}
+
+// field returns the String element holding the given key or nil.
+func (e *Entry) field(key string) *node {
+	for _, s := range e.n.children("String") {
+		if k := s.child("Key"); k != nil && k.Text == key {
+			return s
+		}
+	}
+	return nil
+}
+
+// Get returns the value of the field with the given key and true or the empty
+// string and false if no such field is set.
+func (e *Entry) Get(key string) (string, bool) {
+	s := e.field(key)
+	if s == nil {
+		return "", false
+	}
+	if v := s.child("Value"); v != nil {
+		return v.Text, true
+	}
+	return "", true
+}
+
+// Set sets the value of the field with the given key, adding the field if it
+// does not yet exist. When protect is true, the value will be protected in
+// memory by KeePass clients and hidden in their display.
+func (e *Entry) Set(key, value string, protect bool) {
+	s := e.field(key)
+	if s == nil {
+		s = &node{}
+		s.XMLName.Local = "String"
+		s.add("Key", key)
+		e.insertBeforeHistory(s)
+	}
+
+	v := s.ensure("Value")
+	v.Text = value
+	if protect {
+		v.setAttr("Protected", "True")
+	}
+}
+
+// insertBeforeHistory adds a child element to the entry, keeping any History
+// element at the end where KeePass puts it.
+func (e *Entry) insertBeforeHistory(c *node) {
+	for i, cn := range e.n.Nodes {
+		if cn.XMLName.Local == "History" {
+			e.n.Nodes = append(e.n.Nodes[:i], append([]*node{c}, e.n.Nodes[i:]...)...)
+			return
+		}
+	}
+	e.n.Nodes = append(e.n.Nodes, c)
+}
+
+// LastModified returns the last modification time of the entry.
+func (e *Entry) LastModified() time.Time {
+	if t := e.n.child("Times"); t != nil {
+		if lm := t.child("LastModificationTime"); lm != nil {
+			if ts, ok := parseTime(lm.Text); ok {
+				return ts
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// Touch sets the last modification and access times of the entry.
+func (e *Entry) Touch(now time.Time) {
+	t := e.n.ensure("Times")
+	ts := formatTime(now)
+	t.ensure("LastModificationTime").Text = ts
+	t.ensure("LastAccessTime").Text = ts
+}
+
+// Backup copies the current state of the entry into its history, so that the
+// previous values can be recovered after modification. The oldest items are
+// removed if the history grows longer or larger than the database permits.
+func (e *Entry) Backup() {
+	snapshot := e.n.clone()
+	kept := snapshot.Nodes[:0]
+	for _, c := range snapshot.Nodes {
+		if c.XMLName.Local != "History" {
+			kept = append(kept, c)
+		}
+	}
+	snapshot.Nodes = kept
+
+	hist := e.n.child("History")
+	if hist == nil {
+		hist = e.n.add("History", "")
+	}
+	hist.Nodes = append(hist.Nodes, snapshot)
+
+	if max := e.db.metaLimit("HistoryMaxItems"); max >= 0 && len(hist.Nodes) > max {
+		hist.Nodes = hist.Nodes[len(hist.Nodes)-max:]
+	}
+
+	if max := e.db.metaLimit("HistoryMaxSize"); max >= 0 {
+		size := 0
+		keep := len(hist.Nodes)
+		for keep > 0 {
+			size += historySize(hist.Nodes[keep-1])
+			if size > max {
+				break
+			}
+			keep--
+		}
+		hist.Nodes = hist.Nodes[keep:]
+	}
+}
+
+// historySize estimates the size of a history item in bytes, which is the
+// length of its XML. KeePass estimates sizes differently, but both serve to
+// keep history from growing without bound.
+func historySize(n *node) int {
+	data, err := xml.Marshal(n)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+// metaLimit returns the value of a history limit setting of the database, such
+// as HistoryMaxItems or HistoryMaxSize, or -1 if unlimited.
+func (db *Database) metaLimit(name string) int {
+	if meta := db.doc.child("Meta"); meta != nil {
+		if lim := meta.child(name); lim != nil {
+			if max, err := strconv.Atoi(strings.TrimSpace(lim.Text)); err == nil {
+				return max
+			}
+		}
+	}
+	return -1
+}
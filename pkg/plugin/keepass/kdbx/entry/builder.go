@@ -0,0 +1,65 @@
+package entry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/plugin/keepass/kdbx"
+)
+
+// builder implements the plugin.Builder interface and provides the factory
+// method for constructing a Client.
+type builder struct{}
+
+// options are the plugin options accepted in the configuration.
+type options struct {
+	Path     string `mapstructure:"path"`
+	KeyFile  string `mapstructure:"key_file"`
+	Password string `mapstructure:"password"`
+}
+
+// Build constructs and returns a KeePass client.
+func (b *builder) Build(
+	ctx context.Context,
+	c *config.Plugin,
+) (plugin.Instance, error) {
+	var opts options
+	err := c.DecodeOptions(&opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read KeePass plugin options: %w", err)
+	}
+
+	if opts.Path == "" {
+		return nil, errors.New("the KeePass plugin requires a path option naming the database file")
+	}
+
+	if opts.Password == "" {
+		opts.Password = os.Getenv("KEEPASS_PASSWORD")
+	}
+
+	var keyFile []byte
+	if opts.KeyFile != "" {
+		keyFile, err = os.ReadFile(opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read KeePass key file %q: %w", opts.KeyFile, err)
+		}
+	}
+
+	key, err := kdbx.NewKey(opts.Password, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{path: opts.Path, key: key}, nil
+}
+
+// init registers the plugin.
+func init() {
+	pkg := reflect.TypeOf(Client{}).PkgPath()
+	plugin.Register(pkg, new(builder))
+}
@@ -0,0 +1,4 @@
+// Package entry provides a plugin that implements the rotate.Storage interface
+// for storing rotated secrets as fields of an entry in a KeePass (KDBX 4)
+// database file.
+package entry
@@ -0,0 +1,162 @@
+package entry
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin/internal/atomicfile"
+	"github.com/zostay/garotate/pkg/plugin/keepass/kdbx"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+// Client implements the rotate.Storage interface for storing keys following
+// rotation in a KeePass database.
+//
+// The storage name is the path to the entry, made up of the names of the
+// groups below the top-level group followed by the title of the entry, each
+// separated by a slash (e.g., "CI/deploy/s3sync-builder"). Each key is stored
+// as a protected field of the entry. The previous values are kept in the entry
+// history.
+//
+// To use this client, the path option must name the database file and either
+// the password option, a KEEPASS_PASSWORD environment variable, or the
+// key_file option must be set to unlock it.
+type Client struct {
+	path string
+	key  *kdbx.Key
+	db   *kdbx.Database
+}
+
+// entryPath splits the storage name into the group names and the entry title.
+func entryPath(store secret.Storage) ([]string, string, error) {
+	var parts []string
+	for _, p := range strings.Split(store.Name(), "/") {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+
+	if len(parts) == 0 {
+		return nil, "", fmt.Errorf("storage name %q does not name a KeePass entry", store.Name())
+	}
+
+	return parts[:len(parts)-1], parts[len(parts)-1], nil
+}
+
+// Name returns "KeePass database entries"
+func (c *Client) Name() string {
+	return "KeePass database entries"
+}
+
+// open reads and decrypts the database, unless it has been read already.
+func (c *Client) open() (*kdbx.Database, error) {
+	if c.db != nil {
+		return c.db, nil
+	}
+
+	f, err := os.Open(c.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open KeePass database %q: %w", c.path, err)
+	}
+	defer f.Close()
+
+	db, err := kdbx.Decode(f, c.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read KeePass database %q: %w", c.path, err)
+	}
+
+	c.db = db
+	return db, nil
+}
+
+// save writes the database back to disk. It writes to a temporary file first
+// and renames it into place so a failed write cannot corrupt the database.
+func (c *Client) save() error {
+	fi, err := os.Stat(c.path)
+	if err != nil {
+		return fmt.Errorf("failed to check KeePass database %q: %w", c.path, err)
+	}
+
+	err = atomicfile.Write(c.path, fi.Mode().Perm(), c.db.Encode)
+	if err != nil {
+		return fmt.Errorf("failed to write KeePass database %q: %w", c.path, err)
+	}
+
+	return nil
+}
+
+// LastSaved returns the modification time of the entry named by the storage
+// name if it has the given key. It returns secret.ErrKeyNotFound if the entry
+// does not exist or does not have the key.
+func (c *Client) LastSaved(
+	ctx context.Context,
+	store secret.Storage,
+	key string,
+) (time.Time, error) {
+	groups, title, err := entryPath(store)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	db, err := c.open()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	e := db.FindEntry(groups, title)
+	if e == nil {
+		return time.Time{}, secret.ErrKeyNotFound
+	}
+
+	if _, ok := e.Get(key); !ok {
+		return time.Time{}, secret.ErrKeyNotFound
+	}
+
+	return e.LastModified(), nil
+}
+
+// SaveKeys saves each of the secrets given as fields of the entry named by the
+// storage name, creating the entry and its groups if needed. The previous
+// version of the entry is kept in its history.
+func (c *Client) SaveKeys(
+	ctx context.Context,
+	store secret.Storage,
+	ss secret.Map,
+) error {
+	groups, title, err := entryPath(store)
+	if err != nil {
+		return err
+	}
+
+	db, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	e := db.FindEntry(groups, title)
+	if e != nil {
+		e.Backup()
+	} else {
+		e = db.EnsureEntry(groups, title)
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	for key, sec := range ss {
+		logger.Infow(
+			"updating KeePass entry field",
+			"client", c.Name(),
+			"storage", store.Name(),
+			"secret", key,
+		)
+
+		e.Set(key, sec, true)
+	}
+
+	e.Touch(time.Now())
+
+	return c.save()
+}
@@ -0,0 +1,191 @@
+package entry
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/plugin/keepass/kdbx"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+// testKeePassXCEnv names the environment variable holding the path to the
+// keepassxc-cli program, which is used to check that KeePassXC can read the
+// databases written by the plugin and that the plugin can read databases
+// written by KeePassXC.
+const testKeePassXCEnv = "GAROTATE_TEST_KEEPASSXC_CLI"
+
+// newDatabase writes a new database protected by the password with a cheap key
+// derivation and returns its path.
+func newDatabase(t *testing.T, password string) string {
+	t.Helper()
+
+	key, err := kdbx.NewKey(password, nil)
+	require.NoError(t, err)
+
+	db := kdbx.New(key)
+	db.SetArgon2(1, 64*1024, 2)
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, db.Encode(buf))
+
+	path := filepath.Join(t.TempDir(), "test.kdbx")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+	return path
+}
+
+// build builds the plugin for the database at the path.
+func build(t *testing.T, path, password string) *Client {
+	t.Helper()
+
+	inst, err := plugin.Build(context.Background(), &config.Plugin{
+		Name:    "keepass",
+		Package: "github.com/zostay/garotate/pkg/plugin/keepass/kdbx/entry",
+		Options: map[string]any{
+			"path":     path,
+			"password": password,
+		},
+	})
+	require.NoError(t, err)
+	return inst.(*Client)
+}
+
+// read decodes the database at the path and returns the entry.
+func read(t *testing.T, path, password string, groups []string, title string) *kdbx.Entry {
+	t.Helper()
+
+	key, err := kdbx.NewKey(password, nil)
+	require.NoError(t, err)
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	db, err := kdbx.Decode(f, key)
+	require.NoError(t, err)
+	return db.FindEntry(groups, title)
+}
+
+func TestSaveKeys(t *testing.T) {
+	ctx := context.Background()
+	path := newDatabase(t, "hunter2")
+	c := build(t, path, "hunter2")
+
+	store := &config.StorageMap{StorageName: "CI/deploy/s3sync"}
+
+	_, err := c.LastSaved(ctx, store, "AWS_ACCESS_KEY_ID")
+	assert.ErrorIs(t, err, secret.ErrKeyNotFound, "no entry yet")
+
+	err = c.SaveKeys(ctx, store, secret.Map{
+		"AWS_ACCESS_KEY_ID":     "AKIA1",
+		"AWS_SECRET_ACCESS_KEY": "first",
+	})
+	require.NoError(t, err)
+
+	saved, err := c.LastSaved(ctx, store, "AWS_ACCESS_KEY_ID")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), saved, time.Minute, "just saved")
+
+	_, err = c.LastSaved(ctx, store, "OTHER")
+	assert.ErrorIs(t, err, secret.ErrKeyNotFound, "key not in entry")
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm(), "permissions kept")
+
+	err = c.SaveKeys(ctx, store, secret.Map{
+		"AWS_ACCESS_KEY_ID":     "AKIA2",
+		"AWS_SECRET_ACCESS_KEY": "second",
+	})
+	require.NoError(t, err)
+
+	e := read(t, path, "hunter2", []string{"CI", "deploy"}, "s3sync")
+	require.NotNil(t, e, "entry written to disk")
+	v, _ := e.Get("AWS_SECRET_ACCESS_KEY")
+	assert.Equal(t, "second", v, "newest value saved")
+
+	// a fresh client reads what the first one wrote
+	saved, err = build(t, path, "hunter2").LastSaved(ctx, store, "AWS_SECRET_ACCESS_KEY")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), saved, time.Minute)
+
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(path), ".garotate-*"))
+	require.NoError(t, err)
+	assert.Empty(t, matches, "no temporary files left behind")
+}
+
+func TestSadStorage(t *testing.T) {
+	ctx := context.Background()
+	path := newDatabase(t, "hunter2")
+
+	_, err := build(t, path, "hunter2").LastSaved(ctx, &config.StorageMap{StorageName: "/"}, "KEY")
+	assert.ErrorContains(t, err, "does not name a KeePass entry")
+
+	_, err = build(t, path, "wrong").LastSaved(ctx, &config.StorageMap{StorageName: "thing"}, "KEY")
+	assert.ErrorIs(t, err, kdbx.ErrInvalidCredentials, "wrong password")
+
+	err = build(t, filepath.Join(t.TempDir(), "missing.kdbx"), "hunter2").
+		SaveKeys(ctx, &config.StorageMap{StorageName: "thing"}, secret.Map{"KEY": "value"})
+	assert.Error(t, err, "database must exist")
+
+	_, err = (&builder{}).Build(ctx, &config.Plugin{})
+	assert.Error(t, err, "path is required")
+}
+
+// keepassxc runs keepassxc-cli with the password, and any further input lines,
+// on its standard input and returns its standard output.
+func keepassxc(t *testing.T, cli string, input []string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command(cli, args...)
+	cmd.Stdin = strings.NewReader(strings.Join(input, "\n") + "\n")
+	out, err := cmd.Output()
+	require.NoError(t, err, "keepassxc-cli %s", strings.Join(args, " "))
+	return strings.TrimSpace(string(out))
+}
+
+func TestKeePassXC(t *testing.T) {
+	cli := os.Getenv(testKeePassXCEnv)
+	if cli == "" {
+		t.Skipf("set %s to the path of keepassxc-cli to test against KeePassXC", testKeePassXCEnv)
+	}
+
+	ctx := context.Background()
+
+	// a database written by KeePassXC is read and updated by the plugin
+	path := filepath.Join(t.TempDir(), "keepassxc.kdbx")
+	keepassxc(t, cli, []string{"hunter2", "hunter2"}, "db-create", "--set-password", path)
+	keepassxc(t, cli, []string{"hunter2"}, "mkdir", path, "CI")
+	keepassxc(t, cli, []string{"hunter2", "first"}, "add", "--password-prompt", path, "CI/s3sync")
+
+	e := read(t, path, "hunter2", []string{"CI"}, "s3sync")
+	require.NotNil(t, e, "entry added by KeePassXC is found")
+	v, _ := e.Get("Password")
+	assert.Equal(t, "first", v, "protected value written by KeePassXC")
+
+	store := &config.StorageMap{StorageName: "CI/s3sync"}
+	err := build(t, path, "hunter2").SaveKeys(ctx, store, secret.Map{"Password": "second"})
+	require.NoError(t, err)
+
+	// a database written by the plugin is read by KeePassXC
+	assert.Equal(t, "second",
+		keepassxc(t, cli, []string{"hunter2"}, "show", "--show-protected", "--attributes", "Password", path, "CI/s3sync"),
+		"KeePassXC reads the value saved by the plugin")
+
+	path = newDatabase(t, "hunter2")
+	err = build(t, path, "hunter2").SaveKeys(ctx, &config.StorageMap{StorageName: "CI/deploy/s3sync"}, secret.Map{"Password": "third"})
+	require.NoError(t, err)
+	assert.Equal(t, "third",
+		keepassxc(t, cli, []string{"hunter2"}, "show", "--show-protected", "--attributes", "Password", path, "CI/deploy/s3sync"),
+		"KeePassXC reads a database created by the plugin")
+}
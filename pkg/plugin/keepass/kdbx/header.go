@@ -0,0 +1,335 @@
+package kdbx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// signature1 and signature2 begin every KeePass 2.x database file.
+	signature1 uint32 = 0x9AA2D903
+	signature2 uint32 = 0xB54BFB67
+
+	// version4 is the file version written for new databases. Any 4.x minor
+	// version is accepted when reading.
+	version4 uint32 = 0x00040000
+
+	// compressionGzip is the compression flag for gzip compression.
+	compressionGzip uint32 = 1
+)
+
+// Outer header field identifiers.
+const (
+	hdrEndOfHeader      byte = 0
+	hdrCipherID         byte = 2
+	hdrCompressionFlags byte = 3
+	hdrMasterSeed       byte = 4
+	hdrEncryptionIV     byte = 7
+	hdrKdfParameters    byte = 11
+	hdrPublicCustomData byte = 12
+)
+
+// Inner header field identifiers.
+const (
+	innerEndOfHeader  byte   = 0
+	innerStreamID     byte   = 1
+	innerStreamKey    byte   = 2
+	innerBinary       byte   = 3
+	innerStreamSalsa  uint32 = 2
+	innerStreamChaCha uint32 = 3
+)
+
+// Variant dictionary value types.
+const (
+	vdVersion   uint16 = 0x0100
+	vdEnd       byte   = 0x00
+	vdUInt32    byte   = 0x04
+	vdUInt64    byte   = 0x05
+	vdBool      byte   = 0x08
+	vdInt32     byte   = 0x0C
+	vdInt64     byte   = 0x0D
+	vdString    byte   = 0x18
+	vdByteArray byte   = 0x42
+)
+
+// header is the unencrypted outer header of a KDBX 4 database.
+type header struct {
+	version          uint32
+	cipherID         []byte
+	compression      uint32
+	masterSeed       []byte
+	encryptionIV     []byte
+	kdf              *variantDict
+	publicCustomData []byte
+}
+
+// innerHeader is the header found at the start of the decrypted payload.
+type innerHeader struct {
+	streamID  uint32
+	streamKey []byte
+	binaries  [][]byte
+}
+
+// vdItem is a single entry in a variant dictionary.
+type vdItem struct {
+	typ   byte
+	key   string
+	value []byte
+}
+
+// variantDict is the typed key/value structure used for the KDF parameters.
+// Item order is preserved so that unknown parameters survive a round-trip.
+type variantDict struct {
+	items []vdItem
+}
+
+// readHeader reads the outer header. It returns the parsed header and the raw
+// bytes read, which are needed to verify the header checksums.
+func readHeader(r io.Reader) (*header, []byte, error) {
+	raw := new(bytes.Buffer)
+	tr := io.TeeReader(r, raw)
+
+	var sig [3]uint32
+	if err := binary.Read(tr, binary.LittleEndian, &sig); err != nil {
+		return nil, nil, fmt.Errorf("failed to read database signature: %w", err)
+	}
+	if sig[0] != signature1 || sig[1] != signature2 {
+		return nil, nil, errors.New("file is not a KeePass database")
+	}
+	if sig[2]>>16 != version4>>16 {
+		return nil, nil, fmt.Errorf("unsupported KeePass database version %d.%d; only KDBX 4 is supported", sig[2]>>16, sig[2]&0xFFFF)
+	}
+
+	h := &header{version: sig[2]}
+	for {
+		var id byte
+		var size uint32
+		if err := binary.Read(tr, binary.LittleEndian, &id); err != nil {
+			return nil, nil, fmt.Errorf("failed to read header field: %w", err)
+		}
+		if err := binary.Read(tr, binary.LittleEndian, &size); err != nil {
+			return nil, nil, fmt.Errorf("failed to read header field: %w", err)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(tr, data); err != nil {
+			return nil, nil, fmt.Errorf("failed to read header field: %w", err)
+		}
+
+		switch id {
+		case hdrEndOfHeader:
+			return h, raw.Bytes(), nil
+		case hdrCipherID:
+			h.cipherID = data
+		case hdrCompressionFlags:
+			if len(data) != 4 {
+				return nil, nil, errors.New("malformed compression flags in header")
+			}
+			h.compression = binary.LittleEndian.Uint32(data)
+		case hdrMasterSeed:
+			h.masterSeed = data
+		case hdrEncryptionIV:
+			h.encryptionIV = data
+		case hdrKdfParameters:
+			kdf, err := readVariantDict(data)
+			if err != nil {
+				return nil, nil, err
+			}
+			h.kdf = kdf
+		case hdrPublicCustomData:
+			h.publicCustomData = data
+		}
+	}
+}
+
+// bytes serializes the outer header.
+func (h *header) bytes() []byte {
+	buf := new(bytes.Buffer)
+	_ = binary.Write(buf, binary.LittleEndian, []uint32{signature1, signature2, h.version})
+
+	field := func(id byte, data []byte) {
+		buf.WriteByte(id)
+		_ = binary.Write(buf, binary.LittleEndian, uint32(len(data)))
+		buf.Write(data)
+	}
+
+	var compression [4]byte
+	binary.LittleEndian.PutUint32(compression[:], h.compression)
+
+	field(hdrCipherID, h.cipherID)
+	field(hdrCompressionFlags, compression[:])
+	field(hdrMasterSeed, h.masterSeed)
+	field(hdrEncryptionIV, h.encryptionIV)
+	field(hdrKdfParameters, h.kdf.bytes())
+	if h.publicCustomData != nil {
+		field(hdrPublicCustomData, h.publicCustomData)
+	}
+	field(hdrEndOfHeader, []byte("\r\n\r\n"))
+
+	return buf.Bytes()
+}
+
+// readInnerHeader reads the inner header from the start of the decrypted
+// payload.
+func readInnerHeader(r io.Reader) (*innerHeader, error) {
+	ih := &innerHeader{}
+	for {
+		var id byte
+		var size uint32
+		if err := binary.Read(r, binary.LittleEndian, &id); err != nil {
+			return nil, fmt.Errorf("failed to read inner header field: %w", err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+			return nil, fmt.Errorf("failed to read inner header field: %w", err)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("failed to read inner header field: %w", err)
+		}
+
+		switch id {
+		case innerEndOfHeader:
+			return ih, nil
+		case innerStreamID:
+			if len(data) != 4 {
+				return nil, errors.New("malformed inner random stream ID")
+			}
+			ih.streamID = binary.LittleEndian.Uint32(data)
+		case innerStreamKey:
+			ih.streamKey = data
+		case innerBinary:
+			ih.binaries = append(ih.binaries, data)
+		}
+	}
+}
+
+// bytes serializes the inner header.
+func (ih *innerHeader) bytes() []byte {
+	buf := new(bytes.Buffer)
+
+	field := func(id byte, data []byte) {
+		buf.WriteByte(id)
+		_ = binary.Write(buf, binary.LittleEndian, uint32(len(data)))
+		buf.Write(data)
+	}
+
+	var streamID [4]byte
+	binary.LittleEndian.PutUint32(streamID[:], ih.streamID)
+
+	field(innerStreamID, streamID[:])
+	field(innerStreamKey, ih.streamKey)
+	for _, b := range ih.binaries {
+		field(innerBinary, b)
+	}
+	field(innerEndOfHeader, nil)
+
+	return buf.Bytes()
+}
+
+// readVariantDict parses a serialized variant dictionary.
+func readVariantDict(data []byte) (*variantDict, error) {
+	r := bytes.NewReader(data)
+
+	var version uint16
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return nil, fmt.Errorf("failed to read KDF parameters: %w", err)
+	}
+	if version>>8 != vdVersion>>8 {
+		return nil, fmt.Errorf("unsupported KDF parameters version %#04x", version)
+	}
+
+	vd := &variantDict{}
+	for {
+		typ, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read KDF parameters: %w", err)
+		}
+		if typ == vdEnd {
+			return vd, nil
+		}
+
+		var klen int32
+		if err := binary.Read(r, binary.LittleEndian, &klen); err != nil {
+			return nil, fmt.Errorf("failed to read KDF parameters: %w", err)
+		}
+		key := make([]byte, klen)
+		if _, err := io.ReadFull(r, key); err != nil {
+			return nil, fmt.Errorf("failed to read KDF parameters: %w", err)
+		}
+
+		var vlen int32
+		if err := binary.Read(r, binary.LittleEndian, &vlen); err != nil {
+			return nil, fmt.Errorf("failed to read KDF parameters: %w", err)
+		}
+		value := make([]byte, vlen)
+		if _, err := io.ReadFull(r, value); err != nil {
+			return nil, fmt.Errorf("failed to read KDF parameters: %w", err)
+		}
+
+		vd.items = append(vd.items, vdItem{typ, string(key), value})
+	}
+}
+
+// bytes serializes the variant dictionary.
+func (vd *variantDict) bytes() []byte {
+	buf := new(bytes.Buffer)
+	_ = binary.Write(buf, binary.LittleEndian, vdVersion)
+	for _, it := range vd.items {
+		buf.WriteByte(it.typ)
+		_ = binary.Write(buf, binary.LittleEndian, int32(len(it.key)))
+		buf.WriteString(it.key)
+		_ = binary.Write(buf, binary.LittleEndian, int32(len(it.value)))
+		buf.Write(it.value)
+	}
+	buf.WriteByte(vdEnd)
+	return buf.Bytes()
+}
+
+// get returns the raw value stored for the given key.
+func (vd *variantDict) get(key string) ([]byte, bool) {
+	for _, it := range vd.items {
+		if it.key == key {
+			return it.value, true
+		}
+	}
+	return nil, false
+}
+
+// getUint returns the value for the given key if it is an unsigned integer.
+func (vd *variantDict) getUint(key string) (uint64, bool) {
+	v, ok := vd.get(key)
+	switch {
+	case ok && len(v) == 4:
+		return uint64(binary.LittleEndian.Uint32(v)), true
+	case ok && len(v) == 8:
+		return binary.LittleEndian.Uint64(v), true
+	}
+	return 0, false
+}
+
+// set replaces the value for the given key or adds it, if it is not present.
+func (vd *variantDict) set(typ byte, key string, value []byte) {
+	for i := range vd.items {
+		if vd.items[i].key == key {
+			vd.items[i] = vdItem{typ, key, value}
+			return
+		}
+	}
+	vd.items = append(vd.items, vdItem{typ, key, value})
+}
+
+// setUint32 sets a 32-bit unsigned integer value.
+func (vd *variantDict) setUint32(key string, v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	vd.set(vdUInt32, key, b[:])
+}
+
+// setUint64 sets a 64-bit unsigned integer value.
+func (vd *variantDict) setUint64(key string, v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	vd.set(vdUInt64, key, b[:])
+}
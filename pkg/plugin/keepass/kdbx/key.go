@@ -0,0 +1,107 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Key is the composite key used to unlock a database. It is built from a
+// password, a key file, or both.
+type Key struct {
+	composite []byte
+}
+
+// NewKey builds a composite key from the given password and key file
+// contents. Either may be empty, but not both. The key file may be in any of
+// the formats KeePass understands: an XML key file (version 1.0 or 2.0), 32
+// raw bytes, 64 hexadecimal characters, or any other file, which is hashed.
+func NewKey(password string, keyFile []byte) (*Key, error) {
+	if password == "" && keyFile == nil {
+		return nil, errors.New("a password or key file is required to open a KeePass database")
+	}
+
+	h := sha256.New()
+	if password != "" {
+		pw := sha256.Sum256([]byte(password))
+		h.Write(pw[:])
+	}
+	if keyFile != nil {
+		kf, err := keyFileKey(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		h.Write(kf)
+	}
+
+	return &Key{h.Sum(nil)}, nil
+}
+
+// keyFileKey extracts the 32-byte key from the contents of a key file.
+func keyFileKey(data []byte) ([]byte, error) {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("<?xml")) || bytes.HasPrefix(trimmed, []byte("<KeyFile")) {
+		return xmlKeyFileKey(trimmed)
+	}
+
+	if len(data) == 32 {
+		return data, nil
+	}
+
+	if len(data) == 64 {
+		if k, err := hex.DecodeString(string(data)); err == nil {
+			return k, nil
+		}
+	}
+
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+// xmlKeyFileKey extracts the key from an XML key file.
+func xmlKeyFileKey(data []byte) ([]byte, error) {
+	var kf struct {
+		Meta struct {
+			Version string `xml:"Version"`
+		} `xml:"Meta"`
+		Key struct {
+			Data struct {
+				Hash  string `xml:"Hash,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"Data"`
+		} `xml:"Key"`
+	}
+	if err := xml.Unmarshal(data, &kf); err != nil {
+		return nil, fmt.Errorf("failed to parse XML key file: %w", err)
+	}
+
+	value := strings.TrimSpace(kf.Key.Data.Value)
+	switch {
+	case strings.HasPrefix(kf.Meta.Version, "1."):
+		k, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode XML key file data: %w", err)
+		}
+		return k, nil
+
+	case strings.HasPrefix(kf.Meta.Version, "2."):
+		k, err := hex.DecodeString(strings.Join(strings.Fields(value), ""))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode XML key file data: %w", err)
+		}
+		if kf.Key.Data.Hash != "" {
+			sum := sha256.Sum256(k)
+			if !strings.EqualFold(hex.EncodeToString(sum[:4]), kf.Key.Data.Hash) {
+				return nil, errors.New("XML key file data does not match its hash")
+			}
+		}
+		return k, nil
+	}
+
+	return nil, fmt.Errorf("unsupported XML key file version %q", kf.Meta.Version)
+}
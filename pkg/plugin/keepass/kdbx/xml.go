@@ -0,0 +1,235 @@
+package kdbx
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"strings"
+	"time"
+)
+
+// node is a generic XML element. The database document is kept in this form
+// so that everything garotate does not understand is written back untouched.
+type node struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Text    string     `xml:",chardata"`
+	Nodes   []*node    `xml:",any"`
+}
+
+// epochOffset is the number of seconds between 0001-01-01 and the Unix epoch.
+// KDBX 4 timestamps count seconds from the former.
+const epochOffset = 62135596800
+
+// parseDocument parses the XML document and tidies up the whitespace between
+// elements.
+func parseDocument(data []byte) (*node, error) {
+	doc := &node{}
+	if err := xml.Unmarshal(data, doc); err != nil {
+		return nil, err
+	}
+	doc.walk(func(n *node) {
+		if len(n.Nodes) > 0 && strings.TrimSpace(n.Text) == "" {
+			n.Text = ""
+		}
+	})
+	return doc, nil
+}
+
+// marshal serializes the document with an XML declaration.
+func (n *node) marshal() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.WriteString(`<?xml version="1.0" encoding="utf-8" standalone="yes"?>` + "\n")
+
+	enc := xml.NewEncoder(buf)
+	enc.Indent("", "\t")
+	if err := enc.Encode(n); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// walk visits every node in document order.
+func (n *node) walk(f func(*node)) {
+	f(n)
+	for _, c := range n.Nodes {
+		c.walk(f)
+	}
+}
+
+// child returns the first child element with the given name or nil.
+func (n *node) child(name string) *node {
+	for _, c := range n.Nodes {
+		if c.XMLName.Local == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// children returns all the child elements with the given name.
+func (n *node) children(name string) []*node {
+	var out []*node
+	for _, c := range n.Nodes {
+		if c.XMLName.Local == name {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// ensure returns the first child element with the given name, adding it if
+// it does not exist.
+func (n *node) ensure(name string) *node {
+	if c := n.child(name); c != nil {
+		return c
+	}
+	return n.add(name, "")
+}
+
+// add appends a new child element with the given text.
+func (n *node) add(name, text string) *node {
+	c := &node{XMLName: xml.Name{Local: name}, Text: text}
+	n.Nodes = append(n.Nodes, c)
+	return c
+}
+
+// attr returns the value of the named attribute.
+func (n *node) attr(name string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// setAttr sets the value of the named attribute.
+func (n *node) setAttr(name, value string) {
+	for i := range n.Attrs {
+		if n.Attrs[i].Name.Local == name {
+			n.Attrs[i].Value = value
+			return
+		}
+	}
+	n.Attrs = append(n.Attrs, xml.Attr{Name: xml.Name{Local: name}, Value: value})
+}
+
+// clone makes a deep copy of the node.
+func (n *node) clone() *node {
+	c := &node{
+		XMLName: n.XMLName,
+		Attrs:   append([]xml.Attr(nil), n.Attrs...),
+		Text:    n.Text,
+		Nodes:   make([]*node, len(n.Nodes)),
+	}
+	for i, cn := range n.Nodes {
+		c.Nodes[i] = cn.clone()
+	}
+	return c
+}
+
+// isProtected returns true if the node holds a value protected by the inner
+// random stream.
+func (n *node) isProtected() bool {
+	return strings.EqualFold(n.attr("Protected"), "True")
+}
+
+// protectedNodes returns every protected value in document order, which is
+// the order in which the inner random stream is applied.
+func (n *node) protectedNodes() []*node {
+	var out []*node
+	n.walk(func(c *node) {
+		if c.isProtected() {
+			out = append(out, c)
+		}
+	})
+	return out
+}
+
+// unprotect decodes every protected value in place using the inner random
+// stream described by the inner header.
+func (n *node) unprotect(ih *innerHeader) error {
+	nodes := n.protectedNodes()
+
+	raw := make([][]byte, len(nodes))
+	total := 0
+	for i, c := range nodes {
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(c.Text))
+		if err != nil {
+			return err
+		}
+		raw[i] = b
+		total += len(b)
+	}
+
+	ks, err := keystream(ih.streamID, ih.streamKey, total)
+	if err != nil {
+		return err
+	}
+
+	for i, c := range nodes {
+		for j := range raw[i] {
+			raw[i][j] ^= ks[j]
+		}
+		ks = ks[len(raw[i]):]
+		c.Text = string(raw[i])
+	}
+
+	return nil
+}
+
+// protect encodes every protected value in place using the inner random
+// stream. It returns a function that restores the plain values.
+func (n *node) protect(ih *innerHeader) (func(), error) {
+	nodes := n.protectedNodes()
+
+	plain := make([]string, len(nodes))
+	total := 0
+	for i, c := range nodes {
+		plain[i] = c.Text
+		total += len(c.Text)
+	}
+
+	ks, err := keystream(ih.streamID, ih.streamKey, total)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, c := range nodes {
+		b := []byte(plain[i])
+		for j := range b {
+			b[j] ^= ks[j]
+		}
+		ks = ks[len(b):]
+		c.Text = base64.StdEncoding.EncodeToString(b)
+	}
+
+	return func() {
+		for i, c := range nodes {
+			c.Text = plain[i]
+		}
+	}, nil
+}
+
+// parseTime decodes a timestamp. KDBX 4 stores these as base64 encoded
+// seconds since 0001-01-01, but older tools may write ISO 8601 dates.
+func parseTime(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil && len(b) == 8 {
+		secs := int64(binary.LittleEndian.Uint64(b))
+		return time.Unix(secs-epochOffset, 0).UTC(), true
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// formatTime encodes a timestamp in the KDBX 4 format.
+func formatTime(t time.Time) string {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(t.Unix()+epochOffset))
+	return base64.StdEncoding.EncodeToString(b[:])
+}
@@ -0,0 +1,100 @@
+package password
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"text/template"
+	"time"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/plugin/random/password/generator"
+)
+
+// DefaultTimeout is the network timeout used if none is configured.
+const DefaultTimeout = 30 * time.Second
+
+// builder implements the plugin.Builder interface and provides the factory
+// method for constructing a Client.
+type builder struct{}
+
+// options are the plugin options accepted in the configuration.
+type options struct {
+	URL             string        `mapstructure:"url"`
+	BindDN          string        `mapstructure:"bind_dn"`
+	BindPassword    string        `mapstructure:"bind_password"`
+	StartTLS        bool          `mapstructure:"start_tls"`
+	DNTemplate      string        `mapstructure:"dn_template"`
+	ActiveDirectory bool          `mapstructure:"active_directory"`
+	Timeout         time.Duration `mapstructure:"timeout"`
+
+	generator.Policy `mapstructure:",squash"`
+}
+
+// Build constructs and returns an LDAP account client.
+func (b *builder) Build(
+	ctx context.Context,
+	c *config.Plugin,
+) (plugin.Instance, error) {
+	opts := options{
+		Timeout: DefaultTimeout,
+		Policy:  generator.ConnectionSafePolicy(),
+	}
+	err := generator.DecodePolicy(c, &opts, &opts.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read LDAP plugin options: %w", err)
+	}
+
+	if err := opts.Policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid LDAP password policy: %w", err)
+	}
+
+	u, err := url.Parse(opts.URL)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+		return nil, fmt.Errorf("the LDAP plugin requires a url option with an ldap or ldaps scheme, but got %q", opts.URL)
+	}
+
+	if opts.ActiveDirectory && u.Scheme != "ldaps" && !opts.StartTLS {
+		return nil, errors.New("the LDAP plugin requires an ldaps url or start_tls for active_directory, because Active Directory only permits setting passwords over an encrypted connection")
+	}
+
+	if opts.BindDN == "" {
+		return nil, errors.New("the LDAP plugin requires a bind_dn option")
+	}
+
+	if opts.BindPassword == "" {
+		opts.BindPassword = os.Getenv("LDAP_ADMIN_PASSWORD")
+	}
+	if opts.BindPassword == "" {
+		return nil, errors.New("the LDAP plugin requires a bind_password option or LDAP_ADMIN_PASSWORD environment variable")
+	}
+
+	var tmpl *template.Template
+	if opts.DNTemplate != "" {
+		tmpl, err = template.New("dn_template").Parse(opts.DNTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse LDAP dn_template: %w", err)
+		}
+	}
+
+	return &Client{
+		url:             opts.URL,
+		bindDN:          opts.BindDN,
+		bindPassword:    opts.BindPassword,
+		startTLS:        opts.StartTLS,
+		dnTmpl:          tmpl,
+		activeDirectory: opts.ActiveDirectory,
+		timeout:         opts.Timeout,
+		policy:          opts.Policy,
+	}, nil
+}
+
+// init registers the plugin.
+func init() {
+	pkg := reflect.TypeOf(Client{}).PkgPath()
+	plugin.Register(pkg, new(builder))
+}
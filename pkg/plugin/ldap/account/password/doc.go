@@ -0,0 +1,5 @@
+// Package password provides a plugin which implements the rotate.Client and is
+// used to rotate the passwords of LDAP accounts, such as service accounts kept
+// in OpenLDAP or Active Directory. Each rotation binds as an administrator and
+// sets a new password on the account.
+package password
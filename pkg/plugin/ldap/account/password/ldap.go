@@ -0,0 +1,239 @@
+package password
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf16"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin/random/password/generator"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+const (
+	// DNKey is the key the DN of the account is returned under.
+	DNKey = "LDAP_BIND_DN"
+
+	// PasswordKey is the key the new password is returned under.
+	PasswordKey = "LDAP_BIND_PASSWORD"
+)
+
+// fileTimeEpoch is the number of 100 nanosecond intervals between the Windows
+// FILETIME epoch of January 1, 1601 and the Unix epoch.
+const fileTimeEpoch = 116444736000000000
+
+// Client implements the rotate.Client interface for rotating the passwords of
+// LDAP accounts. The secret name is the DN of the account or, if a DN template
+// is configured, the value substituted into the template to make the DN.
+//
+// On OpenLDAP and other servers following RFC 3062, the password is set with
+// the password modify extended operation, so the server hashes it according to
+// its own policy. On Active Directory, the unicodePwd attribute is replaced
+// instead.
+type Client struct {
+	url             string
+	bindDN          string
+	bindPassword    string
+	startTLS        bool
+	dnTmpl          *template.Template
+	activeDirectory bool
+	timeout         time.Duration
+	policy          generator.Policy
+}
+
+// dnData is the data the DN template is executed with.
+type dnData struct {
+	Name string
+}
+
+// Name returns "LDAP accounts".
+func (c *Client) Name() string {
+	return "LDAP accounts"
+}
+
+// Keys returns the LDAP_BIND_DN and LDAP_BIND_PASSWORD keys.
+func (c *Client) Keys() secret.Map {
+	return secret.Map{
+		DNKey:       "",
+		PasswordKey: "",
+	}
+}
+
+// dn returns the DN of the account named by the secret.
+func (c *Client) dn(sec secret.Info) (string, error) {
+	if c.dnTmpl == nil {
+		return sec.Name(), nil
+	}
+
+	var buf strings.Builder
+	err := c.dnTmpl.Execute(&buf, dnData{Name: ldap.EscapeDN(sec.Name())})
+	if err != nil {
+		return "", fmt.Errorf("failed to execute LDAP dn_template for secret %q: %w", sec.Name(), err)
+	}
+
+	return buf.String(), nil
+}
+
+// connect dials the server and binds as the administrator.
+func (c *Client) connect() (*ldap.Conn, error) {
+	l, err := ldap.DialURL(c.url, ldap.DialWithDialer(&net.Dialer{Timeout: c.timeout}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to LDAP server: %w", err)
+	}
+	l.SetTimeout(c.timeout)
+
+	if c.startTLS {
+		u, _ := url.Parse(c.url)
+		err := l.StartTLS(&tls.Config{ServerName: u.Hostname()})
+		if err != nil {
+			_ = l.Close()
+			return nil, fmt.Errorf("failed to start TLS with LDAP server: %w", err)
+		}
+	}
+
+	err = l.Bind(c.bindDN, c.bindPassword)
+	if err != nil {
+		_ = l.Close()
+		return nil, fmt.Errorf("failed to bind to LDAP server as %q: %w", c.bindDN, err)
+	}
+
+	return l, nil
+}
+
+// parseFileTime parses the Windows FILETIME used by Active Directory. Zero
+// means the password must be changed at the next logon and is returned as the
+// zero time.
+func parseFileTime(s string) (time.Time, error) {
+	ft, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if ft <= 0 {
+		return time.Time{}, nil
+	}
+
+	return time.Unix(0, (ft-fileTimeEpoch)*100).UTC(), nil
+}
+
+// LastRotated returns the time the password of the account was last changed,
+// taken from the pwdChangedTime attribute kept by the OpenLDAP password policy
+// overlay or the pwdLastSet attribute of Active Directory. If neither is set,
+// the directory does not record password changes and an error is returned.
+func (c *Client) LastRotated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	dn, err := c.dn(sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	l, err := c.connect()
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer l.Close()
+
+	res, err := l.Search(ldap.NewSearchRequest(
+		dn, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, 0, false,
+		"(objectClass=*)",
+		[]string{"pwdChangedTime", "pwdLastSet"},
+		nil,
+	))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to look up LDAP account %q: %w", dn, err)
+	}
+
+	if len(res.Entries) == 0 {
+		return time.Time{}, fmt.Errorf("LDAP account %q does not exist", dn)
+	}
+
+	entry := res.Entries[0]
+	if v := entry.GetAttributeValue("pwdChangedTime"); v != "" {
+		t, err := ber.ParseGeneralizedTime([]byte(v))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to parse pwdChangedTime %q of LDAP account %q: %w", v, dn, err)
+		}
+		return t, nil
+	}
+
+	if v := entry.GetAttributeValue("pwdLastSet"); v != "" {
+		t, err := parseFileTime(v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to parse pwdLastSet %q of LDAP account %q: %w", v, dn, err)
+		}
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("LDAP account %q has neither pwdChangedTime nor pwdLastSet; OpenLDAP requires the ppolicy overlay to record password changes", dn)
+}
+
+// unicodePwd encodes a password as Active Directory requires for the
+// unicodePwd attribute: quoted and in UTF-16 little-endian.
+func unicodePwd(password string) string {
+	units := utf16.Encode([]rune(`"` + password + `"`))
+	buf := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(buf[2*i:], u)
+	}
+	return string(buf)
+}
+
+// RotateSecret sets a new password on the account. The old password stops
+// working immediately.
+func (c *Client) RotateSecret(
+	ctx context.Context,
+	sec secret.Info,
+) (secret.Map, error) {
+	dn, err := c.dn(sec)
+	if err != nil {
+		return secret.Map{}, err
+	}
+
+	password, _, err := c.policy.NewValue()
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to generate password for LDAP account %q: %w", dn, err)
+	}
+
+	l, err := c.connect()
+	if err != nil {
+		return secret.Map{}, err
+	}
+	defer l.Close()
+
+	if c.activeDirectory {
+		req := ldap.NewModifyRequest(dn, nil)
+		req.Replace("unicodePwd", []string{unicodePwd(password)})
+		err = l.Modify(req)
+	} else {
+		_, err = l.PasswordModify(ldap.NewPasswordModifyRequest(dn, "", password))
+	}
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to set password of LDAP account %q: %w", dn, err)
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Infow(
+		"set LDAP account password",
+		"secret", sec.Name(),
+		"client", c.Name(),
+		"dn", dn,
+	)
+
+	return secret.Map{
+		DNKey:       dn,
+		PasswordKey: password,
+	}, nil
+}
@@ -0,0 +1,339 @@
+package password
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+)
+
+const (
+	testAdminDN       = "cn=admin,dc=example,dc=com"
+	testAdminPassword = "admin-password"
+)
+
+// fakeDirectory is an in-process LDAP server supporting just enough of the
+// protocol to bind, read a single entry, and change passwords the way
+// OpenLDAP and Active Directory do.
+type fakeDirectory struct {
+	mu        sync.Mutex
+	entries   map[string]map[string]string
+	passwords map[string]string
+}
+
+// serve accepts connections until the listener is closed.
+func (f *fakeDirectory) serve(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+// result builds an LDAPResult style response.
+func result(id int64, tag ber.Tag, code int64) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return message(id, op)
+}
+
+// message wraps a protocol operation in an LDAPMessage.
+func message(id int64, op *ber.Packet) *ber.Packet {
+	msg := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+	msg.AppendChild(op)
+	return msg
+}
+
+// setPassword records a new password for the entry along with the attribute
+// the kind of server given records the time of the change in.
+func (f *fakeDirectory) setPassword(dn, password string, ad bool) int64 {
+	entry, ok := f.entries[dn]
+	if !ok {
+		return ldap.LDAPResultNoSuchObject
+	}
+
+	f.passwords[dn] = password
+	if ad {
+		ft := time.Now().UnixNano()/100 + fileTimeEpoch
+		entry["pwdLastSet"] = strconv.FormatInt(ft, 10)
+	} else {
+		entry["pwdChangedTime"] = time.Now().UTC().Format("20060102150405Z")
+	}
+
+	return ldap.LDAPResultSuccess
+}
+
+// handle answers the requests of one connection.
+func (f *fakeDirectory) handle(conn net.Conn) {
+	defer conn.Close()
+
+	var bound string
+	for {
+		req, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+
+		id := req.Children[0].Value.(int64)
+		op := req.Children[1]
+
+		f.mu.Lock()
+		var res []*ber.Packet
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			code := int64(ldap.LDAPResultInvalidCredentials)
+			if p, ok := f.passwords[dn]; ok && p == password {
+				bound, code = dn, ldap.LDAPResultSuccess
+			}
+			res = append(res, result(id, ldap.ApplicationBindResponse, code))
+
+		case ldap.ApplicationUnbindRequest:
+			f.mu.Unlock()
+			return
+
+		case ldap.ApplicationSearchRequest:
+			dn := op.Children[0].Value.(string)
+			entry, ok := f.entries[dn]
+			if !ok {
+				res = append(res, result(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultNoSuchObject))
+				break
+			}
+
+			e := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+			e.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, ""))
+			attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+			for _, a := range op.Children[7].Children {
+				name := a.Value.(string)
+				v, ok := entry[name]
+				if !ok {
+					continue
+				}
+				attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+				attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+				vals := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+				vals.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, ""))
+				attr.AppendChild(vals)
+				attrs.AppendChild(attr)
+			}
+			e.AppendChild(attrs)
+			res = append(res, message(id, e), result(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+
+		case ldap.ApplicationModifyRequest:
+			dn := op.Children[0].Value.(string)
+			code := int64(ldap.LDAPResultInsufficientAccessRights)
+			if bound == testAdminDN {
+				code = ldap.LDAPResultUnwillingToPerform
+				mod := op.Children[1].Children[0].Children[1]
+				if mod.Children[0].Value.(string) == "unicodePwd" {
+					raw := mod.Children[1].Children[0].Data.Bytes()
+					units := make([]uint16, len(raw)/2)
+					for i := range units {
+						units[i] = binary.LittleEndian.Uint16(raw[2*i:])
+					}
+					quoted := string(utf16.Decode(units))
+					code = f.setPassword(dn, quoted[1:len(quoted)-1], true)
+				}
+			}
+			res = append(res, result(id, ldap.ApplicationModifyResponse, code))
+
+		case ldap.ApplicationExtendedRequest:
+			code := int64(ldap.LDAPResultInsufficientAccessRights)
+			if bound == testAdminDN {
+				value, _ := ber.DecodePacketErr(op.Children[1].Data.Bytes())
+				var dn, password string
+				for _, c := range value.Children {
+					switch c.Tag {
+					case 0:
+						dn = c.Data.String()
+					case 2:
+						password = c.Data.String()
+					}
+				}
+				code = f.setPassword(dn, password, false)
+			}
+			res = append(res, result(id, ldap.ApplicationExtendedResponse, code))
+
+		default:
+			res = append(res, result(id, op.Tag+1, ldap.LDAPResultUnwillingToPerform))
+		}
+		f.mu.Unlock()
+
+		for _, p := range res {
+			if _, err := conn.Write(p.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// startDirectory starts a fake directory with an administrator, one service
+// account whose password has not been changed since it was created, and one
+// service account on a server that does not record password changes. It
+// returns the URL of the directory.
+func startDirectory(t *testing.T, ad bool) string {
+	t.Helper()
+
+	app := map[string]string{"pwdChangedTime": "20200101000000Z"}
+	if ad {
+		app = map[string]string{"pwdLastSet": "0"}
+	}
+
+	f := &fakeDirectory{
+		entries: map[string]map[string]string{
+			testAdminDN:                                  {},
+			"uid=app,ou=services,dc=example,dc=com":      app,
+			"uid=nopolicy,ou=services,dc=example,dc=com": {},
+		},
+		passwords: map[string]string{
+			testAdminDN:                                  testAdminPassword,
+			"uid=app,ou=services,dc=example,dc=com":      "initial-password",
+			"uid=nopolicy,ou=services,dc=example,dc=com": "initial-password",
+		},
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+	go f.serve(ln)
+
+	return "ldap://" + ln.Addr().String()
+}
+
+// bind reports whether the DN can bind with the password.
+func bind(t *testing.T, url, dn, password string) error {
+	t.Helper()
+
+	l, err := ldap.DialURL(url)
+	require.NoError(t, err)
+	defer l.Close()
+
+	return l.Bind(dn, password)
+}
+
+func TestRotateAccount(t *testing.T) {
+	for _, ad := range []bool{false, true} {
+		ctx := context.Background()
+		url := startDirectory(t, ad)
+
+		inst, err := plugin.Build(ctx, &config.Plugin{
+			Name:    "ldap",
+			Package: "github.com/zostay/garotate/pkg/plugin/ldap/account/password",
+			Options: map[string]any{
+				"url":           url,
+				"bind_dn":       testAdminDN,
+				"bind_password": testAdminPassword,
+				"dn_template":   "uid={{.Name}},ou=services,dc=example,dc=com",
+			},
+		})
+		require.NoError(t, err)
+		c := inst.(*Client)
+
+		// the fake directory does not do TLS, so switch modes after building
+		c.activeDirectory = ad
+
+		sec := &config.Secret{SecretName: "app"}
+
+		last, err := c.LastRotated(ctx, sec)
+		require.NoError(t, err, "ad=%t", ad)
+		if ad {
+			assert.True(t, last.IsZero(), "ad=%t must change at next logon", ad)
+		} else {
+			assert.Equal(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), last, "ad=%t set at creation", ad)
+		}
+
+		keys, err := c.RotateSecret(ctx, sec)
+		require.NoError(t, err, "ad=%t", ad)
+		assert.Equal(t, "uid=app,ou=services,dc=example,dc=com", keys[DNKey])
+		assert.Len(t, keys[PasswordKey], 32)
+
+		assert.NoError(t, bind(t, url, keys[DNKey], keys[PasswordKey]), "ad=%t new password works", ad)
+		assert.Error(t, bind(t, url, keys[DNKey], "initial-password"), "ad=%t old password does not", ad)
+
+		last, err = c.LastRotated(ctx, sec)
+		require.NoError(t, err, "ad=%t", ad)
+		assert.WithinDuration(t, time.Now(), last, time.Minute, "ad=%t just rotated", ad)
+
+		_, err = c.RotateSecret(ctx, &config.Secret{SecretName: "missing"})
+		assert.Error(t, err, "ad=%t missing account", ad)
+	}
+}
+
+func TestLastRotatedWithoutPolicy(t *testing.T) {
+	ctx := context.Background()
+	url := startDirectory(t, false)
+
+	inst, err := plugin.Build(ctx, &config.Plugin{
+		Name:    "ldap",
+		Package: "github.com/zostay/garotate/pkg/plugin/ldap/account/password",
+		Options: map[string]any{
+			"url":           url,
+			"bind_dn":       testAdminDN,
+			"bind_password": testAdminPassword,
+			"dn_template":   "uid={{.Name}},ou=services,dc=example,dc=com",
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = inst.(*Client).LastRotated(ctx, &config.Secret{SecretName: "nopolicy"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ppolicy overlay")
+}
+
+func TestDN(t *testing.T) {
+	c := &Client{}
+	dn, err := c.dn(&config.Secret{SecretName: "cn=app,dc=example,dc=com"})
+	require.NoError(t, err)
+	assert.Equal(t, "cn=app,dc=example,dc=com", dn, "no template")
+
+	inst, err := (&builder{}).Build(context.Background(), &config.Plugin{
+		Options: map[string]any{
+			"url":           "ldap://localhost",
+			"bind_dn":       testAdminDN,
+			"bind_password": testAdminPassword,
+			"dn_template":   "cn={{.Name}},dc=example,dc=com",
+		},
+	})
+	require.NoError(t, err)
+	dn, err = inst.(*Client).dn(&config.Secret{SecretName: "Smith, J"})
+	require.NoError(t, err)
+	assert.Equal(t, `cn=Smith\, J,dc=example,dc=com`, dn, "escaped")
+
+	_, err = (&builder{}).Build(context.Background(), &config.Plugin{
+		Options: map[string]any{
+			"url":              "ldap://localhost",
+			"bind_dn":          testAdminDN,
+			"bind_password":    testAdminPassword,
+			"active_directory": true,
+		},
+	})
+	assert.Error(t, err, "active directory requires TLS")
+}
+
+func TestParseFileTime(t *testing.T) {
+	tm, err := parseFileTime("133170048000000000")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), tm)
+
+	tm, err = parseFileTime("0")
+	require.NoError(t, err)
+	assert.True(t, tm.IsZero(), "must change at next logon")
+}
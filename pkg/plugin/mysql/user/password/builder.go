@@ -0,0 +1,88 @@
+package password
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/plugin/random/password/generator"
+)
+
+// builder implements the plugin.Builder interface and provides the factory
+// method for constructing a Client.
+type builder struct{}
+
+// options are the plugin options accepted in the configuration.
+type options struct {
+	DSN                   string `mapstructure:"dsn"`
+	RetainCurrentPassword bool   `mapstructure:"retain_current_password"`
+
+	generator.Policy `mapstructure:",squash"`
+}
+
+// Build constructs and returns a MySQL user client.
+func (b *builder) Build(
+	ctx context.Context,
+	c *config.Plugin,
+) (plugin.Instance, error) {
+	opts := options{
+		RetainCurrentPassword: true,
+		Policy:                generator.ConnectionSafePolicy(),
+	}
+	err := generator.DecodePolicy(c, &opts, &opts.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MySQL plugin options: %w", err)
+	}
+
+	if err := opts.Policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid MySQL password policy: %w", err)
+	}
+
+	if opts.DSN == "" {
+		opts.DSN = os.Getenv("MYSQL_ADMIN_DSN")
+	}
+	if opts.DSN == "" {
+		return nil, errors.New("the MySQL plugin requires a dsn option or MYSQL_ADMIN_DSN environment variable")
+	}
+
+	dsn, err := mysql.ParseDSN(opts.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse MySQL dsn: %w", err)
+	}
+
+	// Passwords are interpolated by the driver, which escapes them correctly
+	// for the server's SQL mode, because ALTER USER cannot be prepared.
+	// Timestamps are read in UTC.
+	dsn.InterpolateParams = true
+	dsn.ParseTime = true
+	dsn.Loc = time.UTC
+	if dsn.Params == nil {
+		dsn.Params = make(map[string]string)
+	}
+	dsn.Params["time_zone"] = "'+00:00'"
+
+	connector, err := mysql.NewConnector(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure MySQL connection: %w", err)
+	}
+
+	return &Client{
+		db:     sql.OpenDB(connector),
+		retain: opts.RetainCurrentPassword,
+		policy: opts.Policy,
+	}, nil
+}
+
+// init registers the plugin.
+func init() {
+	pkg := reflect.TypeOf(Client{}).PkgPath()
+	plugin.Register(pkg, new(builder))
+}
@@ -0,0 +1,6 @@
+// Package password provides a plugin which implements both the rotate.Client
+// and the disable.Client and is used to rotate the passwords of MySQL users.
+// On MySQL 8.0.14 and later, the current password is retained as a secondary
+// password during rotation, so consumers keep working until they pick up the
+// new password. Disablement discards the retained password.
+package password
@@ -0,0 +1,278 @@
+package password
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin/random/password/generator"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+const (
+	// UserKey is the key the user name is returned under.
+	UserKey = "MYSQL_USER"
+
+	// PasswordKey is the key the new password is returned under.
+	PasswordKey = "MYSQL_PASSWORD"
+)
+
+// Client implements the rotate.Client and disable.Client interfaces for
+// rotating the passwords of MySQL users. It also implements rotate.Revoker, so
+// users may be used with the alternating strategy, which revokes idle users by
+// locking them.
+//
+// The secret name is the account name in user@host form. If no host is given,
+// "%" is assumed.
+type Client struct {
+	db     *sql.DB
+	retain bool
+	policy generator.Policy
+
+	mu      sync.Mutex
+	mariadb *bool
+}
+
+// account is a MySQL account name.
+type account struct {
+	user string
+	host string
+}
+
+// parseAccount splits the secret name into the user and host.
+func parseAccount(sec secret.Info) account {
+	name := sec.Name()
+	if i := strings.LastIndex(name, "@"); i >= 0 {
+		return account{name[:i], name[i+1:]}
+	}
+	return account{name, "%"}
+}
+
+// String returns the account name in user@host form.
+func (a account) String() string {
+	return a.user + "@" + a.host
+}
+
+// userRow is the password state of an account read from mysql.user.
+type userRow struct {
+	lastChanged sql.NullTime
+	retained    bool
+	locked      bool
+}
+
+// Name returns "MySQL user passwords".
+func (c *Client) Name() string {
+	return "MySQL user passwords"
+}
+
+// Keys returns the MYSQL_USER and MYSQL_PASSWORD keys.
+func (c *Client) Keys() secret.Map {
+	return secret.Map{
+		UserKey:     "",
+		PasswordKey: "",
+	}
+}
+
+// Close closes the connections to the server.
+func (c *Client) Close() error {
+	return c.db.Close()
+}
+
+// isMariaDB reports whether the server is MariaDB, which records password
+// changes differently and does not support dual passwords. The answer is
+// remembered after the first successful check.
+func (c *Client) isMariaDB(ctx context.Context) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.mariadb != nil {
+		return *c.mariadb, nil
+	}
+
+	var version string
+	err := c.db.QueryRowContext(ctx, `SELECT VERSION()`).Scan(&version)
+	if err != nil {
+		return false, fmt.Errorf("failed to determine MySQL server version: %w", err)
+	}
+
+	isMariaDB := strings.Contains(version, "MariaDB")
+	c.mariadb = &isMariaDB
+	return isMariaDB, nil
+}
+
+// getUser reads the password state of the account. Whether a secondary
+// password is retained is only checked when retaining is configured, as
+// servers without dual password support lack the column that records it.
+func (c *Client) getUser(ctx context.Context, acct account) (*userRow, error) {
+	isMariaDB, err := c.isMariaDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT password_last_changed, FALSE, account_locked = 'Y' FROM mysql.user WHERE User = ? AND Host = ?`
+	switch {
+	case isMariaDB:
+		query = `SELECT FROM_UNIXTIME(JSON_VALUE(Priv, '$.password_last_changed')), FALSE, COALESCE(JSON_VALUE(Priv, '$.account_locked') = 'true', FALSE) FROM mysql.global_priv WHERE User = ? AND Host = ?`
+	case c.retain:
+		query = `SELECT password_last_changed, COALESCE(JSON_CONTAINS_PATH(User_attributes, 'one', '$.additional_password'), FALSE), account_locked = 'Y' FROM mysql.user WHERE User = ? AND Host = ?`
+	}
+
+	var row userRow
+	err = c.db.QueryRowContext(ctx, query, acct.user, acct.host).
+		Scan(&row.lastChanged, &row.retained, &row.locked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("MySQL account %q does not exist", acct)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to look up MySQL account %q: %w", acct, err)
+	}
+
+	return &row, nil
+}
+
+// LastRotated returns the time the password of the account was last changed.
+func (c *Client) LastRotated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	row, err := c.getUser(ctx, parseAccount(sec))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return row.lastChanged.Time, nil
+}
+
+// RotateSecret sets a new password for the account. When configured to retain
+// the current password, the old password continues to work until disabled.
+func (c *Client) RotateSecret(
+	ctx context.Context,
+	sec secret.Info,
+) (secret.Map, error) {
+	acct := parseAccount(sec)
+
+	if c.retain {
+		isMariaDB, err := c.isMariaDB(ctx)
+		if err != nil {
+			return secret.Map{}, err
+		}
+		if isMariaDB {
+			return secret.Map{}, errors.New("MariaDB does not support retaining the current password; set retain_current_password to false")
+		}
+	}
+
+	password, _, err := c.policy.NewValue()
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to generate password for MySQL account %q: %w", acct, err)
+	}
+
+	alter := `ALTER USER ?@? IDENTIFIED BY ?`
+	if c.retain {
+		alter += ` RETAIN CURRENT PASSWORD`
+	}
+
+	_, err = c.db.ExecContext(ctx, alter, acct.user, acct.host, password)
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to change password of MySQL account %q: %w", acct, err)
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Infow(
+		"rotated MySQL account password",
+		"secret", sec.Name(),
+		"client", c.Name(),
+		"retained", c.retain,
+	)
+
+	return secret.Map{
+		UserKey:     acct.user,
+		PasswordKey: password,
+	}, nil
+}
+
+// LastUpdated returns the time the retained password became inactive, which
+// is when the current password was set. If no password is retained, there is
+// nothing to disable.
+func (c *Client) LastUpdated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	row, err := c.getUser(ctx, parseAccount(sec))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if !row.retained {
+		return time.Time{}, disable.ErrNothingToDisable
+	}
+
+	return row.lastChanged.Time, nil
+}
+
+// DisableSecret discards the retained password of the account.
+func (c *Client) DisableSecret(
+	ctx context.Context,
+	sec secret.Info,
+) error {
+	acct := parseAccount(sec)
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Infow(
+		"discarding old MySQL account password",
+		"secret", sec.Name(),
+		"client", c.Name(),
+	)
+
+	_, err := c.db.ExecContext(ctx, `ALTER USER ?@? DISCARD OLD PASSWORD`, acct.user, acct.host)
+	if err != nil {
+		return fmt.Errorf("failed to discard old password of MySQL account %q: %w", acct, err)
+	}
+
+	return nil
+}
+
+// Revoked returns true if the account is locked.
+func (c *Client) Revoked(
+	ctx context.Context,
+	sec secret.Info,
+) (bool, error) {
+	row, err := c.getUser(ctx, parseAccount(sec))
+	if err != nil {
+		return false, err
+	}
+
+	return row.locked, nil
+}
+
+// RevokeSecret locks the account.
+func (c *Client) RevokeSecret(
+	ctx context.Context,
+	sec secret.Info,
+) error {
+	acct := parseAccount(sec)
+	_, err := c.db.ExecContext(ctx, `ALTER USER ?@? ACCOUNT LOCK`, acct.user, acct.host)
+	if err != nil {
+		return fmt.Errorf("failed to lock MySQL account %q: %w", acct, err)
+	}
+
+	return nil
+}
+
+// RestoreSecret unlocks the account.
+func (c *Client) RestoreSecret(
+	ctx context.Context,
+	sec secret.Info,
+) error {
+	acct := parseAccount(sec)
+	_, err := c.db.ExecContext(ctx, `ALTER USER ?@? ACCOUNT UNLOCK`, acct.user, acct.host)
+	if err != nil {
+		return fmt.Errorf("failed to unlock MySQL account %q: %w", acct, err)
+	}
+
+	return nil
+}
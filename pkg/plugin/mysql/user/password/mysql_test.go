@@ -0,0 +1,124 @@
+package password
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin"
+)
+
+// testDSNEnv names the environment variable holding the DSN of an
+// administrator connection to a MySQL 8.0.14 or later server to test against,
+// such as a disposable container:
+//
+//	docker run --rm -e MYSQL_ROOT_PASSWORD=secret -p 3306:3306 mysql:8
+//	GAROTATE_TEST_MYSQL_DSN='root:secret@tcp(localhost:3306)/' go test ./...
+const testDSNEnv = "GAROTATE_TEST_MYSQL_DSN"
+
+// login connects as the given user and reports whether it succeeded.
+func login(t *testing.T, dsn, user, password string) error {
+	t.Helper()
+
+	cfg, err := mysql.ParseDSN(dsn)
+	require.NoError(t, err)
+	cfg.User = user
+	cfg.Passwd = password
+
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	require.NoError(t, err)
+	defer db.Close()
+
+	return db.Ping()
+}
+
+func TestRotateUser(t *testing.T) {
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("set %s to test against a MySQL server", testDSNEnv)
+	}
+
+	ctx := context.Background()
+	user := fmt.Sprintf("garotate_%d", time.Now().UnixNano()%1e9)
+	oldPassword := "Initial-Password-1"
+
+	admin, err := sql.Open("mysql", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = admin.Exec(`DROP USER IF EXISTS '` + user + `'@'%'`)
+		_ = admin.Close()
+	})
+
+	_, err = admin.Exec(`CREATE USER '` + user + `'@'%' IDENTIFIED BY '` + oldPassword + `'`)
+	require.NoError(t, err)
+
+	inst, err := plugin.Build(ctx, &config.Plugin{
+		Name:    "mysql",
+		Package: "github.com/zostay/garotate/pkg/plugin/mysql/user/password",
+		Options: map[string]any{
+			"dsn": dsn,
+		},
+	})
+	require.NoError(t, err)
+
+	c := inst.(*Client)
+	t.Cleanup(func() { _ = c.Close() })
+
+	sec := &config.Secret{SecretName: user + "@%"}
+
+	last, err := c.LastRotated(ctx, sec)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), last, time.Minute, "password set on creation")
+
+	_, err = c.LastUpdated(ctx, sec)
+	assert.ErrorIs(t, err, disable.ErrNothingToDisable, "nothing to disable yet")
+
+	keys, err := c.RotateSecret(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, user, keys[UserKey])
+	assert.Len(t, keys[PasswordKey], 32)
+
+	assert.NoError(t, login(t, dsn, user, keys[PasswordKey]), "new password works")
+	assert.NoError(t, login(t, dsn, user, oldPassword), "old password is retained")
+
+	upd, err := c.LastUpdated(ctx, sec)
+	require.NoError(t, err)
+	last, err = c.LastRotated(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, last, upd, "old password inactive since rotation")
+
+	require.NoError(t, c.DisableSecret(ctx, sec))
+
+	assert.NoError(t, login(t, dsn, user, keys[PasswordKey]), "new password still works")
+	assert.Error(t, login(t, dsn, user, oldPassword), "old password is discarded")
+
+	require.NoError(t, c.RevokeSecret(ctx, sec))
+	revoked, err := c.Revoked(ctx, sec)
+	require.NoError(t, err)
+	assert.True(t, revoked, "account is locked")
+	assert.Error(t, login(t, dsn, user, keys[PasswordKey]), "locked account cannot log in")
+
+	require.NoError(t, c.RestoreSecret(ctx, sec))
+	revoked, err = c.Revoked(ctx, sec)
+	require.NoError(t, err)
+	assert.False(t, revoked, "account is unlocked")
+	assert.NoError(t, login(t, dsn, user, keys[PasswordKey]), "unlocked account can log in")
+
+	_, err = c.LastRotated(ctx, &config.Secret{SecretName: user + "_missing"})
+	assert.Error(t, err, "missing user is an error")
+}
+
+func TestParseAccount(t *testing.T) {
+	assert.Equal(t, account{"app", "%"}, parseAccount(&config.Secret{SecretName: "app"}))
+	assert.Equal(t, account{"app", "10.0.%"}, parseAccount(&config.Secret{SecretName: "app@10.0.%"}))
+	assert.Equal(t, account{"me@example.com", "localhost"}, parseAccount(&config.Secret{SecretName: "me@example.com@localhost"}))
+}
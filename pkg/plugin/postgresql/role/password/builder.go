@@ -0,0 +1,101 @@
+package password
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/plugin/random/password/generator"
+)
+
+// DefaultTrackingTable is the table used to record rotation times if none is
+// configured.
+const DefaultTrackingTable = "garotate_rotations"
+
+// builder implements the plugin.Builder interface and provides the factory
+// method for constructing a Client.
+type builder struct{}
+
+// options are the plugin options accepted in the configuration.
+type options struct {
+	DSN           string        `mapstructure:"dsn"`
+	TrackingTable string        `mapstructure:"tracking_table"`
+	ValidFor      time.Duration `mapstructure:"valid_for"`
+
+	generator.Policy `mapstructure:",squash"`
+}
+
+// Build constructs and returns a PostgreSQL role client.
+func (b *builder) Build(
+	ctx context.Context,
+	c *config.Plugin,
+) (plugin.Instance, error) {
+	opts := options{
+		TrackingTable: DefaultTrackingTable,
+		Policy:        generator.ConnectionSafePolicy(),
+	}
+	err := generator.DecodePolicy(c, &opts, &opts.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PostgreSQL plugin options: %w", err)
+	}
+
+	if err := opts.Policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid PostgreSQL password policy: %w", err)
+	}
+
+	if opts.DSN == "" {
+		opts.DSN = os.Getenv("POSTGRES_ADMIN_DSN")
+	}
+	if opts.DSN == "" {
+		return nil, errors.New("the PostgreSQL plugin requires a dsn option or POSTGRES_ADMIN_DSN environment variable")
+	}
+
+	table, err := quoteTable(opts.TrackingTable)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("postgres", opts.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure PostgreSQL connection: %w", err)
+	}
+
+	return &Client{
+		db:       db,
+		table:    table,
+		validFor: opts.ValidFor,
+		policy:   opts.Policy,
+	}, nil
+}
+
+// quoteTable quotes the name of the tracking table, which may be qualified by
+// a schema name.
+func quoteTable(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("the PostgreSQL plugin tracking_table option must not be empty")
+	}
+
+	parts := strings.Split(name, ".")
+	if len(parts) > 2 {
+		return "", fmt.Errorf("the PostgreSQL plugin tracking_table %q has too many parts", name)
+	}
+	for i, p := range parts {
+		parts[i] = pq.QuoteIdentifier(p)
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// init registers the plugin.
+func init() {
+	pkg := reflect.TypeOf(Client{}).PkgPath()
+	plugin.Register(pkg, new(builder))
+}
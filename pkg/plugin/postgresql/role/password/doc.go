@@ -0,0 +1,5 @@
+// Package password provides a plugin which implements the rotate.Client and is
+// used to rotate the passwords of PostgreSQL roles. Passwords are sent to the
+// server as SCRAM-SHA-256 verifiers, so the plain password never appears in
+// server logs or statistics.
+package password
@@ -0,0 +1,232 @@
+package password
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin/random/password/generator"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+const (
+	// UserKey is the key the role name is returned under.
+	UserKey = "PGUSER"
+
+	// PasswordKey is the key the new password is returned under.
+	PasswordKey = "PGPASSWORD"
+)
+
+// Client implements the rotate.Client interface for rotating the passwords of
+// PostgreSQL roles. The secret name is the role name.
+//
+// PostgreSQL does not record when a password was changed, so the time of each
+// rotation is kept in a tracking table, which is created by the first rotation
+// if it does not exist.
+// If valid_for is configured, each new password is also set to expire after
+// that long, and the expiration is used to work out the last rotation of roles
+// that have no row in the tracking table.
+//
+// Client also implements rotate.Revoker, so roles may be used with the
+// alternating strategy, which revokes idle roles by disabling their login.
+type Client struct {
+	db       *sql.DB
+	table    string
+	validFor time.Duration
+	policy   generator.Policy
+
+	tableReady bool
+}
+
+// Name returns "PostgreSQL role passwords".
+func (c *Client) Name() string {
+	return "PostgreSQL role passwords"
+}
+
+// Keys returns the PGUSER and PGPASSWORD keys.
+func (c *Client) Keys() secret.Map {
+	return secret.Map{
+		UserKey:     "",
+		PasswordKey: "",
+	}
+}
+
+// Close closes the connections to the server.
+func (c *Client) Close() error {
+	return c.db.Close()
+}
+
+// ensureTable creates the tracking table if it does not already exist.
+func (c *Client) ensureTable(ctx context.Context) error {
+	if c.tableReady {
+		return nil
+	}
+
+	_, err := c.db.ExecContext(ctx,
+		`CREATE TABLE IF NOT EXISTS `+c.table+` (
+			role_name text PRIMARY KEY,
+			rotated_at timestamptz NOT NULL
+		)`)
+	if err != nil {
+		return fmt.Errorf("failed to create rotation tracking table %s: %w", c.table, err)
+	}
+
+	c.tableReady = true
+	return nil
+}
+
+// isUndefinedTable returns true if the error reports that a table does not
+// exist, as the tracking table does not until the first rotation.
+func isUndefinedTable(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "42P01"
+}
+
+// LastRotated returns the time the role password was last rotated according
+// to the tracking table. If the role has never been rotated by garotate, but
+// has an expiration set and valid_for is configured, the rotation time is
+// worked out from the expiration. Otherwise, the zero time is returned.
+func (c *Client) LastRotated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	var validUntil sql.NullTime
+	err := c.db.QueryRowContext(ctx,
+		`SELECT rolvaliduntil FROM pg_catalog.pg_roles WHERE rolname = $1`,
+		sec.Name(),
+	).Scan(&validUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, fmt.Errorf("PostgreSQL role %q does not exist", sec.Name())
+	} else if err != nil {
+		return time.Time{}, fmt.Errorf("failed to look up PostgreSQL role %q: %w", sec.Name(), err)
+	}
+
+	var rotated time.Time
+	err = c.db.QueryRowContext(ctx,
+		`SELECT rotated_at FROM `+c.table+` WHERE role_name = $1`,
+		sec.Name(),
+	).Scan(&rotated)
+	switch {
+	case err == nil:
+		return rotated, nil
+	case !errors.Is(err, sql.ErrNoRows) && !isUndefinedTable(err):
+		return time.Time{}, fmt.Errorf("failed to read last rotation of PostgreSQL role %q: %w", sec.Name(), err)
+	case c.validFor > 0 && validUntil.Valid:
+		return validUntil.Time.Add(-c.validFor), nil
+	}
+
+	return time.Time{}, nil
+}
+
+// RotateSecret sets a new password on the role and records the time of the
+// rotation in the same transaction.
+func (c *Client) RotateSecret(
+	ctx context.Context,
+	sec secret.Info,
+) (secret.Map, error) {
+	password, _, err := c.policy.NewValue()
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to generate password for PostgreSQL role %q: %w", sec.Name(), err)
+	}
+
+	verifier, err := scramVerifier(password)
+	if err != nil {
+		return secret.Map{}, err
+	}
+
+	if err := c.ensureTable(ctx); err != nil {
+		return secret.Map{}, err
+	}
+
+	now := time.Now()
+	alter := `ALTER ROLE ` + pq.QuoteIdentifier(sec.Name()) + ` PASSWORD ` + pq.QuoteLiteral(verifier)
+	if c.validFor > 0 {
+		alter += ` VALID UNTIL ` + pq.QuoteLiteral(now.Add(c.validFor).UTC().Format(time.RFC3339))
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, alter); err != nil {
+		return secret.Map{}, fmt.Errorf("failed to change password of PostgreSQL role %q: %w", sec.Name(), err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO `+c.table+` (role_name, rotated_at) VALUES ($1, $2)
+		ON CONFLICT (role_name) DO UPDATE SET rotated_at = EXCLUDED.rotated_at`,
+		sec.Name(), now,
+	)
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to record rotation of PostgreSQL role %q: %w", sec.Name(), err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return secret.Map{}, fmt.Errorf("failed to commit rotation of PostgreSQL role %q: %w", sec.Name(), err)
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Infow(
+		"rotated PostgreSQL role password",
+		"secret", sec.Name(),
+		"client", c.Name(),
+	)
+
+	return secret.Map{
+		UserKey:     sec.Name(),
+		PasswordKey: password,
+	}, nil
+}
+
+// Revoked returns true if the role is not permitted to log in.
+func (c *Client) Revoked(
+	ctx context.Context,
+	sec secret.Info,
+) (bool, error) {
+	var canLogin bool
+	err := c.db.QueryRowContext(ctx,
+		`SELECT rolcanlogin FROM pg_catalog.pg_roles WHERE rolname = $1`,
+		sec.Name(),
+	).Scan(&canLogin)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("PostgreSQL role %q does not exist", sec.Name())
+	} else if err != nil {
+		return false, fmt.Errorf("failed to look up PostgreSQL role %q: %w", sec.Name(), err)
+	}
+
+	return !canLogin, nil
+}
+
+// RevokeSecret prevents the role from logging in. This is used by the
+// alternating strategy to revoke idle roles.
+func (c *Client) RevokeSecret(
+	ctx context.Context,
+	sec secret.Info,
+) error {
+	_, err := c.db.ExecContext(ctx, `ALTER ROLE `+pq.QuoteIdentifier(sec.Name())+` NOLOGIN`)
+	if err != nil {
+		return fmt.Errorf("failed to revoke login of PostgreSQL role %q: %w", sec.Name(), err)
+	}
+
+	return nil
+}
+
+// RestoreSecret permits the role to log in again.
+func (c *Client) RestoreSecret(
+	ctx context.Context,
+	sec secret.Info,
+) error {
+	_, err := c.db.ExecContext(ctx, `ALTER ROLE `+pq.QuoteIdentifier(sec.Name())+` LOGIN`)
+	if err != nil {
+		return fmt.Errorf("failed to restore login of PostgreSQL role %q: %w", sec.Name(), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package password
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// scramIterations is the iteration count PostgreSQL uses by default.
+	scramIterations = 4096
+
+	// scramSaltSize is the salt length PostgreSQL uses by default.
+	scramSaltSize = 16
+)
+
+// scramVerifier computes the SCRAM-SHA-256 verifier for the password in the
+// format PostgreSQL stores in pg_authid, which ALTER ROLE accepts in place of
+// the password itself. The password is not normalized with SASLprep, so it
+// should be ASCII, as generated passwords are.
+func scramVerifier(password string) (string, error) {
+	salt := make([]byte, scramSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	return scramVerifierWithSalt(password, salt, scramIterations), nil
+}
+
+// scramVerifierWithSalt computes the verifier using the given salt and
+// iteration count.
+func scramVerifierWithSalt(password string, salt []byte, iterations int) string {
+	salted := pbkdf2.Key([]byte(password), salt, iterations, sha256.Size, sha256.New)
+
+	clientKey := hmacSHA256(salted, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	serverKey := hmacSHA256(salted, "Server Key")
+
+	b64 := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf("SCRAM-SHA-256$%d:%s$%s:%s",
+		iterations, b64(salt), b64(storedKey[:]), b64(serverKey))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of the message with the given key.
+func hmacSHA256(key []byte, msg string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(msg))
+	return h.Sum(nil)
+}
@@ -0,0 +1,60 @@
+package password
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestScramVerifierRFC7677 checks the verifier against the example exchange
+// in RFC 7677, section 3. The stored and server keys in the verifier must
+// reproduce the client proof and server signature of that exchange.
+func TestScramVerifierRFC7677(t *testing.T) {
+	salt, err := base64.StdEncoding.DecodeString("W22ZaJ0SNY7soEsUEjb6gQ==")
+	require.NoError(t, err)
+
+	v := scramVerifierWithSalt("pencil", salt, 4096)
+
+	parts := strings.FieldsFunc(v, func(r rune) bool { return r == '$' || r == ':' })
+	require.Len(t, parts, 5, "verifier has the PostgreSQL format")
+	assert.Equal(t, "SCRAM-SHA-256", parts[0])
+	assert.Equal(t, "4096", parts[1])
+	assert.Equal(t, "W22ZaJ0SNY7soEsUEjb6gQ==", parts[2])
+
+	storedKey, err := base64.StdEncoding.DecodeString(parts[3])
+	require.NoError(t, err)
+	serverKey, err := base64.StdEncoding.DecodeString(parts[4])
+	require.NoError(t, err)
+
+	authMessage := "n=user,r=rOprNGfwEbeRWgbNEkqO," +
+		"r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096," +
+		"c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0"
+
+	serverSignature := hmacSHA256(serverKey, authMessage)
+	assert.Equal(t, "6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=",
+		base64.StdEncoding.EncodeToString(serverSignature), "server signature")
+
+	proof, err := base64.StdEncoding.DecodeString("dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=")
+	require.NoError(t, err)
+	clientKey := hmacSHA256(storedKey, authMessage)
+	for i := range clientKey {
+		clientKey[i] ^= proof[i]
+	}
+	hashed := sha256.Sum256(clientKey)
+	assert.True(t, hmac.Equal(storedKey, hashed[:]), "client proof matches the stored key")
+}
+
+func TestScramVerifierSalted(t *testing.T) {
+	a, err := scramVerifier("hunter2")
+	require.NoError(t, err)
+	b, err := scramVerifier("hunter2")
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(a, "SCRAM-SHA-256$4096:"), "default iterations")
+	assert.NotEqual(t, a, b, "each verifier has its own salt")
+}
@@ -0,0 +1,109 @@
+package password
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/plugin/internal/jsonapi"
+	"github.com/zostay/garotate/pkg/plugin/random/password/generator"
+)
+
+// DefaultTagPrefix begins the user tag the time of each rotation is recorded in
+// if no prefix is configured.
+const DefaultTagPrefix = "garotate-rotated-"
+
+// builder implements the plugin.Builder interface and provides the factory
+// method for constructing a Client.
+type builder struct{}
+
+// options are the plugin options accepted in the configuration.
+type options struct {
+	URL         string `mapstructure:"url"`
+	TagPrefix   string `mapstructure:"tag_prefix"`
+	URLTemplate string `mapstructure:"url_template"`
+
+	generator.Policy `mapstructure:",squash"`
+}
+
+// Build constructs and returns a RabbitMQ user client.
+func (b *builder) Build(
+	ctx context.Context,
+	c *config.Plugin,
+) (plugin.Instance, error) {
+	opts := options{
+		TagPrefix: DefaultTagPrefix,
+		Policy:    generator.ConnectionSafePolicy(),
+	}
+	err := generator.DecodePolicy(c, &opts, &opts.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read RabbitMQ plugin options: %w", err)
+	}
+
+	if err := opts.Policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid RabbitMQ password policy: %w", err)
+	}
+
+	if opts.TagPrefix == "" || strings.Contains(opts.TagPrefix, ",") {
+		return nil, fmt.Errorf("the RabbitMQ plugin tag_prefix option must be set and must not contain commas, but got %q", opts.TagPrefix)
+	}
+
+	var tmpl *template.Template
+	if opts.URLTemplate != "" {
+		tmpl, err = parseURLTemplate(opts.URLTemplate)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.URL == "" {
+		opts.URL = os.Getenv("RABBITMQ_ADMIN_URL")
+	}
+	if opts.URL == "" {
+		return nil, errors.New("the RabbitMQ plugin requires a url option or RABBITMQ_ADMIN_URL environment variable")
+	}
+
+	api, err := url.Parse(opts.URL)
+	if err != nil || api.Host == "" {
+		return nil, fmt.Errorf("the RabbitMQ plugin url option must be the URL of the management API")
+	}
+	if api.User == nil {
+		return nil, errors.New("the RabbitMQ plugin url option must include the administrator user name and password")
+	}
+
+	user := api.User.Username()
+	pass, _ := api.User.Password()
+	api.User = nil
+	if !strings.HasSuffix(api.Path, "/") {
+		api.Path += "/"
+	}
+
+	return &Client{
+		api: &jsonapi.Client{
+			HTTP: http.DefaultClient,
+			Base: api,
+			Header: http.Header{
+				"Authorization": {"Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass))},
+			},
+			ErrorMessage: errorMessage,
+		},
+		tagPrefix: opts.TagPrefix,
+		urlTmpl:   tmpl,
+		policy:    opts.Policy,
+	}, nil
+}
+
+// init registers the plugin.
+func init() {
+	pkg := reflect.TypeOf(Client{}).PkgPath()
+	plugin.Register(pkg, new(builder))
+}
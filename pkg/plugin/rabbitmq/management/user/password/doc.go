@@ -0,0 +1,5 @@
+// Package password provides a plugin which implements the rotate.Client and is
+// used to rotate the passwords of RabbitMQ users through the management HTTP
+// API. RabbitMQ does not record when a password was changed, so the time of
+// each rotation is kept in a tag on the user.
+package password
@@ -0,0 +1,279 @@
+package password
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin/internal/jsonapi"
+	"github.com/zostay/garotate/pkg/plugin/random/password/generator"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+const (
+	// UserKey is the key the user name is returned under.
+	UserKey = "AMQP_USERNAME"
+
+	// PasswordKey is the key the new password is returned under.
+	PasswordKey = "AMQP_PASSWORD"
+
+	// URLKey is the key the connection URL is returned under, when a URL
+	// template is configured.
+	URLKey = "AMQP_URL"
+)
+
+// Client implements the rotate.Client interface for rotating the passwords of
+// RabbitMQ users. The secret name is the user name.
+//
+// The time of the last rotation is kept in a user tag made of the configured
+// prefix and the time in seconds since the Unix epoch. Management plugins treat
+// unknown tags as having no meaning, so the tag grants nothing.
+type Client struct {
+	api       *jsonapi.Client
+	tagPrefix string
+	urlTmpl   *template.Template
+	policy    generator.Policy
+}
+
+// secretOptions are the options that may be set on each secret.
+type secretOptions struct {
+	URLTemplate string `mapstructure:"url_template"`
+}
+
+// urlData is the data the URL template is executed with.
+type urlData struct {
+	Username string
+	Password string
+}
+
+// user is the subset of the management API user resource used by the client.
+type user struct {
+	Name string          `json:"name"`
+	Tags json.RawMessage `json:"tags"`
+}
+
+// parseURLTemplate parses a template for the AMQP_URL key.
+func parseURLTemplate(s string) (*template.Template, error) {
+	tmpl, err := template.New("url_template").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse RabbitMQ url_template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// escapeUserinfo escapes s for use as the user name or password in a URL.
+func escapeUserinfo(s string) string {
+	return strings.TrimPrefix(url.UserPassword("", s).String(), ":")
+}
+
+// tags returns the tags of the user. Older versions of RabbitMQ return the tags
+// as a single comma separated string rather than a list.
+func (u *user) tags() ([]string, error) {
+	if len(u.Tags) == 0 || string(u.Tags) == "null" {
+		return nil, nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(u.Tags, &list); err == nil {
+		return list, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(u.Tags, &s); err != nil {
+		return nil, fmt.Errorf("failed to decode tags: %w", err)
+	}
+
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			list = append(list, t)
+		}
+	}
+
+	return list, nil
+}
+
+// Name returns "RabbitMQ users".
+func (c *Client) Name() string {
+	return "RabbitMQ users"
+}
+
+// Keys returns the AMQP_USERNAME and AMQP_PASSWORD keys and, when a URL template
+// is configured for the plugin, the AMQP_URL key.
+func (c *Client) Keys() secret.Map {
+	keys := secret.Map{
+		UserKey:     "",
+		PasswordKey: "",
+	}
+
+	if c.urlTmpl != nil {
+		keys[URLKey] = ""
+	}
+
+	return keys
+}
+
+// call sends a request for the user to the management API and decodes the
+// response into out, if out is not nil.
+func (c *Client) call(
+	ctx context.Context,
+	method string,
+	name string,
+	in any,
+	out any,
+) error {
+	err := c.api.Call(ctx, method, "api/users/"+url.PathEscape(name), nil, nil, in, out)
+	var sErr *jsonapi.StatusError
+	if errors.As(err, &sErr) && sErr.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("RabbitMQ user %q does not exist", name)
+	}
+	return err
+}
+
+// errorMessage returns the reason in the error body returned by the management
+// API.
+func errorMessage(body []byte) string {
+	var apiErr struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(body, &apiErr); err != nil {
+		return ""
+	}
+	return apiErr.Reason
+}
+
+// getUser returns the tags of the user, leaving out the rotation tag, and the
+// time recorded in the rotation tag, which is zero if there is none.
+func (c *Client) getUser(
+	ctx context.Context,
+	sec secret.Info,
+) ([]string, time.Time, error) {
+	var u user
+	err := c.call(ctx, http.MethodGet, sec.Name(), nil, &u)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to look up RabbitMQ user %q: %w", sec.Name(), err)
+	}
+
+	all, err := u.tags()
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to read tags of RabbitMQ user %q: %w", sec.Name(), err)
+	}
+
+	var (
+		tags    []string
+		rotated time.Time
+	)
+	for _, t := range all {
+		if !strings.HasPrefix(t, c.tagPrefix) {
+			tags = append(tags, t)
+			continue
+		}
+
+		ts := strings.TrimPrefix(t, c.tagPrefix)
+		if secs, err := strconv.ParseInt(ts, 10, 64); err == nil {
+			if at := time.Unix(secs, 0); at.After(rotated) {
+				rotated = at
+			}
+		}
+	}
+
+	return tags, rotated, nil
+}
+
+// LastRotated returns the time recorded in the rotation tag of the user. If
+// garotate has never rotated the user, the zero time is returned.
+func (c *Client) LastRotated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	_, rotated, err := c.getUser(ctx, sec)
+	return rotated, err
+}
+
+// urlTemplate returns the URL template for the secret, which is the template
+// set in the secret options, if any, or the template configured for the
+// plugin. A secret may only override the template of the plugin, because Keys
+// includes the AMQP_URL key only when the plugin has one.
+func (c *Client) urlTemplate(sec secret.Info) (*template.Template, error) {
+	var o secretOptions
+	if so, ok := sec.(secret.Options); ok {
+		if err := so.DecodeOptions(&o); err != nil {
+			return nil, fmt.Errorf("failed to read RabbitMQ options of secret %q: %w", sec.Name(), err)
+		}
+	}
+
+	if o.URLTemplate != "" {
+		if c.urlTmpl == nil {
+			return nil, fmt.Errorf("the RabbitMQ url_template option of secret %q requires a url_template option on the plugin", sec.Name())
+		}
+		return parseURLTemplate(o.URLTemplate)
+	}
+
+	return c.urlTmpl, nil
+}
+
+// RotateSecret sets a new password on the user and replaces the rotation tag,
+// keeping the other tags of the user. The old password stops working
+// immediately.
+func (c *Client) RotateSecret(
+	ctx context.Context,
+	sec secret.Info,
+) (secret.Map, error) {
+	tmpl, err := c.urlTemplate(sec)
+	if err != nil {
+		return secret.Map{}, err
+	}
+
+	// PUT creates missing users, so look the user up first
+	tags, _, err := c.getUser(ctx, sec)
+	if err != nil {
+		return secret.Map{}, err
+	}
+
+	password, _, err := c.policy.NewValue()
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to generate password for RabbitMQ user %q: %w", sec.Name(), err)
+	}
+
+	keys := secret.Map{
+		UserKey:     sec.Name(),
+		PasswordKey: password,
+	}
+
+	if tmpl != nil {
+		var buf strings.Builder
+		err := tmpl.Execute(&buf, urlData{
+			Username: escapeUserinfo(sec.Name()),
+			Password: escapeUserinfo(password),
+		})
+		if err != nil {
+			return secret.Map{}, fmt.Errorf("failed to execute RabbitMQ url_template for secret %q: %w", sec.Name(), err)
+		}
+		keys[URLKey] = buf.String()
+	}
+
+	tags = append(tags, c.tagPrefix+strconv.FormatInt(time.Now().Unix(), 10))
+	err = c.call(ctx, http.MethodPut, sec.Name(), map[string]string{
+		"password": password,
+		"tags":     strings.Join(tags, ","),
+	}, nil)
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to set password of RabbitMQ user %q: %w", sec.Name(), err)
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Infow(
+		"set RabbitMQ user password",
+		"secret", sec.Name(),
+		"client", c.Name(),
+	)
+
+	return keys, nil
+}
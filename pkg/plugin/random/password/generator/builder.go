@@ -0,0 +1,64 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+)
+
+// DefaultKey is the key the generated value is returned under if none is
+// configured.
+const DefaultKey = "password"
+
+// builder implements the plugin.Builder interface and provides the factory
+// method for constructing a Client.
+type builder struct{}
+
+// options are the plugin options accepted in the configuration. The policy
+// options set here are the defaults for every secret.
+type options struct {
+	Key    string `mapstructure:"key"`
+	Policy `mapstructure:",squash"`
+}
+
+// Build constructs and returns a random secret generator client.
+func (b *builder) Build(
+	ctx context.Context,
+	c *config.Plugin,
+) (plugin.Instance, error) {
+	plugins := plugin.ManagerFrom(ctx)
+	if plugins == nil {
+		return nil, errors.New("the random secret generator must be built by a plugin manager to find the storages it checks")
+	}
+
+	opts := options{Key: DefaultKey, Policy: DefaultPolicy()}
+	err := DecodePolicy(c, &opts, &opts.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read random secret generator options: %w", err)
+	}
+
+	if opts.Key == "" {
+		return nil, errors.New("the random secret generator key option must not be empty")
+	}
+
+	if err := opts.Policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid random secret generator policy: %w", err)
+	}
+
+	return &Client{
+		plugins:   plugins,
+		key:       opts.Key,
+		defaults:  opts.Policy,
+		wordLists: make(map[string][]string),
+	}, nil
+}
+
+// init registers the plugin.
+func init() {
+	pkg := reflect.TypeOf(Client{}).PkgPath()
+	plugin.Register(pkg, new(builder))
+}
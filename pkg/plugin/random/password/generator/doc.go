@@ -0,0 +1,5 @@
+// Package generator provides a plugin which implements the rotate.Client by
+// generating random secret values according to a policy rather than asking an
+// upstream service to rotate them. This is suited to shared passwords, tokens,
+// and the like that garotate is responsible for minting itself.
+package generator
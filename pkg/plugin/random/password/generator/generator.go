@@ -0,0 +1,118 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/rotate"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+// Client implements the rotate.Client interface by generating random values.
+// As there is no upstream service that knows when a secret was rotated, the
+// storages of each secret are consulted instead.
+type Client struct {
+	plugins   *plugin.Manager
+	key       string
+	defaults  Policy
+	wordLists map[string][]string
+}
+
+// Name returns "random secret generator".
+func (c *Client) Name() string {
+	return "random secret generator"
+}
+
+// Keys returns the configured key, which is the only key returned by
+// RotateSecret.
+func (c *Client) Keys() secret.Map {
+	return secret.Map{c.key: ""}
+}
+
+// policy returns the policy for the secret, which is the default policy of the
+// plugin overridden by any options set on the secret.
+func (c *Client) policy(sec secret.Info) (Policy, error) {
+	p := c.defaults
+
+	if o, ok := sec.(secret.Options); ok {
+		if err := DecodePolicy(o, &p, &p); err != nil {
+			return Policy{}, fmt.Errorf("failed to read random secret generator options of secret %q: %w", sec.Name(), err)
+		}
+	}
+
+	if err := p.Validate(); err != nil {
+		return Policy{}, fmt.Errorf("invalid random secret generator policy for secret %q: %w", sec.Name(), err)
+	}
+
+	return p, nil
+}
+
+// wordList returns the words of the word list at the given path, reading it
+// the first time it is needed.
+func (c *Client) wordList(path string) ([]string, error) {
+	if words, ok := c.wordLists[path]; ok {
+		return words, nil
+	}
+
+	words, err := readWordListFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.wordLists[path] = words
+	return words, nil
+}
+
+// LastRotated returns the earliest of the times the generated key was last
+// saved to each of the storages of the secret. If it has never been saved, the
+// zero time is returned, which will cause rotation.
+func (c *Client) LastRotated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	return rotate.LastStored(ctx, c.plugins, c.Keys(), sec)
+}
+
+// RotateSecret generates a new value for the secret according to its policy.
+// The estimated entropy of the policy is logged.
+func (c *Client) RotateSecret(
+	ctx context.Context,
+	sec secret.Info,
+) (secret.Map, error) {
+	p, err := c.policy(sec)
+	if err != nil {
+		return secret.Map{}, err
+	}
+
+	var words []string
+	if p.Type == TypeDiceware {
+		words, err = c.wordList(p.WordList)
+		if err != nil {
+			return secret.Map{}, err
+		}
+	}
+
+	value, bits, err := p.Generate(words)
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to generate value for secret %q: %w", sec.Name(), err)
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Infow(
+		"generated new random secret value",
+		"secret", sec.Name(),
+		"client", c.Name(),
+		"type", p.Type,
+		"entropy_bits", math.Floor(bits),
+	)
+
+	if bits < p.MinEntropy {
+		return secret.Map{}, fmt.Errorf("policy for secret %q provides only %.0f bits of entropy, but at least %.0f are required", sec.Name(), math.Floor(bits), p.MinEntropy)
+	}
+
+	return secret.Map{c.key: value}, nil
+}
@@ -0,0 +1,381 @@
+package generator
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+// These are the types of secret values that may be generated.
+const (
+	TypePassword  = "password"  // random characters from character classes
+	TypeDiceware  = "diceware"  // random words from a word list
+	TypeHex       = "hex"       // random bytes encoded as hexadecimal
+	TypeBase64    = "base64"    // random bytes encoded as standard Base64
+	TypeBase64URL = "base64url" // random bytes encoded as unpadded URL-safe Base64
+)
+
+// These are the character classes that may be used to generate passwords.
+const (
+	ClassLower  = "lower"
+	ClassUpper  = "upper"
+	ClassDigit  = "digit"
+	ClassSymbol = "symbol"
+)
+
+const (
+	// DefaultSymbols are the symbols used by the symbol class if none are
+	// configured. Quotes, backslashes, and spaces are left out because they so
+	// often require escaping.
+	DefaultSymbols = "!#$%&*+-=?@^_~"
+
+	// DefaultSeparator is the separator placed between diceware words.
+	DefaultSeparator = "-"
+
+	lowerChars = "abcdefghijklmnopqrstuvwxyz"
+	upperChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	digitChars = "0123456789"
+)
+
+// defaultLengths is the length used for each type when none is configured.
+// This is characters for passwords, words for diceware, and random bytes for
+// the other types.
+var defaultLengths = map[string]int{
+	TypePassword:  32,
+	TypeDiceware:  6,
+	TypeHex:       32,
+	TypeBase64:    32,
+	TypeBase64URL: 32,
+}
+
+// Policy describes how a secret value is generated. It may be set in the
+// plugin options and overridden in the options of each secret.
+type Policy struct {
+	// Type is the type of value to generate. It defaults to TypePassword.
+	Type string `mapstructure:"type"`
+
+	// Length is the number of characters, words, or random bytes to generate,
+	// depending on the type.
+	Length int `mapstructure:"length"`
+
+	// Classes are the character classes passwords are made from. Every
+	// password contains at least one character from each class.
+	Classes []string `mapstructure:"classes"`
+
+	// Exclude lists characters that must never appear in a password, such as
+	// those easily mistaken for one another.
+	Exclude string `mapstructure:"exclude"`
+
+	// Symbols are the characters of the symbol class.
+	Symbols string `mapstructure:"symbols"`
+
+	// WordList is the path to the word list for diceware. It may be a list of
+	// words, one per line, or a list in the format of the EFF diceware word
+	// lists, with the dice rolls before each word.
+	WordList string `mapstructure:"word_list"`
+
+	// Separator is placed between the words of diceware passphrases.
+	Separator string `mapstructure:"separator"`
+
+	// MinEntropy is the minimum estimated entropy in bits the policy must
+	// provide. Generation fails for weaker policies.
+	MinEntropy float64 `mapstructure:"min_entropy"`
+}
+
+// DefaultPolicy returns the policy used when nothing is configured: 32
+// character passwords using all four character classes.
+func DefaultPolicy() Policy {
+	return Policy{
+		Type:      TypePassword,
+		Classes:   []string{ClassLower, ClassUpper, ClassDigit, ClassSymbol},
+		Symbols:   DefaultSymbols,
+		Separator: DefaultSeparator,
+	}
+}
+
+// ConnectionSafePolicy returns the default policy without symbols. It is the
+// default of plugins whose passwords often end up in connection strings and
+// URLs.
+func ConnectionSafePolicy() Policy {
+	p := DefaultPolicy()
+	p.Classes = []string{ClassLower, ClassUpper, ClassDigit}
+	return p
+}
+
+// DecodePolicy decodes the options into out, which must be a pointer to p or
+// to a struct that squashes p into its own options. Unlike other options,
+// configured classes replace the default classes in p rather than being
+// merged with them.
+func DecodePolicy(o secret.Options, out any, p *Policy) error {
+	classes := p.Classes
+	p.Classes = nil
+	if err := o.DecodeOptions(out); err != nil {
+		p.Classes = classes
+		return err
+	}
+	if p.Classes == nil {
+		p.Classes = classes
+	}
+	return nil
+}
+
+// length returns the configured length or the default for the type.
+func (p *Policy) length() int {
+	if p.Length > 0 {
+		return p.Length
+	}
+	return defaultLengths[p.Type]
+}
+
+// Validate returns an error if the policy cannot be used to generate values.
+func (p *Policy) Validate() error {
+	if _, ok := defaultLengths[p.Type]; !ok {
+		return fmt.Errorf("unknown secret type %q", p.Type)
+	}
+
+	if p.Length < 0 {
+		return fmt.Errorf("length must not be negative, but got %d", p.Length)
+	}
+
+	switch p.Type {
+	case TypePassword:
+		sets, err := p.charsets()
+		if err != nil {
+			return err
+		}
+		if p.length() < len(sets) {
+			return fmt.Errorf("length %d is too short to include all %d character classes", p.length(), len(sets))
+		}
+	case TypeDiceware:
+		if p.WordList == "" {
+			return errors.New("diceware requires a word_list")
+		}
+	}
+
+	return nil
+}
+
+// charsets returns the characters of each configured class with the excluded
+// characters removed.
+func (p *Policy) charsets() ([]string, error) {
+	if len(p.Classes) == 0 {
+		return nil, errors.New("at least one character class is required")
+	}
+
+	sets := make([]string, 0, len(p.Classes))
+	for _, class := range p.Classes {
+		var chars string
+		switch class {
+		case ClassLower:
+			chars = lowerChars
+		case ClassUpper:
+			chars = upperChars
+		case ClassDigit:
+			chars = digitChars
+		case ClassSymbol:
+			chars = p.Symbols
+		default:
+			return nil, fmt.Errorf("unknown character class %q", class)
+		}
+
+		chars = strings.Map(func(r rune) rune {
+			if strings.ContainsRune(p.Exclude, r) {
+				return -1
+			}
+			return r
+		}, chars)
+
+		if chars == "" {
+			return nil, fmt.Errorf("character class %q has no characters left after exclusions", class)
+		}
+		sets = append(sets, chars)
+	}
+
+	return sets, nil
+}
+
+// Generate generates a new value according to the policy. For diceware, the
+// words are the parsed word list. It returns the value and an estimate of its
+// entropy in bits.
+func (p *Policy) Generate(words []string) (string, float64, error) {
+	switch p.Type {
+	case TypePassword:
+		return p.password()
+	case TypeDiceware:
+		return p.diceware(words)
+	case TypeHex, TypeBase64, TypeBase64URL:
+		b := make([]byte, p.length())
+		if _, err := rand.Read(b); err != nil {
+			return "", 0, fmt.Errorf("failed to read random bytes: %w", err)
+		}
+
+		bits := float64(8 * len(b))
+		switch p.Type {
+		case TypeHex:
+			return hex.EncodeToString(b), bits, nil
+		case TypeBase64:
+			return base64.StdEncoding.EncodeToString(b), bits, nil
+		default:
+			return base64.RawURLEncoding.EncodeToString(b), bits, nil
+		}
+	}
+
+	return "", 0, fmt.Errorf("unknown secret type %q", p.Type)
+}
+
+// NewValue generates a new value according to the policy just like Generate,
+// but reads the word list itself when one is needed.
+func (p *Policy) NewValue() (string, float64, error) {
+	var words []string
+	if p.Type == TypeDiceware {
+		var err error
+		words, err = readWordListFile(p.WordList)
+		if err != nil {
+			return "", 0, err
+		}
+	}
+
+	return p.Generate(words)
+}
+
+// password generates a password with at least one character from each class.
+// The estimated entropy is calculated as if every character were drawn from
+// all the classes, which slightly overstates it.
+func (p *Policy) password() (string, float64, error) {
+	sets, err := p.charsets()
+	if err != nil {
+		return "", 0, err
+	}
+
+	seen := make(map[rune]struct{})
+	var all []rune
+	for _, set := range sets {
+		for _, r := range set {
+			if _, ok := seen[r]; !ok {
+				seen[r] = struct{}{}
+				all = append(all, r)
+			}
+		}
+	}
+
+	n := p.length()
+	pw := make([]rune, 0, n)
+	for _, set := range sets {
+		r, err := pick([]rune(set))
+		if err != nil {
+			return "", 0, err
+		}
+		pw = append(pw, r)
+	}
+	for len(pw) < n {
+		r, err := pick(all)
+		if err != nil {
+			return "", 0, err
+		}
+		pw = append(pw, r)
+	}
+
+	for i := len(pw) - 1; i > 0; i-- {
+		j, err := randomInt(i + 1)
+		if err != nil {
+			return "", 0, err
+		}
+		pw[i], pw[j] = pw[j], pw[i]
+	}
+
+	return string(pw), float64(n) * math.Log2(float64(len(all))), nil
+}
+
+// diceware generates a passphrase from the given words.
+func (p *Policy) diceware(words []string) (string, float64, error) {
+	if len(words) < 2 {
+		return "", 0, errors.New("diceware word list must have at least two words")
+	}
+
+	n := p.length()
+	phrase := make([]string, n)
+	for i := range phrase {
+		w, err := pick(words)
+		if err != nil {
+			return "", 0, err
+		}
+		phrase[i] = w
+	}
+
+	return strings.Join(phrase, p.Separator), float64(n) * math.Log2(float64(len(words))), nil
+}
+
+// ReadWordList reads a word list with one word per line. Blank lines are
+// skipped. When a line has more than one field, as in the EFF diceware lists
+// where each word follows its dice roll, the last field is the word.
+// Duplicate words are dropped as they would only reduce the entropy.
+func ReadWordList(r io.Reader) ([]string, error) {
+	seen := make(map[string]struct{})
+	var words []string
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		w := fields[len(fields)-1]
+		if _, ok := seen[w]; ok {
+			continue
+		}
+		seen[w] = struct{}{}
+		words = append(words, w)
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return words, nil
+}
+
+// readWordListFile reads the word list in the named file.
+func readWordListFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open word list %q: %w", path, err)
+	}
+	defer f.Close()
+
+	words, err := ReadWordList(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read word list %q: %w", path, err)
+	}
+
+	return words, nil
+}
+
+// randomInt returns a uniformly random integer in [0, n).
+func randomInt(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate random number: %w", err)
+	}
+	return int(i.Int64()), nil
+}
+
+// pick returns a uniformly random element of the list.
+func pick[T any](list []T) (T, error) {
+	i, err := randomInt(len(list))
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return list[i], nil
+}
@@ -0,0 +1,138 @@
+package generator
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zostay/garotate/pkg/config"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	p := DefaultPolicy()
+	p.Length = 16
+	p.Exclude = "lIO0"
+	require.NoError(t, p.Validate(), "policy is valid")
+
+	for i := 0; i < 100; i++ {
+		pw, bits, err := p.Generate(nil)
+		require.NoError(t, err, "password generated")
+		assert.Len(t, pw, 16, "password has the requested length")
+		assert.InDelta(t, 16*math.Log2(72), bits, 0.001, "entropy of 16 characters from 72")
+
+		assert.True(t, strings.ContainsAny(pw, lowerChars), "has a lowercase letter")
+		assert.True(t, strings.ContainsAny(pw, upperChars), "has an uppercase letter")
+		assert.True(t, strings.ContainsAny(pw, digitChars), "has a digit")
+		assert.True(t, strings.ContainsAny(pw, DefaultSymbols), "has a symbol")
+		assert.False(t, strings.ContainsAny(pw, p.Exclude), "has no excluded characters")
+	}
+}
+
+func TestPasswordPolicyClasses(t *testing.T) {
+	p := DefaultPolicy()
+	p.Classes = []string{ClassDigit}
+	p.Length = 8
+
+	pw, _, err := p.Generate(nil)
+	require.NoError(t, err, "password generated")
+	assert.Equal(t, "", strings.Trim(pw, digitChars), "only digits")
+
+	p.Length = 0
+	pw, _, err = p.Generate(nil)
+	require.NoError(t, err, "password generated")
+	assert.Len(t, pw, 32, "default length")
+}
+
+func TestBytePolicies(t *testing.T) {
+	p := Policy{Type: TypeHex, Length: 16}
+	v, bits, err := p.Generate(nil)
+	require.NoError(t, err, "hex generated")
+	b, err := hex.DecodeString(v)
+	assert.NoError(t, err, "hex decodes")
+	assert.Len(t, b, 16, "hex has the requested bytes")
+	assert.Equal(t, 128.0, bits, "hex entropy")
+
+	p = Policy{Type: TypeBase64}
+	v, _, err = p.Generate(nil)
+	require.NoError(t, err, "base64 generated")
+	b, err = base64.StdEncoding.DecodeString(v)
+	assert.NoError(t, err, "base64 decodes")
+	assert.Len(t, b, 32, "base64 has the default bytes")
+
+	p = Policy{Type: TypeBase64URL, Length: 10}
+	v, _, err = p.Generate(nil)
+	require.NoError(t, err, "base64url generated")
+	b, err = base64.RawURLEncoding.DecodeString(v)
+	assert.NoError(t, err, "base64url decodes")
+	assert.Len(t, b, 10, "base64url has the requested bytes")
+}
+
+func TestDicewarePolicy(t *testing.T) {
+	words, err := ReadWordList(strings.NewReader(
+		"11111\tabacus\n11112\tabdomen\n\n11113\tabdominal\n11114 abide\nabacus\n",
+	))
+	require.NoError(t, err, "word list read")
+	assert.Equal(t, []string{"abacus", "abdomen", "abdominal", "abide"}, words, "words parsed")
+
+	p := DefaultPolicy()
+	p.Type = TypeDiceware
+	p.WordList = "words.txt"
+	p.Length = 5
+	require.NoError(t, p.Validate(), "policy is valid")
+
+	v, bits, err := p.Generate(words)
+	require.NoError(t, err, "passphrase generated")
+	assert.Len(t, strings.Split(v, "-"), 5, "five words")
+	assert.Equal(t, 10.0, bits, "two bits per word")
+
+	_, _, err = p.Generate(words[:1])
+	assert.Error(t, err, "one word is not enough")
+}
+
+func TestPolicyValidate(t *testing.T) {
+	bad := []Policy{
+		{Type: "uuid"},
+		{Type: TypeHex, Length: -1},
+		{Type: TypeDiceware},
+		{Type: TypePassword},
+		{Type: TypePassword, Classes: []string{"emoji"}},
+		{Type: TypePassword, Classes: []string{ClassDigit}, Exclude: digitChars},
+		{Type: TypePassword, Classes: []string{ClassDigit, ClassLower}, Length: 1},
+	}
+
+	for _, p := range bad {
+		assert.Error(t, p.Validate(), "policy %+v is invalid", p)
+	}
+}
+
+func TestDecodePolicy(t *testing.T) {
+	type options struct {
+		Key    string `mapstructure:"key"`
+		Policy `mapstructure:",squash"`
+	}
+
+	decode := func(o map[string]any) options {
+		opts := options{Key: "password", Policy: ConnectionSafePolicy()}
+		require.NoError(t, DecodePolicy(&config.Plugin{Options: o}, &opts, &opts.Policy))
+		return opts
+	}
+
+	opts := decode(map[string]any{"length": 20})
+	assert.Equal(t, "password", opts.Key, "other options keep their defaults")
+	assert.Equal(t, 20, opts.Length, "policy options are decoded")
+	assert.Equal(t, []string{ClassLower, ClassUpper, ClassDigit}, opts.Classes, "default classes are kept")
+
+	opts = decode(map[string]any{"key": "token", "classes": []string{ClassDigit}})
+	assert.Equal(t, "token", opts.Key, "other options are decoded")
+	assert.Equal(t, []string{ClassDigit}, opts.Classes, "classes replace the defaults")
+
+	p := DefaultPolicy()
+	err := DecodePolicy(&config.Plugin{Options: map[string]any{"length": "long"}}, &p, &p)
+	assert.Error(t, err, "bad options fail")
+	assert.Equal(t, DefaultPolicy().Classes, p.Classes, "default classes survive a failure")
+}
@@ -0,0 +1,83 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/plugin/random/password/generator"
+)
+
+// DefaultTrackingKey is the key of the hash the time of each rotation is
+// recorded in if none is configured.
+const DefaultTrackingKey = "garotate:rotations"
+
+// builder implements the plugin.Builder interface and provides the factory
+// method for constructing a Client.
+type builder struct{}
+
+// options are the plugin options accepted in the configuration.
+type options struct {
+	URL         string `mapstructure:"url"`
+	TrackingKey string `mapstructure:"tracking_key"`
+	SaveACL     bool   `mapstructure:"save_acl"`
+
+	generator.Policy `mapstructure:",squash"`
+}
+
+// Build constructs and returns a Redis ACL user client.
+func (b *builder) Build(
+	ctx context.Context,
+	c *config.Plugin,
+) (plugin.Instance, error) {
+	opts := options{
+		TrackingKey: DefaultTrackingKey,
+		Policy:      generator.ConnectionSafePolicy(),
+	}
+	err := generator.DecodePolicy(c, &opts, &opts.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Redis plugin options: %w", err)
+	}
+
+	if err := opts.Policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid Redis password policy: %w", err)
+	}
+
+	if opts.TrackingKey == "" {
+		return nil, errors.New("the Redis plugin tracking_key option must not be empty")
+	}
+
+	if opts.URL == "" {
+		opts.URL = os.Getenv("REDIS_ADMIN_URL")
+	}
+	if opts.URL == "" {
+		return nil, errors.New("the Redis plugin requires a url option or REDIS_ADMIN_URL environment variable")
+	}
+
+	ropts, err := redis.ParseURL(opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Redis url: %w", err)
+	}
+
+	// replies to ACL GETUSER are parsed as RESP2 arrays
+	ropts.Protocol = 2
+
+	return &Client{
+		rdb:         redis.NewClient(ropts),
+		trackingKey: opts.TrackingKey,
+		saveACL:     opts.SaveACL,
+		policy:      opts.Policy,
+	}, nil
+}
+
+// init registers the plugin.
+func init() {
+	pkg := reflect.TypeOf(Client{}).PkgPath()
+	plugin.Register(pkg, new(builder))
+}
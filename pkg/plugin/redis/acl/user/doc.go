@@ -0,0 +1,6 @@
+// Package user provides a plugin which implements both the rotate.Client and
+// the disable.Client and is used to rotate the passwords of Redis ACL users.
+// Redis permits a user to have several passwords, so rotation adds a new
+// password and keeps the old ones working. Disablement removes every password
+// except the newest.
+package user
@@ -0,0 +1,285 @@
+package user
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin/random/password/generator"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+const (
+	// UserKey is the key the user name is returned under.
+	UserKey = "REDIS_USERNAME"
+
+	// PasswordKey is the key the new password is returned under.
+	PasswordKey = "REDIS_PASSWORD"
+)
+
+// Client implements the rotate.Client and disable.Client interfaces for
+// rotating the passwords of Redis ACL users. The secret name is the user name.
+//
+// Redis does not record when a password was added, so the time of each
+// rotation and the hash of the new password are kept in a hash owned by
+// garotate, with a field for each user.
+type Client struct {
+	rdb         *redis.Client
+	trackingKey string
+	saveACL     bool
+	policy      generator.Policy
+}
+
+// rotation is the record of the last rotation of a user kept in the tracking
+// hash.
+type rotation struct {
+	RotatedAt    time.Time `json:"rotated_at"`
+	PasswordHash string    `json:"password_hash"`
+}
+
+// Name returns "Redis ACL users".
+func (c *Client) Name() string {
+	return "Redis ACL users"
+}
+
+// Keys returns the REDIS_USERNAME and REDIS_PASSWORD keys.
+func (c *Client) Keys() secret.Map {
+	return secret.Map{
+		UserKey:     "",
+		PasswordKey: "",
+	}
+}
+
+// Close closes the connections to the server.
+func (c *Client) Close() error {
+	return c.rdb.Close()
+}
+
+// passwords returns the SHA-256 hashes of the passwords of the user, oldest
+// first, as hex. It returns an error if the user does not exist.
+func (c *Client) passwords(ctx context.Context, name string) ([]string, error) {
+	res, err := c.rdb.Do(ctx, "ACL", "GETUSER", name).Slice()
+	if errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("Redis ACL user %q does not exist", name)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to look up Redis ACL user %q: %w", name, err)
+	}
+
+	for i := 0; i+1 < len(res); i += 2 {
+		if field, _ := res[i].(string); field != "passwords" {
+			continue
+		}
+
+		list, _ := res[i+1].([]any)
+		hashes := make([]string, 0, len(list))
+		for _, h := range list {
+			if hash, ok := h.(string); ok {
+				hashes = append(hashes, hash)
+			}
+		}
+		return hashes, nil
+	}
+
+	return nil, nil
+}
+
+// lastRotation returns the record of the last rotation of the user or nil if
+// garotate has never rotated it.
+func (c *Client) lastRotation(ctx context.Context, name string) (*rotation, error) {
+	raw, err := c.rdb.HGet(ctx, c.trackingKey, name).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read last rotation of Redis ACL user %q: %w", name, err)
+	}
+
+	var r rotation
+	err = json.Unmarshal([]byte(raw), &r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode last rotation of Redis ACL user %q: %w", name, err)
+	}
+
+	return &r, nil
+}
+
+// save persists the ACL to the ACL file, if configured.
+func (c *Client) save(ctx context.Context) error {
+	if !c.saveACL {
+		return nil
+	}
+
+	err := c.rdb.Do(ctx, "ACL", "SAVE").Err()
+	if err != nil {
+		return fmt.Errorf("failed to save Redis ACL file: %w", err)
+	}
+
+	return nil
+}
+
+// LastRotated returns the time the user was last rotated according to the
+// tracking hash. If garotate has never rotated the user, the zero time is
+// returned.
+func (c *Client) LastRotated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	if _, err := c.passwords(ctx, sec.Name()); err != nil {
+		return time.Time{}, err
+	}
+
+	r, err := c.lastRotation(ctx, sec.Name())
+	if err != nil || r == nil {
+		return time.Time{}, err
+	}
+
+	return r.RotatedAt, nil
+}
+
+// RotateSecret adds a new password to the user, keeping the existing
+// passwords, and records the rotation in the same transaction.
+func (c *Client) RotateSecret(
+	ctx context.Context,
+	sec secret.Info,
+) (secret.Map, error) {
+	// ACL SETUSER creates missing users, so check first
+	if _, err := c.passwords(ctx, sec.Name()); err != nil {
+		return secret.Map{}, err
+	}
+
+	password, _, err := c.policy.NewValue()
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to generate password for Redis ACL user %q: %w", sec.Name(), err)
+	}
+
+	hash := sha256.Sum256([]byte(password))
+	record, err := json.Marshal(rotation{
+		RotatedAt:    time.Now(),
+		PasswordHash: hex.EncodeToString(hash[:]),
+	})
+	if err != nil {
+		return secret.Map{}, err
+	}
+
+	_, err = c.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Do(ctx, "ACL", "SETUSER", sec.Name(), ">"+password)
+		pipe.HSet(ctx, c.trackingKey, sec.Name(), string(record))
+		return nil
+	})
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to add password to Redis ACL user %q: %w", sec.Name(), err)
+	}
+
+	if err := c.save(ctx); err != nil {
+		return secret.Map{}, err
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Infow(
+		"added Redis ACL user password",
+		"secret", sec.Name(),
+		"client", c.Name(),
+	)
+
+	return secret.Map{
+		UserKey:     sec.Name(),
+		PasswordKey: password,
+	}, nil
+}
+
+// LastUpdated returns the time the older passwords of the user became
+// inactive, which is when the newest password was added. If the user has only
+// one password, there is nothing to disable. If garotate has never rotated the
+// user, there is no telling which password is newest, so disablement is put
+// off until the first rotation.
+func (c *Client) LastUpdated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	hashes, err := c.passwords(ctx, sec.Name())
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if len(hashes) < 2 {
+		return time.Time{}, disable.ErrNothingToDisable
+	}
+
+	r, err := c.lastRotation(ctx, sec.Name())
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if r == nil {
+		logger := config.LoggerFrom(ctx).Sugar()
+		logger.Warnw(
+			"Redis ACL user has several passwords, but no rotation record; not disabling any until it is rotated",
+			"secret", sec.Name(),
+			"client", c.Name(),
+			"tracking_key", c.trackingKey,
+		)
+		return time.Time{}, disable.ErrNothingToDisable
+	}
+
+	return r.RotatedAt, nil
+}
+
+// DisableSecret removes every password of the user except the newest. The
+// newest is the password added by the last rotation or, if that password is
+// not found, the password most recently added to the user.
+func (c *Client) DisableSecret(
+	ctx context.Context,
+	sec secret.Info,
+) error {
+	hashes, err := c.passwords(ctx, sec.Name())
+	if err != nil {
+		return err
+	}
+
+	if len(hashes) < 2 {
+		return nil
+	}
+
+	r, err := c.lastRotation(ctx, sec.Name())
+	if err != nil {
+		return err
+	}
+
+	keep := hashes[len(hashes)-1]
+	if r != nil {
+		for _, hash := range hashes {
+			if hash == r.PasswordHash {
+				keep = hash
+			}
+		}
+	}
+
+	args := []any{"ACL", "SETUSER", sec.Name()}
+	for _, hash := range hashes {
+		if hash != keep {
+			args = append(args, "!"+hash)
+		}
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Infow(
+		"removing old Redis ACL user passwords",
+		"secret", sec.Name(),
+		"client", c.Name(),
+		"count", len(args)-3,
+	)
+
+	err = c.rdb.Do(ctx, args...).Err()
+	if err != nil {
+		return fmt.Errorf("failed to remove old passwords of Redis ACL user %q: %w", sec.Name(), err)
+	}
+
+	return c.save(ctx)
+}
@@ -0,0 +1,226 @@
+package user
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin"
+)
+
+// testURLEnv names the environment variable holding the URL of an
+// administrator connection to a Redis 6 or later server to test against, such
+// as a disposable container:
+//
+//	docker run --rm -p 6379:6379 redis
+//	GAROTATE_TEST_REDIS_URL=redis://localhost:6379/0 go test ./...
+const testURLEnv = "GAROTATE_TEST_REDIS_URL"
+
+// login reports whether the user can authenticate with the password.
+func login(t *testing.T, url, user, password string) error {
+	t.Helper()
+
+	opts, err := redis.ParseURL(url)
+	require.NoError(t, err)
+	opts.Username = user
+	opts.Password = password
+
+	rdb := redis.NewClient(opts)
+	defer rdb.Close()
+
+	return rdb.Ping(context.Background()).Err()
+}
+
+func TestRotateUser(t *testing.T) {
+	url := os.Getenv(testURLEnv)
+	if url == "" {
+		t.Skipf("set %s to test against a Redis server", testURLEnv)
+	}
+
+	ctx := context.Background()
+	user := fmt.Sprintf("garotate_test_%d", time.Now().UnixNano())
+	trackingKey := "garotate:test:rotations"
+	oldPassword := "initial-password"
+
+	opts, err := redis.ParseURL(url)
+	require.NoError(t, err)
+	admin := redis.NewClient(opts)
+	t.Cleanup(func() {
+		_ = admin.Do(ctx, "ACL", "DELUSER", user).Err()
+		_ = admin.Del(ctx, trackingKey).Err()
+		_ = admin.Close()
+	})
+
+	require.NoError(t, admin.Do(ctx, "ACL", "SETUSER", user, "on", ">"+oldPassword, "+ping").Err())
+
+	inst, err := plugin.Build(ctx, &config.Plugin{
+		Name:    "redis",
+		Package: "github.com/zostay/garotate/pkg/plugin/redis/acl/user",
+		Options: map[string]any{
+			"url":          url,
+			"tracking_key": trackingKey,
+		},
+	})
+	require.NoError(t, err)
+
+	c := inst.(*Client)
+	t.Cleanup(func() { _ = c.Close() })
+
+	sec := &config.Secret{SecretName: user}
+
+	last, err := c.LastRotated(ctx, sec)
+	require.NoError(t, err)
+	assert.True(t, last.IsZero(), "never rotated")
+
+	_, err = c.LastUpdated(ctx, sec)
+	assert.ErrorIs(t, err, disable.ErrNothingToDisable, "nothing to disable yet")
+
+	keys, err := c.RotateSecret(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, user, keys[UserKey])
+	assert.Len(t, keys[PasswordKey], 32)
+
+	assert.NoError(t, login(t, url, user, keys[PasswordKey]), "new password works")
+	assert.NoError(t, login(t, url, user, oldPassword), "old password still works")
+
+	last, err = c.LastRotated(ctx, sec)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), last, time.Minute, "just rotated")
+
+	upd, err := c.LastUpdated(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, last, upd, "old password inactive since rotation")
+
+	require.NoError(t, c.DisableSecret(ctx, sec))
+
+	assert.NoError(t, login(t, url, user, keys[PasswordKey]), "new password still works")
+	assert.Error(t, login(t, url, user, oldPassword), "old password is removed")
+
+	_, err = c.RotateSecret(ctx, &config.Secret{SecretName: user + "_missing"})
+	assert.Error(t, err, "missing user is an error")
+}
+
+// fakeRedis is a minimal RESP server that answers ACL GETUSER with the given
+// password hashes and reports that nothing is recorded in any hash.
+type fakeRedis struct {
+	mu        sync.Mutex
+	passwords []string
+}
+
+// setPasswords replaces the password hashes of the user.
+func (f *fakeRedis) setPasswords(passwords ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.passwords = passwords
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		var reply string
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			reply = "+PONG\r\n"
+		case "ACL":
+			f.mu.Lock()
+			reply = fmt.Sprintf("*4\r\n$5\r\nflags\r\n*1\r\n$2\r\non\r\n$9\r\npasswords\r\n*%d\r\n", len(f.passwords))
+			for _, p := range f.passwords {
+				reply += fmt.Sprintf("$%d\r\n%s\r\n", len(p), p)
+			}
+			f.mu.Unlock()
+		case "HGET":
+			reply = "$-1\r\n"
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+// readCommand reads a command sent as a RESP array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+
+	return args, nil
+}
+
+func TestLastUpdatedWithoutRecord(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	f := &fakeRedis{}
+	f.setPasswords("aaaa", "bbbb")
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+
+	ctx := context.Background()
+	inst, err := plugin.Build(ctx, &config.Plugin{
+		Name:    "redis",
+		Package: "github.com/zostay/garotate/pkg/plugin/redis/acl/user",
+		Options: map[string]any{
+			"url": "redis://" + ln.Addr().String(),
+		},
+	})
+	require.NoError(t, err)
+
+	c := inst.(*Client)
+	t.Cleanup(func() { _ = c.Close() })
+
+	_, err = c.LastUpdated(ctx, &config.Secret{SecretName: "app"})
+	assert.ErrorIs(t, err, disable.ErrNothingToDisable, "several passwords, but never rotated")
+
+	f.setPasswords("aaaa")
+	_, err = c.LastUpdated(ctx, &config.Secret{SecretName: "app"})
+	assert.ErrorIs(t, err, disable.ErrNothingToDisable, "only one password")
+}
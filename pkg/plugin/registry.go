@@ -3,6 +3,7 @@ package plugin
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/zostay/garotate/pkg/config"
 )
@@ -27,6 +28,9 @@ type Builder interface {
 // registy is where all the Builders are held after registered.
 var registry = make(map[string]Builder)
 
+// prefixes is where the Builders registered for a package prefix are held.
+var prefixes = make(map[string]Builder)
+
 // Register should be called during package initialization to add a plugin
 // package to the registered list of plugins. The Go package name is preferred
 // as the registered alias by convention, but it could be anything.
@@ -37,9 +41,35 @@ func Register(pkg string, b Builder) {
 	registry[pkg] = b
 }
 
-// Get retrieves the builder associated with the given package or nil.
+// RegisterPrefix works like Register, but the Builder will be used for every
+// package starting with the given prefix that has not been registered by its
+// full name. This allows a single plugin to build instances for packages that
+// are not compiled in, such as external programs.
+func RegisterPrefix(prefix string, b Builder) {
+	if _, alreadyExists := prefixes[prefix]; alreadyExists {
+		panic(fmt.Sprintf("garotate plugin prefix %q has already been registered", prefix))
+	}
+	prefixes[prefix] = b
+}
+
+// Get retrieves the builder associated with the given package or nil. A
+// builder registered for the full package name is preferred. Otherwise, the
+// builder registered for the longest matching prefix is returned.
 func Get(pkg string) Builder {
-	return registry[pkg]
+	if b, ok := registry[pkg]; ok {
+		return b
+	}
+
+	var (
+		found   Builder
+		longest int
+	)
+	for prefix, b := range prefixes {
+		if strings.HasPrefix(pkg, prefix) && len(prefix) > longest {
+			found, longest = b, len(prefix)
+		}
+	}
+	return found
 }
 
 // Build will construct a plugin instance and return it. If the instance fails
@@ -0,0 +1,128 @@
+package entry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+)
+
+// DefaultKey is the storage key holding the public key if none is configured.
+const DefaultKey = "SSH_PUBLIC_KEY"
+
+// builder implements the plugin.Builder interface and provides the factory
+// method for constructing a Client.
+type builder struct{}
+
+// options are the plugin options accepted in the configuration.
+type options struct {
+	Key          string `mapstructure:"key"`
+	User         string `mapstructure:"user"`
+	IdentityFile string `mapstructure:"identity_file"`
+	KnownHosts   string `mapstructure:"known_hosts"`
+}
+
+// Build constructs and returns an authorized_keys storage client.
+func (b *builder) Build(
+	ctx context.Context,
+	c *config.Plugin,
+) (plugin.Instance, error) {
+	opts := options{Key: DefaultKey}
+	err := c.DecodeOptions(&opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authorized_keys plugin options: %w", err)
+	}
+
+	if opts.Key == "" {
+		return nil, errors.New("the authorized_keys plugin key option must not be empty")
+	}
+
+	if opts.User == "" {
+		if u, err := user.Current(); err == nil {
+			opts.User = u.Username
+		}
+	}
+
+	if opts.KnownHosts == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			opts.KnownHosts = filepath.Join(home, ".ssh", "known_hosts")
+		}
+	}
+
+	return &Client{
+		plugins: plugin.ManagerFrom(ctx),
+		key:     opts.Key,
+		ssh: sshConfig{
+			user:         opts.User,
+			identityFile: opts.IdentityFile,
+			knownHosts:   opts.KnownHosts,
+		},
+	}, nil
+}
+
+// sshConfig holds the settings for connecting to remote hosts.
+type sshConfig struct {
+	user         string
+	identityFile string
+	knownHosts   string
+}
+
+// clientConfig returns the configuration for connecting as the given user. It
+// authenticates with the identity file, if configured, or else with the SSH
+// agent. The closer returned must be called when the connection is done.
+func (s *sshConfig) clientConfig(user string) (*ssh.ClientConfig, func(), error) {
+	hostKeys, err := knownhosts.New(s.knownHosts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read known hosts: %w", err)
+	}
+
+	cfg := &ssh.ClientConfig{
+		User:            user,
+		HostKeyCallback: hostKeys,
+	}
+
+	if s.identityFile != "" {
+		pem, err := os.ReadFile(s.identityFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read identity file: %w", err)
+		}
+
+		signer, err := ssh.ParsePrivateKey(pem)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse identity file: %w", err)
+		}
+
+		cfg.Auth = []ssh.AuthMethod{ssh.PublicKeys(signer)}
+		return cfg, func() {}, nil
+	}
+
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, nil, errors.New("an identity_file option or SSH_AUTH_SOCK environment variable is required to connect to remote hosts")
+	}
+
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to SSH agent: %w", err)
+	}
+
+	cfg.Auth = []ssh.AuthMethod{ssh.PublicKeysCallback(agent.NewClient(conn).Signers)}
+	return cfg, func() { _ = conn.Close() }, nil
+}
+
+// init registers the plugin.
+func init() {
+	pkg := reflect.TypeOf(Client{}).PkgPath()
+	plugin.Register(pkg, new(builder))
+}
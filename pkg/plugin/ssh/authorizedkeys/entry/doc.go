@@ -0,0 +1,5 @@
+// Package entry provides a plugin which implements the rotate.Storage
+// interface by installing public keys into an authorized_keys file, either
+// locally or over SSH. It also implements the disable.Client interface, which
+// removes the keys it installed before the newest.
+package entry
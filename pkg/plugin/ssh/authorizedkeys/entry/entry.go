@@ -0,0 +1,302 @@
+package entry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/rotate"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+// Tag begins the comment of every key installed. If the storage name has a
+// tag, it follows after a colon. The comment ends with the time the key was
+// installed.
+const Tag = "garotate"
+
+// Client implements the rotate.Storage interface by installing public keys
+// into authorized_keys files. Each storage name is a path, optionally prefixed
+// with "[user@]host[:port]:" to reach the file over SSH. Adding "#tag" to the
+// name sets the tag, which is needed to tell keys apart when several secrets
+// share a file.
+//
+// Each installed key is commented with the tag and the time it was installed.
+// Other lines of the file are left alone. Only the configured key is
+// installed; any other keys, such as the private key, are ignored and are
+// considered saved whenever the public key is.
+//
+// Client also implements the disable.Client interface. Disablement removes
+// every tagged key but the newest from each authorized_keys storage of the
+// secret.
+type Client struct {
+	plugins *plugin.Manager
+	key     string
+	ssh     sshConfig
+}
+
+// line is a line of an authorized_keys file.
+type line struct {
+	text      string
+	key       ssh.PublicKey
+	installed time.Time
+	tagged    bool
+}
+
+// Name returns "authorized_keys".
+func (c *Client) Name() string {
+	return "authorized_keys"
+}
+
+// comment returns the comment marking a key installed with the given tag.
+func comment(tag string) string {
+	if tag == "" {
+		return Tag
+	}
+	return Tag + ":" + tag
+}
+
+// parseLines splits the file into lines, marking those installed with the tag.
+func parseLines(data []byte, tag string) []line {
+	mark := comment(tag)
+
+	var lines []line
+	for _, text := range strings.SplitAfter(string(data), "\n") {
+		if text == "" {
+			continue
+		}
+
+		l := line{text: text}
+		key, cmt, _, _, err := ssh.ParseAuthorizedKey([]byte(text))
+		if err == nil {
+			l.key = key
+			fields := strings.Fields(cmt)
+			if len(fields) == 2 && fields[0] == mark {
+				if t, err := time.Parse(time.RFC3339, fields[1]); err == nil {
+					l.installed = t
+					l.tagged = true
+				}
+			}
+		}
+
+		lines = append(lines, l)
+	}
+
+	return lines
+}
+
+// joinLines joins the lines back into the content of a file.
+func joinLines(lines []line) []byte {
+	var buf bytes.Buffer
+	for _, l := range lines {
+		buf.WriteString(l.text)
+		if !strings.HasSuffix(l.text, "\n") {
+			buf.WriteString("\n")
+		}
+	}
+	return buf.Bytes()
+}
+
+// newest returns the index of the most recently installed tagged line or -1.
+func newest(lines []line) int {
+	idx := -1
+	for i, l := range lines {
+		if l.tagged && (idx < 0 || !l.installed.Before(lines[idx].installed)) {
+			idx = i
+		}
+	}
+	return idx
+}
+
+// load reads and parses the file named by the storage name.
+func (c *Client) load(ctx context.Context, name string) (*location, []line, error) {
+	loc, err := parseLocation(name, &c.ssh)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := loc.read(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read authorized_keys %q: %w", name, err)
+	}
+
+	return loc, parseLines(data, loc.tag), nil
+}
+
+// LastSaved returns the time the newest tagged key was installed. It returns
+// secret.ErrKeyNotFound if no tagged key is installed.
+func (c *Client) LastSaved(
+	ctx context.Context,
+	store secret.Storage,
+	key string,
+) (time.Time, error) {
+	_, lines, err := c.load(ctx, store.Name())
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if i := newest(lines); i >= 0 {
+		return lines[i].installed, nil
+	}
+
+	return time.Time{}, secret.ErrKeyNotFound
+}
+
+// SaveKeys installs the public key, tagged with the current time. Older keys
+// are left in place until disabled.
+func (c *Client) SaveKeys(
+	ctx context.Context,
+	store secret.Storage,
+	ss secret.Map,
+) error {
+	value, ok := ss[c.key]
+	if !ok {
+		return fmt.Errorf("no %q key to install in authorized_keys %q", c.key, store.Name())
+	}
+
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(value))
+	if err != nil {
+		return fmt.Errorf("failed to parse public key to install in authorized_keys %q: %w", store.Name(), err)
+	}
+
+	loc, lines, err := c.load(ctx, store.Name())
+	if err != nil {
+		return err
+	}
+
+	// drop any earlier copy of the same key so it is only installed once
+	kept := make([]line, 0, len(lines)+1)
+	for _, l := range lines {
+		if l.key == nil || !bytes.Equal(l.key.Marshal(), pub.Marshal()) {
+			kept = append(kept, l)
+		}
+	}
+
+	text := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+	kept = append(kept, line{
+		text: text + " " + comment(loc.tag) + " " + time.Now().UTC().Format(time.RFC3339) + "\n",
+	})
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Infow(
+		"installing public key in authorized_keys",
+		"client", c.Name(),
+		"storage", store.Name(),
+		"fingerprint", ssh.FingerprintSHA256(pub),
+	)
+
+	err = loc.write(ctx, joinLines(kept))
+	if err != nil {
+		return fmt.Errorf("failed to write authorized_keys %q: %w", store.Name(), err)
+	}
+
+	return nil
+}
+
+// storages returns the names of the storages of the secret that use this
+// client.
+func (c *Client) storages(ctx context.Context, sec secret.Info) ([]string, error) {
+	if c.plugins == nil {
+		return nil, errors.New("the authorized_keys plugin must be built by a plugin manager to find the storages it disables")
+	}
+
+	return rotate.StorageNames(ctx, c.plugins, c, sec)
+}
+
+// LastUpdated returns the time the newest tagged key was installed in any of
+// the authorized_keys storages of the secret that hold older tagged keys, as
+// that is when the older keys became inactive. If there are no older keys,
+// there is nothing to disable.
+func (c *Client) LastUpdated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	names, err := c.storages(ctx, sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var updated time.Time
+	for _, name := range names {
+		_, lines, err := c.load(ctx, name)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		tagged := 0
+		for _, l := range lines {
+			if l.tagged {
+				tagged++
+			}
+		}
+
+		if tagged < 2 {
+			continue
+		}
+
+		if t := lines[newest(lines)].installed; t.After(updated) {
+			updated = t
+		}
+	}
+
+	if updated.IsZero() {
+		return time.Time{}, disable.ErrNothingToDisable
+	}
+
+	return updated, nil
+}
+
+// DisableSecret removes every tagged key but the newest from each of the
+// authorized_keys storages of the secret.
+func (c *Client) DisableSecret(
+	ctx context.Context,
+	sec secret.Info,
+) error {
+	names, err := c.storages(ctx, sec)
+	if err != nil {
+		return err
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	for _, name := range names {
+		loc, lines, err := c.load(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		keep := newest(lines)
+		kept := make([]line, 0, len(lines))
+		for i, l := range lines {
+			if !l.tagged || i == keep {
+				kept = append(kept, l)
+				continue
+			}
+
+			logger.Infow(
+				"removing old public key from authorized_keys",
+				"secret", sec.Name(),
+				"client", c.Name(),
+				"storage", name,
+				"fingerprint", ssh.FingerprintSHA256(l.key),
+			)
+		}
+
+		if len(kept) == len(lines) {
+			continue
+		}
+
+		err = loc.write(ctx, joinLines(kept))
+		if err != nil {
+			return fmt.Errorf("failed to write authorized_keys %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package entry
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+func newPublicKey(t *testing.T) string {
+	t.Helper()
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	sshPub, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPub))) + " garotate:test"
+}
+
+func TestParseLocation(t *testing.T) {
+	cfg := &sshConfig{user: "me"}
+
+	loc, err := parseLocation("/home/me/.ssh/authorized_keys", cfg)
+	require.NoError(t, err)
+	assert.Equal(t, &localFile{path: "/home/me/.ssh/authorized_keys"}, loc.target)
+	assert.Equal(t, "", loc.tag)
+
+	loc, err = parseLocation("authorized_keys#ci", cfg)
+	require.NoError(t, err)
+	assert.Equal(t, &localFile{path: "authorized_keys"}, loc.target)
+	assert.Equal(t, "ci", loc.tag)
+
+	loc, err = parseLocation("web1:.ssh/authorized_keys", cfg)
+	require.NoError(t, err)
+	assert.Equal(t, &remoteFile{cfg: cfg, user: "me", host: "web1", port: "22", path: ".ssh/authorized_keys"}, loc.target)
+
+	loc, err = parseLocation("deploy@web1:2222:/home/deploy/.ssh/authorized_keys#app", cfg)
+	require.NoError(t, err)
+	assert.Equal(t, &remoteFile{cfg: cfg, user: "deploy", host: "web1", port: "2222", path: "/home/deploy/.ssh/authorized_keys"}, loc.target)
+	assert.Equal(t, "app", loc.tag)
+
+	_, err = parseLocation("web1:", cfg)
+	assert.Error(t, err, "remote needs a path")
+
+	assert.Equal(t, `'it'\''s'`, shellQuote("it's"))
+}
+
+func TestSaveAndDisable(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "authorized_keys")
+	other := newPublicKey(t)
+	require.NoError(t, os.WriteFile(path, []byte("# managed by hand\n"+other+"\n"), 0o600))
+
+	plugins := plugin.NewManager(config.PluginList{
+		"keys": config.Plugin{
+			Name:    "keys",
+			Package: "github.com/zostay/garotate/pkg/plugin/ssh/authorizedkeys/entry",
+		},
+	})
+
+	inst, err := plugins.Instance(ctx, "keys")
+	require.NoError(t, err)
+	c := inst.(*Client)
+
+	sec := &config.Secret{
+		SecretName: "app",
+		Storages: []config.StorageMap{
+			{StorageClient: "keys", StorageName: path + "#app"},
+		},
+	}
+	store := &sec.Storages[0]
+
+	_, err = c.LastSaved(ctx, store, DefaultKey)
+	assert.ErrorIs(t, err, secret.ErrKeyNotFound, "nothing installed yet")
+
+	first := newPublicKey(t)
+	require.NoError(t, c.SaveKeys(ctx, store, secret.Map{DefaultKey: first, "SSH_PRIVATE_KEY": "private"}))
+
+	saved, err := c.LastSaved(ctx, store, "SSH_PRIVATE_KEY")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), saved, time.Minute, "just installed")
+
+	_, err = c.LastUpdated(ctx, sec)
+	assert.ErrorIs(t, err, disable.ErrNothingToDisable, "nothing to disable yet")
+
+	second := newPublicKey(t)
+	require.NoError(t, c.SaveKeys(ctx, store, secret.Map{DefaultKey: second}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), strings.Fields(first)[1], "first key still installed")
+	assert.Contains(t, string(data), strings.Fields(second)[1], "second key installed")
+	assert.NotContains(t, string(data), "private", "private key is never installed")
+
+	require.NoError(t, c.DisableSecret(ctx, sec))
+
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "# managed by hand\n", "other lines kept")
+	assert.Contains(t, string(data), other+"\n", "untagged key kept")
+	assert.NotContains(t, string(data), strings.Fields(first)[1], "old key removed")
+	assert.Contains(t, string(data), strings.Fields(second)[1]+" garotate:app ", "new key kept with tag")
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm(), "mode kept")
+}
@@ -0,0 +1,184 @@
+package entry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/zostay/garotate/pkg/plugin/internal/atomicfile"
+)
+
+// target is an authorized_keys file that can be read and replaced.
+type target interface {
+	// read returns the content of the file, which is empty if the file does
+	// not exist.
+	read(ctx context.Context) ([]byte, error)
+
+	// write replaces the content of the file.
+	write(ctx context.Context, data []byte) error
+}
+
+// location is a parsed storage name.
+type location struct {
+	target
+	tag string
+}
+
+// parseLocation parses a storage name, which has the form:
+//
+//	[[user@]host[:port]:]path[#tag]
+//
+// A name without a host is a local path.
+func parseLocation(name string, cfg *sshConfig) (*location, error) {
+	loc := &location{}
+	if i := strings.LastIndex(name, "#"); i >= 0 {
+		name, loc.tag = name[:i], name[i+1:]
+	}
+
+	if name == "" {
+		return nil, errors.New("authorized_keys storage name has no path")
+	}
+
+	parts := strings.SplitN(name, ":", 3)
+	if len(parts) == 1 || strings.ContainsAny(parts[0], "/\\") {
+		loc.target = &localFile{path: name}
+		return loc, nil
+	}
+
+	r := &remoteFile{cfg: cfg, user: cfg.user, host: parts[0], port: "22"}
+	if i := strings.LastIndex(r.host, "@"); i >= 0 {
+		r.user, r.host = r.host[:i], r.host[i+1:]
+	}
+
+	switch {
+	case len(parts) == 3:
+		if _, err := strconv.Atoi(parts[1]); err != nil {
+			r.path = parts[1] + ":" + parts[2]
+		} else {
+			r.port, r.path = parts[1], parts[2]
+		}
+	default:
+		r.path = parts[1]
+	}
+
+	if r.host == "" || r.path == "" {
+		return nil, fmt.Errorf("authorized_keys storage name %q must have a host and path", name)
+	}
+
+	loc.target = r
+	return loc, nil
+}
+
+// localFile is an authorized_keys file on the local filesystem.
+type localFile struct {
+	path string
+}
+
+// read returns the content of the file.
+func (f *localFile) read(ctx context.Context) ([]byte, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// write replaces the file by writing a temporary file alongside it and
+// renaming it into place. The mode of the existing file is kept.
+func (f *localFile) write(ctx context.Context, data []byte) error {
+	mode := fs.FileMode(0o600)
+	if fi, err := os.Stat(f.path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+
+	return atomicfile.WriteFile(f.path, data, mode)
+}
+
+// remoteFile is an authorized_keys file on a remote host reached over SSH.
+type remoteFile struct {
+	cfg  *sshConfig
+	user string
+	host string
+	port string
+	path string
+}
+
+// shellQuote quotes the string for use as a single word in a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// run runs the command on the remote host with the given input and returns
+// its output.
+func (f *remoteFile) run(ctx context.Context, cmd string, in []byte) ([]byte, error) {
+	cfg, closeAuth, err := f.cfg.clientConfig(f.user)
+	if err != nil {
+		return nil, err
+	}
+	defer closeAuth()
+
+	addr := net.JoinHostPort(f.host, f.port)
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+
+	sconn, chans, reqs, err := ssh.NewClientConn(conn, addr, cfg)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+
+	client := ssh.NewClient(sconn, chans, reqs)
+	defer client.Close()
+
+	sess, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start SSH session on %s: %w", addr, err)
+	}
+	defer sess.Close()
+
+	var stdout, stderr bytes.Buffer
+	sess.Stdin = bytes.NewReader(in)
+	sess.Stdout = &stdout
+	sess.Stderr = &stderr
+
+	done := make(chan error, 1)
+	go func() { done <- sess.Run(cmd) }()
+
+	select {
+	case <-ctx.Done():
+		_ = client.Close()
+		return nil, ctx.Err()
+	case err := <-done:
+		if err != nil {
+			return nil, fmt.Errorf("command failed on %s: %w: %s", addr, err, strings.TrimSpace(stderr.String()))
+		}
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// read returns the content of the remote file.
+func (f *remoteFile) read(ctx context.Context) ([]byte, error) {
+	p := shellQuote(f.path)
+	return f.run(ctx, "if [ -e "+p+" ]; then cat -- "+p+"; fi", nil)
+}
+
+// write replaces the remote file by writing a temporary file alongside it and
+// renaming it into place.
+func (f *remoteFile) write(ctx context.Context, data []byte) error {
+	p := shellQuote(f.path)
+	tmp := shellQuote(f.path + ".garotate")
+	_, err := f.run(ctx, "umask 077 && cat > "+tmp+" && mv -f -- "+tmp+" "+p, data)
+	return err
+}
@@ -0,0 +1,47 @@
+package pair
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+)
+
+// builder implements the plugin.Builder interface and provides the factory
+// method for constructing a Client.
+type builder struct{}
+
+// Build constructs and returns an SSH keypair client.
+func (b *builder) Build(
+	ctx context.Context,
+	c *config.Plugin,
+) (plugin.Instance, error) {
+	plugins := plugin.ManagerFrom(ctx)
+	if plugins == nil {
+		return nil, errors.New("the SSH keypair plugin must be built by a plugin manager to find the storages it checks")
+	}
+
+	opts := DefaultOptions()
+	err := c.DecodeOptions(&opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH keypair plugin options: %w", err)
+	}
+
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid SSH keypair plugin options: %w", err)
+	}
+
+	return &Client{
+		plugins:  plugins,
+		defaults: opts,
+	}, nil
+}
+
+// init registers the plugin.
+func init() {
+	pkg := reflect.TypeOf(Client{}).PkgPath()
+	plugin.Register(pkg, new(builder))
+}
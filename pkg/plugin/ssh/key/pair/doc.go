@@ -0,0 +1,5 @@
+// Package pair provides a plugin which implements the rotate.Client and is used
+// to generate SSH keypairs. The private key is meant for CI storages and the
+// public key for an authorized_keys file, such as one managed by the
+// github.com/zostay/garotate/pkg/plugin/ssh/authorizedkeys/entry plugin.
+package pair
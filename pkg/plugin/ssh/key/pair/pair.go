@@ -0,0 +1,202 @@
+package pair
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/rotate"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+const (
+	// PrivateKey is the key the private key is returned under in OpenSSH
+	// format.
+	PrivateKey = "SSH_PRIVATE_KEY"
+
+	// PublicKey is the key the public key is returned under in
+	// authorized_keys format.
+	PublicKey = "SSH_PUBLIC_KEY"
+
+	// TypeEd25519 generates Ed25519 keys.
+	TypeEd25519 = "ed25519"
+
+	// TypeRSA generates RSA keys.
+	TypeRSA = "rsa"
+
+	// CommentPrefix begins the comment of every key generated. It is followed
+	// by the secret name.
+	CommentPrefix = "garotate:"
+)
+
+// Options are the options for generating keys. They may be set on the plugin
+// and overridden on each secret.
+type Options struct {
+	// Type is the type of key to generate, either TypeEd25519 or TypeRSA.
+	Type string `mapstructure:"type"`
+
+	// Bits is the size of RSA keys.
+	Bits int `mapstructure:"bits"`
+}
+
+// DefaultOptions returns the default options, which generate Ed25519 keys.
+func DefaultOptions() Options {
+	return Options{
+		Type: TypeEd25519,
+		Bits: 4096,
+	}
+}
+
+// Validate returns an error if the options cannot be used to generate keys.
+func (o *Options) Validate() error {
+	switch o.Type {
+	case TypeEd25519:
+	case TypeRSA:
+		if o.Bits < 2048 {
+			return fmt.Errorf("RSA keys must be at least 2048 bits, not %d", o.Bits)
+		}
+	default:
+		return fmt.Errorf("unknown key type %q", o.Type)
+	}
+	return nil
+}
+
+// Client implements the rotate.Client interface by generating SSH keypairs.
+// As there is no upstream service that knows when a keypair was generated,
+// the storages of each secret are consulted instead.
+type Client struct {
+	plugins  *plugin.Manager
+	defaults Options
+}
+
+// Name returns "SSH keypair generator".
+func (c *Client) Name() string {
+	return "SSH keypair generator"
+}
+
+// Keys returns the SSH_PRIVATE_KEY and SSH_PUBLIC_KEY keys.
+func (c *Client) Keys() secret.Map {
+	return secret.Map{
+		PrivateKey: "",
+		PublicKey:  "",
+	}
+}
+
+// options returns the options for the secret, which are the default options of
+// the plugin overridden by any options set on the secret.
+func (c *Client) options(sec secret.Info) (Options, error) {
+	o := c.defaults
+
+	if so, ok := sec.(secret.Options); ok {
+		if err := so.DecodeOptions(&o); err != nil {
+			return Options{}, fmt.Errorf("failed to read SSH keypair options of secret %q: %w", sec.Name(), err)
+		}
+	}
+
+	if err := o.Validate(); err != nil {
+		return Options{}, fmt.Errorf("invalid SSH keypair options for secret %q: %w", sec.Name(), err)
+	}
+
+	return o, nil
+}
+
+// LastRotated returns the earliest of the times the keys were last saved to
+// the storages of the secret, which is the nearest to when the keypair was
+// generated. If they have never been saved, the zero time is returned, which
+// will cause rotation.
+func (c *Client) LastRotated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	return rotate.LastStored(ctx, c.plugins, c.Keys(), sec)
+}
+
+// Keypair is a generated SSH keypair.
+type Keypair struct {
+	// PrivateKey is the private key in OpenSSH format.
+	PrivateKey string
+
+	// PublicKey is the public key in authorized_keys format, including the
+	// comment.
+	PublicKey string
+
+	// Fingerprint is the SHA-256 fingerprint of the public key.
+	Fingerprint string
+}
+
+// Generate generates a new keypair according to the options. The comment is
+// set on both keys.
+func Generate(o Options, comment string) (*Keypair, error) {
+	var (
+		key crypto.PrivateKey
+		err error
+	)
+	switch o.Type {
+	case TypeRSA:
+		key, err = rsa.GenerateKey(rand.Reader, o.Bits)
+	default:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := ssh.MarshalPrivateKey(key, comment)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	pub := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+
+	return &Keypair{
+		PrivateKey:  string(pem.EncodeToMemory(block)),
+		PublicKey:   pub + " " + comment,
+		Fingerprint: ssh.FingerprintSHA256(signer.PublicKey()),
+	}, nil
+}
+
+// RotateSecret generates a new keypair. The comment of both keys names the
+// secret.
+func (c *Client) RotateSecret(
+	ctx context.Context,
+	sec secret.Info,
+) (secret.Map, error) {
+	o, err := c.options(sec)
+	if err != nil {
+		return secret.Map{}, err
+	}
+
+	kp, err := Generate(o, CommentPrefix+sec.Name())
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to generate SSH key for secret %q: %w", sec.Name(), err)
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Infow(
+		"generated new SSH keypair",
+		"secret", sec.Name(),
+		"client", c.Name(),
+		"type", o.Type,
+		"fingerprint", kp.Fingerprint,
+	)
+
+	return secret.Map{
+		PrivateKey: kp.PrivateKey,
+		PublicKey:  kp.PublicKey,
+	}, nil
+}
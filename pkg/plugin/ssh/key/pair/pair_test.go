@@ -0,0 +1,41 @@
+package pair
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/zostay/garotate/pkg/config"
+)
+
+func TestRotateSecret(t *testing.T) {
+	c := &Client{defaults: DefaultOptions()}
+
+	for _, typ := range []string{TypeEd25519, TypeRSA} {
+		sec := &config.Secret{
+			SecretName: "deploy",
+			Options:    map[string]any{"type": typ, "bits": 2048},
+		}
+
+		keys, err := c.RotateSecret(context.Background(), sec)
+		require.NoError(t, err, typ)
+
+		signer, err := ssh.ParsePrivateKey([]byte(keys[PrivateKey]))
+		require.NoError(t, err, "%s private key parses", typ)
+
+		pub, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(keys[PublicKey]))
+		require.NoError(t, err, "%s public key parses", typ)
+		assert.Equal(t, "garotate:deploy", comment, "%s public key comment", typ)
+		assert.True(t, bytes.Equal(signer.PublicKey().Marshal(), pub.Marshal()), "%s keys match", typ)
+	}
+
+	_, err := c.RotateSecret(context.Background(), &config.Secret{
+		SecretName: "deploy",
+		Options:    map[string]any{"type": TypeRSA, "bits": 1024},
+	})
+	assert.Error(t, err, "small RSA keys are refused")
+}
@@ -0,0 +1,168 @@
+package cert
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+)
+
+// DefaultCRLValidity is how long a published CRL is valid for if no
+// crl_validity is configured.
+const DefaultCRLValidity = 7 * 24 * time.Hour
+
+// builder implements the plugin.Builder interface and provides the factory
+// method for constructing a Client.
+type builder struct{}
+
+// options are the plugin options accepted in the configuration. The options
+// for the certificates issued may be set here as defaults.
+type options struct {
+	CACertFile  string        `mapstructure:"ca_cert_file"`
+	CAKeyFile   string        `mapstructure:"ca_key_file"`
+	StateDir    string        `mapstructure:"state_dir"`
+	CRLFile     string        `mapstructure:"crl_file"`
+	CRLValidity time.Duration `mapstructure:"crl_validity"`
+
+	Options `mapstructure:",squash"`
+}
+
+// readPEM reads the first PEM block of the given type from the file.
+func readPEM(file, typ string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("no %s PEM block found in %q", typ, file)
+		}
+
+		if block.Type == typ {
+			return block.Bytes, nil
+		}
+	}
+}
+
+// readKey reads a PKCS #8, PKCS #1, or SEC 1 private key from the file.
+func readKey(file string) (crypto.Signer, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in %q", file)
+	}
+
+	var key any
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q in %q", block.Type, file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		return k, nil
+	case ed25519.PrivateKey:
+		return k, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T in %q", key, file)
+	}
+}
+
+// Build constructs and returns a local CA certificate client.
+func (b *builder) Build(
+	ctx context.Context,
+	c *config.Plugin,
+) (plugin.Instance, error) {
+	opts := options{
+		CRLValidity: DefaultCRLValidity,
+		Options:     DefaultOptions(),
+	}
+	err := c.DecodeOptions(&opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TLS CA plugin options: %w", err)
+	}
+
+	if opts.CACertFile == "" || opts.CAKeyFile == "" {
+		return nil, errors.New("the TLS CA plugin requires the ca_cert_file and ca_key_file options")
+	}
+
+	if opts.StateDir == "" {
+		return nil, errors.New("the TLS CA plugin requires a state_dir option to keep the certificates it issues")
+	}
+
+	if opts.CRLValidity <= 0 {
+		return nil, fmt.Errorf("the TLS CA plugin crl_validity option must be positive, but got %s", opts.CRLValidity)
+	}
+
+	if err := opts.Options.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid TLS CA plugin options: %w", err)
+	}
+
+	der, err := readPEM(opts.CACertFile, "CERTIFICATE")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TLS CA certificate: %w", err)
+	}
+
+	caCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse TLS CA certificate %q: %w", opts.CACertFile, err)
+	}
+
+	if !caCert.IsCA {
+		return nil, fmt.Errorf("the TLS CA certificate %q is not a CA certificate", opts.CACertFile)
+	}
+
+	caKey, err := readKey(opts.CAKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TLS CA private key: %w", err)
+	}
+
+	pub, ok := caKey.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(caCert.PublicKey) {
+		return nil, fmt.Errorf("the TLS CA private key %q does not match the certificate %q", opts.CAKeyFile, opts.CACertFile)
+	}
+
+	return &Client{
+		caCert:      caCert,
+		caKey:       caKey,
+		stateDir:    opts.StateDir,
+		crlFile:     opts.CRLFile,
+		crlValidity: opts.CRLValidity,
+		defaults:    opts.Options,
+	}, nil
+}
+
+// init registers the plugin.
+func init() {
+	pkg := reflect.TypeOf(Client{}).PkgPath()
+	plugin.Register(pkg, new(builder))
+}
@@ -0,0 +1,636 @@
+package cert
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin/internal/atomicfile"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+const (
+	// CertKey is the key the new certificate is returned under in PEM format.
+	CertKey = "TLS_CERT"
+
+	// KeyKey is the key the new private key is returned under in PKCS #8 PEM
+	// format.
+	KeyKey = "TLS_KEY"
+
+	// CAKey is the key the CA certificate is returned under in PEM format.
+	CAKey = "TLS_CA"
+
+	// TypeECDSA generates ECDSA keys on the P-256 curve.
+	TypeECDSA = "ecdsa"
+
+	// TypeEd25519 generates Ed25519 keys.
+	TypeEd25519 = "ed25519"
+
+	// TypeRSA generates RSA keys.
+	TypeRSA = "rsa"
+)
+
+// revokedAtHeader is the PEM header recording when a certificate in the
+// revoked directory was revoked.
+const revokedAtHeader = "Revoked-At"
+
+// Options are the options for issuing certificates. They may be set on the
+// plugin and overridden on each secret.
+type Options struct {
+	// KeyType is the type of key to generate, TypeECDSA, TypeEd25519, or
+	// TypeRSA.
+	KeyType string `mapstructure:"key_type"`
+
+	// Bits is the size of RSA keys.
+	Bits int `mapstructure:"bits"`
+
+	// TTL is how long each certificate is valid. Certificates never outlive
+	// the CA certificate.
+	TTL time.Duration `mapstructure:"ttl"`
+
+	// CommonName is the common name of the subject. If it is empty, the secret
+	// name is used.
+	CommonName string `mapstructure:"common_name"`
+
+	// Organization is the organization of the subject.
+	Organization []string `mapstructure:"organization"`
+
+	// OrganizationalUnit is the organizational unit of the subject.
+	OrganizationalUnit []string `mapstructure:"organizational_unit"`
+
+	// DNSNames are the DNS subject alternative names.
+	DNSNames []string `mapstructure:"dns_names"`
+
+	// IPAddresses are the IP address subject alternative names.
+	IPAddresses []string `mapstructure:"ip_addresses"`
+
+	// EmailAddresses are the email subject alternative names.
+	EmailAddresses []string `mapstructure:"email_addresses"`
+
+	// URIs are the URI subject alternative names, such as SPIFFE IDs.
+	URIs []string `mapstructure:"uris"`
+}
+
+// DefaultOptions returns the default options, which issue certificates for
+// ECDSA keys valid for 30 days.
+func DefaultOptions() Options {
+	return Options{
+		KeyType: TypeECDSA,
+		Bits:    2048,
+		TTL:     30 * 24 * time.Hour,
+	}
+}
+
+// Validate returns an error if the options cannot be used to issue
+// certificates.
+func (o *Options) Validate() error {
+	switch o.KeyType {
+	case TypeECDSA, TypeEd25519:
+	case TypeRSA:
+		if o.Bits < 2048 {
+			return fmt.Errorf("RSA keys must be at least 2048 bits, not %d", o.Bits)
+		}
+	default:
+		return fmt.Errorf("unknown key type %q", o.KeyType)
+	}
+
+	if o.TTL <= 0 {
+		return fmt.Errorf("the ttl must be positive, not %s", o.TTL)
+	}
+
+	for _, ip := range o.IPAddresses {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid IP address %q", ip)
+		}
+	}
+
+	for _, u := range o.URIs {
+		if _, err := url.Parse(u); err != nil {
+			return fmt.Errorf("invalid URI %q: %w", u, err)
+		}
+	}
+
+	return nil
+}
+
+// Client implements the rotate.Client and disable.Client interfaces for
+// issuing TLS client certificates from a local CA. The secret name is the
+// common name of the certificate unless one is configured.
+//
+// The CA keeps no database of its own, so every certificate issued is kept in
+// the state directory, under issued/ in a directory named for the secret, and
+// the newest of them is the current certificate. Disablement moves the others
+// to revoked/ and publishes them all in the CRL file, if one is configured.
+type Client struct {
+	caCert      *x509.Certificate
+	caKey       crypto.Signer
+	stateDir    string
+	crlFile     string
+	crlValidity time.Duration
+	defaults    Options
+}
+
+// Name returns "TLS CA certificates".
+func (c *Client) Name() string {
+	return "TLS CA certificates"
+}
+
+// Keys returns the TLS_CERT, TLS_KEY, and TLS_CA keys.
+func (c *Client) Keys() secret.Map {
+	return secret.Map{
+		CertKey: "",
+		KeyKey:  "",
+		CAKey:   "",
+	}
+}
+
+// options returns the options for the secret, which are the default options of
+// the plugin overridden by any options set on the secret.
+func (c *Client) options(sec secret.Info) (Options, error) {
+	o := c.defaults
+
+	if so, ok := sec.(secret.Options); ok {
+		if err := so.DecodeOptions(&o); err != nil {
+			return Options{}, fmt.Errorf("failed to read TLS certificate options of secret %q: %w", sec.Name(), err)
+		}
+	}
+
+	if err := o.Validate(); err != nil {
+		return Options{}, fmt.Errorf("invalid TLS certificate options for secret %q: %w", sec.Name(), err)
+	}
+
+	return o, nil
+}
+
+// issuedDir returns the directory the certificates issued for the secret are
+// kept in.
+func (c *Client) issuedDir(sec secret.Info) (string, error) {
+	name := url.PathEscape(sec.Name())
+	if name == "" || name == "." || name == ".." {
+		return "", fmt.Errorf("the secret name %q cannot be used as a TLS certificate name", sec.Name())
+	}
+
+	return filepath.Join(c.stateDir, "issued", name), nil
+}
+
+// revokedDir returns the directory revoked certificates are kept in.
+func (c *Client) revokedDir() string {
+	return filepath.Join(c.stateDir, "revoked")
+}
+
+// serialFile returns the name of the file a certificate is kept in.
+func serialFile(cert *x509.Certificate) string {
+	return cert.SerialNumber.Text(16) + ".pem"
+}
+
+// record is a certificate kept in the state directory.
+type record struct {
+	file    string
+	modTime time.Time
+	cert    *x509.Certificate
+	headers map[string]string
+}
+
+// readRecords reads the certificates kept in the directory, sorted from
+// oldest to newest. Certificates only record NotBefore to the second, so ties
+// are broken by when the records were written. A missing directory holds none.
+func readRecords(dir string) ([]*record, error) {
+	ents, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	recs := make([]*record, 0, len(ents))
+	for _, ent := range ents {
+		if ent.IsDir() || !strings.HasSuffix(ent.Name(), ".pem") {
+			continue
+		}
+
+		file := filepath.Join(dir, ent.Name())
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		block, _ := pem.Decode(data)
+		if block == nil || block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("no certificate found in %q", file)
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate %q: %w", file, err)
+		}
+
+		info, err := ent.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		recs = append(recs, &record{file, info.ModTime(), cert, block.Headers})
+	}
+
+	sort.Slice(recs, func(i, j int) bool {
+		a, b := recs[i].cert, recs[j].cert
+		if !a.NotBefore.Equal(b.NotBefore) {
+			return a.NotBefore.Before(b.NotBefore)
+		}
+		if !recs[i].modTime.Equal(recs[j].modTime) {
+			return recs[i].modTime.Before(recs[j].modTime)
+		}
+		return a.SerialNumber.Cmp(b.SerialNumber) < 0
+	})
+
+	return recs, nil
+}
+
+// issued returns the certificates issued for the secret that have not been
+// revoked, sorted from oldest to newest.
+func (c *Client) issued(sec secret.Info) ([]*record, error) {
+	dir, err := c.issuedDir(sec)
+	if err != nil {
+		return nil, err
+	}
+
+	recs, err := readRecords(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TLS certificates issued for secret %q: %w", sec.Name(), err)
+	}
+
+	return recs, nil
+}
+
+// LastRotated returns the NotBefore time of the current certificate of the
+// secret. If none has been issued, the zero time is returned.
+func (c *Client) LastRotated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	recs, err := c.issued(sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if len(recs) == 0 {
+		return time.Time{}, nil
+	}
+
+	return recs[len(recs)-1].cert.NotBefore, nil
+}
+
+// generateKey generates a new private key according to the options.
+func generateKey(o Options) (crypto.Signer, error) {
+	switch o.KeyType {
+	case TypeRSA:
+		return rsa.GenerateKey(rand.Reader, o.Bits)
+	case TypeEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+}
+
+// template returns the certificate to be signed for the secret.
+func (c *Client) template(sec secret.Info, o Options, now time.Time) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	cn := o.CommonName
+	if cn == "" {
+		cn = sec.Name()
+	}
+
+	notAfter := now.Add(o.TTL)
+	if notAfter.After(c.caCert.NotAfter) {
+		notAfter = c.caCert.NotAfter
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:         cn,
+			Organization:       o.Organization,
+			OrganizationalUnit: o.OrganizationalUnit,
+		},
+		NotBefore:      now,
+		NotAfter:       notAfter,
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		DNSNames:       o.DNSNames,
+		EmailAddresses: o.EmailAddresses,
+	}
+
+	if o.KeyType == TypeRSA {
+		tmpl.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+
+	for _, ip := range o.IPAddresses {
+		tmpl.IPAddresses = append(tmpl.IPAddresses, net.ParseIP(ip))
+	}
+
+	for _, u := range o.URIs {
+		pu, _ := url.Parse(u)
+		tmpl.URIs = append(tmpl.URIs, pu)
+	}
+
+	return tmpl, nil
+}
+
+// RotateSecret generates a new private key and issues a certificate for it,
+// which becomes the current certificate of the secret. Certificates previously
+// issued remain valid until they expire or are revoked by disablement. The
+// records of any that have expired are removed.
+func (c *Client) RotateSecret(
+	ctx context.Context,
+	sec secret.Info,
+) (secret.Map, error) {
+	o, err := c.options(sec)
+	if err != nil {
+		return secret.Map{}, err
+	}
+
+	dir, err := c.issuedDir(sec)
+	if err != nil {
+		return secret.Map{}, err
+	}
+
+	key, err := generateKey(o)
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to generate TLS key for secret %q: %w", sec.Name(), err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	tmpl, err := c.template(sec, o, now)
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to generate TLS certificate serial number for secret %q: %w", sec.Name(), err)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, c.caCert, key.Public(), c.caKey)
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to sign TLS certificate for secret %q: %w", sec.Name(), err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to parse TLS certificate issued for secret %q: %w", sec.Name(), err)
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to encode TLS key for secret %q: %w", sec.Name(), err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	err = os.MkdirAll(dir, 0o700)
+	if err == nil {
+		err = atomicfile.WriteFile(filepath.Join(dir, serialFile(cert)), certPEM, 0o600)
+	}
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to record TLS certificate issued for secret %q: %w", sec.Name(), err)
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Infow(
+		"issued TLS certificate",
+		"secret", sec.Name(),
+		"client", c.Name(),
+		"serial", cert.SerialNumber.Text(16),
+		"not_after", cert.NotAfter,
+	)
+
+	recs, err := c.issued(sec)
+	if err == nil {
+		for _, rec := range recs {
+			if now.After(rec.cert.NotAfter) {
+				err = os.Remove(rec.file)
+				if err != nil {
+					break
+				}
+			}
+		}
+	}
+	if err != nil {
+		logger.Warnw(
+			"failed to remove records of expired TLS certificates",
+			"secret", sec.Name(),
+			"client", c.Name(),
+			"error", err,
+		)
+	}
+
+	return secret.Map{
+		CertKey: string(certPEM),
+		KeyKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})),
+		CAKey:   string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.caCert.Raw})),
+	}, nil
+}
+
+// LastUpdated returns the NotBefore time of the current certificate of the
+// secret, which is when the older certificates became inactive. If there is
+// only one certificate, or no CRL file is configured to publish revocations
+// in, there is nothing to disable.
+func (c *Client) LastUpdated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	if c.crlFile == "" {
+		return time.Time{}, disable.ErrNothingToDisable
+	}
+
+	recs, err := c.issued(sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if len(recs) < 2 {
+		return time.Time{}, disable.ErrNothingToDisable
+	}
+
+	return recs[len(recs)-1].cert.NotBefore, nil
+}
+
+// Refresh publishes the CRL again if it is due, so that it does not expire
+// while there is nothing new to revoke. It is called on every disablement run.
+func (c *Client) Refresh(ctx context.Context) error {
+	if c.crlFile == "" {
+		return nil
+	}
+
+	now := time.Now().Truncate(time.Second)
+	due, err := c.crlDue(now)
+	if err != nil {
+		return fmt.Errorf("failed to read TLS CRL %q: %w", c.crlFile, err)
+	}
+
+	if !due {
+		return nil
+	}
+
+	if err := c.publishCRL(now); err != nil {
+		return fmt.Errorf("failed to publish TLS CRL %q: %w", c.crlFile, err)
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Infow(
+		"refreshed TLS CRL",
+		"client", c.Name(),
+		"crl_file", c.crlFile,
+	)
+
+	return nil
+}
+
+// crlDue reports whether the CRL should be published again because it has not
+// been published yet, cannot be read, or has less than half of its validity
+// left.
+func (c *Client) crlDue(now time.Time) (bool, error) {
+	data, err := os.ReadFile(c.crlFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	crl, err := x509.ParseCRL(data) //nolint:staticcheck // ParseRevocationList needs Go 1.19
+	if err != nil {
+		return true, nil
+	}
+
+	return crl.TBSCertList.NextUpdate.Sub(now) < c.crlValidity/2, nil
+}
+
+// publishCRL signs a CRL listing every revoked certificate that has not yet
+// expired and writes it to the CRL file. Expired certificates need not be
+// listed, so their records are removed.
+func (c *Client) publishCRL(now time.Time) error {
+	recs, err := readRecords(c.revokedDir())
+	if err != nil {
+		return err
+	}
+
+	revoked := make([]pkix.RevokedCertificate, 0, len(recs))
+	for _, rec := range recs {
+		if now.After(rec.cert.NotAfter) {
+			if err := os.Remove(rec.file); err != nil {
+				return err
+			}
+			continue
+		}
+
+		at, err := time.Parse(time.RFC3339, rec.headers[revokedAtHeader])
+		if err != nil {
+			return fmt.Errorf("failed to read revocation time of %q: %w", rec.file, err)
+		}
+
+		revoked = append(revoked, pkix.RevokedCertificate{
+			SerialNumber:   rec.cert.SerialNumber,
+			RevocationTime: at,
+		})
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:              big.NewInt(now.UnixNano()),
+		ThisUpdate:          now,
+		NextUpdate:          now.Add(c.crlValidity),
+		RevokedCertificates: revoked,
+	}, c.caCert, c.caKey)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.crlFile), 0o700); err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(c.crlFile, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0o644)
+}
+
+// DisableSecret revokes every certificate issued for the secret except the
+// current one and publishes the CRL. Certificates that have already expired
+// are forgotten instead.
+func (c *Client) DisableSecret(
+	ctx context.Context,
+	sec secret.Info,
+) error {
+	if c.crlFile == "" {
+		return fmt.Errorf("the TLS CA plugin requires a crl_file option to revoke the certificates of secret %q", sec.Name())
+	}
+
+	recs, err := c.issued(sec)
+	if err != nil {
+		return err
+	}
+
+	if len(recs) < 2 {
+		return nil
+	}
+
+	now := time.Now().Truncate(time.Second)
+	old := recs[:len(recs)-1]
+	for _, rec := range old {
+		if now.After(rec.cert.NotAfter) {
+			continue
+		}
+
+		data := pem.EncodeToMemory(&pem.Block{
+			Type:    "CERTIFICATE",
+			Headers: map[string]string{revokedAtHeader: now.Format(time.RFC3339)},
+			Bytes:   rec.cert.Raw,
+		})
+		err := os.MkdirAll(c.revokedDir(), 0o700)
+		if err == nil {
+			err = atomicfile.WriteFile(filepath.Join(c.revokedDir(), serialFile(rec.cert)), data, 0o600)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to revoke TLS certificate %s of secret %q: %w", rec.cert.SerialNumber.Text(16), sec.Name(), err)
+		}
+	}
+
+	if err := c.publishCRL(now); err != nil {
+		return fmt.Errorf("failed to publish TLS CRL %q: %w", c.crlFile, err)
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	for _, rec := range old {
+		if err := os.Remove(rec.file); err != nil {
+			return fmt.Errorf("failed to remove record of TLS certificate %s of secret %q: %w", rec.cert.SerialNumber.Text(16), sec.Name(), err)
+		}
+
+		if now.After(rec.cert.NotAfter) {
+			continue
+		}
+
+		logger.Infow(
+			"revoked TLS certificate",
+			"secret", sec.Name(),
+			"client", c.Name(),
+			"serial", rec.cert.SerialNumber.Text(16),
+		)
+	}
+
+	return nil
+}
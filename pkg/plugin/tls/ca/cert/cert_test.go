@@ -0,0 +1,256 @@
+package cert
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin"
+)
+
+// writeCA generates a CA keypair in the directory and returns the names of the
+// certificate and key files.
+func writeCA(t *testing.T, dir string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test CA"},
+	}, key.Public(), key)
+	require.NoError(t, err)
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "ca.pem")
+	keyFile := filepath.Join(dir, "ca-key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), 0o600))
+
+	return certFile, keyFile
+}
+
+// parseCert parses a PEM certificate.
+func parseCert(t *testing.T, data string) *x509.Certificate {
+	t.Helper()
+
+	block, _ := pem.Decode([]byte(data))
+	require.NotNil(t, block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestRotateAndDisable(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	caCert, caKey := writeCA(t, dir)
+	crlFile := filepath.Join(dir, "ca.crl")
+
+	inst, err := plugin.Build(ctx, &config.Plugin{
+		Name:    "tls",
+		Package: "github.com/zostay/garotate/pkg/plugin/tls/ca/cert",
+		Options: map[string]any{
+			"ca_cert_file": caCert,
+			"ca_key_file":  caKey,
+			"state_dir":    filepath.Join(dir, "state"),
+			"crl_file":     crlFile,
+			"organization": []string{"Example"},
+			"ttl":          "72h",
+		},
+	})
+	require.NoError(t, err)
+	c := inst.(*Client)
+
+	sec := &config.Secret{
+		SecretName: "billing",
+		Options: map[string]any{
+			"key_type":     TypeEd25519,
+			"dns_names":    []string{"billing.example.com"},
+			"ip_addresses": []string{"10.0.0.1"},
+			"uris":         []string{"spiffe://example.com/billing"},
+		},
+	}
+
+	last, err := c.LastRotated(ctx, sec)
+	require.NoError(t, err)
+	assert.True(t, last.IsZero(), "never rotated")
+
+	first, err := c.RotateSecret(ctx, sec)
+	require.NoError(t, err)
+
+	ca := parseCert(t, first[CAKey])
+	cert := parseCert(t, first[CertKey])
+	assert.Equal(t, "billing", cert.Subject.CommonName)
+	assert.Equal(t, []string{"Example"}, cert.Subject.Organization)
+	assert.Equal(t, []string{"billing.example.com"}, cert.DNSNames)
+	assert.Equal(t, "10.0.0.1", cert.IPAddresses[0].String())
+	assert.Equal(t, "spiffe://example.com/billing", cert.URIs[0].String())
+	assert.WithinDuration(t, cert.NotBefore.Add(72*time.Hour), cert.NotAfter, time.Second, "ttl")
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	assert.NoError(t, err, "client certificate verifies")
+
+	block, _ := pem.Decode([]byte(first[KeyKey]))
+	require.NotNil(t, block)
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	require.NoError(t, err)
+	assert.True(t, cert.PublicKey.(interface{ Equal(crypto.PublicKey) bool }).Equal(key.(crypto.Signer).Public()), "key matches")
+
+	last, err = c.LastRotated(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, cert.NotBefore, last)
+
+	_, err = c.LastUpdated(ctx, sec)
+	assert.ErrorIs(t, err, disable.ErrNothingToDisable, "nothing to disable")
+
+	second, err := c.RotateSecret(ctx, sec)
+	require.NoError(t, err)
+	current := parseCert(t, second[CertKey])
+
+	last, err = c.LastRotated(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, current.NotBefore, last)
+
+	updated, err := c.LastUpdated(ctx, sec)
+	require.NoError(t, err)
+	assert.Equal(t, current.NotBefore, updated, "old certificate to disable")
+
+	require.NoError(t, c.DisableSecret(ctx, sec))
+
+	crl := readCRL(t, crlFile, ca)
+	require.Len(t, crl.TBSCertList.RevokedCertificates, 1)
+	assert.Equal(t, cert.SerialNumber, crl.TBSCertList.RevokedCertificates[0].SerialNumber, "old certificate revoked")
+
+	recs, err := c.issued(sec)
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	assert.Equal(t, current.SerialNumber, recs[0].cert.SerialNumber, "current certificate kept")
+
+	_, err = c.LastUpdated(ctx, sec)
+	assert.ErrorIs(t, err, disable.ErrNothingToDisable, "nothing left to disable")
+}
+
+func TestOptions(t *testing.T) {
+	o := DefaultOptions()
+	assert.NoError(t, o.Validate())
+
+	o = DefaultOptions()
+	o.KeyType = TypeRSA
+	o.Bits = 1024
+	assert.Error(t, o.Validate(), "small RSA keys are refused")
+
+	o = DefaultOptions()
+	o.IPAddresses = []string{"not-an-ip"}
+	assert.Error(t, o.Validate(), "bad IP address")
+
+	c := &Client{stateDir: t.TempDir()}
+	_, err := c.issuedDir(&config.Secret{SecretName: ".."})
+	assert.Error(t, err, "no escaping the state directory")
+
+	dir, err := c.issuedDir(&config.Secret{SecretName: "team/app"})
+	require.NoError(t, err)
+	assert.Equal(t, "team%2Fapp", filepath.Base(dir))
+}
+
+// readCRL reads and checks the signature of the CRL file.
+func readCRL(t *testing.T, crlFile string, ca *x509.Certificate) *pkix.CertificateList {
+	t.Helper()
+
+	data, err := os.ReadFile(crlFile)
+	require.NoError(t, err)
+	crl, err := x509.ParseCRL(data) //nolint:staticcheck // ParseRevocationList needs Go 1.19
+	require.NoError(t, err)
+	require.NoError(t, ca.CheckCRLSignature(crl), "CRL signed by CA")
+	return crl
+}
+
+func TestRefreshCRL(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	caCert, caKey := writeCA(t, dir)
+	crlFile := filepath.Join(dir, "ca.crl")
+
+	inst, err := plugin.Build(ctx, &config.Plugin{
+		Name:    "tls",
+		Package: "github.com/zostay/garotate/pkg/plugin/tls/ca/cert",
+		Options: map[string]any{
+			"ca_cert_file": caCert,
+			"ca_key_file":  caKey,
+			"state_dir":    filepath.Join(dir, "state"),
+			"crl_file":     crlFile,
+			"crl_validity": "4h",
+		},
+	})
+	require.NoError(t, err)
+	c := inst.(*Client)
+
+	sec := &config.Secret{SecretName: "billing"}
+	keys, err := c.RotateSecret(ctx, sec)
+	require.NoError(t, err)
+	ca := parseCert(t, keys[CAKey])
+
+	_, err = c.LastUpdated(ctx, sec)
+	assert.ErrorIs(t, err, disable.ErrNothingToDisable, "one certificate, nothing to disable")
+
+	var refresher disable.Refresher = c
+	require.NoError(t, refresher.Refresh(ctx))
+	crl := readCRL(t, crlFile, ca)
+	assert.Empty(t, crl.TBSCertList.RevokedCertificates, "nothing revoked")
+	assert.WithinDuration(t, time.Now().Add(4*time.Hour), crl.TBSCertList.NextUpdate, time.Minute, "CRL published")
+
+	fi, err := os.Stat(crlFile)
+	require.NoError(t, err)
+	stamp := fi.ModTime().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(crlFile, stamp, stamp))
+	require.NoError(t, c.Refresh(ctx))
+	fi, err = os.Stat(crlFile)
+	require.NoError(t, err)
+	assert.Equal(t, stamp, fi.ModTime(), "fresh CRL left alone")
+
+	// with a longer validity, the published CRL has less than half left
+	c.crlValidity = 10 * time.Hour
+	require.NoError(t, c.Refresh(ctx))
+	crl = readCRL(t, crlFile, ca)
+	assert.Empty(t, crl.TBSCertList.RevokedCertificates, "still nothing revoked")
+	assert.WithinDuration(t, time.Now().Add(10*time.Hour), crl.TBSCertList.NextUpdate, time.Minute, "CRL refreshed")
+
+	recs, err := c.issued(sec)
+	require.NoError(t, err)
+	assert.Len(t, recs, 1, "current certificate kept")
+
+	require.NoError(t, os.WriteFile(crlFile, []byte("garbage"), 0o644))
+	require.NoError(t, c.Refresh(ctx))
+	readCRL(t, crlFile, ca)
+}
@@ -0,0 +1,6 @@
+// Package cert provides a plugin which implements the rotate.Client and
+// disable.Client and is used to issue TLS client certificates from a local
+// certificate authority. Each rotation generates a new private key and signs a
+// certificate for it with the CA keypair. Disablement revokes the certificates
+// replaced by rotation and publishes them in a certificate revocation list.
+package cert
@@ -0,0 +1,96 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/plugin/internal/sealbox"
+)
+
+// builder implements the plugin.Builder interface and provides the factory
+// method for constructing a Client.
+type builder struct{}
+
+// options are the plugin options accepted in the configuration.
+type options struct {
+	URL        string        `mapstructure:"url"`
+	HMACSecret string        `mapstructure:"hmac_secret"`
+	PublicKey  string        `mapstructure:"public_key"`
+	Retries    int           `mapstructure:"retries"`
+	RetryWait  time.Duration `mapstructure:"retry_wait"`
+	Timeout    time.Duration `mapstructure:"timeout"`
+	Insecure   bool          `mapstructure:"insecure"`
+}
+
+// defaults provides sane defaults for the retry and timeout options.
+var (
+	defaultRetries   = 3
+	defaultRetryWait = time.Second
+	defaultTimeout   = 30 * time.Second
+)
+
+// Build constructs and returns a webhook client.
+func (b *builder) Build(
+	ctx context.Context,
+	c *config.Plugin,
+) (plugin.Instance, error) {
+	opts := options{
+		Retries:   defaultRetries,
+		RetryWait: defaultRetryWait,
+		Timeout:   defaultTimeout,
+	}
+	err := c.DecodeOptions(&opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook plugin options: %w", err)
+	}
+
+	u, err := url.Parse(opts.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("the webhook plugin requires a url option naming the endpoint, but got %q", opts.URL)
+	}
+	if u.Scheme != "https" && !opts.Insecure {
+		return nil, fmt.Errorf("the webhook endpoint %q must use https", opts.URL)
+	}
+
+	if opts.HMACSecret == "" {
+		opts.HMACSecret = os.Getenv("WEBHOOK_HMAC_SECRET")
+	}
+	if opts.HMACSecret == "" {
+		return nil, errors.New("the webhook plugin requires an hmac_secret option or WEBHOOK_HMAC_SECRET environment variable")
+	}
+
+	var pk []byte
+	if opts.PublicKey != "" {
+		pk, err = base64.StdEncoding.DecodeString(opts.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode webhook public key: %w", err)
+		}
+		if len(pk) != sealbox.KeySize {
+			return nil, fmt.Errorf("webhook public key must be %d bytes, but got %d", sealbox.KeySize, len(pk))
+		}
+	}
+
+	return &Client{
+		hc:         &http.Client{Timeout: opts.Timeout},
+		url:        u.String(),
+		hmacSecret: []byte(opts.HMACSecret),
+		publicKey:  pk,
+		retries:    opts.Retries,
+		retryWait:  opts.RetryWait,
+	}, nil
+}
+
+// init registers the plugin.
+func init() {
+	pkg := reflect.TypeOf(Client{}).PkgPath()
+	plugin.Register(pkg, new(builder))
+}
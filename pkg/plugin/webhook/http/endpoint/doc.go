@@ -0,0 +1,4 @@
+// Package endpoint provides a plugin that implements the rotate.Storage
+// interface by posting rotated secrets as signed JSON to an HTTPS endpoint
+// operated by the consumer of those secrets.
+package endpoint
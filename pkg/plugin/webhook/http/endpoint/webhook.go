@@ -0,0 +1,311 @@
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin/internal/sealbox"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+const (
+	// TimestampHeader is the request header holding the time the request was
+	// signed as seconds since the Unix epoch.
+	TimestampHeader = "X-Garotate-Timestamp"
+
+	// SignatureHeader is the request header holding the signature. The value
+	// is "sha256=" followed by the hex encoded HMAC-SHA256 of the timestamp, a
+	// period, and the request body, keyed with the configured secret.
+	SignatureHeader = "X-Garotate-Signature"
+
+	// ActionSave is the action of a request to store new values for the keys.
+	ActionSave = "save"
+
+	// ActionStatus is the action of a request asking when the keys were last
+	// stored.
+	ActionStatus = "status"
+)
+
+// Request is the JSON body posted to the endpoint.
+type Request struct {
+	// Action is either ActionSave or ActionStatus.
+	Action string `json:"action"`
+
+	// Name is the storage name configured for the secret.
+	Name string `json:"name"`
+
+	// Encrypted is true when each of the values in Keys is sealed to the
+	// configured public key with a NaCl anonymous sealed box and encoded as
+	// Base64.
+	Encrypted bool `json:"encrypted,omitempty"`
+
+	// Keys maps the remapped key names to the new secret values. It is only
+	// sent with ActionSave.
+	Keys map[string]string `json:"keys,omitempty"`
+}
+
+// Response is the JSON body the endpoint must respond with to a status
+// request. It may also be sent in response to a save request.
+type Response struct {
+	// Saved maps each key the endpoint holds for the named storage to the time
+	// it was last saved. A key that is missing is treated as never saved.
+	Saved map[string]time.Time `json:"saved"`
+}
+
+// savedTimes is the key used for caching the saved times of a storage.
+type savedTimes struct{}
+
+// Client implements the rotate.Storage interface for posting keys following
+// rotation to a webhook endpoint.
+//
+// Each request is a JSON encoded Request. The endpoint must respond with a 2xx
+// status code on success. Requests that fail with a network error, a 429, or a
+// 5xx status code are retried with exponential backoff, or after the wait
+// given by a Retry-After header.
+type Client struct {
+	hc         *http.Client
+	url        string
+	hmacSecret []byte
+	publicKey  []byte
+	retries    int
+	retryWait  time.Duration
+}
+
+// setCachedSavedTimes is a helper that stores the saved times of the storage.
+func setCachedSavedTimes(c secret.Cache, saved map[string]time.Time) {
+	c.CacheSet(savedTimes{}, saved)
+}
+
+// getCachedSavedTimes is a helper that retrieves the saved times of the
+// storage.
+func getCachedSavedTimes(c secret.Cache) (map[string]time.Time, bool) {
+	t, ok := c.CacheGet(savedTimes{})
+	if saved, typeOk := t.(map[string]time.Time); ok && typeOk {
+		return saved, true
+	}
+	return nil, false
+}
+
+// Name returns "signed webhook"
+func (c *Client) Name() string {
+	return "signed webhook"
+}
+
+// sign returns the signature header value for the given timestamp and body.
+func (c *Client) sign(ts string, body []byte) string {
+	m := hmac.New(sha256.New, c.hmacSecret)
+	m.Write([]byte(ts))
+	m.Write([]byte("."))
+	m.Write(body)
+	return "sha256=" + hex.EncodeToString(m.Sum(nil))
+}
+
+// post sends the request to the endpoint, retrying as needed, and returns the
+// decoded response.
+func (c *Client) post(ctx context.Context, req *Request) (*Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	wait := c.retryWait
+	for attempt := 0; ; attempt++ {
+		res, retryAfter, retry, err := c.try(ctx, body)
+		if err == nil {
+			return res, nil
+		}
+
+		if !retry || attempt >= c.retries {
+			return nil, err
+		}
+
+		pause := wait
+		if retryAfter > 0 {
+			pause = retryAfter
+		}
+
+		logger.Warnw(
+			"webhook request failed; retrying",
+			"client", c.Name(),
+			"storage", req.Name,
+			"action", req.Action,
+			"attempt", attempt+1,
+			"wait", pause,
+			"error", err,
+		)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(pause):
+		}
+		wait *= 2
+	}
+}
+
+// retryAfter returns the wait requested by the Retry-After header of the
+// response, which may be given in seconds or as an HTTP date, or zero if there
+// is none.
+func retryAfter(res *http.Response) time.Duration {
+	v := res.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+
+	if at, err := http.ParseTime(v); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait
+		}
+	}
+
+	return 0
+}
+
+// try makes a single attempt at sending the request. It returns the response
+// or an error, the wait requested by the endpoint before retrying, if any, and
+// a flag indicating whether the error is worth retrying.
+//
+// Once the endpoint responds with a 2xx status code, the request is never
+// retried, since the endpoint may already have acted on it.
+func (c *Client) try(ctx context.Context, body []byte) (*Response, time.Duration, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add(TimestampHeader, ts)
+	req.Header.Add(SignatureHeader, c.sign(ts, body))
+
+	res, err := c.hc.Do(req)
+	if err != nil {
+		return nil, 0, true, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 {
+		return nil, retryAfter(res), true, fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, 0, false, fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("failed to read webhook response: %w", err)
+	}
+
+	var out Response
+	if len(bytes.TrimSpace(resBody)) > 0 {
+		err = json.Unmarshal(resBody, &out)
+		if err != nil {
+			return nil, 0, false, fmt.Errorf("failed to decode webhook response: %w", err)
+		}
+	}
+
+	return &out, 0, false, nil
+}
+
+// LastSaved asks the endpoint when the given key was last saved. It returns
+// secret.ErrKeyNotFound if the endpoint does not report the key.
+func (c *Client) LastSaved(
+	ctx context.Context,
+	store secret.Storage,
+	key string,
+) (time.Time, error) {
+	saved, ok := getCachedSavedTimes(store)
+	if !ok {
+		res, err := c.post(ctx, &Request{
+			Action: ActionStatus,
+			Name:   store.Name(),
+		})
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to retrieve webhook status for storage %q: %w", store.Name(), err)
+		}
+
+		saved = res.Saved
+		if saved == nil {
+			saved = map[string]time.Time{}
+		}
+		setCachedSavedTimes(store, saved)
+	}
+
+	if upd, found := saved[key]; found {
+		return upd, nil
+	}
+
+	return time.Time{}, secret.ErrKeyNotFound
+}
+
+// SaveKeys posts all of the secrets to the endpoint in a single request,
+// sealing each value first if a public key is configured.
+func (c *Client) SaveKeys(
+	ctx context.Context,
+	store secret.Storage,
+	ss secret.Map,
+) error {
+	keys := make(map[string]string, len(ss))
+	for key, sec := range ss {
+		if c.publicKey != nil {
+			sealed, err := sealbox.Seal(c.publicKey, sec)
+			if err != nil {
+				return fmt.Errorf("failed to seal secret %q for storage %q: %w", key, store.Name(), err)
+			}
+			sec = sealed
+		}
+		keys[key] = sec
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Infow(
+		"posting secrets to webhook",
+		"client", c.Name(),
+		"storage", store.Name(),
+		"encrypted", c.publicKey != nil,
+	)
+
+	res, err := c.post(ctx, &Request{
+		Action:    ActionSave,
+		Name:      store.Name(),
+		Encrypted: c.publicKey != nil,
+		Keys:      keys,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to post secrets to webhook for storage %q: %w", store.Name(), err)
+	}
+
+	saved, isCached := getCachedSavedTimes(store)
+	if !isCached {
+		saved = make(map[string]time.Time, len(ss))
+	}
+
+	now := time.Now()
+	for key := range ss {
+		if upd, ok := res.Saved[key]; ok {
+			saved[key] = upd
+		} else {
+			saved[key] = now
+		}
+	}
+
+	setCachedSavedTimes(store, saved)
+
+	return nil
+}
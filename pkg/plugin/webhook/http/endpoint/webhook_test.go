@@ -0,0 +1,241 @@
+package endpoint
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/nacl/box"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+const testSecret = "shared-secret"
+
+// fakeEndpoint is a webhook endpoint that checks signatures and keeps the
+// requests it receives. Each request is answered by the next of the handlers,
+// or by the last one once they run out.
+type fakeEndpoint struct {
+	t *testing.T
+
+	mu       sync.Mutex
+	requests []Request
+	handlers []http.HandlerFunc
+}
+
+func (f *fakeEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	require.NoError(f.t, err)
+
+	ts := r.Header.Get(TimestampHeader)
+	m := hmac.New(sha256.New, []byte(testSecret))
+	m.Write([]byte(ts + "."))
+	m.Write(body)
+	assert.Equal(f.t, "sha256="+hex.EncodeToString(m.Sum(nil)), r.Header.Get(SignatureHeader), "signed")
+	assert.Equal(f.t, "application/json", r.Header.Get("Content-Type"))
+
+	var req Request
+	require.NoError(f.t, json.Unmarshal(body, &req))
+
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	h := f.handlers[0]
+	if len(f.handlers) > 1 {
+		f.handlers = f.handlers[1:]
+	}
+	f.mu.Unlock()
+
+	h(w, r)
+}
+
+// status responds with the given status code.
+func status(code int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+	}
+}
+
+// respond responds with the given JSON body.
+func respond(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}
+}
+
+// newEndpoint starts a fake endpoint and builds a client for it.
+func newEndpoint(t *testing.T, opts map[string]any, handlers ...http.HandlerFunc) (*fakeEndpoint, *Client) {
+	f := &fakeEndpoint{t: t, handlers: handlers}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	o := map[string]any{
+		"url":         srv.URL,
+		"hmac_secret": testSecret,
+		"insecure":    true,
+		"retry_wait":  "1ms",
+	}
+	for k, v := range opts {
+		o[k] = v
+	}
+
+	inst, err := plugin.Build(context.Background(), &config.Plugin{
+		Name:    "webhook",
+		Package: "github.com/zostay/garotate/pkg/plugin/webhook/http/endpoint",
+		Options: o,
+	})
+	require.NoError(t, err)
+	return f, inst.(*Client)
+}
+
+func TestStatusAndSave(t *testing.T) {
+	ctx := context.Background()
+	saved := time.Date(2022, time.May, 1, 0, 0, 0, 0, time.UTC)
+	f, c := newEndpoint(t, nil,
+		respond(`{"saved":{"API_KEY":"2022-05-01T00:00:00Z"}}`),
+		respond(``),
+	)
+
+	store := &config.StorageMap{StorageName: "deploy"}
+	last, err := c.LastSaved(ctx, store, "API_KEY")
+	require.NoError(t, err)
+	assert.Equal(t, saved, last)
+
+	_, err = c.LastSaved(ctx, store, "OTHER_KEY")
+	assert.ErrorIs(t, err, secret.ErrKeyNotFound, "key not reported")
+	assert.Len(t, f.requests, 1, "status is cached")
+
+	require.NoError(t, c.SaveKeys(ctx, store, secret.Map{"API_KEY": "hunter2"}))
+	require.Len(t, f.requests, 2)
+	assert.Equal(t, Request{Action: ActionStatus, Name: "deploy"}, f.requests[0])
+	assert.Equal(t, Request{Action: ActionSave, Name: "deploy", Keys: map[string]string{"API_KEY": "hunter2"}}, f.requests[1])
+
+	last, err = c.LastSaved(ctx, store, "API_KEY")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), last, time.Minute, "empty response means saved now")
+}
+
+func TestSaveSealed(t *testing.T) {
+	pub, priv, err := box.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	saved := time.Date(2022, time.May, 2, 0, 0, 0, 0, time.UTC)
+	f, c := newEndpoint(t,
+		map[string]any{"public_key": base64.StdEncoding.EncodeToString(pub[:])},
+		respond(`{"saved":{"API_KEY":"2022-05-02T00:00:00Z"}}`),
+	)
+
+	store := &config.StorageMap{StorageName: "deploy"}
+	require.NoError(t, c.SaveKeys(context.Background(), store, secret.Map{"API_KEY": "hunter2"}))
+
+	require.Len(t, f.requests, 1)
+	assert.True(t, f.requests[0].Encrypted, "marked encrypted")
+	enc, err := base64.StdEncoding.DecodeString(f.requests[0].Keys["API_KEY"])
+	require.NoError(t, err)
+	plain, ok := box.OpenAnonymous(nil, enc, pub, priv)
+	require.True(t, ok, "sealed to the public key")
+	assert.Equal(t, "hunter2", string(plain))
+
+	last, err := c.LastSaved(context.Background(), store, "API_KEY")
+	require.NoError(t, err)
+	assert.Equal(t, saved, last, "saved time reported by the endpoint is used")
+	assert.Len(t, f.requests, 1, "saved times are cached")
+}
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+	store := func() *config.StorageMap { return &config.StorageMap{StorageName: "deploy"} }
+
+	f, c := newEndpoint(t, nil,
+		status(http.StatusBadGateway),
+		status(http.StatusTooManyRequests),
+		respond(`{}`),
+	)
+	require.NoError(t, c.SaveKeys(ctx, store(), secret.Map{"API_KEY": "hunter2"}))
+	assert.Len(t, f.requests, 3, "429 and 5xx are retried")
+
+	f, c = newEndpoint(t, map[string]any{"retries": 2}, status(http.StatusServiceUnavailable))
+	err := c.SaveKeys(ctx, store(), secret.Map{"API_KEY": "hunter2"})
+	assert.ErrorContains(t, err, "503")
+	assert.Len(t, f.requests, 3, "gives up after the retries")
+
+	f, c = newEndpoint(t, nil, status(http.StatusForbidden))
+	err = c.SaveKeys(ctx, store(), secret.Map{"API_KEY": "hunter2"})
+	assert.ErrorContains(t, err, "403")
+	assert.Len(t, f.requests, 1, "other errors are not retried")
+
+	f, c = newEndpoint(t, nil, respond(`not json`))
+	_, err = c.LastSaved(ctx, store(), "API_KEY")
+	assert.ErrorContains(t, err, "failed to decode webhook response")
+	assert.Len(t, f.requests, 1, "bad responses are not retried")
+
+	f, c = newEndpoint(t, nil, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		_, _ = w.Write([]byte(`{"saved":`))
+	})
+	err = c.SaveKeys(ctx, store(), secret.Map{"API_KEY": "hunter2"})
+	assert.ErrorContains(t, err, "failed to read webhook response")
+	assert.Len(t, f.requests, 1, "a save accepted by the endpoint is not sent again")
+
+	f, c = newEndpoint(t, map[string]any{"retry_wait": "1h"},
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		},
+		respond(`{}`),
+	)
+	start := time.Now()
+	require.NoError(t, c.SaveKeys(ctx, store(), secret.Map{"API_KEY": "hunter2"}))
+	assert.Len(t, f.requests, 2)
+	assert.Less(t, time.Since(start), time.Minute, "Retry-After used instead of retry_wait")
+	assert.GreaterOrEqual(t, time.Since(start), time.Second, "Retry-After is honored")
+}
+
+func TestRetryAfter(t *testing.T) {
+	res := &http.Response{Header: http.Header{}}
+	assert.Zero(t, retryAfter(res), "no header")
+
+	res.Header.Set("Retry-After", "120")
+	assert.Equal(t, 2*time.Minute, retryAfter(res), "seconds")
+
+	res.Header.Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	assert.InDelta(t, time.Hour, retryAfter(res), float64(2*time.Second), "HTTP date")
+
+	res.Header.Set("Retry-After", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+	assert.Zero(t, retryAfter(res), "past date")
+
+	res.Header.Set("Retry-After", "soon")
+	assert.Zero(t, retryAfter(res), "nonsense")
+}
+
+func TestBuild(t *testing.T) {
+	t.Setenv("WEBHOOK_HMAC_SECRET", "")
+
+	build := func(opts map[string]any) error {
+		_, err := (&builder{}).Build(context.Background(), &config.Plugin{Options: opts})
+		return err
+	}
+
+	assert.NoError(t, build(map[string]any{"url": "https://example.com/hook", "hmac_secret": "x"}))
+	assert.Error(t, build(map[string]any{"url": "https://example.com/hook"}), "no secret")
+	assert.Error(t, build(map[string]any{"url": "http://example.com/hook", "hmac_secret": "x"}), "plain http")
+	assert.Error(t, build(map[string]any{"hmac_secret": "x"}), "no url")
+	assert.Error(t, build(map[string]any{
+		"url":         "https://example.com/hook",
+		"hmac_secret": "x",
+		"public_key":  base64.StdEncoding.EncodeToString([]byte("short")),
+	}), "short public key")
+}
@@ -0,0 +1,409 @@
+package rotate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/errors"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+// DefaultSuffixes are the suffixes appended to the secret name to name the
+// accounts used by the alternating strategy when none are configured.
+var DefaultSuffixes = []string{"_a", "_b"}
+
+// AccountOptions are the per-secret options read by the alternating strategy.
+type AccountOptions struct {
+	// Accounts names the accounts to alternate between for this secret,
+	// replacing the names built from the suffixes.
+	Accounts []string `mapstructure:"accounts"`
+}
+
+// Alternating implements the Client interface for systems that can only hold
+// one secret per account. Each secret is backed by two or more accounts. The
+// active account is the one most recently rotated before the secret was saved
+// to all of its storages, so its values are the ones published. Every other
+// account is idle. Rotation rotates the least recently rotated idle account,
+// which then becomes the active account once stored, without disrupting any
+// consumer of the previously active account.
+//
+// Alternating also implements the disable.Client interface. If the wrapped
+// Client implements Revoker, disablement revokes the idle accounts once the
+// active account has been active long enough.
+type Alternating struct {
+	plugins  *plugin.Manager
+	client   Client
+	suffixes []string
+	userKey  string
+}
+
+// accountList is the key used for caching the accounts of a secret.
+type accountList struct{}
+
+// account is the secret.Info passed to the wrapped Client to describe an
+// account. Per-secret options are passed through from the secret.
+type account struct {
+	name  string
+	opts  secret.Options
+	cache map[any]any
+}
+
+// NewAlternating constructs an alternating strategy that rotates accounts
+// using the given Client. The plugin manager is used to find the storages of
+// each secret to learn which account was last published. The accounts of each
+// secret are named by appending each of the suffixes to the secret name, unless
+// the secret sets the accounts option. If userKey is not empty, the name of the
+// account rotated is returned under that key.
+func NewAlternating(
+	client Client,
+	plugins *plugin.Manager,
+	suffixes []string,
+	userKey string,
+) *Alternating {
+	if len(suffixes) == 0 {
+		suffixes = DefaultSuffixes
+	}
+
+	return &Alternating{
+		plugins:  plugins,
+		client:   client,
+		suffixes: suffixes,
+		userKey:  userKey,
+	}
+}
+
+// Name returns the name of the wrapped client prefixed with "alternating".
+func (a *Alternating) Name() string {
+	return "alternating " + a.client.Name()
+}
+
+// Keys returns the keys of the wrapped client and the user key, if one is
+// configured.
+func (a *Alternating) Keys() secret.Map {
+	keys := make(secret.Map, len(a.client.Keys())+1)
+	for k, v := range a.client.Keys() {
+		keys[k] = v
+	}
+	if a.userKey != "" {
+		keys[a.userKey] = ""
+	}
+	return keys
+}
+
+// accounts returns the accounts backing the secret.
+func (a *Alternating) accounts(sec secret.Info) ([]*account, error) {
+	if cached, ok := sec.CacheGet(accountList{}); ok {
+		if accts, typeOk := cached.([]*account); typeOk {
+			return accts, nil
+		}
+	}
+
+	var names []string
+	opts, hasOpts := sec.(secret.Options)
+	if hasOpts {
+		var ao AccountOptions
+		err := opts.DecodeOptions(&ao)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read accounts of secret %q: %w", sec.Name(), err)
+		}
+		names = ao.Accounts
+	}
+
+	if names == nil {
+		names = make([]string, len(a.suffixes))
+		for i, suffix := range a.suffixes {
+			names[i] = sec.Name() + suffix
+		}
+	}
+
+	if len(names) < 2 {
+		return nil, fmt.Errorf("secret %q must have at least two accounts to alternate between", sec.Name())
+	}
+
+	accts := make([]*account, len(names))
+	for i, name := range names {
+		accts[i] = &account{
+			name:  name,
+			opts:  opts,
+			cache: make(map[any]any),
+		}
+	}
+
+	sec.CacheSet(accountList{}, accts)
+
+	return accts, nil
+}
+
+// lastRotated returns the accounts of the secret ordered from the most to the
+// least recently rotated and the time each was rotated.
+func (a *Alternating) lastRotated(
+	ctx context.Context,
+	sec secret.Info,
+) ([]*account, []time.Time, error) {
+	accts, err := a.accounts(sec)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rotated := make(map[*account]time.Time, len(accts))
+	for _, acct := range accts {
+		t, err := a.client.LastRotated(ctx, acct)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to check last rotation of account %q: %w", acct.name, err)
+		}
+		rotated[acct] = t
+	}
+
+	// ties keep the configured order
+	ordered := make([]*account, len(accts))
+	copy(ordered, accts)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return rotated[ordered[i]].After(rotated[ordered[j]])
+	})
+
+	times := make([]time.Time, len(ordered))
+	for i, acct := range ordered {
+		times[i] = rotated[acct]
+	}
+
+	return ordered, times, nil
+}
+
+// active returns the index of the active account in the accounts ordered by
+// lastRotated(). The active account is the most recently rotated account that
+// was rotated before the secret was last saved to all of its storages. If the
+// secret has no storages or has never been stored, the most recently rotated
+// account is active.
+func (a *Alternating) active(
+	ctx context.Context,
+	sec secret.Info,
+	times []time.Time,
+) (int, error) {
+	s, isSecret := sec.(*config.Secret)
+	if a.plugins == nil || !isSecret || len(s.Storages) == 0 {
+		return 0, nil
+	}
+
+	stored, err := LastStored(ctx, a.plugins, a.Keys(), s)
+	if err != nil {
+		return 0, err
+	} else if stored.IsZero() {
+		return 0, nil
+	}
+
+	for i, rotated := range times {
+		if !rotated.After(stored) {
+			return i, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// idle returns the accounts ordered by lastRotated() with the active account
+// removed and the time the active account was rotated.
+func (a *Alternating) idle(
+	ctx context.Context,
+	sec secret.Info,
+) ([]*account, time.Time, error) {
+	accts, times, err := a.lastRotated(ctx, sec)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	active, err := a.active(ctx, sec, times)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	idle := make([]*account, 0, len(accts)-1)
+	idle = append(idle, accts[:active]...)
+	idle = append(idle, accts[active+1:]...)
+
+	return idle, times[active], nil
+}
+
+// LastRotated returns the time the most recently rotated account was rotated.
+// This is usually the active account, but may be an idle account if the values
+// of its last rotation were never stored.
+func (a *Alternating) LastRotated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	_, times, err := a.lastRotated(ctx, sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return times[0], nil
+}
+
+// RotateSecret rotates the least recently rotated idle account, restoring it
+// if it has been revoked, and returns its values. If the account cannot be
+// restored, the new values are returned along with the error.
+func (a *Alternating) RotateSecret(
+	ctx context.Context,
+	sec secret.Info,
+) (secret.Map, error) {
+	idle, _, err := a.idle(ctx, sec)
+	if err != nil {
+		return secret.Map{}, err
+	}
+
+	acct := idle[len(idle)-1]
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	logger.Infow(
+		"rotating idle account",
+		"secret", sec.Name(),
+		"client", a.Name(),
+		"account", acct.name,
+	)
+
+	keys, err := a.client.RotateSecret(ctx, acct)
+	if err != nil {
+		return secret.Map{}, fmt.Errorf("failed to rotate account %q: %w", acct.name, err)
+	}
+
+	if a.userKey != "" {
+		keys[a.userKey] = acct.name
+	}
+
+	if r, ok := a.client.(Revoker); ok {
+		revoked, err := r.Revoked(ctx, acct)
+		if err != nil {
+			return keys, fmt.Errorf("failed to check revocation of account %q: %w", acct.name, err)
+		}
+
+		if revoked {
+			err = r.RestoreSecret(ctx, acct)
+			if err != nil {
+				return keys, fmt.Errorf("failed to restore account %q: %w", acct.name, err)
+			}
+		}
+	}
+
+	return keys, nil
+}
+
+// revoker returns the wrapped client as a Revoker or an error if it cannot
+// revoke accounts.
+func (a *Alternating) revoker() (Revoker, error) {
+	if r, ok := a.client.(Revoker); ok {
+		return r, nil
+	}
+	return nil, fmt.Errorf("client %q does not support revoking accounts", a.client.Name())
+}
+
+// LastUpdated returns the time the active account was rotated, which is when
+// the other accounts became idle. If every idle account has been revoked
+// already, there is nothing to disable.
+func (a *Alternating) LastUpdated(
+	ctx context.Context,
+	sec secret.Info,
+) (time.Time, error) {
+	r, err := a.revoker()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	idle, activeRotated, err := a.idle(ctx, sec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for _, acct := range idle {
+		revoked, err := r.Revoked(ctx, acct)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to check revocation of account %q: %w", acct.name, err)
+		}
+
+		if !revoked {
+			return activeRotated, nil
+		}
+	}
+
+	return time.Time{}, disable.ErrNothingToDisable
+}
+
+// DisableSecret revokes every idle account.
+func (a *Alternating) DisableSecret(
+	ctx context.Context,
+	sec secret.Info,
+) error {
+	r, err := a.revoker()
+	if err != nil {
+		return err
+	}
+
+	idle, _, err := a.idle(ctx, sec)
+	if err != nil {
+		return err
+	}
+
+	logger := config.LoggerFrom(ctx).Sugar()
+	var errs []error
+	for _, acct := range idle {
+		revoked, err := r.Revoked(ctx, acct)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to check revocation of account %q: %w", acct.name, err))
+			continue
+		}
+
+		if revoked {
+			continue
+		}
+
+		logger.Infow(
+			"revoking idle account",
+			"secret", sec.Name(),
+			"client", a.Name(),
+			"account", acct.name,
+		)
+
+		err = r.RevokeSecret(ctx, acct)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to revoke account %q: %w", acct.name, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.NewAggregate(errs)
+	}
+
+	return nil
+}
+
+// Name returns the name of the account.
+func (a *account) Name() string {
+	return a.name
+}
+
+// CacheSet stores a value in the account cache.
+func (a *account) CacheSet(k, v any) {
+	a.cache[k] = v
+}
+
+// CacheGet retrieves a value from the account cache.
+func (a *account) CacheGet(k any) (any, bool) {
+	v, ok := a.cache[k]
+	return v, ok
+}
+
+// CacheClear deletes a value from the account cache.
+func (a *account) CacheClear(k any) {
+	delete(a.cache, k)
+}
+
+// DecodeOptions decodes the options of the secret the account belongs to.
+func (a *account) DecodeOptions(out any) error {
+	if a.opts == nil {
+		return nil
+	}
+	return a.opts.DecodeOptions(out)
+}
@@ -0,0 +1,200 @@
+package rotate
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/disable"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+type testAccountClient struct {
+	keys    secret.Map
+	rotated map[string]time.Time
+	revoked map[string]bool
+
+	failRestore bool
+}
+
+func newTestAccountClient() *testAccountClient {
+	return &testAccountClient{
+		keys:    secret.Map{"password": ""},
+		rotated: map[string]time.Time{},
+		revoked: map[string]bool{},
+	}
+}
+
+func (c *testAccountClient) Name() string {
+	return "test accounts"
+}
+
+func (c *testAccountClient) Keys() secret.Map {
+	return c.keys
+}
+
+func (c *testAccountClient) LastRotated(ctx context.Context, s secret.Info) (time.Time, error) {
+	return c.rotated[s.Name()], nil
+}
+
+func (c *testAccountClient) RotateSecret(ctx context.Context, s secret.Info) (secret.Map, error) {
+	c.rotated[s.Name()] = time.Now()
+	return secret.Map{"password": "new " + s.Name()}, nil
+}
+
+type testRevokerClient struct {
+	*testAccountClient
+}
+
+func (c testRevokerClient) Revoked(ctx context.Context, s secret.Info) (bool, error) {
+	return c.revoked[s.Name()], nil
+}
+
+func (c testRevokerClient) RevokeSecret(ctx context.Context, s secret.Info) error {
+	if c.revoked[s.Name()] {
+		return fmt.Errorf("account %q already revoked", s.Name())
+	}
+	c.revoked[s.Name()] = true
+	return nil
+}
+
+func (c testRevokerClient) RestoreSecret(ctx context.Context, s secret.Info) error {
+	if c.failRestore {
+		return fmt.Errorf("account %q cannot be restored", s.Name())
+	}
+	c.revoked[s.Name()] = false
+	return nil
+}
+
+func TestHappyAlternating(t *testing.T) {
+	c := newTestAccountClient()
+	c.rotated["app_a"] = recentButPastDate
+	c.rotated["app_b"] = pastDate
+	c.revoked["app_b"] = true
+
+	a := NewAlternating(testRevokerClient{c}, nil, nil, "user")
+	sec := &config.Secret{SecretName: "app"}
+	ctx := context.Background()
+
+	assert.Equal(t, secret.Map{"password": "", "user": ""}, a.Keys(), "user key added")
+	assert.Equal(t, secret.Map{"password": ""}, c.Keys(), "keys of the wrapped client untouched")
+
+	last, err := a.LastRotated(ctx, sec)
+	require.NoError(t, err, "no error getting last rotation")
+	assert.Equal(t, recentButPastDate, last, "last rotation is the active account")
+
+	_, err = a.LastUpdated(ctx, sec)
+	assert.ErrorIs(t, err, disable.ErrNothingToDisable, "nothing to disable while idle is revoked")
+
+	keys, err := a.RotateSecret(ctx, sec)
+	require.NoError(t, err, "no error rotating")
+	assert.Equal(t, secret.Map{"password": "new app_b", "user": "app_b"}, keys, "idle account rotated")
+	assert.False(t, c.revoked["app_b"], "rotated account restored")
+
+	upd, err := a.LastUpdated(ctx, sec)
+	require.NoError(t, err, "no error getting last update")
+	assert.Equal(t, c.rotated["app_b"], upd, "previous account idle since rotation")
+
+	require.NoError(t, a.DisableSecret(ctx, sec), "no error disabling")
+	assert.True(t, c.revoked["app_a"], "idle account revoked")
+	assert.False(t, c.revoked["app_b"], "active account not revoked")
+
+	require.NoError(t, a.DisableSecret(ctx, sec), "disabling again does nothing")
+}
+
+func TestHappyAlternatingUnstored(t *testing.T) {
+	pluginMgr := plugin.NewManager(
+		config.PluginList{
+			"test": config.Plugin{
+				Name:    "test",
+				Package: "testStorage",
+			},
+		},
+	)
+
+	ctx := context.Background()
+	store, err := pluginMgr.Instance(ctx, "test")
+	require.NoError(t, err, "got no errors retrieving storage instance")
+
+	tstore := store.(*testStorage)
+	tstore.storage = map[string]map[string]string{
+		"App": {"password": "old app_a"},
+	}
+	tstore.lastSaved = recentButPastDate
+
+	c := newTestAccountClient()
+	c.rotated["app_a"] = pastDate
+	c.rotated["app_b"] = time.Now()
+
+	a := NewAlternating(testRevokerClient{c}, pluginMgr, nil, "")
+	sec := &config.Secret{
+		SecretName: "app",
+		Storages: []config.StorageMap{
+			{StorageClient: "test", StorageName: "App"},
+		},
+	}
+
+	last, err := a.LastRotated(ctx, sec)
+	require.NoError(t, err, "no error getting last rotation")
+	assert.Equal(t, c.rotated["app_b"], last, "last rotation includes unstored rotation")
+
+	require.NoError(t, a.DisableSecret(ctx, sec), "no error disabling")
+	assert.False(t, c.revoked["app_a"], "stored account is active")
+	assert.True(t, c.revoked["app_b"], "unstored account is idle")
+
+	keys, err := a.RotateSecret(ctx, sec)
+	require.NoError(t, err, "no error rotating")
+	assert.Equal(t, secret.Map{"password": "new app_b"}, keys, "unstored account rotated again")
+	assert.False(t, c.revoked["app_b"], "rotated account restored")
+}
+
+func TestHappyAlternatingAccountsOption(t *testing.T) {
+	c := newTestAccountClient()
+	c.rotated["app_blue@%"] = pastDate
+
+	a := NewAlternating(c, nil, nil, "")
+	sec := &config.Secret{
+		SecretName: "app",
+		Options: map[string]any{
+			"accounts": []any{"app_blue@%", "app_green@%"},
+		},
+	}
+
+	keys, err := a.RotateSecret(context.Background(), sec)
+	require.NoError(t, err, "no error rotating")
+	assert.Equal(t, secret.Map{"password": "new app_green@%"}, keys, "configured account rotated")
+}
+
+func TestSadAlternatingRestore(t *testing.T) {
+	c := newTestAccountClient()
+	c.rotated["app_a"] = recentButPastDate
+	c.rotated["app_b"] = pastDate
+	c.revoked["app_b"] = true
+	c.failRestore = true
+
+	a := NewAlternating(testRevokerClient{c}, nil, nil, "user")
+	keys, err := a.RotateSecret(context.Background(), &config.Secret{SecretName: "app"})
+	assert.ErrorContains(t, err, "failed to restore", "restore failure reported")
+	assert.Equal(t, secret.Map{"password": "new app_b", "user": "app_b"}, keys, "new values returned anyway")
+}
+
+func TestSadAlternating(t *testing.T) {
+	a := NewAlternating(newTestAccountClient(), nil, nil, "")
+
+	_, err := a.LastUpdated(context.Background(), &config.Secret{SecretName: "app"})
+	assert.ErrorContains(t, err, "does not support revoking", "disablement requires a revoker")
+
+	_, err = a.RotateSecret(context.Background(), &config.Secret{
+		SecretName: "app",
+		Options: map[string]any{
+			"accounts": []any{"app"},
+		},
+	})
+	assert.ErrorContains(t, err, "at least two accounts", "one account is not enough")
+}
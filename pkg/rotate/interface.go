@@ -75,10 +75,52 @@ type Client interface {
 	// configuration. It is recommended that the names be the most natural names
 	// for the accounting system being rotated.
 	//
-	// If rotation cannot be performed, an error must be returned.
+	// If rotation cannot be performed, an error must be returned. If the
+	// secret was rotated, but a later step failed, the new values should be
+	// returned along with the error, so they are not lost.
 	//
 	// The context provides a logger via context tools in the config package.
 	//
 	// The secret.Info describes the secret to be rotated.
 	RotateSecret(context.Context, secret.Info) (secret.Map, error)
 }
+
+// Revoker may be implemented by a Client to permit the alternating strategy to
+// revoke the idle account of a secret during disablement.
+type Revoker interface {
+	// Revoked must return true if the account has been revoked.
+	//
+	// The context provides a logger via context tools in the config package.
+	//
+	// The secret.Info describes the account to check.
+	Revoked(context.Context, secret.Info) (bool, error)
+
+	// RevokeSecret must prevent the account from being used until it is
+	// restored. It must not change the date returned by LastRotated().
+	//
+	// The context provides a logger via context tools in the config package.
+	//
+	// The secret.Info describes the account to revoke.
+	RevokeSecret(context.Context, secret.Info) error
+
+	// RestoreSecret must undo the revocation of the account. It is called
+	// after the account has been rotated.
+	//
+	// The context provides a logger via context tools in the config package.
+	//
+	// The secret.Info describes the account to restore.
+	RestoreSecret(context.Context, secret.Info) error
+}
+
+// Renewer may be implemented by a Client whose secrets expire, such as
+// certificates, to decide when rotation is needed by itself. When a Client
+// implements it, the rotate_after of the policy is not used.
+type Renewer interface {
+	// NeedsRenewal must return true if the secret should be rotated now, which
+	// is usually when it is close to expiring or missing.
+	//
+	// The context provides a logger via context tools in the config package.
+	//
+	// The secret.Info describes the secret to check.
+	NeedsRenewal(context.Context, secret.Info) (bool, error)
+}
@@ -52,7 +52,8 @@ func New(
 // 2. LastRotate() value of the project is newer than any LastSaved() value of
 //    any secret key associated with this project in any Storage.
 //
-// Otherwise, this returns false.
+// If the client implements Renewer, its NeedsRenewal() takes the place of the
+// first condition. Otherwise, this returns false.
 func (m *Manager) needsRotation(
 	ctx context.Context,
 	s *config.Secret,
@@ -97,7 +98,28 @@ func (m *Manager) needsRotation(
 		return false
 	}
 
-	if time.Since(rotated) > m.rotateAfter {
+	if r, ok := m.client.(Renewer); ok {
+		renew, err := r.NeedsRenewal(ctx, s)
+		if err != nil {
+			logger.Errorw(
+				"got error while checking need for renewal; skipping",
+				"secret", s.Name(),
+				"client", m.client.Name(),
+				"error", err,
+			)
+			return false
+		}
+
+		if renew {
+			logger.Debugw(
+				"secret is due for renewal and requires rotation",
+				"secret", s.Name(),
+				"client", m.client.Name(),
+				"rotation_ts", rotated,
+			)
+			return true
+		}
+	} else if time.Since(rotated) > m.rotateAfter {
 		logger.Debugw(
 			"secret is out of date and requires rotation",
 			"secret", s.Name(),
@@ -168,7 +190,17 @@ func (m *Manager) findStorage(
 	ctx context.Context,
 	name string,
 ) (Storage, error) {
-	inst, err := m.plugins.Instance(ctx, name)
+	return findStorage(ctx, m.plugins, name)
+}
+
+// findStorage returns a storage client instance for the given name built by the
+// given plugin manager or an error.
+func findStorage(
+	ctx context.Context,
+	plugins *plugin.Manager,
+	name string,
+) (Storage, error) {
+	inst, err := plugins.Instance(ctx, name)
 	if err != nil {
 		return nil, err
 	}
@@ -201,7 +233,9 @@ func remapKeys(
 // rotateSecret rotates a single secret. It checks if the secret needs to be
 // rotated by calling needsRotation(). If not, it does nothing further. If so,
 // it tells the rotation client to rotate the secret. It then it saves the newly
-// minted secret in all configured storage locations.
+// minted secret in all configured storage locations. If the client returns new
+// values along with an error, the values are saved before the error is
+// reported.
 func (m *Manager) rotateSecret(
 	ctx context.Context,
 	s *config.Secret,
@@ -216,10 +250,19 @@ func (m *Manager) rotateSecret(
 		newSecrets secret.Map
 		err        error
 	)
+	errlist := make([]error, 0)
 	if !m.dryRun {
 		newSecrets, err = m.client.RotateSecret(ctx, s)
-		if err != nil {
+		if err != nil && len(newSecrets) == 0 {
 			return fmt.Errorf("RotateSecret(): %w", err)
+		} else if err != nil {
+			errlist = append(errlist, fmt.Errorf("RotateSecret(): %w", err))
+			logger.Errorw(
+				"secret rotated with errors; storing the new values anyway",
+				"secret", s.Name(),
+				"client", m.client.Name(),
+				"error", err,
+			)
 		}
 	} else {
 		logger.Infow(
@@ -229,7 +272,6 @@ func (m *Manager) rotateSecret(
 		)
 	}
 
-	errlist := make([]error, 0)
 	for i := range s.Storages {
 		sm := &s.Storages[i]
 		store, err := m.findStorage(ctx, sm.StorageClient)
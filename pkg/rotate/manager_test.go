@@ -42,6 +42,7 @@ type testClient struct {
 	lastRotated      time.Time
 	failLastRotated  int
 	failRotateSecret int
+	partialRotate    bool
 }
 
 func NewTestClient() *testClient {
@@ -87,6 +88,11 @@ func (c *testClient) RotateSecret(
 	})
 	if c.failRotateSecret == 0 {
 		return nil, fmt.Errorf("rotate bad stuff")
+	} else if c.partialRotate {
+		return secret.Map{
+			"alpha": "one",
+			"beta":  "two",
+		}, fmt.Errorf("rotated with bad stuff")
 	} else {
 		c.failRotateSecret--
 		return secret.Map{
@@ -207,6 +213,51 @@ func TestSadManagerFailToRotate(t *testing.T) {
 	assert.Equal(t, callSecrets, c.lastCallSecrets, "all four calls made even when sad")
 }
 
+type testRenewingClient struct {
+	*testClient
+	needsRenewal map[string]bool
+}
+
+func (c *testRenewingClient) NeedsRenewal(ctx context.Context, s secret.Info) (bool, error) {
+	c.lastCallSecrets = append(c.lastCallSecrets, testClientSecret{
+		call: "NeedsRenewal",
+		sec:  s,
+	})
+	return c.needsRenewal[s.Name()], nil
+}
+
+func TestManagerRenewal(t *testing.T) {
+	pluginMgr := plugin.NewManager(
+		config.PluginList{},
+	)
+	c := &testRenewingClient{
+		testClient:   NewTestClient(),
+		needsRenewal: map[string]bool{"Thomas": true},
+	}
+	m := New(c, 0, false,
+		pluginMgr,
+		[]config.Secret{
+			{SecretName: "Thomas"},
+			{SecretName: "Matthew"},
+		},
+	)
+
+	ctx := context.Background()
+	err := m.RotateSecrets(ctx)
+
+	assert.NoError(t, err, "no error on rotate secrets renewal run")
+
+	callSecrets := []testClientSecret{
+		{call: "LastRotated", sec: &config.Secret{SecretName: "Thomas"}},
+		{call: "NeedsRenewal", sec: &config.Secret{SecretName: "Thomas"}},
+		{call: "RotateSecret", sec: &config.Secret{SecretName: "Thomas"}},
+		{call: "LastRotated", sec: &config.Secret{SecretName: "Matthew"}},
+		{call: "NeedsRenewal", sec: &config.Secret{SecretName: "Matthew"}},
+	}
+
+	assert.Equal(t, callSecrets, c.lastCallSecrets, "only the secret due for renewal is rotated despite rotate_after")
+}
+
 type testStorage struct {
 	storage       map[string]map[string]string
 	lastSaved     time.Time
@@ -391,6 +442,50 @@ func TestHappyRotationStorage(t *testing.T) {
 	}
 }
 
+func TestSadRotationPartial(t *testing.T) {
+	pluginMgr := plugin.NewManager(
+		config.PluginList{
+			"test": config.Plugin{
+				Name:    "test",
+				Package: "testStorage",
+			},
+		},
+	)
+
+	c := NewTestClient()
+	c.partialRotate = true
+	m := New(c, 0, false,
+		pluginMgr,
+		[]config.Secret{
+			{
+				SecretName: "Jude",
+				Storages: []config.StorageMap{
+					{StorageClient: "test", StorageName: "Jude"},
+				},
+			},
+		},
+	)
+
+	ctx := context.Background()
+	store, err := pluginMgr.Instance(ctx, "test")
+	require.NoError(t, err, "got no errors retrieving storage instance")
+
+	tstore := store.(*testStorage)
+	tstore.storage = nil
+	tstore.lastSaved = pastDate
+
+	err = m.RotateSecrets(ctx)
+	assert.ErrorContains(t, err, "rotated with bad stuff", "rotation error is reported")
+
+	assert.Equal(t,
+		map[string]map[string]string{
+			"Jude": {"alpha": "one", "beta": "two"},
+		},
+		tstore.storage,
+		"values returned with the error are stored",
+	)
+}
+
 func TestHappyRotationStorageDryRun(t *testing.T) {
 	pluginMgr := plugin.NewManager(
 		config.PluginList{
@@ -709,3 +804,160 @@ func TestSadRotationStorageBrokenSaveKeys(t *testing.T) {
 
 	assert.Error(t, err, "expected error occurred")
 }
+
+func TestLastStored(t *testing.T) {
+	pluginMgr := plugin.NewManager(
+		config.PluginList{
+			"test": config.Plugin{
+				Name:    "test",
+				Package: "testStorage",
+			},
+		},
+	)
+
+	ctx := context.Background()
+	store, err := pluginMgr.Instance(ctx, "test")
+	require.NoError(t, err, "got no errors retrieving storage instance")
+
+	tstore, ok := store.(*testStorage)
+	require.True(t, ok, "type coercion to testStorage works")
+
+	sec := &config.Secret{
+		SecretName: "Thomas",
+		Storages: []config.StorageMap{
+			{
+				StorageClient: "test",
+				StorageName:   "Thomas",
+				Keys: config.KeyMap{
+					"alpha": "omega",
+				},
+			},
+		},
+	}
+
+	keys := secret.Map{"alpha": ""}
+
+	last, err := LastStored(ctx, pluginMgr, keys, sec)
+	assert.NoError(t, err, "no error when nothing is stored")
+	assert.True(t, last.IsZero(), "zero time when nothing is stored")
+
+	tstore.storage = map[string]map[string]string{
+		"Thomas": {"omega": "hunter2"},
+	}
+	tstore.lastSaved = pastDate
+
+	last, err = LastStored(ctx, pluginMgr, keys, sec)
+	assert.NoError(t, err, "no error when the remapped key is stored")
+	assert.Equal(t, pastDate, last, "got the last saved time")
+
+	pluginMgr = plugin.NewManager(
+		config.PluginList{
+			"test": config.Plugin{
+				Name:    "test",
+				Package: "testStorage",
+			},
+			"other": config.Plugin{
+				Name:    "other",
+				Package: "testStorage",
+			},
+		},
+	)
+	for name, saved := range map[string]time.Time{"test": recentButPastDate, "other": pastDate} {
+		store, err := pluginMgr.Instance(ctx, name)
+		require.NoError(t, err, "got no errors retrieving storage instance")
+		tstore = store.(*testStorage)
+		tstore.storage = map[string]map[string]string{
+			"Thomas": {"omega": "hunter2"},
+		}
+		tstore.lastSaved = saved
+	}
+	sec.Storages = append(sec.Storages, config.StorageMap{
+		StorageClient: "other",
+		StorageName:   "Thomas",
+		Keys:          config.KeyMap{"alpha": "omega"},
+	})
+
+	last, err = LastStored(ctx, pluginMgr, keys, sec)
+	assert.NoError(t, err, "no error with several storages")
+	assert.Equal(t, pastDate, last, "got the earliest saved time")
+
+	tstore.failLastSaved = 0
+	_, err = LastStored(ctx, pluginMgr, keys, sec)
+	assert.ErrorContains(t, err, "last saved bad stuff", "storage errors are returned")
+
+	sec.Storages[0].StorageClient = "missing"
+	_, err = LastStored(ctx, pluginMgr, keys, sec)
+	assert.ErrorContains(t, err, "no plugin configuration found", "missing storages are errors")
+}
+
+// testStoredSecret is a secret that knows what LastStored and StorageNames
+// would otherwise find.
+type testStoredSecret struct {
+	config.Secret
+
+	last  time.Time
+	known bool
+	names []string
+}
+
+func (s *testStoredSecret) LastStored() (time.Time, bool) {
+	return s.last, s.known
+}
+
+func (s *testStoredSecret) StorageNames() []string {
+	return s.names
+}
+
+func TestStoredSecret(t *testing.T) {
+	pluginMgr := plugin.NewManager(
+		config.PluginList{
+			"test": config.Plugin{
+				Name:    "test",
+				Package: "testStorage",
+			},
+			"other": config.Plugin{
+				Name:    "other",
+				Package: "testStorage",
+			},
+		},
+	)
+
+	ctx := context.Background()
+	store, err := pluginMgr.Instance(ctx, "test")
+	require.NoError(t, err, "got no errors retrieving storage instance")
+
+	sec := &config.Secret{
+		SecretName: "Thomas",
+		Storages: []config.StorageMap{
+			{StorageClient: "test", StorageName: "project"},
+			{StorageClient: "other", StorageName: "elsewhere"},
+			{StorageClient: "test", StorageName: "archive"},
+		},
+	}
+
+	names, err := StorageNames(ctx, pluginMgr, store, sec)
+	assert.NoError(t, err, "no error finding storage names")
+	assert.Equal(t, []string{"project", "archive"}, names, "only storages using the client")
+
+	ss := &testStoredSecret{
+		Secret: config.Secret{SecretName: "Thomas"},
+		last:   pastDate,
+		known:  true,
+		names:  []string{"project"},
+	}
+
+	last, err := LastStored(ctx, nil, secret.Map{"alpha": ""}, ss)
+	assert.NoError(t, err, "no error when the secret knows")
+	assert.Equal(t, pastDate, last, "got the time the secret knows")
+
+	names, err = StorageNames(ctx, nil, store, ss)
+	assert.NoError(t, err, "no error when the secret knows")
+	assert.Equal(t, []string{"project"}, names, "got the names the secret knows")
+
+	ss.known = false
+	_, err = LastStored(ctx, nil, secret.Map{"alpha": ""}, ss)
+	assert.ErrorContains(t, err, "are not known", "unknown time without a configured secret")
+
+	_, err = StorageNames(ctx, pluginMgr, store, &config.StorageMap{StorageName: "Thomas"})
+	assert.ErrorContains(t, err, "are not known", "unknown storages without a configured secret")
+}
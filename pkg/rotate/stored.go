@@ -0,0 +1,122 @@
+package rotate
+
+import (
+	"context"
+	goerr "errors"
+	"fmt"
+	"time"
+
+	"github.com/zostay/garotate/pkg/config"
+	"github.com/zostay/garotate/pkg/plugin"
+	"github.com/zostay/garotate/pkg/secret"
+)
+
+// StoredSecret may be implemented by a secret.Info that already knows what
+// LastStored and StorageNames would otherwise find using the configuration of
+// other plugins. The secrets given to plugins served by a plugin process
+// implement it, since that configuration is not available to the process.
+type StoredSecret interface {
+	secret.Info
+
+	// LastStored returns the time LastStored should return for the secret and
+	// true, or false if that time is not known.
+	LastStored() (time.Time, bool)
+
+	// StorageNames returns the names of the storages of the secret that use
+	// the plugin the secret was given to.
+	StorageNames() []string
+}
+
+// LastStored returns the earliest time any of the given keys of the secret was
+// last saved to any of the storages configured for it. The keys are remapped
+// for each storage just as they are when saving.
+//
+// This is intended for rotation clients that have no record of rotation of
+// their own, such as those that generate secrets themselves. A rotation
+// happens before any of its values are saved, so the earliest time is the
+// closest to the rotation. Using it also ensures that no saved key appears
+// older than the rotation, which would cause another rotation. Keys that have
+// never been saved are skipped. If no key has been saved anywhere, the zero
+// time is returned. Any other error checking a storage is returned.
+//
+// If the secret is a StoredSecret that knows the time, that time is returned
+// without checking the storages. Otherwise, the secret must be a
+// *config.Secret so its storages are known.
+func LastStored(
+	ctx context.Context,
+	plugins *plugin.Manager,
+	keys secret.Map,
+	sec secret.Info,
+) (time.Time, error) {
+	if ss, ok := sec.(StoredSecret); ok {
+		if last, known := ss.LastStored(); known {
+			return last, nil
+		}
+	}
+
+	s, ok := sec.(*config.Secret)
+	if !ok {
+		return time.Time{}, fmt.Errorf("the storages of secret %q are not known, so the last rotation cannot be determined", sec.Name())
+	}
+
+	var last time.Time
+	for i := range s.Storages {
+		sm := &s.Storages[i]
+		store, err := findStorage(ctx, plugins, sm.StorageClient)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("error while loading storage plugin %q: %w", sm.StorageClient, err)
+		}
+
+		for storeKey := range remapKeys(sm.Keys, keys) {
+			saved, err := store.LastSaved(ctx, sm, storeKey)
+			if goerr.Is(err, secret.ErrKeyNotFound) {
+				continue
+			} else if err != nil {
+				return time.Time{}, fmt.Errorf("error while checking storage %q for key %q: %w", sm.StorageClient, storeKey, err)
+			}
+
+			if last.IsZero() || saved.Before(last) {
+				last = saved
+			}
+		}
+	}
+
+	return last, nil
+}
+
+// StorageNames returns the names of the storages of the secret that use the
+// given storage client. This is intended for storage clients that also disable
+// the secrets they store, so they can find them again.
+//
+// If the secret is a StoredSecret, the names it reports are returned.
+// Otherwise, the secret must be a *config.Secret so its storages are known.
+func StorageNames(
+	ctx context.Context,
+	plugins *plugin.Manager,
+	store plugin.Instance,
+	sec secret.Info,
+) ([]string, error) {
+	if ss, ok := sec.(StoredSecret); ok {
+		return ss.StorageNames(), nil
+	}
+
+	s, ok := sec.(*config.Secret)
+	if !ok {
+		return nil, fmt.Errorf("the storages of secret %q are not known", sec.Name())
+	}
+
+	var names []string
+	for i := range s.Storages {
+		sm := &s.Storages[i]
+		inst, err := plugins.Instance(ctx, sm.StorageClient)
+		if err != nil {
+			return nil, fmt.Errorf("error while loading storage plugin %q: %w", sm.StorageClient, err)
+		}
+
+		if inst == store {
+			names = append(names, sm.Name())
+		}
+	}
+
+	return names, nil
+}
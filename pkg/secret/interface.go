@@ -56,6 +56,15 @@ type Info interface {
 	Name() string
 }
 
+// Options may be implemented by an Info or Storage that carries options for
+// the plugin client configured alongside the secret. Plugin clients that
+// support per-secret settings should check for this interface.
+type Options interface {
+	// DecodeOptions decodes the options into the given value, which should be
+	// a pointer to a struct whose fields are tagged with mapstructure tags.
+	DecodeOptions(out any) error
+}
+
 // Map is the object used to contain a map of keys to secret values. Upon
 // rotation, the rotation plugin will return one of these objects containing new
 // the new secret values. It is recommended that the keys in such a case be the